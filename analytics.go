@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+// nodeTypeReport is the reachability of one kind of tagged node, selected
+// the way BI tools do it: readPreference=secondary with the Atlas
+// nodeType tag.
+type nodeTypeReport struct {
+	NodeType  string  `json:"node_type"`
+	Expected  int     `json:"expected,omitempty"`
+	Host      string  `json:"host,omitempty"`
+	Reachable bool    `json:"reachable"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// analyticsReport is the outcome of the last analytics node check.
+type analyticsReport struct {
+	CheckedAt time.Time        `json:"checked_at"`
+	Passives  []string         `json:"passives,omitempty"`
+	Nodes     []nodeTypeReport `json:"nodes,omitempty"`
+}
+
+var analyticsNodeTypes = []string{"ANALYTICS", "READ_ONLY"}
+
+var (
+	analyticsCheck bool
+
+	analyticsMu       sync.Mutex
+	lastAnalytics     *analyticsReport
+	analyticsExpected map[string]int
+	analyticsFetched  time.Time
+	analyticsSeen     = map[string]bool{}
+	analyticsDown     string
+)
+
+// loadAnalyticsConfig reads ANALYTICS_NODE_CHECK=true.
+func loadAnalyticsConfig() {
+	analyticsCheck = os.Getenv("ANALYTICS_NODE_CHECK") == "true"
+}
+
+// checkAnalyticsNodes verifies that analytics and read-only nodes can be
+// selected through the endpoint. Which node types exist comes from the
+// Atlas cluster description when the API is configured; otherwise a node
+// type counts as present once it has been reached. Only the BI workloads
+// notice when these nodes are cut off, so it is alerted on separately.
+func checkAnalyticsNodes(uri string) {
+	if !analyticsCheck {
+		return
+	}
+
+	expected := expectedNodeTypes()
+	report := &analyticsReport{CheckedAt: time.Now()}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "analytics"))
+	if err != nil {
+		logThrottled("Analytics node check failed to connect", err)
+		return
+	}
+	defer closeClient(client, "analytics")
+
+	var hello bson.M
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello); err == nil {
+		if passives, ok := hello["passives"].(primitive.A); ok {
+			for _, host := range passives {
+				report.Passives = append(report.Passives, fmt.Sprint(host))
+			}
+		}
+	}
+
+	var down []string
+	for _, nodeType := range analyticsNodeTypes {
+		node := probeNodeType(ctx, client, nodeType)
+		node.Expected = expected[nodeType]
+
+		analyticsMu.Lock()
+		if node.Reachable {
+			analyticsSeen[nodeType] = true
+		}
+		present := node.Expected > 0 || (expected == nil && analyticsSeen[nodeType])
+		analyticsMu.Unlock()
+
+		if !present {
+			continue
+		}
+		report.Nodes = append(report.Nodes, node)
+		if node.Reachable {
+			log.Printf("%s node %s reachable in %.1fms\n", nodeType, node.Host, node.LatencyMS)
+		} else {
+			down = append(down, tr("analytics.node_unreachable", "{kind} nodes are not reachable with readPreference=secondary&readPreferenceTags=nodeType:{type}: {error}",
+				"kind", strings.ToLower(nodeType), "type", nodeType, "error", node.Error))
+		}
+	}
+
+	problems := strings.Join(down, "\n")
+	analyticsMu.Lock()
+	lastAnalytics = report
+	previous := analyticsDown
+	analyticsDown = problems
+	analyticsMu.Unlock()
+
+	if problems == previous {
+		return
+	}
+	if problems != "" {
+		log.Printf("Tagged nodes unreachable:\n%s\n", problems)
+		sendAlert("MongoDB Analytics Nodes Unreachable",
+			tr("analytics.unreachable", "Reads routed to analytics or read-only nodes fail while the rest of the cluster is reachable:\n{problems}\n\nPassive members seen: {passives}\n{endpoints}",
+				"problems", problems, "passives", strings.Join(report.Passives, ", "), "endpoints", vpcEndpointProblemSummary()))
+	} else {
+		sendRecovery("MongoDB Analytics Nodes Reachable Again", tr("analytics.reachable", "Analytics and read-only nodes can be reached through the endpoint again."))
+	}
+}
+
+// probeNodeType runs isMaster on a secondary tagged with nodeType; server
+// selection fails when no such node is reachable.
+func probeNodeType(ctx context.Context, client *mongo.Client, nodeType string) nodeTypeReport {
+	node := nodeTypeReport{NodeType: nodeType}
+	rp := readpref.Secondary(readpref.WithTagSets(tag.NewTagSetsFromMaps([]map[string]string{{"nodeType": nodeType}})...))
+	probeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	var hello bson.M
+	err := client.Database("admin").RunCommand(probeCtx, bson.D{{Key: "isMaster", Value: 1}}, options.RunCmd().SetReadPreference(rp)).Decode(&hello)
+	node.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	node.Reachable = true
+	node.Host, _ = hello["me"].(string)
+	return node
+}
+
+// expectedNodeTypes returns the number of analytics and read-only nodes
+// from the Atlas cluster description, refreshed hourly, or nil when the
+// Atlas API is not available.
+func expectedNodeTypes() map[string]int {
+	if !atlasConfigured() || atlasClusterName == "" {
+		return nil
+	}
+	analyticsMu.Lock()
+	defer analyticsMu.Unlock()
+	if analyticsExpected != nil && time.Since(analyticsFetched) < time.Hour {
+		return analyticsExpected
+	}
+
+	var cluster struct {
+		ReplicationSpecs []struct {
+			RegionConfigs []struct {
+				AnalyticsSpecs struct {
+					NodeCount int `json:"nodeCount"`
+				} `json:"analyticsSpecs"`
+				ReadOnlySpecs struct {
+					NodeCount int `json:"nodeCount"`
+				} `json:"readOnlySpecs"`
+			} `json:"regionConfigs"`
+		} `json:"replicationSpecs"`
+	}
+	if err := atlasRequest("GET", "/groups/"+atlasProjectID+"/clusters/"+atlasClusterName, nil, &cluster); err != nil {
+		logThrottled("Failed to fetch analytics node counts from Atlas", err)
+		return analyticsExpected
+	}
+	counts := map[string]int{}
+	for _, spec := range cluster.ReplicationSpecs {
+		for _, region := range spec.RegionConfigs {
+			counts["ANALYTICS"] += region.AnalyticsSpecs.NodeCount
+			counts["READ_ONLY"] += region.ReadOnlySpecs.NodeCount
+		}
+	}
+	analyticsExpected = counts
+	analyticsFetched = time.Now()
+	return counts
+}
+
+func analyticsSnapshot() *analyticsReport {
+	analyticsMu.Lock()
+	defer analyticsMu.Unlock()
+	return lastAnalytics
+}
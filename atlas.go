@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Atlas Admin API access, configured the same way as the Python tooling in
+// this repository (ATLAS_BASE_URL, ATLAS_PROJECT_ID, ATLAS_CLUSTER_NAME,
+// ATLAS_PUBLIC_KEY, ATLAS_PRIVATE_KEY).
+
+const atlasAccept = "application/vnd.atlas.2024-08-05+json"
+
+var (
+	atlasBaseURL     string
+	atlasProjectID   string
+	atlasClusterName string
+	atlasPublicKey   string
+	atlasPrivateKey  string
+
+	atlasHTTPClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+func loadAtlasConfig() {
+	atlasBaseURL = strings.TrimSuffix(os.Getenv("ATLAS_BASE_URL"), "/")
+	if atlasBaseURL == "" {
+		atlasBaseURL = "https://cloud.mongodb.com"
+	}
+	atlasProjectID = os.Getenv("ATLAS_PROJECT_ID")
+	atlasClusterName = os.Getenv("ATLAS_CLUSTER_NAME")
+	atlasPublicKey = os.Getenv("ATLAS_PUBLIC_KEY")
+	atlasPrivateKey = os.Getenv("ATLAS_PRIVATE_KEY")
+}
+
+func atlasConfigured() bool {
+	return atlasProjectID != "" && atlasPublicKey != "" && atlasPrivateKey != ""
+}
+
+// atlasRequest calls the Atlas Admin API v2 with HTTP digest authentication.
+// path is relative to /api/atlas/v2, e.g. "/groups/{id}/clusters".
+func atlasRequest(method, path string, body, out interface{}) error {
+	if !atlasConfigured() {
+		return errors.New("Atlas API is not configured (ATLAS_PROJECT_ID, ATLAS_PUBLIC_KEY, ATLAS_PRIVATE_KEY)")
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	url := atlasBaseURL + "/api/atlas/v2" + path
+
+	resp, err := doAtlasRequest(method, url, payload, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authz, err := digestAuthorization(challenge, method, url)
+		if err != nil {
+			return err
+		}
+		if resp, err = doAtlasRequest(method, url, payload, authz); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return &atlasError{method: method, path: path, status: resp.Status, StatusCode: resp.StatusCode, body: bytes.TrimSpace(data)}
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// atlasError is a non-2xx Atlas API response.
+type atlasError struct {
+	method, path, status string
+	StatusCode           int
+	body                 []byte
+}
+
+func (e *atlasError) Error() string {
+	return fmt.Sprintf("Atlas API %s %s returned %s: %s", e.method, e.path, e.status, e.body)
+}
+
+func doAtlasRequest(method, url string, payload []byte, authz string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", atlasAccept)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authz != "" {
+		req.Header.Set("Authorization", authz)
+	}
+	return atlasHTTPClient.Do(req)
+}
+
+// digestAuthorization answers an RFC 2617 Digest challenge (MD5, qop=auth),
+// which is what Atlas programmatic API keys use.
+func digestAuthorization(challenge, method, rawURL string) (string, error) {
+	if !strings.HasPrefix(challenge, "Digest ") {
+		return "", fmt.Errorf("unsupported Atlas auth challenge %q", challenge)
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Digest "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[key] = strings.Trim(value, `"`)
+		}
+	}
+
+	uri := rawURL
+	if i := strings.Index(rawURL, "://"); i >= 0 {
+		if j := strings.Index(rawURL[i+3:], "/"); j >= 0 {
+			uri = rawURL[i+3+j:]
+		}
+	}
+
+	cnonceBytes := make([]byte, 8)
+	rand.Read(cnonceBytes)
+	cnonce := hex.EncodeToString(cnonceBytes)
+	nc := "00000001"
+
+	md5hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := md5hex(atlasPublicKey + ":" + params["realm"] + ":" + atlasPrivateKey)
+	ha2 := md5hex(method + ":" + uri)
+	response := md5hex(strings.Join([]string{ha1, params["nonce"], nc, cnonce, "auth", ha2}, ":"))
+
+	authz := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=auth, nc=%s, cnonce="%s", response="%s", algorithm=MD5`,
+		atlasPublicKey, params["realm"], params["nonce"], uri, nc, cnonce, response)
+	if opaque := params["opaque"]; opaque != "" {
+		authz += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return authz, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// atlasEndpointService is a private endpoint service as the Atlas Admin API
+// reports it, with the state of each interface endpoint connected to it.
+type atlasEndpointService struct {
+	ID           string               `json:"id"`
+	Region       string               `json:"region"`
+	ServiceName  string               `json:"service_name,omitempty"`
+	Status       string               `json:"status"`
+	ErrorMessage string               `json:"error_message,omitempty"`
+	Endpoints    []atlasEndpointState `json:"endpoints,omitempty"`
+}
+
+type atlasEndpointState struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// atlasEndpointReport is the outcome of the last cross-check.
+type atlasEndpointReport struct {
+	Time     time.Time              `json:"time"`
+	Services []atlasEndpointService `json:"services"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+var (
+	atlasEndpointCheck    bool
+	atlasEndpointProvider string
+
+	atlasEndpointMu         sync.Mutex
+	lastAtlasEndpointReport *atlasEndpointReport
+)
+
+// loadAtlasEndpointConfig reads ATLAS_PRIVATE_ENDPOINT_CHECK=true, which
+// asks the Atlas Admin API for the private endpoint service and endpoint
+// status when a connection fails, and ATLAS_PRIVATE_ENDPOINT_PROVIDER
+// (default AWS).
+func loadAtlasEndpointConfig() {
+	atlasEndpointCheck = os.Getenv("ATLAS_PRIVATE_ENDPOINT_CHECK") == "true" && atlasConfigured()
+	atlasEndpointProvider = orString(os.Getenv("ATLAS_PRIVATE_ENDPOINT_PROVIDER"), "AWS")
+}
+
+// fetchAtlasEndpoints lists the project's endpoint services for the
+// provider and the connection status Atlas sees for each of their
+// interface endpoints.
+func fetchAtlasEndpoints() *atlasEndpointReport {
+	report := &atlasEndpointReport{Time: time.Now()}
+	base := "/groups/" + atlasProjectID + "/privateEndpoint/" + url.PathEscape(atlasEndpointProvider) + "/endpointService"
+
+	var services []struct {
+		ID                  string   `json:"id"`
+		RegionName          string   `json:"regionName"`
+		EndpointServiceName string   `json:"endpointServiceName"`
+		Status              string   `json:"status"`
+		ErrorMessage        string   `json:"errorMessage"`
+		InterfaceEndpoints  []string `json:"interfaceEndpoints"`
+	}
+	if err := atlasRequest("GET", base, nil, &services); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	for _, s := range services {
+		service := atlasEndpointService{ID: s.ID, Region: s.RegionName, ServiceName: s.EndpointServiceName, Status: s.Status, ErrorMessage: s.ErrorMessage}
+		for _, id := range s.InterfaceEndpoints {
+			var endpoint struct {
+				ConnectionStatus string `json:"connectionStatus"`
+				ErrorMessage     string `json:"errorMessage"`
+			}
+			state := atlasEndpointState{ID: id}
+			if err := atlasRequest("GET", base+"/"+url.PathEscape(s.ID)+"/endpoint/"+url.PathEscape(id), nil, &endpoint); err != nil {
+				state.Error = err.Error()
+			} else {
+				state.Status, state.ErrorMessage = endpoint.ConnectionStatus, endpoint.ErrorMessage
+			}
+			service.Endpoints = append(service.Endpoints, state)
+		}
+		report.Services = append(report.Services, service)
+	}
+	return report
+}
+
+// atlasEndpointSummary is the "Atlas says" section of connection failure
+// alerts, so driver errors can be read against the state Atlas has for
+// its side of the private endpoint.
+func atlasEndpointSummary() string {
+	if !atlasEndpointCheck {
+		return ""
+	}
+	report := fetchAtlasEndpoints()
+	atlasEndpointMu.Lock()
+	lastAtlasEndpointReport = report
+	atlasEndpointMu.Unlock()
+
+	if report.Error != "" {
+		return tr("atlas.endpoint.unavailable", "Atlas private endpoint status unavailable: {error}\n", "error", report.Error)
+	}
+	if len(report.Services) == 0 {
+		return tr("atlas.endpoint.none", "Atlas says: no {provider} private endpoint service in the project.\n", "provider", atlasEndpointProvider)
+	}
+	var b strings.Builder
+	for _, s := range report.Services {
+		b.WriteString(tr("atlas.endpoint.service", "Atlas says: endpoint service {id} ({region}) is {status}", "id", s.ID, "region", s.Region, "status", s.Status))
+		if s.ErrorMessage != "" {
+			b.WriteString(": " + s.ErrorMessage)
+		}
+		b.WriteString("\n")
+		for _, e := range s.Endpoints {
+			switch {
+			case e.Error != "":
+				b.WriteString(tr("atlas.endpoint.endpoint_unavailable", "  {id}: status unavailable: {error}\n", "id", e.ID, "error", e.Error))
+			case e.ErrorMessage != "":
+				fmt.Fprintf(&b, "  %s: %s: %s\n", e.ID, e.Status, e.ErrorMessage)
+			default:
+				fmt.Fprintf(&b, "  %s: %s\n", e.ID, e.Status)
+			}
+		}
+	}
+	return b.String()
+}
+
+func atlasEndpointSnapshot() *atlasEndpointReport {
+	atlasEndpointMu.Lock()
+	defer atlasEndpointMu.Unlock()
+	return lastAtlasEndpointReport
+}
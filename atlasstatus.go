@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// atlasStatusIncident is an unresolved incident on the MongoDB status page
+// that mentions one of our regions.
+type atlasStatusIncident struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Impact    string    `json:"impact"`
+	Link      string    `json:"link"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var atlasStatusHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+var (
+	atlasStatusURL      string
+	atlasStatusRegions  []string
+	atlasStatusSuppress bool
+	atlasStatusInterval time.Duration
+
+	atlasStatusMu        sync.Mutex
+	atlasStatusIncidents []atlasStatusIncident
+	atlasStatusFetched   time.Time
+)
+
+// atlasStatusPollsKept is how many poll intervals the last incident list
+// is trusted for while polls fail, so that suppression cannot outlive the
+// upstream incident by more than that.
+const atlasStatusPollsKept = 3
+
+// loadAtlasStatusConfig reads ATLAS_STATUS_REGIONS, the terms that identify
+// our region in status page incidents (e.g. "us-east-1,US_EAST_1,N. Virginia"),
+// ATLAS_STATUS_SUPPRESS, ATLAS_STATUS_POLL_MINUTES, and ATLAS_STATUS_URL for
+// the Statuspage unresolved incidents feed.
+func loadAtlasStatusConfig() {
+	atlasStatusRegions = splitList(os.Getenv("ATLAS_STATUS_REGIONS"))
+	atlasStatusURL = orString(os.Getenv("ATLAS_STATUS_URL"), "https://status.mongodb.com/api/v2/incidents/unresolved.json")
+	atlasStatusSuppress = os.Getenv("ATLAS_STATUS_SUPPRESS") == "true"
+	atlasStatusInterval = time.Duration(getEnvInt("ATLAS_STATUS_POLL_MINUTES", 5)) * time.Minute
+}
+
+func startAtlasStatusPoller() {
+	if len(atlasStatusRegions) == 0 {
+		return
+	}
+	go func() {
+		lastErr := ""
+		for {
+			incidents, err := fetchAtlasStatus()
+			if err != nil {
+				if err.Error() != lastErr {
+					log.Printf("Failed to poll the Atlas status feed: %v\n", err)
+				}
+				lastErr = err.Error()
+			} else {
+				lastErr = ""
+				atlasStatusMu.Lock()
+				atlasStatusIncidents = incidents
+				atlasStatusFetched = time.Now()
+				atlasStatusMu.Unlock()
+			}
+			time.Sleep(atlasStatusInterval)
+		}
+	}()
+}
+
+// fetchAtlasStatus returns the unresolved status page incidents whose name,
+// affected components, or latest update mention one of our regions.
+func fetchAtlasStatus() ([]atlasStatusIncident, error) {
+	resp, err := atlasStatusHTTPClient.Get(atlasStatusURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("status feed returned %s: %s", resp.Status, msg)
+	}
+
+	var feed struct {
+		Incidents []struct {
+			ID         string    `json:"id"`
+			Name       string    `json:"name"`
+			Status     string    `json:"status"`
+			Impact     string    `json:"impact"`
+			Shortlink  string    `json:"shortlink"`
+			CreatedAt  time.Time `json:"created_at"`
+			Components []struct {
+				Name string `json:"name"`
+			} `json:"components"`
+			Updates []struct {
+				Body string `json:"body"`
+			} `json:"incident_updates"`
+		} `json:"incidents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, err
+	}
+
+	var matching []atlasStatusIncident
+	for _, inc := range feed.Incidents {
+		text := inc.Name
+		for _, c := range inc.Components {
+			text += "\n" + c.Name
+		}
+		if len(inc.Updates) > 0 {
+			text += "\n" + inc.Updates[0].Body
+		}
+		if !mentionsRegion(text) {
+			continue
+		}
+		matching = append(matching, atlasStatusIncident{
+			ID:        inc.ID,
+			Name:      inc.Name,
+			Status:    inc.Status,
+			Impact:    inc.Impact,
+			Link:      inc.Shortlink,
+			CreatedAt: inc.CreatedAt,
+		})
+	}
+	return matching, nil
+}
+
+func mentionsRegion(text string) bool {
+	text = strings.ToLower(text)
+	for _, region := range atlasStatusRegions {
+		if strings.Contains(text, strings.ToLower(region)) {
+			return true
+		}
+	}
+	return false
+}
+
+// currentAtlasStatus returns the incidents of the last successful poll, or
+// none once it is older than atlasStatusPollsKept intervals.
+func currentAtlasStatus() []atlasStatusIncident {
+	atlasStatusMu.Lock()
+	defer atlasStatusMu.Unlock()
+	if time.Since(atlasStatusFetched) > atlasStatusPollsKept*atlasStatusInterval {
+		return nil
+	}
+	return atlasStatusIncidents
+}
+
+// confirmedAtlasIncident returns an upstream incident that MongoDB has
+// confirmed (past "investigating"), which is when failure alerts are
+// suppressed. Recoveries still go out, so that the incidents they close,
+// ours and PagerDuty's, do not stay open.
+func confirmedAtlasIncident() (atlasStatusIncident, bool) {
+	for _, inc := range currentAtlasStatus() {
+		if inc.Status == "identified" || inc.Status == "monitoring" {
+			return inc, true
+		}
+	}
+	return atlasStatusIncident{}, false
+}
+
+// atlasStatusSummary is the line added to failure alerts.
+func atlasStatusSummary() string {
+	incidents := currentAtlasStatus()
+	if len(incidents) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(tr("atlas.status.incidents", "MongoDB status page incidents affecting our region:\n"))
+	for _, inc := range incidents {
+		b.WriteString(tr("atlas.status.incident", "  {name} ({status}, impact {impact}) {link}\n",
+			"name", inc.Name, "status", inc.Status, "impact", inc.Impact, "link", inc.Link))
+	}
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// apiRole is what an API token may do. Each role includes the ones below it.
+type apiRole int
+
+const (
+	roleReadOnly apiRole = iota + 1
+	roleSilence
+	roleAdmin
+)
+
+var apiRoleNames = map[string]apiRole{
+	"read-only": roleReadOnly,
+	"silence":   roleSilence,
+	"admin":     roleAdmin,
+}
+
+// apiToken is one bearer token accepted by the HTTP API. Tenant tokens are
+// further restricted to the tenant's targets.
+type apiToken struct {
+	name   string
+	token  string
+	role   apiRole
+	tenant *tenant
+}
+
+var apiTokens []apiToken
+
+// loadAPITokens reads API_TOKEN_<NAME>="<role>:<token>" with role one of
+// read-only, silence, or admin, plus one token per tenant with the role in
+// TENANT_<NAME>_ROLE (default silence). Without any tokens the API stays
+// open, as before.
+func loadAPITokens() {
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		name, ok := strings.CutPrefix(key, "API_TOKEN_")
+		if !ok || name == "" {
+			continue
+		}
+		roleName, token, ok := strings.Cut(value, ":")
+		role, known := apiRoleNames[roleName]
+		if !ok || !known || token == "" {
+			log.Fatalf("Invalid %s, expected <read-only|silence|admin>:<token>", key)
+		}
+		apiTokens = append(apiTokens, apiToken{name: strings.ToLower(name), token: token, role: role})
+	}
+
+	for _, t := range tenants {
+		key := "TENANT_" + strings.ToUpper(strings.ReplaceAll(t.name, "-", "_")) + "_ROLE"
+		role := roleSilence
+		if roleName := os.Getenv(key); roleName != "" {
+			var known bool
+			if role, known = apiRoleNames[roleName]; !known {
+				log.Fatalf("Invalid %s %q", key, roleName)
+			}
+		}
+		apiTokens = append(apiTokens, apiToken{name: "tenant " + t.name, token: t.token, role: role, tenant: t})
+	}
+}
+
+// authorize checks the bearer token against the role an endpoint needs and
+// returns the tenant the caller is restricted to, if any. It writes the
+// error response and returns false when the request is refused.
+func authorize(w http.ResponseWriter, r *http.Request, need apiRole) (*tenant, bool) {
+	if len(apiTokens) == 0 {
+		return nil, true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for _, t := range apiTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.token)) != 1 {
+			continue
+		}
+		if t.role < need {
+			log.Printf("API token %s refused for %s %s\n", t.name, r.Method, r.URL.Path)
+			writeError(w, http.StatusForbidden, "token is not allowed to do this")
+			return nil, false
+		}
+		return t.tenant, true
+	}
+	writeError(w, http.StatusUnauthorized, "a valid API token is required")
+	return nil, false
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// awsAccount is an AWS account whose VPC endpoints the monitor describes.
+// Accounts other than the monitor's own are reached by assuming roleARN
+// with the monitor's credentials.
+type awsAccount struct {
+	name       string
+	roleARN    string
+	externalID string
+	region     string
+	endpoints  []string
+	zones      []string
+
+	mu      sync.Mutex
+	creds   awsCredentials
+	expires time.Time
+}
+
+var awsAccounts []*awsAccount
+
+// loadAWSAccounts reads AWS_ACCOUNTS="network,prod" and for each account
+// AWS_ACCOUNT_<NAME>_VPC_ENDPOINTS (endpoint IDs), AWS_ACCOUNT_<NAME>_REGION
+// (default AWS_REGION), AWS_ACCOUNT_<NAME>_AZS (the availability zones every
+// endpoint must serve, by default those seen on the first check), and, unless the endpoints are in the monitor's own
+// account, AWS_ACCOUNT_<NAME>_ROLE_ARN with an optional
+// AWS_ACCOUNT_<NAME>_EXTERNAL_ID. The role needs ec2:DescribeVpcEndpoints,
+// ec2:DescribeNetworkInterfaces, and ec2:DescribeSecurityGroups.
+func loadAWSAccounts() {
+	for _, name := range splitList(os.Getenv("AWS_ACCOUNTS")) {
+		prefix := "AWS_ACCOUNT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		a := &awsAccount{
+			name:       name,
+			roleARN:    os.Getenv(prefix + "ROLE_ARN"),
+			externalID: os.Getenv(prefix + "EXTERNAL_ID"),
+			region:     orString(os.Getenv(prefix+"REGION"), awsRegion),
+			endpoints:  splitList(os.Getenv(prefix + "VPC_ENDPOINTS")),
+			zones:      splitList(os.Getenv(prefix + "AZS")),
+		}
+		if len(a.endpoints) == 0 {
+			log.Fatalf("%sVPC_ENDPOINTS is required for AWS account %s", prefix, name)
+		}
+		if a.region == "" {
+			log.Fatalf("%sREGION or AWS_REGION is required for AWS account %s", prefix, name)
+		}
+		awsAccounts = append(awsAccounts, a)
+	}
+}
+
+func findAWSAccount(name string) *awsAccount {
+	for _, a := range awsAccounts {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// credentials returns the credentials to use in the account, assuming its
+// role again shortly before the previous session expires.
+func (a *awsAccount) credentials() (awsCredentials, error) {
+	base, err := awsDefaultCredentials()
+	if err != nil || a.roleARN == "" {
+		return base, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if time.Until(a.expires) > 5*time.Minute {
+		return a.creds, nil
+	}
+	creds, expires, err := assumeRole(base, a.region, a.roleARN, a.externalID)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("assuming %s: %w", a.roleARN, err)
+	}
+	a.creds, a.expires = creds, expires
+	return creds, nil
+}
+
+// assumeRole calls STS AssumeRole in the regional STS endpoint.
+func assumeRole(base awsCredentials, region, roleARN, externalID string) (awsCredentials, time.Time, error) {
+	params := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {roleARN},
+		"RoleSessionName": {"privatelink-monitor"},
+		"DurationSeconds": {"3600"},
+	}
+	if externalID != "" {
+		params.Set("ExternalId", externalID)
+	}
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err := awsQueryRequest(base, region, "sts", "sts."+region+".amazonaws.com", params, &out); err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	c := out.Credentials
+	return awsCredentials{accessKeyID: c.AccessKeyID, secretAccessKey: c.SecretAccessKey, sessionToken: c.SessionToken}, c.Expiration, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The credential providers of the AWS SDKs' default chain that apply to a
+// monitor running inside the VPC, tried in this order: the environment,
+// a web identity token (EKS IAM roles for service accounts), the container
+// credentials endpoint (ECS task roles, EKS Pod Identity), and the EC2
+// instance metadata service (IMDSv2).
+
+const (
+	ecsCredentialsHost = "http://169.254.170.2"
+	imdsEndpoint       = "http://169.254.169.254"
+	// Temporary credentials are fetched again this long before they expire
+	awsCredentialsRefresh = 5 * time.Minute
+)
+
+var (
+	// The metadata services answer within milliseconds where they exist;
+	// elsewhere the chain should give up quickly. They are link-local, so
+	// never reached through a proxy.
+	awsMetadataClient = &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{}}
+
+	awsCredsMu      sync.Mutex
+	awsCachedCreds  awsCredentials
+	awsCredsExpires time.Time
+	awsCredsSource  string
+)
+
+// awsDefaultCredentials returns the monitor's own AWS credentials from the
+// first provider of the chain that has them. Temporary credentials are
+// cached until shortly before they expire.
+func awsDefaultCredentials() (awsCredentials, error) {
+	if creds, ok := awsEnvCredentials(); ok {
+		return creds, nil
+	}
+
+	awsCredsMu.Lock()
+	defer awsCredsMu.Unlock()
+	if awsCredsSource != "" && time.Until(awsCredsExpires) > awsCredentialsRefresh {
+		return awsCachedCreds, nil
+	}
+
+	providers := []struct {
+		name  string
+		fetch func() (awsCredentials, time.Time, bool, error)
+	}{
+		{"web identity", awsWebIdentityCredentials},
+		{"container", awsContainerCredentials},
+		{"instance metadata", awsInstanceCredentials},
+	}
+	var errs []string
+	for _, p := range providers {
+		creds, expires, ok, err := p.fetch()
+		if !ok {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", p.name, err))
+			continue
+		}
+		if awsCredsSource != p.name {
+			log.Printf("Using AWS credentials from %s\n", p.name)
+		}
+		awsCachedCreds, awsCredsExpires, awsCredsSource = creds, expires, p.name
+		return creds, nil
+	}
+	if len(errs) > 0 {
+		return awsCredentials{}, fmt.Errorf("no AWS credentials: %s", strings.Join(errs, "; "))
+	}
+	return awsCredentials{}, errors.New("AWS credentials are not configured (AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, a web identity token, a container or an instance role)")
+}
+
+// awsEnvCredentials reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and the
+// optional AWS_SESSION_TOKEN.
+func awsEnvCredentials() (awsCredentials, bool) {
+	creds := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	return creds, creds.accessKeyID != "" && creds.secretAccessKey != ""
+}
+
+// awsWebIdentityCredentials exchanges the token in
+// AWS_WEB_IDENTITY_TOKEN_FILE for a session of AWS_ROLE_ARN. The token file
+// is read on every refresh, since the kubelet rotates it.
+func awsWebIdentityCredentials() (awsCredentials, time.Time, bool, error) {
+	tokenFile, roleARN := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+	if tokenFile == "" || roleARN == "" {
+		return awsCredentials{}, time.Time{}, false, nil
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	params := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {orString(os.Getenv("AWS_ROLE_SESSION_NAME"), "privatelink-monitor")},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	host := "sts.amazonaws.com"
+	if awsRegion != "" {
+		host = "sts." + awsRegion + ".amazonaws.com"
+	}
+	// The token is the credential; the call is not signed
+	resp, err := awsHTTPClient.Post("https://"+host+"/", "application/x-www-form-urlencoded; charset=utf-8", strings.NewReader(params.Encode()))
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	if resp.StatusCode >= 300 {
+		return awsCredentials{}, time.Time{}, true, fmt.Errorf("AssumeRoleWithWebIdentity returned %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(data, &out); err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	c := out.Credentials
+	return awsCredentials{accessKeyID: c.AccessKeyID, secretAccessKey: c.SecretAccessKey, sessionToken: c.SessionToken}, c.Expiration, true, nil
+}
+
+// awsContainerCredentials asks the container credentials endpoint named by
+// AWS_CONTAINER_CREDENTIALS_RELATIVE_URI (ECS) or
+// AWS_CONTAINER_CREDENTIALS_FULL_URI with AWS_CONTAINER_AUTHORIZATION_TOKEN
+// or AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE (EKS Pod Identity).
+func awsContainerCredentials() (awsCredentials, time.Time, bool, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = ecsCredentialsHost + relative
+	}
+	if endpoint == "" {
+		return awsCredentials{}, time.Time{}, false, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return awsCredentials{}, time.Time{}, true, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	creds, expires, err := fetchMetadataCredentials(req)
+	return creds, expires, true, err
+}
+
+// awsInstanceCredentials reads the instance role's credentials from the
+// EC2 instance metadata service with an IMDSv2 session token, unless
+// AWS_EC2_METADATA_DISABLED=true.
+func awsInstanceCredentials() (awsCredentials, time.Time, bool, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return awsCredentials{}, time.Time{}, false, nil
+	}
+	endpoint := orString(os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"), imdsEndpoint)
+
+	req, err := http.NewRequest(http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	resp, err := awsMetadataClient.Do(req)
+	if err != nil {
+		// Not on EC2, or the hop limit keeps a container from it
+		return awsCredentials{}, time.Time{}, false, nil
+	}
+	token, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, time.Time{}, true, fmt.Errorf("IMDSv2 token request returned %s", resp.Status)
+	}
+
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, endpoint+path, nil)
+		if err == nil {
+			req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		}
+		return req, err
+	}
+	req, err = get("/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	resp, err = awsMetadataClient.Do(req)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	roles, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return awsCredentials{}, time.Time{}, true, errors.New("the instance has no IAM role")
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if resp.StatusCode != http.StatusOK || role == "" {
+		return awsCredentials{}, time.Time{}, true, fmt.Errorf("listing the instance role returned %s", resp.Status)
+	}
+
+	req, err = get("/latest/meta-data/iam/security-credentials/" + url.PathEscape(role))
+	if err != nil {
+		return awsCredentials{}, time.Time{}, true, err
+	}
+	creds, expires, err := fetchMetadataCredentials(req)
+	return creds, expires, true, err
+}
+
+// fetchMetadataCredentials reads the credentials document the container and
+// instance metadata endpoints share.
+func fetchMetadataCredentials(req *http.Request) (awsCredentials, time.Time, error) {
+	resp, err := awsMetadataClient.Do(req)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("%s returned %s: %s", req.URL.Path, resp.Status, bytes.TrimSpace(data))
+	}
+	var doc struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	if doc.AccessKeyID == "" || doc.SecretAccessKey == "" {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("%s returned no credentials", req.URL.Path)
+	}
+	return awsCredentials{accessKeyID: doc.AccessKeyID, secretAccessKey: doc.SecretAccessKey, sessionToken: doc.Token}, doc.Expiration, nil
+}
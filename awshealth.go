@@ -0,0 +1,238 @@
+package main
+
+import (
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// awsHealthEvent is an AWS Health event for a service the endpoint depends
+// on.
+type awsHealthEvent struct {
+	ARN              string    `json:"arn"`
+	Service          string    `json:"service"`
+	EventTypeCode    string    `json:"event_type_code"`
+	Region           string    `json:"region"`
+	AvailabilityZone string    `json:"availability_zone,omitempty"`
+	StatusCode       string    `json:"status_code"`
+	Start            time.Time `json:"start"`
+	End              time.Time `json:"end,omitempty"`
+}
+
+var (
+	awsHealthEnabled  bool
+	awsHealthRegion   string
+	awsHealthServices []string
+	awsHealthInterval time.Duration
+
+	awsHealthMu       sync.Mutex
+	awsHealthEvents   []awsHealthEvent
+	awsHealthPolledAt time.Time
+)
+
+// loadAWSHealthConfig reads AWS_HEALTH_EVENTS=true, AWS_HEALTH_REGION
+// (default AWS_REGION), AWS_HEALTH_SERVICES, and AWS_HEALTH_POLL_MINUTES.
+// The AWS Health API needs a Business or Enterprise support plan.
+func loadAWSHealthConfig() {
+	awsHealthEnabled = os.Getenv("AWS_HEALTH_EVENTS") == "true"
+	awsHealthRegion = orString(os.Getenv("AWS_HEALTH_REGION"), awsRegion)
+	awsHealthServices = splitList(orString(os.Getenv("AWS_HEALTH_SERVICES"), "VPC,ELASTICLOADBALANCING,EC2"))
+	awsHealthInterval = time.Duration(getEnvInt("AWS_HEALTH_POLL_MINUTES", 5)) * time.Minute
+	if awsHealthEnabled && awsHealthRegion == "" {
+		log.Fatal("AWS_HEALTH_EVENTS needs AWS_HEALTH_REGION or AWS_REGION")
+	}
+}
+
+func startAWSHealthPoller() {
+	if !awsHealthEnabled {
+		return
+	}
+	go func() {
+		lastErr := ""
+		for {
+			events, err := fetchAWSHealthEvents()
+			if err != nil {
+				if err.Error() != lastErr {
+					log.Printf("Failed to poll AWS Health: %v\n", err)
+				}
+				lastErr = err.Error()
+			} else {
+				lastErr = ""
+				awsHealthMu.Lock()
+				awsHealthEvents = events
+				awsHealthPolledAt = time.Now()
+				awsHealthMu.Unlock()
+				annotateIncidentsWithAWS()
+			}
+			time.Sleep(awsHealthInterval)
+		}
+	}()
+}
+
+// fetchAWSHealthEvents lists events of the watched services in the region
+// that are open or upcoming, whenever they started, and those that closed
+// within the last day, which still overlap incidents open since.
+func fetchAWSHealthEvents() ([]awsHealthEvent, error) {
+	creds, err := awsDefaultCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := describeAWSHealthEvents(creds, map[string]interface{}{
+		"services":         awsHealthServices,
+		"regions":          []string{awsHealthRegion},
+		"eventStatusCodes": []string{"open", "upcoming"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	closed, err := describeAWSHealthEvents(creds, map[string]interface{}{
+		"services":         awsHealthServices,
+		"regions":          []string{awsHealthRegion},
+		"eventStatusCodes": []string{"closed"},
+		"endTimes": []map[string]float64{
+			{"from": float64(time.Now().Add(-24 * time.Hour).Unix())},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(events, closed...), nil
+}
+
+func describeAWSHealthEvents(creds awsCredentials, filter map[string]interface{}) ([]awsHealthEvent, error) {
+	var events []awsHealthEvent
+	var nextToken string
+	for {
+		in := map[string]interface{}{"filter": filter, "maxResults": 100}
+		if nextToken != "" {
+			in["nextToken"] = nextToken
+		}
+		var out struct {
+			Events []struct {
+				ARN              string  `json:"arn"`
+				Service          string  `json:"service"`
+				EventTypeCode    string  `json:"eventTypeCode"`
+				Region           string  `json:"region"`
+				AvailabilityZone string  `json:"availabilityZone"`
+				StatusCode       string  `json:"statusCode"`
+				StartTime        float64 `json:"startTime"`
+				EndTime          float64 `json:"endTime"`
+			} `json:"events"`
+			NextToken string `json:"nextToken"`
+		}
+		// The Health API is global and served from us-east-1
+		err := awsJSONRequest(creds, "us-east-1", "health", "health.us-east-1.amazonaws.com", "AWSHealth_20160804.DescribeEvents", in, &out)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range out.Events {
+			events = append(events, awsHealthEvent{
+				ARN:              e.ARN,
+				Service:          e.Service,
+				EventTypeCode:    e.EventTypeCode,
+				Region:           e.Region,
+				AvailabilityZone: e.AvailabilityZone,
+				StatusCode:       e.StatusCode,
+				Start:            epochTime(e.StartTime),
+				End:              epochTime(e.EndTime),
+			})
+		}
+		if out.NextToken == "" {
+			return events, nil
+		}
+		nextToken = out.NextToken
+	}
+}
+
+func epochTime(seconds float64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9))
+}
+
+// overlappingAWSEvents returns the events active at any time since start.
+func overlappingAWSEvents(start time.Time) []awsHealthEvent {
+	awsHealthMu.Lock()
+	defer awsHealthMu.Unlock()
+
+	var overlapping []awsHealthEvent
+	for _, e := range awsHealthEvents {
+		if e.End.IsZero() || !e.End.Before(start) {
+			overlapping = append(overlapping, e)
+		}
+	}
+	return overlapping
+}
+
+// annotateIncidentsWithAWS attaches AWS-reported events overlapping each
+// open incident, including ones AWS publishes after the incident began.
+func annotateIncidentsWithAWS() {
+	incidentMu.Lock()
+	open := make([]*incident, 0, len(incidents))
+	for _, inc := range incidents {
+		open = append(open, inc)
+	}
+	incidentMu.Unlock()
+
+	for _, inc := range open {
+		events := overlappingAWSEvents(inc.Start)
+		incidentMu.Lock()
+		if incidents[inc.Target] == inc {
+			annotateIncident(inc, events)
+		}
+		incidentMu.Unlock()
+	}
+}
+
+// annotateIncident records events on inc. Called with incidentMu held.
+func annotateIncident(inc *incident, events []awsHealthEvent) {
+	known := map[string]bool{}
+	for _, e := range inc.AWSEvents {
+		known[e.ARN] = true
+	}
+	for _, e := range events {
+		if !known[e.ARN] {
+			log.Printf("Incident %s overlaps AWS Health event %s (%s)\n", inc.ID, e.EventTypeCode, e.StatusCode)
+		}
+	}
+	inc.AWSEvents = events
+}
+
+// awsHealthSummary is the line added to failure alerts, telling apart an
+// AWS-side problem from one in our own configuration.
+func awsHealthSummary(start time.Time) string {
+	if !awsHealthEnabled {
+		return ""
+	}
+	return describeAWSEvents(overlappingAWSEvents(start))
+}
+
+func describeAWSEvents(events []awsHealthEvent) string {
+	awsHealthMu.Lock()
+	polled := !awsHealthPolledAt.IsZero()
+	awsHealthMu.Unlock()
+	if !polled {
+		return tr("aws.health.not_polled", "AWS Health: no successful poll yet.\n")
+	}
+	if len(events) == 0 {
+		return tr("aws.health.no_events", "AWS Health: no {services} events in {region}, the cause is more likely on our side.\n",
+			"services", strings.Join(awsHealthServices, "/"), "region", awsHealthRegion)
+	}
+	var b strings.Builder
+	b.WriteString(tr("aws.health.events", "AWS Health: {count} event(s) overlap this incident:\n", "count", len(events)))
+	for _, e := range events {
+		az := ""
+		if e.AvailabilityZone != "" {
+			az = " " + e.AvailabilityZone
+		}
+		b.WriteString(tr("aws.health.event", "  {code} {region}{zone} ({status} since {start})\n",
+			"code", e.EventTypeCode, "region", e.Region, "zone", az, "status", e.StatusCode, "start", e.Start.Format("2006-01-02 15:04")))
+	}
+	return b.String()
+}
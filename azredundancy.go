@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	expectedAZCount  int
+	endpointDNSNames []string
+
+	azMu            sync.Mutex
+	endpointAnswers = map[string]int{}
+	azShortfall     string
+)
+
+// loadAZRedundancyConfig reads EXPECTED_AZ_COUNT, the number of A records
+// each endpoint DNS name should return (one per zone), and
+// ENDPOINT_DNS_NAMES, the names to watch. Without ENDPOINT_DNS_NAMES the
+// regional DNS names of the described VPC endpoints are watched.
+func loadAZRedundancyConfig() {
+	expectedAZCount = getEnvInt("EXPECTED_AZ_COUNT", 0)
+	endpointDNSNames = splitList(os.Getenv("ENDPOINT_DNS_NAMES"))
+}
+
+// trackEndpointDNS resolves the endpoint names along with the primary
+// cluster's own, so they are part of the check's DNS lookups and change
+// log.
+func trackEndpointDNS() []dnsLookup {
+	if expectedAZCount <= 0 {
+		return nil
+	}
+	names := endpointDNSNames
+	if len(names) == 0 {
+		for _, e := range vpcEndpointSnapshot() {
+			if e.RegionalDNS != "" {
+				names = append(names, e.RegionalDNS)
+			}
+		}
+	}
+	var lookups []dnsLookup
+	for _, name := range names {
+		_, lookup := observeDNS(name, dnsTypeA)
+		lookups = append(lookups, lookup)
+	}
+	return lookups
+}
+
+// evaluateAZRedundancy alerts when an endpoint name in lookups answers with fewer
+// addresses than EXPECTED_AZ_COUNT. DNS drops a zone's address once its
+// interface is unhealthy, and clients keep working through the remaining
+// zones, so this is the warning before the next zone failure is an outage.
+// Failed lookups are left to the check.
+func evaluateAZRedundancy(lookups []dnsLookup) {
+	if expectedAZCount <= 0 {
+		return
+	}
+	var short []string
+	azMu.Lock()
+	for _, lookup := range lookups {
+		if lookup.Error != "" {
+			continue
+		}
+		endpointAnswers[lookup.Name] = len(lookup.Answers)
+		if len(lookup.Answers) < expectedAZCount {
+			short = append(short, tr("az.name", "{name}: {count} of {zones} ({answers})", "name", lookup.Name, "count", len(lookup.Answers), "zones", expectedAZCount, "answers", strings.Join(lookup.Answers, ", ")))
+		}
+	}
+	sort.Strings(short)
+	current := strings.Join(short, "\n")
+	previous := azShortfall
+	azShortfall = current
+	azMu.Unlock()
+
+	if current == previous {
+		return
+	}
+	if current != "" {
+		log.Printf("Endpoint DNS answers below %d zones:\n%s\n", expectedAZCount, current)
+		sendAlert("MongoDB Endpoint DNS Below AZ Redundancy",
+			tr("az.below", "Endpoint DNS names return fewer addresses than the {zones} expected zones:\n{names}\n\nConnections still work through the remaining zones, but another zone failure would be an outage.\n{dns}{endpoints}",
+				"zones", expectedAZCount, "names", current, "dns", lastDNSChangeSummary(), "endpoints", vpcEndpointProblemSummary()))
+	} else {
+		sendRecovery("MongoDB Endpoint DNS AZ Redundancy Restored",
+			tr("az.restored", "Every endpoint DNS name returns {zones} or more addresses again.", "zones", expectedAZCount))
+	}
+}
+
+func endpointAnswerCounts() map[string]int {
+	azMu.Lock()
+	defer azMu.Unlock()
+	counts := make(map[string]int, len(endpointAnswers))
+	for name, n := range endpointAnswers {
+		counts[name] = n
+	}
+	return counts
+}
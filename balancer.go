@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// balancerReport is the balancer state seen in the last cycle.
+type balancerReport struct {
+	Mode             string    `json:"mode"`
+	InBalancerRound  bool      `json:"in_balancer_round"`
+	Rounds           int64     `json:"rounds"`
+	RoundsChangedAt  time.Time `json:"rounds_changed_at"`
+	ActiveMigrations int       `json:"active_migrations"`
+	Stuck            bool      `json:"stuck"`
+}
+
+var (
+	balancerChecksEnabled bool
+	balancerStuckAfter    time.Duration
+
+	balancerMu   sync.Mutex
+	lastBalancer *balancerReport
+)
+
+func loadBalancerConfig() {
+	balancerChecksEnabled = os.Getenv("BALANCER_CHECKS") == "true"
+	balancerStuckAfter = time.Duration(getEnvInt("BALANCER_STUCK_MINUTES", 60)) * time.Minute
+}
+
+// checkBalancer reads balancerStatus and in-progress migrations from a
+// mongos. The balancer counts as stuck when it sits inside a round without
+// the round counter moving for BALANCER_STUCK_MINUTES.
+func checkBalancer(uri string) {
+	if !balancerChecksEnabled {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "balancer"))
+	if err != nil {
+		logThrottled("Failed to connect for balancer check", err)
+		return
+	}
+	defer closeClient(client, "balancer")
+
+	admin := client.Database("admin")
+	var status struct {
+		Mode              string `bson:"mode"`
+		InBalancerRound   bool   `bson:"inBalancerRound"`
+		NumBalancerRounds int64  `bson:"numBalancerRounds"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "balancerStatus", Value: 1}}).Decode(&status); err != nil {
+		if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == 59 {
+			// CommandNotFound: not a sharded cluster
+			return
+		}
+		logThrottled("Failed to get balancer status", err)
+		return
+	}
+
+	balancerMu.Lock()
+	previous := lastBalancer
+	balancerMu.Unlock()
+
+	report := balancerReport{
+		Mode:             status.Mode,
+		InBalancerRound:  status.InBalancerRound,
+		Rounds:           status.NumBalancerRounds,
+		RoundsChangedAt:  time.Now(),
+		ActiveMigrations: activeMigrations(ctx, admin),
+	}
+	if previous != nil && previous.Rounds == report.Rounds {
+		report.RoundsChangedAt = previous.RoundsChangedAt
+	}
+	report.Stuck = report.Mode != "off" && report.InBalancerRound && time.Since(report.RoundsChangedAt) >= balancerStuckAfter
+
+	log.Printf("Balancer: mode=%s inRound=%v rounds=%d activeMigrations=%d\n", report.Mode, report.InBalancerRound, report.Rounds, report.ActiveMigrations)
+
+	wasStuck := previous != nil && previous.Stuck
+	if report.Stuck && !wasStuck {
+		sendAlert("MongoDB Balancer Stuck",
+			tr("balancer.stuck", "The balancer has been in the same round since {since} ({rounds} rounds total, {migrations} active migration(s)).\n"+
+				"A stuck balancer is a common secondary symptom of partial connectivity loss between shards.",
+				"since", report.RoundsChangedAt.Format("2006-01-02 15:04:05"), "rounds", report.Rounds, "migrations", report.ActiveMigrations))
+	} else if !report.Stuck && wasStuck {
+		sendRecovery("MongoDB Balancer Progressing Again", tr("balancer.progressing", "The balancer completed a round ({rounds} rounds total).", "rounds", report.Rounds))
+	}
+
+	balancerMu.Lock()
+	lastBalancer = &report
+	balancerMu.Unlock()
+}
+
+// activeMigrations counts chunk migrations in progress, or -1 if the
+// monitoring user may not run $currentOp.
+func activeMigrations(ctx context.Context, admin *mongo.Database) int {
+	pipeline := mongo.Pipeline{
+		{{Key: "$currentOp", Value: bson.D{{Key: "allUsers", Value: true}}}},
+		{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "command.moveChunk", Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.D{{Key: "command._shardsvrMoveRange", Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.D{{Key: "desc", Value: bson.D{{Key: "$regex", Value: "^MoveChunk|^migrateThread"}}}},
+		}}}}},
+	}
+	cursor, err := admin.Aggregate(ctx, pipeline)
+	if err != nil {
+		logThrottled("Failed to list active chunk migrations", err)
+		return -1
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		count++
+	}
+	return count
+}
+
+func balancerSnapshot() *balancerReport {
+	balancerMu.Lock()
+	defer balancerMu.Unlock()
+	return lastBalancer
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Default body limits per channel, in bytes. Slack truncates long message
+// text and PagerDuty rejects oversized events; everything else gets a
+// limit mail gateways accept.
+var defaultBodyLimits = map[string]int{
+	"slack":     3500,
+	"pagerduty": 16000,
+}
+
+const defaultBodyLimit = 64000
+
+var bodyLimits = map[string]int{}
+
+// loadBodyLimits reads ALERT_MAX_BODY_BYTES_<CHANNEL>, then
+// ALERT_MAX_BODY_BYTES, then the channel's default, for every configured
+// notifier. 0 disables the limit.
+func loadBodyLimits() {
+	for name := range availableNotifiers {
+		def := defaultBodyLimit
+		if limit, ok := defaultBodyLimits[name]; ok {
+			def = limit
+		}
+		def = getEnvInt("ALERT_MAX_BODY_BYTES", def)
+		bodyLimits[name] = getEnvInt("ALERT_MAX_BODY_BYTES_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_")), def)
+	}
+}
+
+// limitBody shortens body to at most limit bytes, keeping whole lines from
+// the start, where the error and failure class are, and from the end, where
+// the state dump and acknowledgement link are, with a note of what was
+// left out in between.
+func limitBody(body string, limit int) string {
+	if limit <= 0 || len(body) <= limit {
+		return body
+	}
+	lines := strings.SplitAfter(body, "\n")
+	budget := limit - 120 // room for the note
+	headBudget := budget * 2 / 3
+
+	var head, tail []string
+	used := 0
+	i := 0
+	for ; i < len(lines) && used+len(lines[i]) <= headBudget; i++ {
+		head = append(head, lines[i])
+		used += len(lines[i])
+	}
+	j := len(lines) - 1
+	for ; j >= i && used+len(lines[j]) <= budget; j-- {
+		tail = append([]string{lines[j]}, tail...)
+		used += len(lines[j])
+	}
+	if len(head) == 0 && len(tail) == 0 {
+		// A single huge line: cut it
+		return body[:max(budget, 0)] + fmt.Sprintf("\n[... %d bytes omitted ...]\n", len(body)-max(budget, 0))
+	}
+
+	omitted := 0
+	for _, line := range lines[i : j+1] {
+		omitted += len(line)
+	}
+	note := fmt.Sprintf("[... %d lines (%d bytes) omitted, the full details are in the log and state dump ...]\n", j+1-i, omitted)
+	if len(head) > 0 && !strings.HasSuffix(head[len(head)-1], "\n") {
+		note = "\n" + note
+	}
+	return strings.Join(head, "") + note + strings.Join(tail, "")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+var (
+	canaryDB         string
+	canaryCollection string
+)
+
+// loadCanaryConfig reads CANARY_DB, which adds a write, read-back and
+// delete of a small document to every connection check, and
+// CANARY_COLLECTION (default monitor_canary).
+func loadCanaryConfig() {
+	canaryDB = os.Getenv("CANARY_DB")
+	canaryCollection = orString(os.Getenv("CANARY_COLLECTION"), "monitor_canary")
+}
+
+// runCanary writes a document through the check's client, reads it back
+// from the primary and deletes it, timing the write and the read apart.
+// A ping only needs some member to answer; this catches writes hanging
+// behind a broken route to the primary, and fails the check when they do.
+func (c *cluster) runCanary(ctx context.Context, client *mongo.Client) (write, read time.Duration, err error) {
+	if canaryDB == "" || !probeAllowed("canary") {
+		return 0, 0, nil
+	}
+	coll := client.Database(canaryDB).Collection(canaryCollection)
+	if err := withOperation(ctx, func(ctx context.Context) error { return ensureProbeTTL(ctx, coll, "written_at") }); err != nil {
+		return 0, 0, fmt.Errorf("canary: %w", err)
+	}
+
+	id := primitive.NewObjectID()
+	start := time.Now()
+	err = withOperation(ctx, func(ctx context.Context) error {
+		_, err := coll.InsertOne(ctx, bson.D{{Key: "_id", Value: id}, {Key: "target", Value: c.name}, {Key: "written_at", Value: start}})
+		return err
+	})
+	write = time.Since(start)
+	if err != nil {
+		return write, 0, fmt.Errorf("canary write: %w", err)
+	}
+
+	start = time.Now()
+	err = withOperation(ctx, func(ctx context.Context) error {
+		primary := coll.Database().Collection(coll.Name(), options.Collection().SetReadPreference(readpref.Primary()))
+		return primary.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Err()
+	})
+	read = time.Since(start)
+	if err != nil {
+		return write, read, fmt.Errorf("canary read: %w", err)
+	}
+
+	if err := withOperation(ctx, func(ctx context.Context) error {
+		_, err := coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+		return err
+	}); err != nil {
+		return write, read, fmt.Errorf("canary delete: %w", err)
+	}
+	return write, read, nil
+}
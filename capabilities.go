@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// privilegeNeed is a set of actions a probe runs on one resource: the
+// cluster, or a database and optionally a collection in it.
+type privilegeNeed struct {
+	cluster    bool
+	db         string
+	collection string
+	actions    []string
+}
+
+func (n privilegeNeed) resource() string {
+	switch {
+	case n.cluster:
+		return "cluster"
+	case n.collection == "":
+		return n.db
+	}
+	return n.db + "." + n.collection
+}
+
+// probeCapability describes what the monitor user needs for one probe.
+type probeCapability struct {
+	name       string
+	configured func() bool
+	needs      func() []privilegeNeed
+}
+
+// probeCapabilities are the probes whose privileges go beyond the basic
+// check. Probes missing any of them are skipped rather than failing, or
+// paging about a permissions problem, every cycle.
+var probeCapabilities = []probeCapability{
+	{
+		name:       "replication",
+		configured: func() bool { return replicationLagCheck },
+		needs: func() []privilegeNeed {
+			return []privilegeNeed{{cluster: true, actions: []string{"replSetGetStatus"}}}
+		},
+	},
+	{
+		name:       "shards",
+		configured: func() bool { return shardChecksEnabled },
+		needs: func() []privilegeNeed {
+			return []privilegeNeed{{cluster: true, actions: []string{"listShards"}}}
+		},
+	},
+	{
+		name:       "canary",
+		configured: func() bool { return canaryDB != "" },
+		needs: func() []privilegeNeed {
+			return []privilegeNeed{{db: canaryDB, collection: canaryCollection, actions: []string{"insert", "find", "remove"}}}
+		},
+	},
+	{
+		name:       "index_probe",
+		configured: func() bool { return indexProbeDB != "" },
+		needs: func() []privilegeNeed {
+			return []privilegeNeed{{db: indexProbeDB, collection: indexProbeCollection, actions: []string{"find", "listIndexes"}}}
+		},
+	},
+	{
+		name:       "gridfs_probe",
+		configured: func() bool { return gridFSProbeDB != "" },
+		needs: func() []privilegeNeed {
+			return []privilegeNeed{
+				{db: gridFSProbeDB, collection: gridFSProbeBucket + ".files", actions: []string{"insert", "find", "remove", "createIndex"}},
+				{db: gridFSProbeDB, collection: gridFSProbeBucket + ".chunks", actions: []string{"insert", "find", "remove", "createIndex"}},
+			}
+		},
+	},
+	{
+		name:       "read_after_write",
+		configured: func() bool { return rawProbeDB != "" },
+		needs: func() []privilegeNeed {
+			return []privilegeNeed{{db: rawProbeDB, collection: rawProbeCollection, actions: []string{"insert", "find", "createIndex"}}}
+		},
+	},
+}
+
+// probeStatus is whether one configured probe runs, and if not, the
+// privileges it lacks.
+type probeStatus struct {
+	Probe   string   `json:"probe"`
+	Enabled bool     `json:"enabled"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// capabilityReport is what connectionStatus said about the monitor user.
+type capabilityReport struct {
+	CheckedAt time.Time     `json:"checked_at"`
+	Users     []string      `json:"users"`
+	Roles     []string      `json:"roles"`
+	Probes    []probeStatus `json:"probes"`
+}
+
+var (
+	capabilityDiscovery bool
+
+	capabilityMu     sync.Mutex
+	lastCapabilities *capabilityReport
+)
+
+// loadCapabilityConfig reads CAPABILITY_DISCOVERY (default true).
+func loadCapabilityConfig() {
+	capabilityDiscovery = os.Getenv("CAPABILITY_DISCOVERY") != "false"
+}
+
+// userPrivilege is one entry of connectionStatus's
+// authenticatedUserPrivileges.
+type userPrivilege struct {
+	Resource struct {
+		Cluster     bool    `bson:"cluster"`
+		AnyResource bool    `bson:"anyResource"`
+		DB          *string `bson:"db"`
+		Collection  *string `bson:"collection"`
+	} `bson:"resource"`
+	Actions []string `bson:"actions"`
+}
+
+// covers reports whether the privilege grants action on the needed
+// resource. An empty db or collection in a privilege matches any.
+func (p userPrivilege) covers(need privilegeNeed, action string) bool {
+	if !slices.Contains(p.Actions, action) {
+		return false
+	}
+	r := p.Resource
+	switch {
+	case r.AnyResource:
+		return true
+	case need.cluster:
+		return r.Cluster
+	case r.Cluster || r.DB == nil || r.Collection == nil:
+		return false
+	}
+	return (*r.DB == "" || *r.DB == need.db) && (*r.Collection == "" || *r.Collection == need.collection)
+}
+
+// discoverCapabilities runs connectionStatus on a newly connected client
+// and works out which of the configured probes the monitor user can run,
+// or returns nil when discovery is off or failed. With no authenticated
+// user (auth disabled) every probe runs. Nothing is recorded until the
+// check is adopted (see recordCapabilities).
+func discoverCapabilities(ctx context.Context, client *mongo.Client) *capabilityReport {
+	if !capabilityDiscovery {
+		return nil
+	}
+
+	var status struct {
+		AuthInfo struct {
+			Users []struct {
+				User string `bson:"user"`
+				DB   string `bson:"db"`
+			} `bson:"authenticatedUsers"`
+			Roles []struct {
+				Role string `bson:"role"`
+				DB   string `bson:"db"`
+			} `bson:"authenticatedUserRoles"`
+			Privileges []userPrivilege `bson:"authenticatedUserPrivileges"`
+		} `bson:"authInfo"`
+	}
+	cmd := bson.D{{Key: "connectionStatus", Value: 1}, {Key: "showPrivileges", Value: true}}
+	if err := client.Database("admin").RunCommand(ctx, cmd).Decode(&status); err != nil {
+		logThrottled("Failed to discover monitor user privileges", err)
+		return nil
+	}
+
+	report := &capabilityReport{CheckedAt: time.Now()}
+	for _, user := range status.AuthInfo.Users {
+		report.Users = append(report.Users, user.User+"@"+user.DB)
+	}
+	for _, role := range status.AuthInfo.Roles {
+		report.Roles = append(report.Roles, role.Role+"@"+role.DB)
+	}
+	slices.Sort(report.Roles)
+	for _, probe := range probeCapabilities {
+		if !probe.configured() {
+			continue
+		}
+		result := probeStatus{Probe: probe.name, Enabled: true}
+		if len(report.Users) > 0 {
+			result.Missing = missingPrivileges(status.AuthInfo.Privileges, probe.needs())
+			result.Enabled = len(result.Missing) == 0
+		}
+		report.Probes = append(report.Probes, result)
+	}
+	return report
+}
+
+// recordCapabilities makes report the one probeAllowed goes by, logging
+// which probes run when that changed.
+func recordCapabilities(report *capabilityReport) {
+	capabilityMu.Lock()
+	previous := lastCapabilities
+	lastCapabilities = report
+	capabilityMu.Unlock()
+
+	if previous != nil && fmt.Sprint(previous.Roles, previous.Probes) == fmt.Sprint(report.Roles, report.Probes) {
+		return
+	}
+	var enabled []string
+	for _, probe := range report.Probes {
+		if probe.Enabled {
+			enabled = append(enabled, probe.Probe)
+		} else {
+			log.Printf("Skipping %s probe: monitor user lacks %s\n", probe.Probe, strings.Join(probe.Missing, ", "))
+		}
+	}
+	log.Printf("Monitor user %s has roles [%s]; probes enabled: [%s]\n",
+		strings.Join(report.Users, ", "), strings.Join(report.Roles, ", "), strings.Join(enabled, ", "))
+}
+
+// missingPrivileges lists the needed "action on resource" pairs that no
+// privilege grants.
+func missingPrivileges(privileges []userPrivilege, needs []privilegeNeed) []string {
+	var missing []string
+	for _, need := range needs {
+		for _, action := range need.actions {
+			if !slices.ContainsFunc(privileges, func(p userPrivilege) bool { return p.covers(need, action) }) {
+				missing = append(missing, action+" on "+need.resource())
+			}
+		}
+	}
+	return missing
+}
+
+// probeAllowed reports whether the monitor user may run the named probe.
+// Until privileges are known every probe is allowed.
+func probeAllowed(name string) bool {
+	capabilityMu.Lock()
+	defer capabilityMu.Unlock()
+	return lastCapabilities.allows(name)
+}
+
+// allows reports whether the report lets the named probe run. A nil
+// report, from before privileges are known, allows every probe.
+func (r *capabilityReport) allows(name string) bool {
+	if r == nil {
+		return true
+	}
+	for _, probe := range r.Probes {
+		if probe.Probe == name {
+			return probe.Enabled
+		}
+	}
+	return true
+}
+
+func capabilitySnapshot() *capabilityReport {
+	capabilityMu.Lock()
+	defer capabilityMu.Unlock()
+	return lastCapabilities
+}
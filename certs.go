@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// certInfo is one certificate of a chain a server presented.
+type certInfo struct {
+	Host      string    `json:"host"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	Serial    string    `json:"serial"`
+	SANs      []string  `json:"sans,omitempty"`
+	NotAfter  time.Time `json:"not_after"`
+	DaysLeft  int       `json:"days_left"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+var (
+	certWarnDays int
+
+	certMu       sync.Mutex
+	certChains   = map[string][]certInfo{}
+	certExpiring string
+)
+
+// loadCertConfig reads CERT_EXPIRY_WARN_DAYS (default 30).
+func loadCertConfig() {
+	certWarnDays = getEnvInt("CERT_EXPIRY_WARN_DAYS", 30)
+}
+
+// applyCertCapture records the chain each server presents when the driver
+// opens a TLS connection, without changing how it is verified.
+func applyCertCapture(opts *options.ClientOptions) {
+	if opts.TLSConfig == nil {
+		return
+	}
+	fipsTLS(opts.TLSConfig)
+	verify := opts.TLSConfig.VerifyConnection
+	opts.TLSConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		recordPeerCertificates(state)
+		if verify != nil {
+			return verify(state)
+		}
+		return nil
+	}
+}
+
+// recordPeerCertificates stores the chain per server name and logs it the
+// first time it is seen, which also makes rotations visible in the log.
+func recordPeerCertificates(state tls.ConnectionState) {
+	if len(state.PeerCertificates) == 0 {
+		return
+	}
+	host := state.ServerName
+	now := time.Now()
+	chain := make([]certInfo, 0, len(state.PeerCertificates))
+	for _, cert := range state.PeerCertificates {
+		chain = append(chain, describeCertificate(host, cert, now))
+	}
+
+	certMu.Lock()
+	previous := certChains[host]
+	if len(previous) > 0 && previous[0].Serial == chain[0].Serial {
+		for i := range chain {
+			if i < len(previous) {
+				chain[i].FirstSeen = previous[i].FirstSeen
+			}
+		}
+		certChains[host] = chain
+		certMu.Unlock()
+		return
+	}
+	certChains[host] = chain
+	certMu.Unlock()
+
+	if len(previous) > 0 {
+		log.Printf("Certificate for %s changed: serial %s -> %s\n", host, previous[0].Serial, chain[0].Serial)
+	}
+	for _, c := range chain {
+		log.Printf("Certificate for %s: subject=%q issuer=%q expires %s (%d days) SANs=%s\n",
+			host, c.Subject, c.Issuer, c.NotAfter.Format(time.RFC3339), c.DaysLeft, strings.Join(c.SANs, ","))
+	}
+}
+
+func describeCertificate(host string, cert *x509.Certificate, now time.Time) certInfo {
+	sans := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return certInfo{
+		Host:      host,
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		Serial:    cert.SerialNumber.Text(16),
+		SANs:      sans,
+		NotAfter:  cert.NotAfter,
+		DaysLeft:  int(cert.NotAfter.Sub(now).Hours() / 24),
+		FirstSeen: now,
+	}
+}
+
+// checkCertExpiry alerts when a certificate in any recorded chain expires
+// within CERT_EXPIRY_WARN_DAYS, and again once all of them are renewed.
+func checkCertExpiry() {
+	if certWarnDays <= 0 {
+		return
+	}
+	var expiring []string
+	for _, c := range certSnapshot() {
+		if days := int(time.Until(c.NotAfter).Hours() / 24); days < certWarnDays {
+			expiring = append(expiring, tr("certs.certificate", "{host}: {subject:%q} issued by {issuer:%q} expires {expires} ({days} days)",
+				"host", c.Host, "subject", c.Subject, "issuer", c.Issuer, "expires", c.NotAfter.Format("2006-01-02"), "days", days))
+		}
+	}
+	sort.Strings(expiring)
+	summary := strings.Join(expiring, "\n")
+
+	certMu.Lock()
+	previous := certExpiring
+	certExpiring = summary
+	certMu.Unlock()
+	if summary == previous {
+		return
+	}
+	if summary != "" {
+		sendAlert("MongoDB TLS Certificate Expiring",
+			tr("certs.expiring", "Certificates presented by the cluster expire within {days} days:\n{certificates}\n\nMake sure clients trust the replacement before it is rotated in.",
+				"days", certWarnDays, "certificates", summary))
+	} else {
+		sendRecovery("MongoDB TLS Certificates Renewed", tr("certs.renewed", "No certificate presented by the cluster expires soon anymore."))
+	}
+}
+
+func certSnapshot() []certInfo {
+	certMu.Lock()
+	defer certMu.Unlock()
+	hosts := make([]string, 0, len(certChains))
+	for host := range certChains {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	var certs []certInfo
+	for _, host := range hosts {
+		certs = append(certs, certChains[host]...)
+	}
+	return certs
+}
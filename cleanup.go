@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// gridFSProbeBucket is the GridFS bucket the GridFS probe writes to.
+const gridFSProbeBucket = "monitor_probe"
+
+var (
+	probeDataTTL time.Duration
+
+	ttlMu      sync.Mutex
+	ttlEnsured = map[string]bool{}
+)
+
+func loadCleanupConfig() {
+	probeDataTTL = time.Duration(getEnvInt("PROBE_DATA_TTL_HOURS", 24)) * time.Hour
+}
+
+// ensureProbeTTL creates a TTL index on field once per process, so canary
+// documents left behind by an interrupted probe expire on their own.
+func ensureProbeTTL(ctx context.Context, coll *mongo.Collection, field string) error {
+	ns := coll.Database().Name() + "." + coll.Name()
+	ttlMu.Lock()
+	done := ttlEnsured[ns]
+	ttlMu.Unlock()
+	if done {
+		return nil
+	}
+
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetName("monitor_ttl").SetExpireAfterSeconds(int32(probeDataTTL.Seconds())),
+	})
+	if err != nil {
+		return fmt.Errorf("create TTL index on %s: %w", ns, err)
+	}
+	ttlMu.Lock()
+	ttlEnsured[ns] = true
+	ttlMu.Unlock()
+	return nil
+}
+
+// verifyGridFSDeleted checks that no chunks of a deleted probe file remain.
+// TTL indexes cannot cover GridFS chunks, which carry no date.
+func verifyGridFSDeleted(ctx context.Context, db *mongo.Database, id interface{}) error {
+	n, err := db.Collection(gridFSProbeBucket+".chunks").CountDocuments(ctx, bson.D{{Key: "files_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%d chunk(s) of probe file %v remain after delete", n, id)
+	}
+	return nil
+}
+
+// probeArtifacts lists every collection the monitor's write probes create,
+// including those of the probe scripts, each once.
+func probeArtifacts() []string {
+	var namespaces []string
+	if canaryDB != "" {
+		namespaces = append(namespaces, canaryDB+"."+canaryCollection)
+	}
+	if rawProbeDB != "" {
+		namespaces = append(namespaces, rawProbeDB+"."+rawProbeCollection)
+	}
+	if gridFSProbeDB != "" {
+		namespaces = append(namespaces, gridFSProbeDB+"."+gridFSProbeBucket+".files", gridFSProbeDB+"."+gridFSProbeBucket+".chunks")
+	}
+	for _, script := range probeScripts {
+		namespaces = append(namespaces, script.namespaces()...)
+	}
+	seen := map[string]bool{}
+	unique := namespaces[:0]
+	for _, ns := range namespaces {
+		if !seen[ns] {
+			seen[ns] = true
+			unique = append(unique, ns)
+		}
+	}
+	return unique
+}
+
+// runCleanupCommand implements `cleanup`: drop every collection the write
+// probes created, then confirm they are gone.
+func runCleanupCommand(args []string) error {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only list what would be removed")
+	fs.Parse(args)
+
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		return errors.New("MONGODB_URI not set in .env file")
+	}
+	namespaces := probeArtifacts()
+	if len(namespaces) == 0 {
+		fmt.Println("No write probes are configured, nothing to clean up")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "cleanup"))
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer closeClient(client, "cleanup")
+
+	for _, ns := range namespaces {
+		db, coll := splitNamespace(ns)
+		c := client.Database(db).Collection(coll)
+		n, err := c.EstimatedDocumentCount(ctx)
+		if err != nil {
+			return fmt.Errorf("count %s: %w", ns, err)
+		}
+		if *dryRun {
+			fmt.Printf("would drop %s (%d documents)\n", ns, n)
+			continue
+		}
+		if err := c.Drop(ctx); err != nil {
+			return fmt.Errorf("drop %s: %w", ns, err)
+		}
+		names, err := client.Database(db).ListCollectionNames(ctx, bson.D{{Key: "name", Value: coll}})
+		if err != nil {
+			return fmt.Errorf("verify %s: %w", ns, err)
+		}
+		if len(names) > 0 {
+			return fmt.Errorf("%s still exists after drop", ns)
+		}
+		fmt.Printf("dropped %s (%d documents)\n", ns, n)
+	}
+	return nil
+}
+
+// splitNamespace splits "db.collection" at the first dot; collection names
+// such as GridFS buckets may contain more dots.
+func splitNamespace(ns string) (db, coll string) {
+	db, coll, _ = strings.Cut(ns, ".")
+	return db, coll
+}
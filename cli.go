@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/version"
+)
+
+// buildVersion is set at build time with
+// -ldflags "-X main.buildVersion=v1.2.3".
+var buildVersion = "dev"
+
+var (
+	envFile     = ".env"
+	runOnce     bool
+	logToStderr bool
+	// monitoring is set by run, the only command that records what it
+	// observes for later runs to compare against (the pinned cluster
+	// identity and the server version); one-shot commands only compare
+	monitoring bool
+)
+
+const usageText = `Usage: %s [flags] [command] [command flags]
+
+Commands:
+  run              check every cluster until stopped (default); -once for a single cycle
+  check            check every cluster once, print the results, send no alerts
+  validate-config  load the configuration, report problems, and exit
+  report           uptime, outages, and latency percentiles from HISTORY_DB
+  diagnose         run every probe once and write a report for support tickets
+  version          print the version
+  silence, unsilence, drill, provision, cleanup
+                   see "<command> -h"
+
+Flags:
+`
+
+// parseCommandLine reads the global flags and returns the command and its
+// arguments. Flags that pick the configuration are applied to the
+// environment before it is loaded.
+func parseCommandLine() (string, []string) {
+	configPath := flag.String("config", "", "config file (default config.yaml when present, or CONFIG_FILE)")
+	flag.StringVar(&envFile, "env-file", envFile, "environment file to load")
+	verbose := flag.Bool("v", false, "log at debug level and copy the log to stderr")
+	flag.BoolVar(&runOnce, "once", false, "same as run -once")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usageText, os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *configPath != "" {
+		os.Setenv("CONFIG_FILE", *configPath)
+	}
+	if *verbose {
+		os.Setenv("LOG_LEVEL", "debug")
+		logToStderr = true
+	}
+
+	command, args := "run", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "run", "check", "validate-config", "report", "diagnose", "version", "silence", "unsilence", "drill", "provision", "cleanup":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if command == "validate-config" {
+		logToStderr = true
+	}
+	return command, args
+}
+
+// logOutput is where log lines go: the log file, and stderr as well for
+// -v and validate-config.
+func logOutput() io.Writer {
+	if logToStderr {
+		return io.MultiWriter(logFile, os.Stderr)
+	}
+	return logFile
+}
+
+func printVersion() {
+	fmt.Printf("mongodb-privatelink-connectivity-test %s (%s, mongo-driver %s)\n", buildVersion, runtime.Version(), version.Driver)
+}
+
+// runSingleCycle runs one check cycle of every cluster, waits for their
+// alerts to go out, and fails when any cluster's check failed, whether or
+// not CONSECUTIVE_FAILURES_BEFORE_ALERT let it alert. The first result
+// sets the state as with INITIAL_STATE_POLICY=alert, so a success sends no
+// "restored" alert.
+func runSingleCycle() error {
+	initialStatePolicy = "alert"
+	var wg sync.WaitGroup
+	for _, c := range clusters {
+		wg.Add(1)
+		go func(c *cluster) {
+			defer wg.Done()
+			c.run()
+		}(c)
+	}
+	wg.Wait()
+	drainAlerts()
+	drainMQTT()
+	stateDumps.Wait()
+
+	var failed []string
+	for _, c := range clusters {
+		if c.lastErr != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", c.name, c.lastErr))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("check failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// runCheckCommand implements `check`: one connection check per cluster,
+// printed as JSON, without alerts. It exits non-zero when a check fails.
+func runCheckCommand(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	target := fs.String("target", "", "check only this cluster")
+	source := fs.String("source", "", "connect from this local IP address or interface (default PROBE_SOURCE)")
+	fs.Parse(args)
+
+	if *source != "" {
+		if err := setSourceBinding(*source); err != nil {
+			return err
+		}
+	}
+	if sourceIP != nil {
+		fmt.Fprintf(os.Stderr, "Connecting from %s\n", describeSourceBinding())
+	}
+
+	alertsMuted = true
+	selected := clusters
+	if *target != "" {
+		c := findCluster(*target)
+		if c == nil {
+			return fmt.Errorf("unknown cluster %q", *target)
+		}
+		selected = []*cluster{c}
+	}
+
+	results := make([]checkResult, len(selected))
+	var wg sync.WaitGroup
+	for i, c := range selected {
+		wg.Add(1)
+		go func(i int, c *cluster) {
+			defer wg.Done()
+			results[i], _ = c.check()
+			c.dropClient()
+		}(i, c)
+	}
+	wg.Wait()
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	failed := 0
+	for _, result := range results {
+		enc.Encode(result)
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d check(s) failed", failed, len(results))
+	}
+	return nil
+}
+
+// runValidateConfigCommand implements `validate-config`. Loading the
+// configuration already stops on invalid values; this adds the checks that
+// need the whole picture and prints a summary.
+func runValidateConfigCommand(args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	fs.Parse(args)
+
+	var problems []string
+	for _, c := range clusters {
+		if c.uri == "" {
+			problems = append(problems, fmt.Sprintf("cluster %s has no connection string", c.name))
+			continue
+		}
+		if _, _, err := parseSeedList(c.uri); err != nil {
+			problems = append(problems, fmt.Sprintf("cluster %s: %v", c.name, err))
+		}
+		for name, uri := range c.variants {
+			if _, _, err := parseSeedList(uri); err != nil {
+				problems = append(problems, fmt.Sprintf("cluster %s variant %s: %v", c.name, name, err))
+			}
+		}
+	}
+	if expectedAZCount > 0 && len(endpointDNSNames) == 0 && len(awsAccounts) == 0 {
+		problems = append(problems, "EXPECTED_AZ_COUNT needs ENDPOINT_DNS_NAMES or AWS_ACCOUNTS to know which names to watch")
+	}
+	if len(fallbackChain) == 0 && len(fanoutNotifiers) == 0 {
+		problems = append(problems, "no notification channel is configured")
+	}
+
+	names := make([]string, 0, len(availableNotifiers))
+	for name := range availableNotifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, c := range clusters {
+		fmt.Printf("cluster %s: every %v, %d connection string variant(s)\n", c.name, c.interval, len(c.variants))
+	}
+	fmt.Printf("notifiers: %s\n", strings.Join(names, ", "))
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			log.Printf("Configuration problem: %s\n", problem)
+		}
+		return errors.New(strings.Join(problems, "; "))
+	}
+	fmt.Println("configuration OK")
+	return nil
+}
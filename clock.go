@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const maxClockGaps = 100
+
+// clockGap records a stretch of wall-clock time the monitor did not observe,
+// e.g. a VM pause, host sleep, or NTP step. Gaps are not downtime.
+type clockGap struct {
+	start time.Time
+	end   time.Time
+	jump  time.Duration
+}
+
+var (
+	clockJumpThreshold time.Duration
+	lastCycleStart     time.Time
+	expectedWake       time.Time
+
+	clockMu   sync.Mutex
+	clockGaps []clockGap
+)
+
+// detectClockJump compares wall-clock and monotonic time elapsed since the
+// previous cycle. Go's time.Now carries both readings; Round(0) strips the
+// monotonic one. A suspended host stops the monotonic clock but not the wall
+// clock, and an NTP step moves only the wall clock.
+func detectClockJump(now time.Time) bool {
+	last := lastCycleStart
+	lastCycleStart = now
+	if last.IsZero() {
+		return false
+	}
+
+	monoElapsed := now.Sub(last)
+	wallElapsed := now.Round(0).Sub(last.Round(0))
+	jump := wallElapsed - monoElapsed
+
+	// A stalled process (e.g. a paused VM whose monotonic clock kept running)
+	// shows up as waking long after the sleep should have ended
+	stall := now.Sub(expectedWake)
+
+	switch {
+	case jump > clockJumpThreshold || jump < -clockJumpThreshold:
+		log.Printf("CLOCK JUMP: wall clock moved %v while monotonic clock moved %v (jump %v)\n", wallElapsed, monoElapsed, jump)
+	case stall > clockJumpThreshold:
+		log.Printf("CLOCK JUMP: woke %v later than scheduled\n", stall.Round(time.Second))
+		jump = stall
+	default:
+		return false
+	}
+
+	clockMu.Lock()
+	clockGaps = append(clockGaps, clockGap{start: last.Round(0), end: now.Round(0), jump: jump})
+	if len(clockGaps) > maxClockGaps {
+		clockGaps = clockGaps[len(clockGaps)-maxClockGaps:]
+	}
+	clockMu.Unlock()
+	return true
+}
+
+// clockGapTime is how much of the span from start to end fell into clock
+// gaps.
+func clockGapTime(start, end time.Time) time.Duration {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+
+	var total time.Duration
+	for _, gap := range clockGaps {
+		from, to := gap.start, gap.end
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			total += to.Sub(from)
+		}
+	}
+	return total
+}
+
+// expectWakeAfter records when the loop expects to start its next cycle.
+func expectWakeAfter(d time.Duration) {
+	expectedWake = time.Now().Add(d)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// cluster is one monitored deployment with its own check loop, connection
+// state, incidents, and alerts, all keyed by its name as the target. The
+// primary cluster (MONGODB_URI, named by INDEX) also runs the deeper probes
+// and background checks configured for this monitor; the clusters listed
+// in CLUSTERS get the connection check only.
+type cluster struct {
+	name     string
+	uri      string
+	variants map[string]string
+	interval time.Duration
+	primary  bool
+	// Where the URI is read from while running, see loadURISources
+	uriSource string
+
+	// Owned by the cluster's check loop
+	up                bool
+	initialStateKnown bool
+	clientState
+	variantProblems string
+	pingLatency     time.Duration
+	canaryWrite     time.Duration
+	canaryRead      time.Duration
+	degraded        bool
+	publicPath      string
+	raceFailures    string
+	topology        bson.M
+	members         *memberSet
+	degradedMembers bool
+	failures        int
+	successes       int
+	failingSince    time.Time
+	lastCycle       time.Time
+	// The latest check's error, nil when it succeeded
+	lastErr   error
+	hungCheck chan *connectionCheck
+	// On-demand checks from the /check webhook
+	checkRequests chan checkRequest
+}
+
+// connectionCheck is one connection check's own state. The check takes the
+// cluster's client with it and records what it read here, changing no
+// other state; only a check that returns in time is adopted, so one the
+// watchdog abandoned can neither overwrite newer state nor alert when it
+// finally returns.
+type connectionCheck struct {
+	clientState
+	uri string
+	// The identity pinned when the check started, nil if none
+	pinned *clusterIdentity
+
+	cold         bool
+	err          error
+	pingLatency  time.Duration
+	canaryWrite  time.Duration
+	canaryRead   time.Duration
+	serverStatus bson.M
+	topology     bson.M
+	primaryHost  string
+	electedAt    time.Time
+	term         int64
+	identity     *clusterIdentity
+	capabilities *capabilityReport
+	features     *serverFeatures
+}
+
+var clusters []*cluster
+
+// loadClusters reads CLUSTERS="orders,billing" and for each cluster
+// CLUSTER_<NAME>_URI (or CLUSTER_<NAME>_URI_SOURCE, see loadURISources)
+// and CLUSTER_<NAME>_INTERVAL_SECONDS (default CHECK_INTERVAL_SECONDS),
+// plus connection string variants (see loadURIVariants). The primary
+// cluster comes first.
+func loadClusters() {
+	clusters = []*cluster{{name: targetName(), uri: os.Getenv("MONGODB_URI"), uriSource: os.Getenv("MONGODB_URI_SOURCE"), variants: loadURIVariants(""), interval: checkInterval, primary: true,
+		checkRequests: make(chan checkRequest)}}
+	for _, name := range splitList(os.Getenv("CLUSTERS")) {
+		prefix := "CLUSTER_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		c := &cluster{
+			name:      name,
+			uri:       os.Getenv(prefix + "URI"),
+			uriSource: os.Getenv(prefix + "URI_SOURCE"),
+			variants:  loadURIVariants(prefix),
+			interval:  time.Duration(getEnvInt(prefix+"INTERVAL_SECONDS", int(checkInterval.Seconds()))) * time.Second,
+
+			checkRequests: make(chan checkRequest),
+		}
+		if c.uri == "" && c.uriSource == "" {
+			log.Fatalf("%sURI or %sURI_SOURCE is required for cluster %s", prefix, prefix, name)
+		}
+		if c.interval <= 0 {
+			log.Fatalf("%sINTERVAL_SECONDS must be positive for cluster %s", prefix, name)
+		}
+		if findCluster(name) != nil {
+			log.Fatalf("Cluster name %s is used twice (INDEX names the primary cluster)", name)
+		}
+		clusters = append(clusters, c)
+	}
+}
+
+func findCluster(name string) *cluster {
+	for _, c := range clusters {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// logThrottled throttles the cluster's repeated errors separately from
+// those of other clusters.
+func (c *cluster) logThrottled(prefix string, err error) {
+	if c.primary {
+		logThrottled(prefix, err)
+		return
+	}
+	logThrottledScoped(c.name, c.name+": "+prefix, err)
+}
+
+func (c *cluster) endThrottleCycle() {
+	if c.primary {
+		endThrottleCycle("")
+		return
+	}
+	endThrottleCycle(c.name)
+}
+
+// checkWithWatchdog runs the connection check but gives up waiting after
+// CHECK_HARD_CAP_SECONDS, for driver calls that ignore their context. No
+// new check starts before the abandoned one returns; those cycles fail
+// straight away instead. When it does return, its client is dropped, and
+// nothing else it saw is used.
+func (c *cluster) checkWithWatchdog() (cold bool, err error) {
+	if c.hungCheck != nil {
+		select {
+		case late := <-c.hungCheck:
+			log.Printf("Abandoned check of %s has finally returned\n", c.name)
+			late.dropClient()
+			c.hungCheck = nil
+		default:
+			return false, fmt.Errorf("previous check of %s is still hung, not starting another: %w", c.name, context.DeadlineExceeded)
+		}
+	}
+
+	hardCap := c.hardCap()
+	check := &connectionCheck{clientState: c.clientState, uri: c.uri}
+	if c.primary {
+		check.pinned = pinnedIdentity
+	}
+	c.clientState = clientState{}
+	done := make(chan *connectionCheck, 1)
+	go func() {
+		check.cold, check.err = c.checkConnection(check)
+		done <- check
+	}()
+	select {
+	case check := <-done:
+		c.adopt(check)
+		return check.cold, check.err
+	case <-time.After(hardCap):
+		log.Printf("Check of %s did not return within %v, abandoning it\n", c.name, hardCap)
+		c.hungCheck = done
+		return false, fmt.Errorf("check of %s abandoned by the watchdog after %v: %w", c.name, hardCap, context.DeadlineExceeded)
+	}
+}
+
+// adopt takes over the client and measurements of a check that returned
+// in time, and records what it read about the deployment, with the alerts
+// that go with it.
+func (c *cluster) adopt(check *connectionCheck) {
+	c.clientState = check.clientState
+	c.pingLatency, c.canaryWrite, c.canaryRead = check.pingLatency, check.canaryWrite, check.canaryRead
+	if check.topology != nil {
+		c.topology = check.topology
+	}
+	if check.capabilities != nil {
+		recordCapabilities(check.capabilities)
+	}
+	if c.primary && check.serverStatus != nil {
+		if version, ok := check.serverStatus["version"].(string); ok {
+			trackServerVersion(version)
+		}
+		recordServerCursors(check.serverStatus)
+	}
+	c.trackPrimary(check.primaryHost, check.electedAt, check.term)
+	if c.primary && check.topology != nil {
+		checkExpectedTopology(check.topology)
+	}
+	if check.identity != nil && check.pinned == nil {
+		pinClusterIdentity(*check.identity)
+	}
+	if check.features != nil {
+		recordServerFeatures(check.features)
+	}
+}
+
+// hardCap is how long the watchdog waits for a check of the cluster.
+func (c *cluster) hardCap() time.Duration {
+	if checkHardCap > 0 {
+		return checkHardCap
+	}
+	return 2 * c.interval
+}
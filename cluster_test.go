@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A check records what it read only through adopt; the failover it saw is
+// counted once adopted, and a check never adopted changes nothing.
+func TestAdoptPrimary(t *testing.T) {
+	muted := alertsMuted
+	alertsMuted = true
+	t.Cleanup(func() {
+		alertsMuted = muted
+		failoverMu.Lock()
+		delete(primaries, "adopt-test")
+		failoverMu.Unlock()
+	})
+	c := &cluster{name: "adopt-test", interval: time.Minute}
+	elected := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		check     *connectionCheck
+		adopt     bool
+		host      string
+		failovers int
+	}{
+		{"first primary", &connectionCheck{primaryHost: "a:27017"}, true, "a:27017", 0},
+		{"no primary in the reply", &connectionCheck{}, true, "a:27017", 0},
+		{"abandoned check", &connectionCheck{primaryHost: "b:27017", electedAt: elected, term: 7}, false, "a:27017", 0},
+		{"failover", &connectionCheck{primaryHost: "b:27017", electedAt: elected, term: 7}, true, "b:27017", 1},
+		{"same primary", &connectionCheck{primaryHost: "b:27017"}, true, "b:27017", 1},
+	}
+	for _, tt := range tests {
+		if tt.adopt {
+			c.adopt(tt.check)
+		}
+		state := primarySnapshot(c.name)
+		if state == nil || state.Host != tt.host || state.Failovers != tt.failovers {
+			t.Fatalf("%s: primary state = %+v, want %s after %d failover(s)", tt.name, state, tt.host, tt.failovers)
+		}
+	}
+	state := primarySnapshot(c.name)
+	if last := state.Recent[len(state.Recent)-1]; last.From != "a:27017" || !last.ElectedAt.Equal(elected) || last.Term != 7 || !state.Since.Equal(elected) {
+		t.Errorf("failover = %+v since %v, want a:27017 -> b:27017 elected %v in term 7", last, state.Since, elected)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// commandEvent is one driver command monitoring event. Only the command's
+// name is kept, never its body, so nothing sensitive ends up in incidents.
+type commandEvent struct {
+	Time       time.Time `json:"time"`
+	Probe      string    `json:"probe"`
+	Event      string    `json:"event"`
+	Command    string    `json:"command"`
+	Database   string    `json:"database,omitempty"`
+	Connection string    `json:"connection"`
+	RequestID  int64     `json:"request_id"`
+	DurationMS float64   `json:"duration_ms,omitempty"`
+	Failure    string    `json:"failure,omitempty"`
+}
+
+// commandRing holds the latest command events of one connection string.
+type commandRing struct {
+	events []commandEvent
+	next   int
+	full   bool
+}
+
+var (
+	commandLogSize   int
+	commandLogWindow time.Duration
+
+	commandLogMu sync.Mutex
+	commandLogs  = map[string]*commandRing{}
+)
+
+// loadCommandLogConfig reads COMMAND_LOG_SIZE, how many command events are
+// kept per cluster (default 500, 0 turns the log off), and
+// COMMAND_LOG_MINUTES, how far back from a failure they are copied into
+// the incident (default 5).
+func loadCommandLogConfig() {
+	commandLogSize = getEnvInt("COMMAND_LOG_SIZE", 500)
+	commandLogWindow = time.Duration(getEnvInt("COMMAND_LOG_MINUTES", 5)) * time.Minute
+}
+
+// commandMonitor records a probe client's commands in the log of its
+// connection string, alongside the cursor tracking.
+func commandMonitor(uri, probe string) *event.CommandMonitor {
+	cursors := cursorMonitor(probe)
+	if commandLogSize <= 0 {
+		return cursors
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			cursors.Started(ctx, evt)
+			recordCommand(uri, commandEvent{Probe: probe, Event: "started", Command: evt.CommandName, Database: evt.DatabaseName,
+				Connection: evt.ConnectionID, RequestID: evt.RequestID})
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			cursors.Succeeded(ctx, evt)
+			recordCommand(uri, commandEvent{Probe: probe, Event: "succeeded", Command: evt.CommandName,
+				Connection: evt.ConnectionID, RequestID: evt.RequestID, DurationMS: float64(evt.Duration.Microseconds()) / 1000})
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			cursors.Failed(ctx, evt)
+			recordCommand(uri, commandEvent{Probe: probe, Event: "failed", Command: evt.CommandName,
+				Connection: evt.ConnectionID, RequestID: evt.RequestID, DurationMS: float64(evt.Duration.Microseconds()) / 1000, Failure: evt.Failure})
+		},
+	}
+}
+
+func recordCommand(uri string, e commandEvent) {
+	e.Time = time.Now()
+	commandLogMu.Lock()
+	defer commandLogMu.Unlock()
+
+	ring, ok := commandLogs[uri]
+	if !ok {
+		ring = &commandRing{events: make([]commandEvent, commandLogSize)}
+		commandLogs[uri] = ring
+	}
+	ring.events[ring.next] = e
+	ring.next = (ring.next + 1) % commandLogSize
+	if ring.next == 0 {
+		ring.full = true
+	}
+}
+
+// recentCommands returns the events logged for uri since the given time,
+// oldest first.
+func recentCommands(uri string, since time.Time) []commandEvent {
+	commandLogMu.Lock()
+	defer commandLogMu.Unlock()
+
+	ring, ok := commandLogs[uri]
+	if !ok {
+		return nil
+	}
+	var ordered []commandEvent
+	if ring.full {
+		ordered = append(ordered, ring.events[ring.next:]...)
+	}
+	ordered = append(ordered, ring.events[:ring.next]...)
+	for i, e := range ordered {
+		if !e.Time.Before(since) {
+			return ordered[i:]
+		}
+	}
+	return nil
+}
+
+// recordIncidentCommands copies the commands of the minutes before a
+// failure into the target's open incident, for /status and the state file.
+func recordIncidentCommands(target, uri string) {
+	if commandLogSize <= 0 {
+		return
+	}
+	commands := recentCommands(uri, time.Now().Add(-commandLogWindow))
+
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+	if inc := incidents[target]; inc != nil {
+		inc.Commands = commands
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// Probe names used for per-probe concern overrides.
+const (
+	probeConnection  = "connection"
+	probeCredentials = "credentials"
+)
+
+// concernSettings overrides whatever write and read concern the URI implies.
+// Nil fields leave the URI's setting alone.
+type concernSettings struct {
+	writeConcern *writeconcern.WriteConcern
+	readConcern  *readconcern.ReadConcern
+}
+
+// concernReport is the effective write and read concern of a probe.
+type concernReport struct {
+	WriteConcern string `json:"write_concern"`
+	ReadConcern  string `json:"read_concern"`
+}
+
+var (
+	targetConcerns    concernSettings
+	probeConcerns     = map[string]concernSettings{}
+	effectiveConcerns = map[string]concernReport{}
+)
+
+// loadConcerns reads MONGODB_WRITE_CONCERN / MONGODB_READ_CONCERN for the
+// target and PROBE_<NAME>_WRITE_CONCERN / PROBE_<NAME>_READ_CONCERN for
+// individual probes.
+func loadConcerns() {
+	targetConcerns = readConcernEnv("MONGODB")
+	for _, probe := range []string{probeConnection, probeCredentials} {
+		probeConcerns[probe] = readConcernEnv("PROBE_" + strings.ToUpper(probe))
+	}
+}
+
+func readConcernEnv(prefix string) concernSettings {
+	var settings concernSettings
+	if spec := os.Getenv(prefix + "_WRITE_CONCERN"); spec != "" {
+		wc, err := parseWriteConcern(spec)
+		if err != nil {
+			log.Fatalf("Invalid %s_WRITE_CONCERN: %v", prefix, err)
+		}
+		settings.writeConcern = wc
+	}
+	if spec := os.Getenv(prefix + "_READ_CONCERN"); spec != "" {
+		rc, err := parseReadConcern(spec)
+		if err != nil {
+			log.Fatalf("Invalid %s_READ_CONCERN: %v", prefix, err)
+		}
+		settings.readConcern = rc
+	}
+	return settings
+}
+
+// parseWriteConcern accepts "majority", a node count such as "1", a tag set
+// name, or the long form "w=majority,j=true,wtimeout=5s".
+func parseWriteConcern(spec string) (*writeconcern.WriteConcern, error) {
+	wc := &writeconcern.WriteConcern{}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, hasKey := strings.Cut(strings.TrimSpace(part), "=")
+		if !hasKey {
+			key, value = "w", key
+		}
+		switch key {
+		case "w":
+			if n, err := strconv.Atoi(value); err == nil {
+				wc.W = n
+			} else {
+				wc.W = value
+			}
+		case "j":
+			j, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid j %q", value)
+			}
+			wc.Journal = &j
+		case "wtimeout":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid wtimeout %q", value)
+			}
+			wc.WTimeout = d
+		default:
+			return nil, fmt.Errorf("unknown write concern option %q", key)
+		}
+	}
+	if !wc.IsValid() {
+		return nil, fmt.Errorf("invalid write concern %q", spec)
+	}
+	return wc, nil
+}
+
+func parseReadConcern(spec string) (*readconcern.ReadConcern, error) {
+	switch spec {
+	case "local", "available", "majority", "linearizable", "snapshot":
+		return readconcern.New(readconcern.Level(spec)), nil
+	}
+	return nil, fmt.Errorf("unknown read concern level %q", spec)
+}
+
+// applyConcerns layers the target and probe overrides onto client options
+// already populated from the URI.
+func applyConcerns(opts *options.ClientOptions, probe string) {
+	for _, settings := range []concernSettings{targetConcerns, probeConcerns[probe]} {
+		if settings.writeConcern != nil {
+			opts.SetWriteConcern(settings.writeConcern)
+		}
+		if settings.readConcern != nil {
+			opts.SetReadConcern(settings.readConcern)
+		}
+	}
+}
+
+// reportConcerns records the effective concerns of every probe for /status.
+func reportConcerns(uri string) {
+	for probe := range probeConcerns {
+		opts := options.Client().ApplyURI(uri)
+		applyConcerns(opts, probe)
+		report := concernReport{
+			WriteConcern: describeWriteConcern(opts.WriteConcern),
+			ReadConcern:  describeReadConcern(opts.ReadConcern),
+		}
+		effectiveConcerns[probe] = report
+		log.Printf("Effective concerns for %s probe: write=%s read=%s\n", probe, report.WriteConcern, report.ReadConcern)
+	}
+}
+
+func describeWriteConcern(wc *writeconcern.WriteConcern) string {
+	if wc == nil {
+		return "server default"
+	}
+	parts := []string{fmt.Sprintf("w=%v", wc.W)}
+	if wc.W == nil {
+		parts[0] = "w=server default"
+	}
+	if wc.Journal != nil {
+		parts = append(parts, fmt.Sprintf("j=%v", *wc.Journal))
+	}
+	if wc.WTimeout > 0 {
+		parts = append(parts, fmt.Sprintf("wtimeout=%v", wc.WTimeout))
+	}
+	return strings.Join(parts, ",")
+}
+
+func describeReadConcern(rc *readconcern.ReadConcern) string {
+	if rc == nil || rc.Level == "" {
+		return "server default"
+	}
+	return rc.Level
+}
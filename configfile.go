@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A config file holds the same settings as the environment, nested:
+//
+//	check_interval_seconds: 30
+//	smtp:
+//	  host: smtp.example.com
+//	  port: 587
+//	webhook_urls: [https://hooks.example.com/a, https://hooks.example.com/b]
+//	clusters:
+//	  orders:
+//	    uri: mongodb+srv://orders.abc12.mongodb.net
+//	    interval_seconds: 60
+//
+// Keys are joined with underscores and upper-cased, so smtp.host becomes
+// SMTP_HOST, and lists become comma-separated values. Under clusters,
+// tenants and aws_accounts each entry also adds its name to CLUSTERS,
+// TENANTS or AWS_ACCOUNTS and uses the singular prefix (CLUSTER_ORDERS_URI).
+// Environment variables and .env win over the file.
+
+// configCollections maps collection keys to their list variable and the
+// prefix of their per-entry variables.
+var configCollections = map[string][2]string{
+	"clusters":     {"CLUSTERS", "CLUSTER"},
+	"tenants":      {"TENANTS", "TENANT"},
+	"aws_accounts": {"AWS_ACCOUNTS", "AWS_ACCOUNT"},
+}
+
+// configFilePath is CONFIG_FILE, or config.yaml when it exists.
+func configFilePath() string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	if _, err := os.Stat("config.yaml"); err == nil {
+		return "config.yaml"
+	}
+	return ""
+}
+
+// loadConfigFile sets the environment variables the file defines that are
+// not set already, and returns how many it set.
+func loadConfigFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var doc map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		doc, err = parseYAML(data)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	vars := map[string]string{}
+	if err := flattenConfig("", doc, vars); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	set := 0
+	for _, name := range names {
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		os.Setenv(name, vars[name])
+		set++
+	}
+	return set, nil
+}
+
+func flattenConfig(prefix string, value interface{}, vars map[string]string) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+			if collection, ok := configCollections[strings.ToLower(key)]; ok && prefix == "" {
+				entries, ok := child.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%s must map names to settings", key)
+				}
+				entryNames := make([]string, 0, len(entries))
+				for entry, settings := range entries {
+					entryNames = append(entryNames, entry)
+					entryPrefix := collection[1] + "_" + strings.ToUpper(strings.ReplaceAll(entry, "-", "_"))
+					if err := flattenConfig(entryPrefix, settings, vars); err != nil {
+						return err
+					}
+				}
+				sort.Strings(entryNames)
+				vars[collection[0]] = strings.Join(entryNames, ",")
+				continue
+			}
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			if err := flattenConfig(name, child, vars); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return fmt.Errorf("%s: lists may only hold plain values", prefix)
+			}
+			items = append(items, configScalar(item))
+		}
+		vars[prefix] = strings.Join(items, ",")
+	default:
+		if prefix == "" {
+			return fmt.Errorf("the file must hold a mapping of settings")
+		}
+		vars[prefix] = configScalar(v)
+	}
+	return nil
+}
+
+func configScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// parseYAML reads a YAML document whose top level is a mapping. Nested
+// mappings decode to map[string]interface{} and sequences, block or flow,
+// to []interface{}, as encoding/json does for JSON files.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
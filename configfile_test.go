@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  map[string]interface{}{},
+		},
+		{
+			name:  "scalars",
+			input: "uri: mongodb+srv://cluster0.example.net\ninterval: 30\nratio: 0.95\nenabled: true\nquoted: \"a: b\" # comment\n",
+			want: map[string]interface{}{
+				"uri": "mongodb+srv://cluster0.example.net", "interval": 30, "ratio": 0.95, "enabled": true, "quoted": "a: b",
+			},
+		},
+		{
+			name:  "nested mappings",
+			input: "alerts:\n  slack:\n    channel: ops\n",
+			want: map[string]interface{}{
+				"alerts": map[string]interface{}{"slack": map[string]interface{}{"channel": "ops"}},
+			},
+		},
+		{
+			name:  "block sequence",
+			input: "hosts:\n  - a.example.net\n  - b.example.net\n",
+			want:  map[string]interface{}{"hosts": []interface{}{"a.example.net", "b.example.net"}},
+		},
+		{
+			name:  "zero-indented sequence",
+			input: "hosts:\n- a.example.net\n- b.example.net\n",
+			want:  map[string]interface{}{"hosts": []interface{}{"a.example.net", "b.example.net"}},
+		},
+		{
+			name:  "flow collections",
+			input: "hosts: [a, b]\nlabels: {team: data, tier: 1}\n",
+			want: map[string]interface{}{
+				"hosts":  []interface{}{"a", "b"},
+				"labels": map[string]interface{}{"team": "data", "tier": 1},
+			},
+		},
+		{
+			name:  "sequence of mappings",
+			input: "clusters:\n  - name: east\n    uri: mongodb://east\n  - name: west\n",
+			want: map[string]interface{}{
+				"clusters": []interface{}{
+					map[string]interface{}{"name": "east", "uri": "mongodb://east"},
+					map[string]interface{}{"name": "west"},
+				},
+			},
+		},
+		{
+			name:    "top level sequence",
+			input:   "- a\n- b\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad indentation",
+			input:   "a:\n  b: 1\n c: 2\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseYAML() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseYAML() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML() =\n  %#v\nwant\n  %#v", got, tt.want)
+			}
+		})
+	}
+}
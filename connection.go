@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	connectionMode      string
+	coldConnectInterval time.Duration
+)
+
+// loadConnectionMode reads CONNECTION_MODE. "persistent" (the default)
+// keeps one client per cluster across checks, so its pooled connections sit
+// idle between checks the way an application's do and idle connection
+// problems on the endpoint show up; the client is replaced after a failed
+// check and, to keep exercising DNS, TCP and TLS setup, every
+// COLD_CONNECT_MINUTES (default 60, 0 for never). "cold" connects and
+// disconnects on every check.
+func loadConnectionMode() {
+	connectionMode = orString(os.Getenv("CONNECTION_MODE"), "persistent")
+	switch connectionMode {
+	case "persistent", "cold":
+	default:
+		log.Fatalf("Invalid CONNECTION_MODE %q: expected persistent or cold", connectionMode)
+	}
+	coldConnectInterval = time.Duration(getEnvInt("COLD_CONNECT_MINUTES", 60)) * time.Minute
+}
+
+// clientState is a cluster's client, kept across checks in persistent
+// mode. A check takes it over while it runs (see connectionCheck).
+type clientState struct {
+	client      *mongo.Client
+	clientOpts  *options.ClientOptions
+	connectedAt time.Time
+}
+
+// acquireClient returns the client for this check, connecting a new one
+// to uri when the mode or the cold connect schedule calls for it.
+func (s *clientState) acquireClient(ctx context.Context, uri string) (client *mongo.Client, opts *options.ClientOptions, cold bool, err error) {
+	if s.client != nil && connectionMode == "persistent" && (coldConnectInterval == 0 || time.Since(s.connectedAt) < coldConnectInterval) {
+		return s.client, s.clientOpts, false, nil
+	}
+	s.dropClient()
+
+	opts = newClientOptions(uri, probeConnection)
+	client, err = mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, nil, true, err
+	}
+	s.client, s.clientOpts, s.connectedAt = client, opts, time.Now()
+	return client, opts, true, nil
+}
+
+// releaseClient ends a check's use of the client. It is kept for the next
+// check unless the check failed or every check connects cold.
+func (s *clientState) releaseClient(failed bool) {
+	if failed || connectionMode == "cold" {
+		s.dropClient()
+	}
+}
+
+// dropClient forgets the client and disconnects it in the background, so
+// tearing down a dead connection counts neither towards the check's
+// latency nor the next check's.
+func (s *clientState) dropClient() {
+	if s.client == nil {
+		return
+	}
+	go closeClient(s.client, probeConnection)
+	s.client, s.clientOpts = nil, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	consulAddr        string
+	consulToken       string
+	consulServiceName string
+	consulServiceID   string
+
+	consulHTTPClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// loadConsulConfig reads CONSUL_HTTP_ADDR (e.g. http://127.0.0.1:8500),
+// CONSUL_HTTP_TOKEN, and CONSUL_SERVICE_NAME. The variable names match the
+// ones the consul CLI uses. CONSUL_TARGET_SERVICE additionally registers the
+// MongoDB target under that service name.
+func loadConsulConfig() {
+	consulAddr = strings.TrimSuffix(os.Getenv("CONSUL_HTTP_ADDR"), "/")
+	if consulAddr != "" && !strings.Contains(consulAddr, "://") {
+		consulAddr = "http://" + consulAddr
+	}
+	consulToken = os.Getenv("CONSUL_HTTP_TOKEN")
+	consulServiceName = os.Getenv("CONSUL_SERVICE_NAME")
+	if consulServiceName == "" {
+		consulServiceName = "mongodb-privatelink-monitor"
+	}
+	hostname, _ := os.Hostname()
+	consulServiceID = consulServiceName + "-" + hostname + "-" + targetName()
+	consulTargetService = os.Getenv("CONSUL_TARGET_SERVICE")
+}
+
+// consulRequest calls the local Consul agent's HTTP API.
+func consulRequest(method, path string, body interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, consulAddr+path, payload)
+	if err != nil {
+		return err
+	}
+	if consulToken != "" {
+		req.Header.Set("X-Consul-Token", consulToken)
+	}
+	resp, err := consulHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("consul returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// startServiceRegistration registers the HTTP API in Consul so status
+// aggregators can find every running monitor, tagged with the target and
+// tenant. Registration is repeated in the background so the service comes
+// back after an agent restart; the TCP check lets Consul drop monitors that
+// went away without deregistering.
+func startServiceRegistration() {
+	if consulAddr == "" || httpListenAddr == "" {
+		return
+	}
+
+	host, portStr, err := net.SplitHostPort(httpListenAddr)
+	if err != nil {
+		log.Printf("Cannot register in Consul, invalid HTTP_LISTEN_ADDR: %v\n", err)
+		return
+	}
+	port, _ := strconv.Atoi(portStr)
+	if advertise := os.Getenv("CONSUL_ADVERTISE_ADDR"); advertise != "" {
+		host = advertise
+	} else if host == "" || host == "0.0.0.0" || host == "::" {
+		// Let Consul fill in the agent's address
+		host = ""
+	}
+
+	scheme := "http"
+	if httpTLSEnabled() {
+		scheme = "https"
+	}
+	meta := map[string]string{"target": targetName(), "scheme": scheme}
+	tags := []string{"target-" + targetName()}
+	if ns := namespaceName(targetName()); ns != "" {
+		meta["namespace"] = ns
+		tags = append(tags, "namespace-"+ns)
+	}
+	checkAddr := net.JoinHostPort(host, portStr)
+	if host == "" {
+		checkAddr = net.JoinHostPort("127.0.0.1", portStr)
+	}
+
+	registration := map[string]interface{}{
+		"ID":      consulServiceID,
+		"Name":    consulServiceName,
+		"Address": host,
+		"Port":    port,
+		"Tags":    tags,
+		"Meta":    meta,
+		"Check": map[string]interface{}{
+			"Name":                           "HTTP API listening",
+			"TCP":                            checkAddr,
+			"Interval":                       "30s",
+			"DeregisterCriticalServiceAfter": "30m",
+		},
+	}
+
+	go func() {
+		lastErr := "never registered"
+		for {
+			err := consulRequest(http.MethodPut, "/v1/agent/service/register", registration)
+			if err != nil && err.Error() != lastErr {
+				log.Printf("Failed to register in Consul: %v\n", err)
+				lastErr = err.Error()
+			} else if err == nil && lastErr != "" {
+				log.Printf("Registered in Consul as %s (%s)\n", consulServiceID, consulServiceName)
+				lastErr = ""
+			}
+			time.Sleep(5 * time.Minute)
+		}
+	}()
+}
+
+var (
+	consulTargetService    string
+	consulTargetRegistered bool
+)
+
+func consulTargetCheckID() string {
+	return "mongodb-target-" + targetName()
+}
+
+// registerConsulTarget registers the MongoDB target itself as a Consul
+// service whose TTL check the monitor keeps up to date, so clients can fail
+// over on the monitor's verdict. If the monitor stops, the TTL runs out and
+// the target turns critical.
+func registerConsulTarget(uri string) error {
+	srvHost, hosts, err := parseSeedList(uri)
+	if err != nil {
+		return err
+	}
+	address := srvHost
+	port := 27017
+	if address == "" && len(hosts) > 0 {
+		host, portStr, err := net.SplitHostPort(hosts[0])
+		if err != nil {
+			return err
+		}
+		address = host
+		port, _ = strconv.Atoi(portStr)
+	}
+
+	registration := map[string]interface{}{
+		"ID":      consulTargetService + "-" + targetName(),
+		"Name":    consulTargetService,
+		"Address": address,
+		"Port":    port,
+		"Tags":    []string{"target-" + targetName()},
+		"Meta":    map[string]string{"target": targetName(), "monitor": consulServiceID},
+		"Check": map[string]interface{}{
+			"CheckID": consulTargetCheckID(),
+			"Name":    "PrivateLink connectivity from " + consulServiceID,
+			"TTL":     (3 * checkInterval).String(),
+		},
+	}
+	return consulRequest(http.MethodPut, "/v1/agent/service/register", registration)
+}
+
+// updateConsulTarget reports the cycle's verdict to the target's TTL check,
+// registering the service first if needed (including after an agent
+// restart has forgotten it).
+func updateConsulTarget(uri string, result checkResult, up bool) {
+	if consulAddr == "" || consulTargetService == "" {
+		return
+	}
+	if !consulTargetRegistered {
+		if err := registerConsulTarget(uri); err != nil {
+			logThrottled("Failed to register target in Consul", err)
+			return
+		}
+		consulTargetRegistered = true
+	}
+
+	// Follow the monitor's verdict rather than the raw result, so a failure
+	// it decided to re-check does not flip clients over
+	update := map[string]string{"Status": "passing", "Output": fmt.Sprintf("Connected in %.1fms", result.LatencyMS)}
+	if !up {
+		update = map[string]string{"Status": "critical", "Output": result.Error}
+	} else if result.Status != "up" {
+		update["Output"] = "Last check failed, re-checking: " + result.Error
+	} else if result.Health == healthDegraded {
+		update = map[string]string{"Status": "warning", "Output": fmt.Sprintf("Degraded, ping took %.1fms", result.PingMS)}
+	}
+	if err := consulRequest(http.MethodPut, "/v1/agent/check/update/"+consulTargetCheckID(), update); err != nil {
+		logThrottled("Failed to update Consul check", err)
+		consulTargetRegistered = false
+	}
+}
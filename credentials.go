@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const credentialEnvPrefix = "MONGODB_CREDENTIAL_"
+
+// credentialSet is a named username/password pair for the monitored cluster,
+// e.g. the old and new users while a password rotation is in progress.
+type credentialSet struct {
+	name     string
+	username string
+	password string
+}
+
+var (
+	credentialSets   []credentialSet
+	nextCredential   string
+	credentialStatus = map[string]bool{}
+)
+
+// loadCredentialSets reads MONGODB_CREDENTIAL_<NAME>=username:password
+// variables and the optional MONGODB_NEXT_CREDENTIAL=<NAME> marker.
+func loadCredentialSets() {
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, credentialEnvPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, credentialEnvPrefix)
+		username, pass, ok := strings.Cut(value, ":")
+		if name == "" || !ok || username == "" {
+			log.Fatalf("Invalid %s: expected username:password", key)
+		}
+		credentialSets = append(credentialSets, credentialSet{name: name, username: username, password: pass})
+	}
+	sort.Slice(credentialSets, func(i, j int) bool { return credentialSets[i].name < credentialSets[j].name })
+
+	nextCredential = os.Getenv("MONGODB_NEXT_CREDENTIAL")
+	if nextCredential == "" {
+		return
+	}
+	for _, cred := range credentialSets {
+		if cred.name == nextCredential {
+			return
+		}
+	}
+	log.Fatalf("MONGODB_NEXT_CREDENTIAL %q does not match any %s* variable", nextCredential, credentialEnvPrefix)
+}
+
+func checkCredentials(uri string) {
+	for _, cred := range credentialSets {
+		err := checkCredential(uri, cred)
+		wasWorking, seen := credentialStatus[cred.name]
+		credentialStatus[cred.name] = err == nil
+
+		if err != nil {
+			logThrottled(fmt.Sprintf("Credential set %s (user %s) failed to authenticate", cred.name, cred.username), err)
+		} else {
+			log.Printf("Credential set %s (user %s) authenticated successfully\n", cred.name, cred.username)
+		}
+
+		// Only the credentials about to become primary are worth waking someone up for
+		if cred.name != nextCredential {
+			continue
+		}
+		if err != nil && (!seen || wasWorking) {
+			sendAlert("MongoDB Next Credentials Failing",
+				tr("credentials.failing", "Credential set {name} (user {user}) can no longer authenticate: {error}", "name", cred.name, "user", cred.username, "error", err))
+		} else if err == nil && seen && !wasWorking {
+			sendRecovery("MongoDB Next Credentials Restored",
+				tr("credentials.restored", "Credential set {name} (user {user}) can authenticate again.", "name", cred.name, "user", cred.username))
+		}
+	}
+}
+
+func checkCredential(uri string, cred credentialSet) error {
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	defer cancel()
+
+	clientOpts := newClientOptions(uri, probeCredentials)
+
+	// Keep the auth source and mechanism from the URI, swap only the user
+	auth := options.Credential{}
+	if clientOpts.Auth != nil {
+		auth = *clientOpts.Auth
+	}
+	auth.Username = cred.username
+	auth.Password = cred.password
+	auth.PasswordSet = true
+	clientOpts.SetAuth(auth)
+
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return err
+	}
+	defer closeClient(client, probeCredentials)
+
+	// Authentication happens during the connection handshake, so a ping is enough
+	return client.Ping(ctx, readpref.Primary())
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+var overrunPolicy string
+
+func loadCycleConfig() {
+	overrunPolicy = os.Getenv("OVERRUN_POLICY")
+	switch overrunPolicy {
+	case "":
+		overrunPolicy = "skip"
+	case "skip", "queue":
+	default:
+		log.Fatalf("Invalid OVERRUN_POLICY %q: expected skip or queue", overrunPolicy)
+	}
+}
+
+// nextCycleDelay keeps cycles on a fixed schedule of one per interval.
+// When a cycle overruns its slot, "skip" waits for the next free slot and
+// "queue" starts the next cycle immediately.
+func nextCycleDelay(elapsed, interval time.Duration) time.Duration {
+	if elapsed <= interval {
+		return interval - elapsed
+	}
+
+	missed := int(elapsed / interval)
+	log.Printf("Check cycle overran: took %v with a %v interval (%d slot(s) missed, policy %s)\n",
+		elapsed.Round(time.Millisecond), interval, missed, overrunPolicy)
+
+	if overrunPolicy == "queue" {
+		return 0
+	}
+	recordSkippedCycles(missed)
+	return time.Duration(missed+1)*interval - elapsed
+}
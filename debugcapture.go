@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	debugCaptureEnabled bool
+	debugCaptureMax     time.Duration
+	debugCaptureRate    int
+
+	debugMu        sync.Mutex
+	debugTargets   = map[string]*time.Timer{}
+	debugSaveLevel slog.Level
+
+	// Rate cap on driver log lines, per minute
+	debugWindow     time.Time
+	debugLines      int
+	debugSuppressed int
+)
+
+// loadDebugCaptureConfig reads DEBUG_CAPTURE=true, which turns on debug
+// logging, driver logging and host probes on every check while an incident
+// is open, DEBUG_CAPTURE_MAX_MINUTES, after which a long incident goes back
+// to normal verbosity (default 30), and DEBUG_CAPTURE_LINES_PER_MINUTE,
+// the cap on driver log lines (default 600).
+func loadDebugCaptureConfig() {
+	debugCaptureEnabled = os.Getenv("DEBUG_CAPTURE") == "true"
+	debugCaptureMax = time.Duration(getEnvInt("DEBUG_CAPTURE_MAX_MINUTES", 30)) * time.Minute
+	debugCaptureRate = getEnvInt("DEBUG_CAPTURE_LINES_PER_MINUTE", 600)
+}
+
+// startDebugCapture raises the verbosity for the target's incident.
+func startDebugCapture(target string) {
+	if !debugCaptureEnabled {
+		return
+	}
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	if _, ok := debugTargets[target]; ok {
+		return
+	}
+	if len(debugTargets) == 0 {
+		debugSaveLevel = logLevel.Level()
+		logLevel.Set(slog.LevelDebug)
+	}
+	debugTargets[target] = time.AfterFunc(debugCaptureMax, func() {
+		log.Printf("Debug capture for %s reached its %v limit\n", target, debugCaptureMax)
+		stopDebugCapture(target)
+	})
+	log.Printf("Debug capture started for %s\n", target)
+}
+
+// stopDebugCapture goes back to the configured verbosity once no incident
+// needs the capture any more.
+func stopDebugCapture(target string) {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	timer, ok := debugTargets[target]
+	if !ok {
+		return
+	}
+	timer.Stop()
+	delete(debugTargets, target)
+	if len(debugTargets) == 0 {
+		logLevel.Set(debugSaveLevel)
+	}
+	log.Printf("Debug capture stopped for %s\n", target)
+}
+
+func debugCaptureActive() bool {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	return len(debugTargets) > 0
+}
+
+// applyDebugCapture adds driver logging to clients created during a
+// capture; the failing check drops its client, so the next one logs.
+func applyDebugCapture(opts *options.ClientOptions) {
+	if !debugCaptureActive() {
+		return
+	}
+	opts.SetLoggerOptions(options.Logger().
+		SetSink(driverLogSink{}).
+		SetComponentLevel(options.LogComponentAll, options.LogLevelDebug).
+		SetMaxDocumentLength(512))
+}
+
+// driverLogSink writes the driver's log to the monitor's, at most
+// DEBUG_CAPTURE_LINES_PER_MINUTE lines a minute.
+type driverLogSink struct{}
+
+func (driverLogSink) Info(_ int, msg string, keysAndValues ...interface{}) {
+	if debugAllowLine() {
+		slog.Log(context.Background(), slog.LevelDebug, "driver: "+msg, keysAndValues...)
+	}
+}
+
+func (driverLogSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if debugAllowLine() {
+		slog.Warn("driver: "+msg, append(keysAndValues, "error", err)...)
+	}
+}
+
+func debugAllowLine() bool {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	now := time.Now()
+	if now.Sub(debugWindow) >= time.Minute {
+		if debugSuppressed > 0 {
+			log.Printf("Debug capture dropped %d driver log line(s) over the %d/minute cap\n", debugSuppressed, debugCaptureRate)
+		}
+		debugWindow, debugLines, debugSuppressed = now, 0, 0
+	}
+	if debugLines >= debugCaptureRate {
+		debugSuppressed++
+		return false
+	}
+	debugLines++
+	return true
+}
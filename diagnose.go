@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/version"
+)
+
+const diagnoseTimeout = 30 * time.Second
+
+// Outcomes of a diagnostic step
+const (
+	diagnosePass = "pass"
+	diagnoseWarn = "warn"
+	diagnoseFail = "fail"
+	diagnoseSkip = "skip"
+)
+
+// diagnoseStep is one line of the diagnostic report.
+type diagnoseStep struct {
+	Name       string   `json:"name"`
+	Outcome    string   `json:"outcome"`
+	Detail     string   `json:"detail,omitempty"`
+	Items      []string `json:"items,omitempty"`
+	DurationMS float64  `json:"duration_ms"`
+}
+
+type diagnoseCluster struct {
+	Name  string         `json:"name"`
+	URI   string         `json:"uri"`
+	Steps []diagnoseStep `json:"steps"`
+}
+
+// diagnoseReport is the JSON artifact attached to support tickets.
+type diagnoseReport struct {
+	Time     time.Time         `json:"time"`
+	Version  string            `json:"version"`
+	Go       string            `json:"go"`
+	Driver   string            `json:"driver"`
+	Source   string            `json:"source,omitempty"`
+	FIPS     bool              `json:"fips"`
+	Clusters []diagnoseCluster `json:"clusters"`
+	Endpoint []diagnoseStep    `json:"endpoint,omitempty"`
+	Failed   int               `json:"failed"`
+}
+
+// runDiagnoseCommand implements `diagnose`: every probe the monitor has,
+// once, layer by layer, so that the first failing layer is plain to see.
+// Nothing is alerted and no state file is touched.
+func runDiagnoseCommand(args []string) error {
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	target := fs.String("target", "", "diagnose only this cluster")
+	source := fs.String("source", "", "connect from this local IP address or interface (default PROBE_SOURCE)")
+	out := fs.String("o", "", "write the JSON report to this file (default mongodb-diagnose-<time>.json, - for stdout)")
+	noColor := fs.Bool("no-color", false, "do not color the terminal report")
+	fs.Parse(args)
+
+	if *source != "" {
+		if err := setSourceBinding(*source); err != nil {
+			return err
+		}
+	}
+	alertsMuted = true
+	selected := clusters
+	if *target != "" {
+		c := findCluster(*target)
+		if c == nil {
+			return fmt.Errorf("unknown cluster %q", *target)
+		}
+		selected = []*cluster{c}
+	}
+
+	report := diagnoseReport{Time: time.Now(), Version: buildVersion, Go: runtime.Version(), Driver: version.Driver, FIPS: fipsMode}
+	if sourceIP != nil {
+		report.Source = describeSourceBinding()
+	}
+	for _, c := range selected {
+		report.Clusters = append(report.Clusters, c.diagnose())
+	}
+	report.Endpoint = diagnoseEndpoints()
+	for _, c := range report.Clusters {
+		report.Failed += countFailed(c.Steps)
+	}
+	report.Failed += countFailed(report.Endpoint)
+
+	color := !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	if *out != "-" {
+		printDiagnoseReport(os.Stdout, report, color)
+	}
+	if err := writeDiagnoseArtifact(*out, report); err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d step(s) failed", report.Failed)
+	}
+	return nil
+}
+
+// diagnose runs the cluster's steps in the order a connection goes
+// through them. Once a step leaves nothing to build on, the steps after it
+// are skipped instead of failing for the same reason.
+func (c *cluster) diagnose() diagnoseCluster {
+	d := diagnoseCluster{Name: c.name, URI: redactURI(c.uri)}
+	run := func(name string, fn func() diagnoseStep) {
+		start := time.Now()
+		step := fn()
+		step.Name = name
+		step.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+		d.Steps = append(d.Steps, step)
+	}
+	skip := func(name, why string) {
+		d.Steps = append(d.Steps, diagnoseStep{Name: name, Outcome: diagnoseSkip, Detail: why})
+	}
+
+	_, _, err := parseSeedList(c.uri)
+	if err != nil {
+		d.Steps = append(d.Steps, diagnoseStep{Name: "config", Outcome: diagnoseFail, Detail: err.Error()})
+		return d
+	}
+	useTLS := probeTLSConfig(c.uri) != nil
+
+	run("dns", func() diagnoseStep {
+		step := diagnoseStep{Outcome: diagnosePass}
+		lookups := trackDNS(c.uri)
+		if len(lookups) == 0 {
+			return diagnoseStep{Outcome: diagnoseSkip, Detail: "the connection string names no hosts to resolve"}
+		}
+		failed := 0
+		for _, l := range lookups {
+			if l.Error != "" {
+				failed++
+				step.Items = append(step.Items, fmt.Sprintf("%s %s: %s", l.Type, l.Name, l.Error))
+				continue
+			}
+			step.Items = append(step.Items, fmt.Sprintf("%s %s: %s (%.1fms)", l.Type, l.Name, strings.Join(l.Answers, ", "), l.LatencyMS))
+		}
+		step.Detail = fmt.Sprintf("%d of %d lookup(s) answered", len(lookups)-failed, len(lookups))
+		if failed > 0 {
+			step.Outcome = diagnoseFail
+		}
+		if public := publicAddresses(c.uri, lookups); len(public) > 0 {
+			step.Outcome = worseOutcome(step.Outcome, diagnoseWarn)
+			step.Items = append(step.Items, "resolves outside the private endpoint: "+strings.Join(public, ", "))
+		}
+		return step
+	})
+
+	probes := probeHosts(c.uri, replyHosts(c.topology, "hosts", "passives", "arbiters"))
+	layerStep := func(layer string) diagnoseStep {
+		step := diagnoseStep{Outcome: diagnosePass}
+		passed := 0
+		for _, p := range probes {
+			switch {
+			case p.Layer == layer:
+				step.Items = append(step.Items, p.Host+": "+p.Error)
+			case layer == "tcp" && p.Layer == "dns":
+				step.Items = append(step.Items, p.Host+": not resolved")
+			case layer == "tls" && p.Layer != "ok":
+				step.Items = append(step.Items, p.Host+": not reached")
+			default:
+				passed++
+				ms := p.TCPMS
+				if layer == "tls" {
+					ms = p.TLSMS
+				}
+				step.Items = append(step.Items, fmt.Sprintf("%s: %.1fms", p.Host, ms))
+			}
+		}
+		step.Detail = fmt.Sprintf("%d of %d host(s)", passed, len(probes))
+		switch {
+		case passed == 0:
+			step.Outcome = diagnoseFail
+		case passed < len(probes):
+			step.Outcome = diagnoseWarn
+		}
+		return step
+	}
+	run("tcp", func() diagnoseStep { return layerStep("tcp") })
+	if useTLS {
+		run("tls", func() diagnoseStep { return layerStep("tls") })
+	} else {
+		skip("tls", "the connection string does not use TLS")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+	defer cancel()
+	var client *mongo.Client
+	run("auth", func() diagnoseStep {
+		var err error
+		client, err = mongo.Connect(ctx, newClientOptions(c.uri, probeConnection))
+		if err == nil {
+			err = client.Ping(ctx, readpref.Primary())
+		}
+		if err != nil {
+			if client != nil {
+				closeClient(client, probeConnection)
+				client = nil
+			}
+			return diagnoseStep{Outcome: diagnoseFail, Detail: fmt.Sprintf("%s: %v", classifyError(err), err)}
+		}
+		var status bson.M
+		if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "connectionStatus", Value: 1}}).Decode(&status); err != nil {
+			return diagnoseStep{Outcome: diagnoseWarn, Detail: "connected, but connectionStatus failed: " + err.Error()}
+		}
+		var users []string
+		if info, ok := status["authInfo"].(bson.M); ok {
+			if list, ok := info["authenticatedUsers"].(bson.A); ok {
+				for _, u := range list {
+					if user, ok := u.(bson.M); ok {
+						users = append(users, fmt.Sprintf("%v@%v", user["user"], user["db"]))
+					}
+				}
+			}
+		}
+		if len(users) == 0 {
+			return diagnoseStep{Outcome: diagnoseWarn, Detail: "connected without authenticating"}
+		}
+		return diagnoseStep{Outcome: diagnosePass, Detail: "authenticated as " + strings.Join(users, ", ")}
+	})
+	if client == nil {
+		skip("topology", "not connected")
+		skip("read_write", "not connected")
+		return d
+	}
+	defer closeClient(client, probeConnection)
+
+	run("topology", func() diagnoseStep {
+		var topology bson.M
+		if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&topology); err != nil {
+			return diagnoseStep{Outcome: diagnoseFail, Detail: err.Error()}
+		}
+		step := diagnoseStep{Outcome: diagnosePass}
+		switch {
+		case topology["msg"] == "isdbgrid":
+			step.Detail = "sharded cluster, connected through mongos"
+		case topology["setName"] != nil:
+			step.Detail = fmt.Sprintf("replica set %v, primary %v", topology["setName"], topology["primary"])
+			if topology["primary"] == nil {
+				step.Outcome = diagnoseFail
+				step.Detail = fmt.Sprintf("replica set %v has no primary", topology["setName"])
+			}
+		default:
+			step.Detail = "standalone"
+		}
+		if hosts, ok := topology["hosts"].(bson.A); ok {
+			for _, h := range hosts {
+				step.Items = append(step.Items, fmt.Sprint(h))
+			}
+		}
+		return step
+	})
+
+	if canaryDB == "" {
+		skip("read_write", "CANARY_DB is not set")
+		return d
+	}
+	run("read_write", func() diagnoseStep {
+		write, read, err := c.runCanary(ctx, client)
+		if err != nil {
+			return diagnoseStep{Outcome: diagnoseFail, Detail: err.Error()}
+		}
+		return diagnoseStep{Outcome: diagnosePass, Detail: fmt.Sprintf("write %.1fms, read %.1fms in %s.%s",
+			float64(write.Microseconds())/1000, float64(read.Microseconds())/1000, canaryDB, canaryCollection)}
+	})
+	return d
+}
+
+// diagnoseEndpoints asks AWS and Atlas for the state of the private
+// endpoints, when either is configured.
+func diagnoseEndpoints() []diagnoseStep {
+	var steps []diagnoseStep
+	for _, account := range awsAccounts {
+		start := time.Now()
+		step := diagnoseStep{Name: "aws_endpoints:" + account.name, Outcome: diagnosePass}
+		if err := checkVPCEndpoints(account); err != nil {
+			step.Outcome, step.Detail = diagnoseFail, err.Error()
+		} else {
+			for _, e := range vpcEndpointSnapshot() {
+				if e.Account != account.name {
+					continue
+				}
+				item := e.ID + ": " + e.State
+				if e.State != "available" {
+					step.Outcome = diagnoseFail
+				}
+				for _, problem := range append(append([]string{}, e.Problems...), e.RuleProblems...) {
+					item += "; " + problem
+					step.Outcome = worseOutcome(step.Outcome, diagnoseWarn)
+				}
+				if e.Error != "" {
+					item += "; " + e.Error
+					step.Outcome = worseOutcome(step.Outcome, diagnoseWarn)
+				}
+				step.Items = append(step.Items, item)
+			}
+			step.Detail = fmt.Sprintf("%d endpoint(s)", len(step.Items))
+		}
+		step.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+		steps = append(steps, step)
+	}
+
+	if atlasConfigured() {
+		start := time.Now()
+		step := diagnoseStep{Name: "atlas_endpoints", Outcome: diagnosePass}
+		report := fetchAtlasEndpoints()
+		switch {
+		case report.Error != "":
+			step.Outcome, step.Detail = diagnoseFail, report.Error
+		case len(report.Services) == 0:
+			step.Outcome, step.Detail = diagnoseWarn, fmt.Sprintf("no %s private endpoint service in the project", atlasEndpointProvider)
+		}
+		for _, s := range report.Services {
+			if s.Status != "AVAILABLE" {
+				step.Outcome = diagnoseFail
+			}
+			step.Items = append(step.Items, fmt.Sprintf("service %s (%s): %s %s", s.ID, s.Region, s.Status, s.ErrorMessage))
+			for _, e := range s.Endpoints {
+				if e.Error != "" || e.Status != "AVAILABLE" {
+					step.Outcome = diagnoseFail
+				}
+				step.Items = append(step.Items, strings.TrimSpace(fmt.Sprintf("  %s: %s %s %s", e.ID, e.Status, e.ErrorMessage, e.Error)))
+			}
+		}
+		step.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func worseOutcome(a, b string) string {
+	rank := map[string]int{diagnoseSkip: 0, diagnosePass: 1, diagnoseWarn: 2, diagnoseFail: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+func countFailed(steps []diagnoseStep) int {
+	n := 0
+	for _, s := range steps {
+		if s.Outcome == diagnoseFail {
+			n++
+		}
+	}
+	return n
+}
+
+var diagnoseColors = map[string]string{
+	diagnosePass: "\033[32m",
+	diagnoseWarn: "\033[33m",
+	diagnoseFail: "\033[31m",
+	diagnoseSkip: "\033[90m",
+}
+
+func printDiagnoseReport(w io.Writer, report diagnoseReport, color bool) {
+	label := func(outcome string) string {
+		text := fmt.Sprintf("%-4s", strings.ToUpper(outcome))
+		if !color {
+			return text
+		}
+		return diagnoseColors[outcome] + text + "\033[0m"
+	}
+	printSteps := func(steps []diagnoseStep) {
+		for _, s := range steps {
+			fmt.Fprintf(w, "  [%s] %-14s %s", label(s.Outcome), s.Name, s.Detail)
+			if s.Outcome != diagnoseSkip {
+				fmt.Fprintf(w, " (%.0fms)", s.DurationMS)
+			}
+			fmt.Fprintln(w)
+			for _, item := range s.Items {
+				fmt.Fprintf(w, "         %s\n", item)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "mongodb-privatelink-connectivity-test %s diagnostics, %s\n", report.Version, report.Time.Format(time.RFC3339))
+	if report.Source != "" {
+		fmt.Fprintf(w, "Connecting from %s\n", report.Source)
+	}
+	for _, c := range report.Clusters {
+		fmt.Fprintf(w, "\nCluster %s (%s)\n", c.Name, c.URI)
+		printSteps(c.Steps)
+	}
+	if len(report.Endpoint) > 0 {
+		fmt.Fprintln(w, "\nPrivate endpoints")
+		printSteps(report.Endpoint)
+	}
+	fmt.Fprintln(w)
+}
+
+// writeDiagnoseArtifact writes the JSON report to path, or to a file named
+// after the report's time when path is empty.
+func writeDiagnoseArtifact(path string, report diagnoseReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if path == "" {
+		path = "mongodb-diagnose-" + report.Time.UTC().Format("20060102T150405Z") + ".json"
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	fmt.Printf("Report written to %s; attach it to support tickets.\n", path)
+	return nil
+}
+
+// redactURI drops the credentials from a connection string, so that the
+// report can be shared.
+func redactURI(uri string) string {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return uri
+	}
+	hosts, tail := rest, ""
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		hosts, tail = rest[:i], rest[i:]
+	}
+	if i := strings.LastIndex(hosts, "@"); i >= 0 {
+		hosts = "<credentials>@" + hosts[i+1:]
+	}
+	// AWS authentication can carry a session token in the options
+	path, query, _ := strings.Cut(tail, "?")
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		if key, _, ok := strings.Cut(param, "="); ok && strings.EqualFold(key, "authMechanismProperties") {
+			params[i] = key + "=<redacted>"
+		}
+	}
+	if query != "" {
+		path += "?" + strings.Join(params, "&")
+	}
+	return scheme + "://" + hosts + path
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
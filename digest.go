@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	digestEnabled bool
+	digestAt      int // minutes since midnight in NOTIFY_TIMEZONE
+)
+
+// loadDigestConfig reads DAILY_DIGEST=true and DAILY_DIGEST_TIME (default
+// 08:00, in NOTIFY_TIMEZONE).
+func loadDigestConfig() {
+	digestEnabled = os.Getenv("DAILY_DIGEST") == "true"
+	at, err := parseClock(orString(os.Getenv("DAILY_DIGEST_TIME"), "08:00"))
+	if err != nil {
+		log.Fatalf("Invalid DAILY_DIGEST_TIME: %v", err)
+	}
+	digestAt = at
+	if digestEnabled && !emailConfigured() {
+		log.Fatal("DAILY_DIGEST needs email configured (SMTP_HOST, SMTP_PORT, FROM_EMAIL, TO_EMAIL, EMAIL_PASSWORD)")
+	}
+}
+
+// startDigest emails the daily digest at DAILY_DIGEST_TIME. It goes to the
+// alert recipients directly rather than through the alert pipeline: it is
+// not an alert, and a quiet day should still produce one.
+func startDigest() {
+	if !digestEnabled {
+		return
+	}
+	go func() {
+		for {
+			next := nextDigestTime(time.Now())
+			time.Sleep(time.Until(next))
+			sendDigest(next)
+		}
+	}()
+}
+
+// nextDigestTime is the first DAILY_DIGEST_TIME after now.
+func nextDigestTime(now time.Time) time.Time {
+	local := now.In(scheduleLocation)
+	next := time.Date(local.Year(), local.Month(), local.Day(), digestAt/60, digestAt%60, 0, 0, scheduleLocation)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func sendDigest(until time.Time) {
+	subject, body := buildDigest(until)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := sendEmail(ctx, smtpHost, smtpPort, password, targetName(), subject, body); err != nil {
+		log.Printf("Failed to send daily digest: %v\n", err)
+		return
+	}
+	log.Printf("Daily digest sent: %s\n", subject)
+}
+
+// buildDigest summarizes the 24 hours before until for every cluster, with
+// latency compared to the 24 hours before that.
+func buildDigest(until time.Time) (subject, body string) {
+	since := until.Add(-24 * time.Hour)
+	var b strings.Builder
+	var outages int
+	worst := 100.0
+	for _, c := range clusters {
+		day := summarizeUptime(c.name, since, until, resultsBetween(c.name, since, until))
+		before := summarizeUptime(c.name, since.Add(-24*time.Hour), since, resultsBetween(c.name, since.Add(-24*time.Hour), since))
+		outages += day.Outages
+
+		fmt.Fprintf(&b, "%s\n", c.name)
+		if day.Checks == 0 {
+			b.WriteString(tr("digest.no_checks", "  no checks recorded\n\n"))
+			worst = 0
+			continue
+		}
+		worst = min(worst, day.UptimePercent)
+		b.WriteString(tr("digest.checks", "  checks    {checks} ({failed} failed)\n", "checks", day.Checks, "failed", day.FailedChecks))
+		b.WriteString(tr("digest.uptime", "  uptime    {uptime:%.3f}%\n", "uptime", day.UptimePercent))
+		b.WriteString(tr("digest.latency", "  latency   p50 {p50:%.1f}ms, p95 {p95:%.1f}ms, p99 {p99:%.1f}ms{trend}\n",
+			"p50", day.P50MS, "p95", day.P95MS, "p99", day.P99MS, "trend", latencyTrend(day, before)))
+		if len(day.OutageList) == 0 {
+			b.WriteString(tr("digest.no_outages", "  outages   none\n"))
+		} else {
+			b.WriteString(tr("digest.outages", "  outages   {outages}, {downtime} down in total\n",
+				"outages", day.Outages, "downtime", time.Duration(day.DowntimeSeconds*float64(time.Second)).Round(time.Second)))
+			for _, o := range day.OutageList {
+				end := o.End.In(scheduleLocation).Format("15:04")
+				if o.Ongoing {
+					end = tr("digest.ongoing", "ongoing")
+				}
+				fmt.Fprintf(&b, "    %s-%s  %v  %s\n", o.Start.In(scheduleLocation).Format("15:04"), end, o.duration.Round(time.Second), o.Class)
+			}
+		}
+		if historyDB == nil && day.firstCheck.After(since.Add(time.Hour)) {
+			b.WriteString(tr("digest.partial_history", "  (in-memory history only reaches back to {since}; set HISTORY_DB for full days)\n",
+				"since", day.firstCheck.In(scheduleLocation).Format("2006-01-02 15:04")))
+		}
+		b.WriteString("\n")
+	}
+
+	window := tr("digest.window", "{since} to {until}",
+		"since", since.In(scheduleLocation).Format("2006-01-02 15:04"), "until", until.In(scheduleLocation).Format("2006-01-02 15:04 MST"))
+	subject = tr("digest.subject", "MongoDB Daily Digest: {uptime:%.2f}% uptime, {outages} outage(s)", "uptime", worst, "outages", outages)
+	return subject, window + "\n\n" + b.String()
+}
+
+// latencyTrend compares the median with the previous day's, or says
+// nothing without one.
+func latencyTrend(day, before uptimeReport) string {
+	if before.Checks == 0 || before.P50MS == 0 {
+		return ""
+	}
+	change := 100 * (day.P50MS - before.P50MS) / before.P50MS
+	return tr("digest.trend", " (p50 {change:%+.0f}% vs the day before)", "change", change)
+}
+
+// resultsBetween returns a target's results in [since, until) from
+// HISTORY_DB, or from the in-memory history without one.
+func resultsBetween(target string, since, until time.Time) []checkResult {
+	if historyDB != nil {
+		results, err := storedResults(target, since, until, 0)
+		if err != nil {
+			log.Printf("Failed to read history of %s: %v\n", target, err)
+		}
+		return results
+	}
+	var results []checkResult
+	for _, result := range recentResults(target, 0) {
+		if !result.Time.Before(since) && result.Time.Before(until) {
+			results = append(results, result)
+		}
+	}
+	return results
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxDNSObservations = 100
+	maxDNSChanges      = 50
+)
+
+// dnsObservation is the answer set returned for one name at one point in time.
+type dnsObservation struct {
+	time    time.Time
+	name    string
+	rtype   uint16
+	ttl     uint32
+	answers []string
+}
+
+// dnsChange records an answer set flip for a name between two lookups.
+type dnsChange struct {
+	time time.Time
+	name string
+	old  []string
+	new  []string
+}
+
+var (
+	dnsMu      sync.Mutex
+	dnsHistory = map[string][]dnsObservation{}
+	dnsChanges []dnsChange
+)
+
+// parseSeedList extracts the host part of a connection string. For
+// mongodb+srv URIs it returns the SRV host name; otherwise the host:port seed
+// list with the default port filled in.
+func parseSeedList(uri string) (srvHost string, hosts []string, err error) {
+	var rest string
+	switch {
+	case strings.HasPrefix(uri, "mongodb+srv://"):
+		rest = strings.TrimPrefix(uri, "mongodb+srv://")
+	case strings.HasPrefix(uri, "mongodb://"):
+		rest = strings.TrimPrefix(uri, "mongodb://")
+	default:
+		return "", nil, fmt.Errorf("unsupported connection string scheme")
+	}
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	}
+
+	if strings.HasPrefix(uri, "mongodb+srv://") {
+		return rest, nil, nil
+	}
+	for _, host := range strings.Split(rest, ",") {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), "27017")
+		}
+		hosts = append(hosts, host)
+	}
+	return "", hosts, nil
+}
+
+// dnsLookup is one lookup made for a check, as included in its result.
+type dnsLookup struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Answers   []string `json:"answers,omitempty"`
+	LatencyMS float64  `json:"latency_ms"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// trackDNS looks up every name behind the connection string, records TTLs and
+// answer sets, and logs when an answer set changes. It returns the lookups
+// made, so failures can be told apart from DNS problems.
+func trackDNS(uri string) []dnsLookup {
+	srvHost, hosts, err := parseSeedList(uri)
+	if err != nil {
+		log.Printf("Failed to parse MongoDB URI for DNS tracking: %v\n", err)
+		return nil
+	}
+
+	var lookups []dnsLookup
+	if srvHost != "" {
+		srvRecords, lookup := observeDNS("_mongodb._tcp."+srvHost, dnsTypeSRV)
+		lookups = append(lookups, lookup)
+		_, lookup = observeDNS(srvHost, dnsTypeTXT)
+		lookups = append(lookups, lookup)
+		for _, record := range srvRecords {
+			if record.rtype == dnsTypeSRV {
+				hosts = append(hosts, record.value)
+			}
+		}
+	}
+
+	for _, hostPort := range hosts {
+		host, _, err := net.SplitHostPort(hostPort)
+		if err != nil || net.ParseIP(host) != nil {
+			continue
+		}
+		_, lookup := observeDNS(host, dnsTypeA)
+		lookups = append(lookups, lookup)
+	}
+	return lookups
+}
+
+func observeDNS(name string, rtype uint16) ([]dnsRecord, dnsLookup) {
+	start := time.Now()
+	records, err := dnsQuery(name, rtype)
+	lookup := dnsLookup{Name: name, Type: dnsTypeNames[rtype], LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		logThrottled(fmt.Sprintf("DNS %s lookup for %s failed", dnsTypeNames[rtype], name), err)
+		lookup.Error = err.Error()
+		return nil, lookup
+	}
+
+	obs := dnsObservation{time: time.Now(), name: name, rtype: rtype}
+	for i, record := range records {
+		if i == 0 || record.ttl < obs.ttl {
+			obs.ttl = record.ttl
+		}
+		obs.answers = append(obs.answers, dnsTypeNames[record.rtype]+" "+record.value)
+	}
+	sort.Strings(obs.answers)
+	lookup.Answers = obs.answers
+	log.Printf("DNS %s %s TTL=%ds answers=%v in %.1fms\n", dnsTypeNames[rtype], name, obs.ttl, obs.answers, lookup.LatencyMS)
+
+	key := dnsTypeNames[rtype] + " " + name
+	dnsMu.Lock()
+	defer dnsMu.Unlock()
+	history := dnsHistory[key]
+	if n := len(history); n > 0 && !slices.Equal(history[n-1].answers, obs.answers) {
+		change := dnsChange{time: obs.time, name: key, old: history[n-1].answers, new: obs.answers}
+		log.Printf("DNS CHANGE: %s changed from %v to %v\n", key, change.old, change.new)
+		dnsChanges = append(dnsChanges, change)
+		if len(dnsChanges) > maxDNSChanges {
+			dnsChanges = dnsChanges[len(dnsChanges)-maxDNSChanges:]
+		}
+	}
+	history = append(history, obs)
+	if len(history) > maxDNSObservations {
+		history = history[len(history)-maxDNSObservations:]
+	}
+	dnsHistory[key] = history
+
+	return records, lookup
+}
+
+// describeDNSLookups is the section of failure alerts showing what each
+// name resolved to during the failed check.
+func describeDNSLookups(lookups []dnsLookup) string {
+	if len(lookups) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(tr("dns.lookups", "DNS during this check:\n"))
+	for _, l := range lookups {
+		if l.Error != "" {
+			b.WriteString(tr("dns.lookup_failed", "  {type} {name} FAILED after {latency:%.1f}ms: {error}\n",
+				"type", l.Type, "name", l.Name, "latency", l.LatencyMS, "error", l.Error))
+			continue
+		}
+		b.WriteString(tr("dns.lookup", "  {type} {name} -> {answers} ({latency:%.1f}ms)\n",
+			"type", l.Type, "name", l.Name, "answers", strings.Join(l.Answers, ", "), "latency", l.LatencyMS))
+	}
+	return b.String()
+}
+
+// lastDNSChangeSummary describes the most recent DNS change for alerts.
+func lastDNSChangeSummary() string {
+	dnsMu.Lock()
+	defer dnsMu.Unlock()
+
+	if len(dnsChanges) == 0 {
+		return tr("dns.no_changes", "No DNS changes observed since the monitor started.")
+	}
+	change := dnsChanges[len(dnsChanges)-1]
+	return tr("dns.last_change", "Most recent DNS change ({ago} ago, at {at}): {name} changed from {old} to {new}",
+		"ago", time.Since(change.time).Round(time.Second), "at", change.time.Format("2006-01-02 15:04:05"), "name", change.name, "old", change.old, "new", change.new)
+}
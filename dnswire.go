@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// The standard resolver hides TTLs, so lookups that need them go over the
+// wire with this minimal DNS client.
+
+const (
+	dnsTypeA     uint16 = 1
+	dnsTypeCNAME uint16 = 5
+	dnsTypeTXT   uint16 = 16
+	dnsTypeAAAA  uint16 = 28
+	dnsTypeSRV   uint16 = 33
+	dnsTypeOPT   uint16 = 41
+
+	dnsTimeout = 5 * time.Second
+)
+
+var dnsTypeNames = map[uint16]string{
+	dnsTypeA:     "A",
+	dnsTypeCNAME: "CNAME",
+	dnsTypeTXT:   "TXT",
+	dnsTypeAAAA:  "AAAA",
+	dnsTypeSRV:   "SRV",
+}
+
+// dnsRecord is a single answer record, rendered as text.
+type dnsRecord struct {
+	rtype uint16
+	ttl   uint32
+	value string
+}
+
+var errNoSuchHost = errors.New("no such host")
+
+func dnsServerAddress() string {
+	if server := os.Getenv("DNS_SERVER"); server != "" {
+		if _, _, err := net.SplitHostPort(server); err == nil {
+			return server
+		}
+		return net.JoinHostPort(server, "53")
+	}
+
+	f, err := os.Open("/etc/resolv.conf")
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+func dnsQuery(name string, qtype uint16) ([]dnsRecord, error) {
+	id := uint16(rand.Intn(1 << 16))
+	query, err := buildDNSQuery(id, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("udp", dnsServerAddress(), dnsTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsTimeout))
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray responses to earlier queries
+		if n >= 2 && binary.BigEndian.Uint16(buf) == id {
+			return parseDNSResponse(buf[:n], qtype)
+		}
+	}
+}
+
+func buildDNSQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(msg[4:], 1)      // one question
+	binary.BigEndian.PutUint16(msg[10:], 1)     // one EDNS0 OPT record
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, 1) // class IN
+
+	// EDNS0 so large SRV answers fit in a single UDP response
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeOPT)
+	msg = binary.BigEndian.AppendUint16(msg, 4096)
+	msg = binary.BigEndian.AppendUint32(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+	return msg, nil
+}
+
+func parseDNSResponse(msg []byte, qtype uint16) ([]dnsRecord, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("short DNS response")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	switch rcode := flags & 0x000f; rcode {
+	case 0:
+	case 3:
+		return nil, errNoSuchHost
+	default:
+		return nil, fmt.Errorf("DNS server returned rcode %d", rcode)
+	}
+	if flags&0x0200 != 0 {
+		return nil, errors.New("truncated DNS response")
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		var err error
+		if _, off, err = readDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4
+	}
+
+	var records []dnsRecord
+	for i := 0; i < ancount; i++ {
+		var err error
+		if _, off, err = readDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, errors.New("short DNS answer")
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		ttl := binary.BigEndian.Uint32(msg[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, errors.New("short DNS record data")
+		}
+		rdata := msg[off : off+rdlen]
+
+		var value string
+		switch {
+		case rtype == dnsTypeCNAME:
+			value, _, err = readDNSName(msg, off)
+		case rtype != qtype:
+		case rtype == dnsTypeA && rdlen == 4, rtype == dnsTypeAAAA && rdlen == 16:
+			value = net.IP(rdata).String()
+		case rtype == dnsTypeSRV && rdlen > 6:
+			var target string
+			target, _, err = readDNSName(msg, off+6)
+			value = net.JoinHostPort(target, fmt.Sprint(binary.BigEndian.Uint16(rdata[4:])))
+		case rtype == dnsTypeTXT:
+			var parts []string
+			for p := 0; p < len(rdata); p += 1 + int(rdata[p]) {
+				end := min(p+1+int(rdata[p]), len(rdata))
+				parts = append(parts, string(rdata[p+1:end]))
+			}
+			value = strings.Join(parts, "")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			records = append(records, dnsRecord{rtype: rtype, ttl: ttl, value: value})
+		}
+		off += rdlen
+	}
+	return records, nil
+}
+
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("short DNS name")
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 20 {
+				return "", 0, errors.New("invalid DNS name compression")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errors.New("short DNS label")
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// driftReport is the result of the last comparison against the expected
+// Atlas cluster spec.
+type driftReport struct {
+	CheckedAt   time.Time `json:"checked_at"`
+	Differences []string  `json:"differences,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+var (
+	expectedSpecFile   string
+	expectedSpec       map[string]interface{}
+	driftCheckInterval time.Duration
+
+	driftMu   sync.Mutex
+	lastDrift *driftReport
+)
+
+// loadDriftConfig reads ATLAS_EXPECTED_SPEC_FILE, a JSON document holding
+// the subset of the Atlas cluster description that must not change, e.g.
+// {"replicationSpecs":[{"regionConfigs":[{"regionName":"US_EAST_1",
+// "electableSpecs":{"instanceSize":"M30"}}]}],"biConnector":{"enabled":false}}
+func loadDriftConfig() {
+	driftCheckInterval = time.Duration(getEnvInt("ATLAS_DRIFT_CHECK_MINUTES", 60)) * time.Minute
+	expectedSpecFile = os.Getenv("ATLAS_EXPECTED_SPEC_FILE")
+	if expectedSpecFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(expectedSpecFile)
+	if err != nil {
+		log.Fatalf("Failed to read ATLAS_EXPECTED_SPEC_FILE: %v", err)
+	}
+	if err := json.Unmarshal(data, &expectedSpec); err != nil {
+		log.Fatalf("Invalid ATLAS_EXPECTED_SPEC_FILE: %v", err)
+	}
+}
+
+// startDriftCheck compares the live cluster description with the expected
+// spec every ATLAS_DRIFT_CHECK_MINUTES.
+func startDriftCheck() {
+	if expectedSpec == nil {
+		return
+	}
+	if !atlasConfigured() || atlasClusterName == "" {
+		log.Println("ATLAS_EXPECTED_SPEC_FILE is set but the Atlas API or ATLAS_CLUSTER_NAME is not configured, drift detection disabled")
+		return
+	}
+	go func() {
+		for {
+			checkDrift()
+			time.Sleep(driftCheckInterval)
+		}
+	}()
+}
+
+func checkDrift() {
+	report := &driftReport{CheckedAt: time.Now()}
+	var cluster map[string]interface{}
+	if err := atlasRequest("GET", "/groups/"+atlasProjectID+"/clusters/"+atlasClusterName, nil, &cluster); err != nil {
+		log.Printf("Failed to fetch Atlas cluster configuration: %v\n", err)
+		report.Error = err.Error()
+	} else {
+		report.Differences = compareSpec("", expectedSpec, cluster)
+		sort.Strings(report.Differences)
+	}
+
+	driftMu.Lock()
+	previous := lastDrift
+	if report.Error != "" && previous != nil {
+		// Keep the last known drift state when the API is unreachable
+		report.Differences = previous.Differences
+	}
+	lastDrift = report
+	driftMu.Unlock()
+
+	if report.Error != "" {
+		return
+	}
+	before := ""
+	if previous != nil {
+		before = strings.Join(previous.Differences, "\n")
+	}
+	after := strings.Join(report.Differences, "\n")
+	if after == before {
+		return
+	}
+	if after != "" {
+		log.Printf("Atlas cluster configuration drift:\n%s\n", after)
+		sendAlert("MongoDB Atlas Configuration Drift",
+			tr("drift.detected", "Cluster {cluster} no longer matches {spec}:\n{differences}", "cluster", atlasClusterName, "spec", expectedSpecFile, "differences", after))
+	} else if previous != nil {
+		sendRecovery("MongoDB Atlas Configuration Drift Resolved",
+			tr("drift.resolved", "Cluster {cluster} matches {spec} again.", "cluster", atlasClusterName, "spec", expectedSpecFile))
+	}
+}
+
+// compareSpec reports every value in expected that is missing or different
+// in actual. Fields the spec does not mention are ignored.
+func compareSpec(path string, expected, actual interface{}) []string {
+	switch want := expected.(type) {
+	case map[string]interface{}:
+		have, _ := actual.(map[string]interface{})
+		var diffs []string
+		for key, value := range want {
+			diffs = append(diffs, compareSpec(joinSpecPath(path, key), value, have[key])...)
+		}
+		return diffs
+	case []interface{}:
+		have, _ := actual.([]interface{})
+		var diffs []string
+		for i, value := range want {
+			var item interface{}
+			if i < len(have) {
+				item = have[i]
+			}
+			diffs = append(diffs, compareSpec(joinSpecPath(path, strconv.Itoa(i)), value, item)...)
+		}
+		return diffs
+	default:
+		if fmt.Sprint(expected) != fmt.Sprint(actual) {
+			if actual == nil {
+				return []string{tr("drift.missing", "{path}: expected {expected}, missing", "path", path, "expected", expected)}
+			}
+			return []string{tr("drift.different", "{path}: expected {expected}, found {actual}", "path", path, "expected", expected, "actual", actual)}
+		}
+		return nil
+	}
+}
+
+func joinSpecPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func driftSnapshot() *driftReport {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	return lastDrift
+}
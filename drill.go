@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// drillReport is the outcome of a failover drill. Detection and recovery are
+// measured from the moment Atlas accepted the test failover request.
+type drillReport struct {
+	Cluster           string    `json:"cluster"`
+	RequestedAt       time.Time `json:"requested_at"`
+	OldPrimary        string    `json:"old_primary"`
+	NewPrimary        string    `json:"new_primary,omitempty"`
+	FirstFailureAt    time.Time `json:"first_failure_at,omitempty"`
+	PrimaryChangedAt  time.Time `json:"primary_changed_at,omitempty"`
+	RecoveredAt       time.Time `json:"recovered_at,omitempty"`
+	DetectionSeconds  float64   `json:"detection_seconds,omitempty"`
+	RecoverySeconds   float64   `json:"recovery_seconds,omitempty"`
+	DisruptionSeconds float64   `json:"disruption_seconds"`
+	FailedProbes      int       `json:"failed_probes"`
+	TotalProbes       int       `json:"total_probes"`
+	FirstError        string    `json:"first_error,omitempty"`
+	Completed         bool      `json:"completed"`
+}
+
+// runDrillCommand implements `drill`: ask Atlas for a test primary failover
+// and time the disruption as seen through the private endpoint.
+func runDrillCommand(args []string) error {
+	fs := flag.NewFlagSet("drill", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 20*time.Minute, "give up if the failover has not completed by then")
+	interval := fs.Duration("interval", time.Second, "probe interval during the drill")
+	reportPath := fs.String("report", "", "write the JSON drill report to this file")
+	fs.Parse(args)
+
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		return errors.New("MONGODB_URI not set in .env file")
+	}
+	if atlasClusterName == "" {
+		return errors.New("ATLAS_CLUSTER_NAME is required for a failover drill")
+	}
+
+	clientOpts := newClientOptions(uri, "drill").SetServerSelectionTimeout(*interval * 2)
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	client, err := mongo.Connect(ctx, clientOpts)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer closeClient(client, "drill")
+
+	oldPrimary, err := drillPrimary(client, *interval*2)
+	if err != nil {
+		return fmt.Errorf("cluster is not healthy before the drill: %w", err)
+	}
+
+	report := drillReport{Cluster: atlasClusterName, OldPrimary: oldPrimary}
+	fmt.Printf("Requesting test failover of %s (primary %s)\n", atlasClusterName, oldPrimary)
+	log.Printf("Failover drill: requesting test failover of %s, primary %s\n", atlasClusterName, oldPrimary)
+	if err := atlasRequest("POST", "/groups/"+atlasProjectID+"/clusters/"+atlasClusterName+"/restartPrimaries", nil, nil); err != nil {
+		return err
+	}
+	report.RequestedAt = time.Now()
+
+	deadline := report.RequestedAt.Add(*timeout)
+	for time.Now().Before(deadline) {
+		probeStart := time.Now()
+		primary, err := drillPrimary(client, *interval*2)
+		report.TotalProbes++
+
+		switch {
+		case err != nil:
+			report.FailedProbes++
+			if report.FirstFailureAt.IsZero() {
+				report.FirstFailureAt = probeStart
+				report.FirstError = err.Error()
+				fmt.Printf("Disruption detected after %v: %v\n", probeStart.Sub(report.RequestedAt).Round(time.Millisecond), err)
+			}
+		case primary != oldPrimary:
+			if report.PrimaryChangedAt.IsZero() {
+				report.PrimaryChangedAt = probeStart
+				report.NewPrimary = primary
+				fmt.Printf("New primary %s after %v\n", primary, probeStart.Sub(report.RequestedAt).Round(time.Millisecond))
+			}
+			report.RecoveredAt = probeStart
+			report.Completed = true
+		}
+		if report.Completed {
+			break
+		}
+		time.Sleep(time.Until(probeStart.Add(*interval)))
+	}
+
+	if !report.FirstFailureAt.IsZero() {
+		report.DetectionSeconds = report.FirstFailureAt.Sub(report.RequestedAt).Seconds()
+	}
+	if report.Completed {
+		report.RecoverySeconds = report.RecoveredAt.Sub(report.RequestedAt).Seconds()
+		if !report.FirstFailureAt.IsZero() {
+			report.DisruptionSeconds = report.RecoveredAt.Sub(report.FirstFailureAt).Seconds()
+		}
+	}
+
+	data, _ := json.MarshalIndent(report, "", "  ")
+	log.Printf("Failover drill report: %s\n", data)
+	fmt.Printf("%s\n", data)
+	if *reportPath != "" {
+		if err := os.WriteFile(*reportPath, data, 0644); err != nil {
+			return err
+		}
+	}
+	if !report.Completed {
+		return fmt.Errorf("primary did not change within %v", *timeout)
+	}
+	return nil
+}
+
+// drillPrimary pings the primary and returns its address as reported by hello.
+func drillPrimary(client *mongo.Client, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		return "", err
+	}
+	var hello bson.M
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return "", err
+	}
+	primary, _ := hello["primary"].(string)
+	if primary == "" {
+		return "", errors.New("hello did not report a primary")
+	}
+	return primary, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// emailNotifier sends alerts through an SMTP server.
+type emailNotifier struct {
+	name     string
+	host     string
+	port     string
+	password string
+}
+
+func init() {
+	registerNotifier("email", func() Notifier {
+		if !emailConfigured() {
+			return nil
+		}
+		return &emailNotifier{name: "email", host: smtpHost, port: smtpPort, password: password}
+	})
+	registerNotifier("email-backup", func() Notifier {
+		host := os.Getenv("SMTP_BACKUP_HOST")
+		if host == "" || !emailConfigured() {
+			return nil
+		}
+		return &emailNotifier{
+			name:     "email-backup",
+			host:     host,
+			port:     orString(os.Getenv("SMTP_BACKUP_PORT"), smtpPort),
+			password: orString(os.Getenv("SMTP_BACKUP_PASSWORD"), password),
+		}
+	})
+}
+
+// emailConfigured reports whether email alerting is set up. Email is one
+// channel among others and may be left out entirely, but settings given
+// only in part are a mistake worth stopping for.
+func emailConfigured() bool {
+	settings := []string{smtpHost, smtpPort, fromEmail, toEmail, password}
+	set := 0
+	for _, s := range settings {
+		if s != "" {
+			set++
+		}
+	}
+	if set > 0 && set < len(settings) {
+		log.Fatal("Email configuration is incomplete: SMTP_HOST, SMTP_PORT, FROM_EMAIL, TO_EMAIL and EMAIL_PASSWORD go together")
+	}
+	return set == len(settings)
+}
+
+func (e *emailNotifier) Name() string { return e.name }
+
+func (e *emailNotifier) Send(ctx context.Context, alert Alert) error {
+	err := sendEmail(ctx, e.host, e.port, e.password, alert.Target, alert.Subject, alert.Body)
+	var phaseErr *smtpPhaseError
+	if errors.As(err, &phaseErr) {
+		recordSMTPFailure(e.name, phaseErr.Phase)
+		slog.Error("SMTP delivery failed", "channel", e.name, "host", e.host, "port", e.port, "phase", phaseErr.Phase, "error", phaseErr.Err)
+	}
+	return err
+}
+
+func (e *emailNotifier) Test(ctx context.Context) error {
+	return testSMTP(e.host, e.port, e.password)
+}
+
+// smtpPhaseError names the step of the SMTP dialogue that failed: dns,
+// connect, greeting, ehlo, starttls, auth, envelope, data or quit.
+type smtpPhaseError struct {
+	Phase string
+	Err   error
+}
+
+func (e *smtpPhaseError) Error() string { return "SMTP " + e.Phase + ": " + e.Err.Error() }
+func (e *smtpPhaseError) Unwrap() error { return e.Err }
+
+// sendEmail walks the same dialogue as smtp.SendMail one step at a time so
+// a failure says where it happened rather than just what the server said.
+func sendEmail(ctx context.Context, host, port, password, target, subject, body string) error {
+	to := alertRecipients(target)
+	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	msg := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\nDate: %s\r\nIndex: %s\r\n%s", strings.Join(to, ", "), subject, currentTime, target, body))
+
+	fail := func(phase string, err error) error { return &smtpPhaseError{Phase: phase, Err: err} }
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return fail("dns", err)
+	}
+	var dialer net.Dialer
+	var conn net.Conn
+	for _, addr := range addrs {
+		if conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, port)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fail("connect", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fail("greeting", err)
+	}
+	defer c.Close()
+
+	if err := c.Hello("localhost"); err != nil {
+		return fail("ehlo", err)
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(fipsTLS(&tls.Config{ServerName: host})); err != nil {
+			return fail("starttls", err)
+		}
+	}
+	if ok, _ := c.Extension("AUTH"); ok {
+		if err := c.Auth(smtp.PlainAuth("", fromEmail, password, host)); err != nil {
+			return fail("auth", err)
+		}
+	}
+	if err := c.Mail(fromEmail); err != nil {
+		return fail("envelope", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fail("envelope", fmt.Errorf("RCPT TO %s: %w", rcpt, err))
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fail("data", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fail("data", err)
+	}
+	if err := w.Close(); err != nil {
+		return fail("data", err)
+	}
+	if err := c.Quit(); err != nil {
+		return fail("quit", err)
+	}
+	return nil
+}
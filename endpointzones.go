@@ -0,0 +1,186 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// endpointZone is the part of a VPC endpoint in one availability zone: its
+// network interface and the zonal DNS name pointing at it.
+type endpointZone struct {
+	Zone      string   `json:"zone"`
+	ENI       string   `json:"eni,omitempty"`
+	ENIStatus string   `json:"eni_status,omitempty"`
+	IP        string   `json:"ip,omitempty"`
+	DNSName   string   `json:"dns_name,omitempty"`
+	Resolved  []string `json:"resolved,omitempty"`
+}
+
+// checkEndpointZones verifies that the endpoint has an in-use network
+// interface in every expected zone, that each zone's DNS name resolves to
+// that interface, and that the regional DNS name still returns every
+// zone's address. Findings go to status.Problems.
+func checkEndpointZones(account *awsAccount, status, previous *vpcEndpointStatus) error {
+	interfaces, err := describeNetworkInterfaces(account, status.enis)
+	if err != nil {
+		return err
+	}
+	sort.Slice(interfaces, func(i, j int) bool { return interfaces[i].Zone < interfaces[j].Zone })
+
+	status.ExpectedZones = account.zones
+	if len(status.ExpectedZones) == 0 && previous != nil {
+		status.ExpectedZones = previous.ExpectedZones
+	}
+	if len(status.ExpectedZones) == 0 {
+		for _, z := range interfaces {
+			status.ExpectedZones = append(status.ExpectedZones, z.Zone)
+		}
+	}
+
+	var regionalAnswers []string
+	for _, name := range status.dnsNames {
+		if zonalDNSZone(name) == "" && strings.HasPrefix(name, status.ID+"-") {
+			status.RegionalDNS = name
+		}
+	}
+	if status.RegionalDNS == "" {
+		status.Problems = append(status.Problems, tr("endpoint.zones.no_regional_name", "no regional DNS name"))
+	} else if regionalAnswers, err = resolveA(status.RegionalDNS); err != nil {
+		status.Problems = append(status.Problems, tr("endpoint.zones.regional_unresolved", "regional name {name} does not resolve: {error}", "name", status.RegionalDNS, "error", err))
+	}
+
+	for _, zone := range interfaces {
+		if !slices.Contains(status.ExpectedZones, zone.Zone) {
+			log.Printf("VPC endpoint %s has a network interface in unexpected zone %s\n", status.ID, zone.Zone)
+		}
+		for _, name := range status.dnsNames {
+			if zonalDNSZone(name) == zone.Zone {
+				zone.DNSName = name
+			}
+		}
+
+		switch {
+		case zone.ENIStatus != "in-use":
+			status.Problems = append(status.Problems, tr("endpoint.zones.interface_state", "{zone}: network interface {eni} is {state}", "zone", zone.Zone, "eni", zone.ENI, "state", zone.ENIStatus))
+		case zone.DNSName == "":
+			status.Problems = append(status.Problems, tr("endpoint.zones.no_zonal_name", "{zone}: no zonal DNS name", "zone", zone.Zone))
+		default:
+			zone.Resolved, err = resolveA(zone.DNSName)
+			if err != nil {
+				status.Problems = append(status.Problems, tr("endpoint.zones.zonal_unresolved", "{zone}: {name} does not resolve: {error}", "zone", zone.Zone, "name", zone.DNSName, "error", err))
+			} else if !slices.Contains(zone.Resolved, zone.IP) {
+				status.Problems = append(status.Problems, tr("endpoint.zones.zonal_mismatch", "{zone}: {name} resolves to {resolved}, not the interface address {ip}",
+					"zone", zone.Zone, "name", zone.DNSName, "resolved", strings.Join(zone.Resolved, ","), "ip", zone.IP))
+			}
+		}
+		if regionalAnswers != nil && zone.IP != "" && !slices.Contains(regionalAnswers, zone.IP) {
+			status.Problems = append(status.Problems, tr("endpoint.zones.regional_missing", "{zone}: regional name no longer returns {ip}", "zone", zone.Zone, "ip", zone.IP))
+		}
+		status.Zones = append(status.Zones, zone)
+	}
+
+	for _, expected := range status.ExpectedZones {
+		if !slices.ContainsFunc(interfaces, func(z endpointZone) bool { return z.Zone == expected }) {
+			status.Problems = append(status.Problems, tr("endpoint.zones.no_interface", "{zone}: no network interface", "zone", expected))
+		}
+	}
+	return nil
+}
+
+var zonalLabelPattern = regexp.MustCompile(`-([a-z]{2}(?:-gov)?-[a-z]+-[0-9]+[a-z])$`)
+
+// zonalDNSZone returns the zone of a zonal endpoint DNS name, such as
+// us-east-1a for vpce-0abc-1def-us-east-1a.vpce-svc-0123.us-east-1.vpce.amazonaws.com,
+// or "" for the regional name.
+func zonalDNSZone(name string) string {
+	label, _, _ := strings.Cut(name, ".")
+	if m := zonalLabelPattern.FindStringSubmatch(label); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func resolveA(name string) ([]string, error) {
+	records, err := dnsQuery(name, dnsTypeA)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, record := range records {
+		if record.rtype == dnsTypeA {
+			addresses = append(addresses, record.value)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, errNoSuchHost
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// alertEndpointZones alerts when the zone problems of an available endpoint
+// change, e.g. when a zone's interface or DNS entry disappears.
+func alertEndpointZones(status, previous *vpcEndpointStatus) {
+	if status.State != "available" || status.Error != "" {
+		return
+	}
+	before := ""
+	if previous != nil {
+		before = strings.Join(previous.Problems, "\n")
+	}
+	after := strings.Join(status.Problems, "\n")
+	if after == before {
+		return
+	}
+	if after != "" {
+		log.Printf("VPC endpoint %s zone problems:\n%s\n", status.ID, after)
+		sendAlert("PrivateLink Endpoint Zones Degraded",
+			tr("endpoint.zones.degraded", "VPC endpoint {id} in AWS account {account} (zones {zones}):\n{problems}",
+				"id", status.ID, "account", status.Account, "zones", strings.Join(status.ExpectedZones, ", "), "problems", after))
+	} else if previous != nil && previous.State == "available" {
+		sendRecovery("PrivateLink Endpoint Zones Healthy Again",
+			tr("endpoint.zones.healthy", "VPC endpoint {id} in AWS account {account} serves every expected zone again.", "id", status.ID, "account", status.Account))
+	}
+}
+
+// describeNetworkInterfaces returns the zone, status, and address of the
+// endpoint's network interfaces that still exist.
+func describeNetworkInterfaces(account *awsAccount, ids []string) ([]endpointZone, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	creds, err := account.credentials()
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{
+		"Action":        {"DescribeNetworkInterfaces"},
+		"Version":       {"2016-11-15"},
+		"Filter.1.Name": {"network-interface-id"},
+	}
+	for i, id := range ids {
+		params.Set("Filter.1.Value."+strconv.Itoa(i+1), id)
+	}
+	var out struct {
+		Interfaces []struct {
+			ID     string `xml:"networkInterfaceId"`
+			Zone   string `xml:"availabilityZone"`
+			Status string `xml:"status"`
+			IP     string `xml:"privateIpAddress"`
+		} `xml:"networkInterfaceSet>item"`
+	}
+	host := "ec2." + account.region + ".amazonaws.com"
+	if err := awsQueryRequest(creds, account.region, "ec2", host, params, &out); err != nil {
+		return nil, err
+	}
+	var zones []endpointZone
+	for _, i := range out.Interfaces {
+		zones = append(zones, endpointZone{Zone: i.Zone, ENI: i.ID, ENIStatus: i.Status, IP: i.IP})
+	}
+	return zones, nil
+}
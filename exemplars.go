@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Each check's trace ID is logged with the check and carried in its result.
+// When tracing is configured, the latency histogram keeps the trace ID of
+// the latest observation in every bucket as an OpenMetrics exemplar, so a
+// spike on a dashboard leads straight to the trace of the slow check.
+
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type exemplar struct {
+	traceID string
+	value   float64
+	time    time.Time
+}
+
+// latencyHistogram is a cumulative histogram of check latencies. Guarded by
+// telemetryMu.
+type latencyHistogram struct {
+	counts    []uint64
+	exemplars []exemplar
+	sum       float64
+	count     uint64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{
+		counts:    make([]uint64, len(latencyBuckets)+1),
+		exemplars: make([]exemplar, len(latencyBuckets)+1),
+	}
+}
+
+// histogramSample is one labeled histogram of a family.
+type histogramSample struct {
+	labels string
+	h      *latencyHistogram
+}
+
+func (h *latencyHistogram) observe(seconds float64, traceID string, at time.Time) {
+	i := len(latencyBuckets)
+	for j, le := range latencyBuckets {
+		if seconds <= le {
+			i = j
+			break
+		}
+	}
+	h.counts[i]++
+	h.exemplars[i] = exemplar{traceID: traceID, value: seconds, time: at}
+	h.sum += seconds
+	h.count++
+}
+
+// openMetricsWriter marks a metrics writer that renders OpenMetrics instead
+// of the classic Prometheus text format.
+type openMetricsWriter struct {
+	io.Writer
+}
+
+func isOpenMetrics(w io.Writer) bool {
+	_, ok := w.(openMetricsWriter)
+	return ok
+}
+
+// familyName is the name a family is declared under. OpenMetrics declares
+// counters without the _total suffix their samples carry.
+func familyName(w io.Writer, name, kind string) string {
+	if kind == "counter" && isOpenMetrics(w) {
+		return strings.TrimSuffix(name, "_total")
+	}
+	return name
+}
+
+func writeHistogram(w io.Writer, name, help string, samples []histogramSample) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, sample := range samples {
+		writeHistogramSample(w, name, sample.labels, sample.h)
+	}
+}
+
+func writeHistogramSample(w io.Writer, name, labels string, h *latencyHistogram) {
+	prefix := ""
+	if labels != "" {
+		prefix = labels + ","
+	}
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i]
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = fmt.Sprint(latencyBuckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d", name, prefix, le, cumulative)
+		if ex := h.exemplars[i]; ex.traceID != "" && isOpenMetrics(w) {
+			fmt.Fprintf(w, " # {trace_id=%q} %g %.3f", ex.traceID, ex.value, float64(ex.time.UnixMilli())/1000)
+		}
+		fmt.Fprintln(w)
+	}
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n%s_count%s %d\n", name, labels, h.sum, name, labels, h.count)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// failover is one change of primary seen between checks.
+type failover struct {
+	DetectedAt time.Time `json:"detected_at"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	ElectedAt  time.Time `json:"elected_at,omitempty"`
+	Term       int64     `json:"term,omitempty"`
+}
+
+// primaryState is the primary a cluster's checks last saw.
+type primaryState struct {
+	Host      string     `json:"host"`
+	Since     time.Time  `json:"since"`
+	Failovers int        `json:"failovers"`
+	Recent    []failover `json:"recent,omitempty"`
+}
+
+// maxRecentFailovers is how many failovers the status keeps per cluster.
+const maxRecentFailovers = 10
+
+var (
+	failoverMu sync.Mutex
+	primaries  = map[string]*primaryState{}
+)
+
+// observePrimary reads the primary named in the isMaster reply and, when
+// it is not the one recorded for the cluster, when it was elected. It
+// records nothing; trackPrimary does once the check is adopted.
+func (c *cluster) observePrimary(ctx context.Context, client *mongo.Client, topology bson.M) (host string, electedAt time.Time, term int64) {
+	host, _ = topology["primary"].(string)
+	if host == "" {
+		return "", time.Time{}, 0
+	}
+	failoverMu.Lock()
+	state := primaries[c.name]
+	changed := state != nil && state.Host != host
+	failoverMu.Unlock()
+	if changed {
+		electedAt, term = electionInfo(ctx, client, host)
+	}
+	return host, electedAt, term
+}
+
+// trackPrimary compares the primary a check saw with the one seen by the
+// previous check and sends an informational alert when it changed.
+// Elections are routine, but they close connections and fail in-flight
+// writes, so they are worth lining up against connection blips. Replies
+// without a primary (mongos, or mid-election) leave the last known primary
+// in place.
+func (c *cluster) trackPrimary(host string, electedAt time.Time, term int64) {
+	if host == "" {
+		return
+	}
+
+	failoverMu.Lock()
+	state := primaries[c.name]
+	if state == nil {
+		primaries[c.name] = &primaryState{Host: host, Since: time.Now()}
+	}
+	if state == nil || state.Host == host {
+		failoverMu.Unlock()
+		return
+	}
+
+	change := failover{DetectedAt: time.Now(), From: state.Host, To: host, ElectedAt: electedAt, Term: term}
+	state.Host = host
+	state.Since = change.DetectedAt
+	if !change.ElectedAt.IsZero() {
+		state.Since = change.ElectedAt
+	}
+	state.Failovers++
+	state.Recent = append(state.Recent, change)
+	if len(state.Recent) > maxRecentFailovers {
+		state.Recent = state.Recent[len(state.Recent)-maxRecentFailovers:]
+	}
+	failoverMu.Unlock()
+
+	log.Printf("Primary of %s changed from %s to %s\n", c.name, change.From, change.To)
+	elected := tr("failover.elected_unknown", "unknown (replSetGetStatus is not permitted)")
+	if !change.ElectedAt.IsZero() {
+		elected = tr("failover.elected", "{at} (term {term})", "at", change.ElectedAt.Format("2006-01-02 15:04:05 MST"), "term", change.Term)
+	}
+	body := tr("failover.changed", "The primary changed.\n\nOld primary: {from}\nNew primary: {to}\nElected: {elected}\n", "from", change.From, "to", change.To, "elected", elected)
+	if !c.failingSince.IsZero() && time.Since(c.failingSince) < 2*c.interval+10*time.Minute {
+		body += tr("failover.failing_before", "\nChecks started failing at {since}, shortly before this failover was seen.\n", "since", c.failingSince.Format("2006-01-02 15:04:05 MST"))
+	}
+	dispatchAlert(Alert{Subject: "MongoDB Primary Changed", Body: body, Target: c.name, Severity: severityInfo})
+}
+
+// electionInfo reads when host became primary and the election term from
+// replSetGetStatus, or zero values when the monitoring user may not run it.
+func electionInfo(ctx context.Context, client *mongo.Client, host string) (time.Time, int64) {
+	var status struct {
+		Term    int64 `bson:"term"`
+		Members []struct {
+			Name         string    `bson:"name"`
+			ElectionDate time.Time `bson:"electionDate"`
+		} `bson:"members"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&status); err != nil {
+		logThrottled("Failed to read election time", err)
+		return time.Time{}, 0
+	}
+	for _, member := range status.Members {
+		if member.Name == host {
+			return member.ElectionDate, status.Term
+		}
+	}
+	return time.Time{}, status.Term
+}
+
+func primarySnapshot(target string) *primaryState {
+	failoverMu.Lock()
+	defer failoverMu.Unlock()
+	if state := primaries[target]; state != nil {
+		snapshot := *state
+		snapshot.Recent = append([]failover(nil), state.Recent...)
+		return &snapshot
+	}
+	return nil
+}
+
+// failoverCounts is the number of failovers seen per cluster.
+func failoverCounts() map[string]int {
+	failoverMu.Lock()
+	defer failoverMu.Unlock()
+	counts := map[string]int{}
+	for target, state := range primaries {
+		counts[target] = state.Failovers
+	}
+	return counts
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// serverFeatures is what the server advertises about its protocol level,
+// upgrade state, and authentication.
+type serverFeatures struct {
+	MaxWireVersion              int32    `json:"max_wire_version"`
+	FeatureCompatibilityVersion string   `json:"feature_compatibility_version,omitempty"`
+	SASLMechanisms              []string `json:"sasl_mechanisms,omitempty"`
+}
+
+var (
+	featuresMu   sync.Mutex
+	lastFeatures *serverFeatures
+)
+
+// readServerFeatures reads maxWireVersion, FCV, and the SASL mechanisms
+// offered for the configured user, or returns nil when hello fails.
+func readServerFeatures(ctx context.Context, client *mongo.Client, clientOpts *options.ClientOptions) *serverFeatures {
+	admin := client.Database("admin")
+	features := serverFeatures{}
+
+	hello := bson.D{{Key: "hello", Value: 1}}
+	if auth := clientOpts.Auth; auth != nil && auth.Username != "" {
+		source := auth.AuthSource
+		if source == "" {
+			source = "admin"
+		}
+		hello = append(hello, bson.E{Key: "saslSupportedMechs", Value: source + "." + auth.Username})
+	}
+	var helloReply struct {
+		MaxWireVersion     int32    `bson:"maxWireVersion"`
+		SASLSupportedMechs []string `bson:"saslSupportedMechs"`
+	}
+	if err := admin.RunCommand(ctx, hello).Decode(&helloReply); err != nil {
+		logThrottled("Failed to run hello for server features", err)
+		return nil
+	}
+	features.MaxWireVersion = helloReply.MaxWireVersion
+	features.SASLMechanisms = helloReply.SASLSupportedMechs
+	slices.Sort(features.SASLMechanisms)
+
+	var fcv struct {
+		FeatureCompatibilityVersion struct {
+			Version string `bson:"version"`
+		} `bson:"featureCompatibilityVersion"`
+	}
+	err := admin.RunCommand(ctx, bson.D{
+		{Key: "getParameter", Value: 1},
+		{Key: "featureCompatibilityVersion", Value: 1},
+	}).Decode(&fcv)
+	if err != nil {
+		// Needs clusterMonitor; many monitoring users do not have it
+		logThrottled("Failed to get featureCompatibilityVersion", err)
+	}
+	features.FeatureCompatibilityVersion = fcv.FeatureCompatibilityVersion.Version
+	return &features
+}
+
+// recordServerFeatures records the features a check read, alerting when
+// any of them changed since the previous check. An unplanned upgrade or an
+// auth mechanism being dropped tends to surface as driver errors that look
+// like connectivity loss.
+func recordServerFeatures(features *serverFeatures) {
+	log.Printf("Server features: maxWireVersion=%d fcv=%s sasl=%s\n",
+		features.MaxWireVersion, features.FeatureCompatibilityVersion, strings.Join(features.SASLMechanisms, ","))
+
+	featuresMu.Lock()
+	previous := lastFeatures
+	lastFeatures = features
+	featuresMu.Unlock()
+
+	if previous == nil {
+		return
+	}
+	var changes []string
+	if previous.MaxWireVersion != features.MaxWireVersion {
+		changes = append(changes, fmt.Sprintf("maxWireVersion: %d -> %d", previous.MaxWireVersion, features.MaxWireVersion))
+	}
+	// An empty FCV only means the lookup failed this time
+	if features.FeatureCompatibilityVersion != "" && previous.FeatureCompatibilityVersion != "" &&
+		previous.FeatureCompatibilityVersion != features.FeatureCompatibilityVersion {
+		changes = append(changes, fmt.Sprintf("featureCompatibilityVersion: %s -> %s", previous.FeatureCompatibilityVersion, features.FeatureCompatibilityVersion))
+	}
+	if !slices.Equal(previous.SASLMechanisms, features.SASLMechanisms) {
+		changes = append(changes, fmt.Sprintf("SASL mechanisms: [%s] -> [%s]",
+			strings.Join(previous.SASLMechanisms, ", "), strings.Join(features.SASLMechanisms, ", ")))
+	}
+	if len(changes) > 0 {
+		sendAlert("MongoDB Server Features Changed",
+			tr("features.changed", "The server now advertises different capabilities, possibly after an unplanned upgrade:\n")+strings.Join(changes, "\n"))
+	}
+}
+
+func serverFeaturesSnapshot() *serverFeatures {
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+	return lastFeatures
+}
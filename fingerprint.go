@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+var (
+	hostPortPattern = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9.-]*:\d{2,5}`)
+	volatilePattern = regexp.MustCompile(`\[-\d+\]|0x[0-9a-fA-F]+|\b[0-9a-fA-F]{24}\b|\d+(\.\d+)?(ns|µs|ms|s|m|h)?\b`)
+)
+
+// fingerprintError reduces an error to a short stable ID made from its class,
+// the host it names, and its message with volatile parts (pool generation
+// counters, durations, ObjectIds) masked. Two failures with the same
+// fingerprint are the same problem.
+func fingerprintError(err error, class string) (fingerprint, host string) {
+	msg := err.Error()
+	host = hostPortPattern.FindString(msg)
+	normalized := volatilePattern.ReplaceAllString(strings.Replace(msg, host, "", 1), "N")
+
+	sum := sha1.Sum([]byte(class + "|" + host + "|" + normalized))
+	return hex.EncodeToString(sum[:])[:10], host
+}
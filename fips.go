@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"os"
+)
+
+// fipsCipherSuites are the TLS 1.2 suites approved under FIPS 140: ECDHE
+// key exchange with AES-GCM.
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// fipsReport is the compliance section of /status.
+type fipsReport struct {
+	Mode          bool     `json:"mode"`
+	Module        string   `json:"module,omitempty"`
+	ModuleEnabled bool     `json:"module_enabled"`
+	TLSVersions   string   `json:"tls_versions"`
+	CipherSuites  []string `json:"cipher_suites"`
+	Curves        []string `json:"curves"`
+	Findings      []string `json:"findings,omitempty"`
+}
+
+var fipsMode bool
+
+// loadFIPSConfig reads FIPS_MODE=true, which holds every TLS connection the
+// monitor makes or accepts (MongoDB, SMTP, MQTT, webhooks, the Atlas and
+// AWS APIs, the HTTP API) to TLS 1.2 with approved cipher suites and
+// curves. Binaries built with GOEXPERIMENT=boringcrypto are always in this
+// mode and use BoringCrypto; on Go 1.24 and later GODEBUG=fips140=on
+// switches to Go's own validated module. See fipsModule.
+func loadFIPSConfig() {
+	module, enabled := fipsModule()
+	fipsMode = os.Getenv("FIPS_MODE") == "true" || (module == "BoringCrypto" && enabled)
+	if !fipsMode {
+		return
+	}
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport.TLSClientConfig = fipsTLS(transport.TLSClientConfig)
+	}
+	switch {
+	case module == "":
+		log.Println("FIPS mode: TLS restricted to approved settings, but no validated crypto module is built in")
+	case !enabled:
+		log.Printf("FIPS mode: TLS restricted to approved settings, %s present but not enabled\n", module)
+	default:
+		log.Printf("FIPS mode: TLS restricted to approved settings using %s\n", module)
+	}
+}
+
+// fipsTLS restricts a TLS configuration to approved settings in FIPS mode
+// and returns it, creating one when cfg is nil.
+func fipsTLS(cfg *tls.Config) *tls.Config {
+	if !fipsMode {
+		return cfg
+	}
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg.MinVersion = tls.VersionTLS12
+	// Go does not let TLS 1.3 suites be chosen, and not all are approved
+	cfg.MaxVersion = tls.VersionTLS12
+	cfg.CipherSuites = fipsCipherSuites
+	cfg.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+	return cfg
+}
+
+// fipsSnapshot describes the crypto settings in force and anything short of
+// compliance, or nil outside FIPS mode.
+func fipsSnapshot() *fipsReport {
+	if !fipsMode {
+		return nil
+	}
+	module, enabled := fipsModule()
+	report := &fipsReport{Mode: true, Module: module, ModuleEnabled: enabled, TLSVersions: "1.2", Curves: []string{"P-256", "P-384"}}
+	for _, id := range fipsCipherSuites {
+		report.CipherSuites = append(report.CipherSuites, tls.CipherSuiteName(id))
+	}
+	switch {
+	case module == "":
+		report.Findings = append(report.Findings, "no validated crypto module in this build; build with GOEXPERIMENT=boringcrypto or Go 1.24+")
+	case !enabled:
+		report.Findings = append(report.Findings, module+" is present but not enabled (GODEBUG=fips140=on)")
+	}
+	if atlasConfigured() {
+		report.Findings = append(report.Findings, "Atlas API keys authenticate with HTTP Digest, which uses MD5")
+	}
+	return report
+}
@@ -0,0 +1,15 @@
+//go:build boringcrypto
+
+package main
+
+import (
+	"crypto/boring"
+	_ "crypto/tls/fipsonly"
+)
+
+// fipsModule reports the validated crypto module the binary uses. Built
+// with GOEXPERIMENT=boringcrypto, crypto goes through BoringCrypto and
+// fipsonly holds every TLS configuration to approved settings as well.
+func fipsModule() (name string, enabled bool) {
+	return "BoringCrypto", boring.Enabled()
+}
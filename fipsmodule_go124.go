@@ -0,0 +1,11 @@
+//go:build go1.24 && !boringcrypto
+
+package main
+
+import "crypto/fips140"
+
+// fipsModule reports the validated crypto module the binary uses: Go's own
+// FIPS 140-3 module, enabled with GODEBUG=fips140=on.
+func fipsModule() (name string, enabled bool) {
+	return "Go Cryptographic Module", fips140.Enabled()
+}
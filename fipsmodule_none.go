@@ -0,0 +1,9 @@
+//go:build !go1.24 && !boringcrypto
+
+package main
+
+// fipsModule reports the validated crypto module the binary uses; this
+// build has none.
+func fipsModule() (name string, enabled bool) {
+	return "", false
+}
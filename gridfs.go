@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// gridFSProbeReport is the outcome of the last GridFS round trip.
+type gridFSProbeReport struct {
+	Time       time.Time `json:"time"`
+	SizeBytes  int       `json:"size_bytes"`
+	UploadMS   float64   `json:"upload_ms"`
+	DownloadMS float64   `json:"download_ms"`
+	OK         bool      `json:"ok"`
+	Error      string    `json:"error,omitempty"`
+}
+
+var (
+	gridFSProbeDB   string
+	gridFSProbeSize int
+
+	gridFSMu        sync.Mutex
+	lastGridFSProbe *gridFSProbeReport
+)
+
+func loadGridFSProbeConfig() {
+	gridFSProbeDB = os.Getenv("GRIDFS_PROBE_DB")
+	gridFSProbeSize = getEnvInt("GRIDFS_PROBE_SIZE_KB", 1024) * 1024
+}
+
+// checkGridFSProbe uploads a random file large enough to span several
+// chunks, reads it back, and deletes it. Unlike a ping this needs many
+// round trips and a few hundred KB on the wire, which is what breaks first
+// on a path with MTU or idle-timeout trouble.
+func checkGridFSProbe(uri string) {
+	if gridFSProbeDB == "" || !probeAllowed("gridfs_probe") {
+		return
+	}
+
+	report := runGridFSProbe(uri)
+	if report.OK {
+		log.Printf("GridFS probe: %d bytes, upload %.1fms, download %.1fms\n", report.SizeBytes, report.UploadMS, report.DownloadMS)
+	} else {
+		logThrottled("GridFS probe failed", errors.New(report.Error))
+	}
+
+	gridFSMu.Lock()
+	previous := lastGridFSProbe
+	lastGridFSProbe = report
+	gridFSMu.Unlock()
+
+	if !report.OK && (previous == nil || previous.OK) {
+		sendAlert("MongoDB GridFS Probe Failing",
+			tr("gridfs.failing", "Writing and reading back a {size} KB GridFS file failed while single commands succeed: {error}", "size", report.SizeBytes/1024, "error", report.Error))
+	} else if report.OK && previous != nil && !previous.OK {
+		sendRecovery("MongoDB GridFS Probe Restored", tr("gridfs.restored", "GridFS round trips are succeeding again."))
+	}
+}
+
+func runGridFSProbe(uri string) *gridFSProbeReport {
+	report := &gridFSProbeReport{Time: time.Now(), SizeBytes: gridFSProbeSize}
+	fail := func(step string, err error) *gridFSProbeReport {
+		report.Error = fmt.Sprintf("%s: %v", step, err)
+		return report
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "gridfs"))
+	if err != nil {
+		return fail("connect", err)
+	}
+	defer closeClient(client, "gridfs")
+
+	db := client.Database(gridFSProbeDB)
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(gridFSProbeBucket))
+	if err != nil {
+		return fail("bucket", err)
+	}
+	// Files interrupted mid-probe expire; their chunks are caught by `cleanup`
+	if err := ensureProbeTTL(ctx, db.Collection(gridFSProbeBucket+".files"), "uploadDate"); err != nil {
+		logThrottled("GridFS probe TTL index", err)
+	}
+
+	data := make([]byte, gridFSProbeSize)
+	if _, err := rand.Read(data); err != nil {
+		return fail("generate", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		bucket.SetWriteDeadline(deadline)
+		bucket.SetReadDeadline(deadline)
+	}
+
+	start := time.Now()
+	id, err := bucket.UploadFromStream(fmt.Sprintf("probe-%s-%d", targetName(), start.UnixNano()), bytes.NewReader(data))
+	if err != nil {
+		return fail("upload", err)
+	}
+	report.UploadMS = float64(time.Since(start).Microseconds()) / 1000
+	defer func() {
+		err := bucket.Delete(id)
+		if err == nil {
+			err = verifyGridFSDeleted(ctx, db, id)
+		}
+		if err != nil {
+			log.Printf("Failed to delete GridFS probe file %v: %v\n", id, err)
+		}
+	}()
+
+	start = time.Now()
+	var downloaded bytes.Buffer
+	if _, err := bucket.DownloadToStream(id, &downloaded); err != nil {
+		return fail("download", err)
+	}
+	report.DownloadMS = float64(time.Since(start).Microseconds()) / 1000
+
+	if !bytes.Equal(downloaded.Bytes(), data) {
+		return fail("verify", fmt.Errorf("downloaded %d bytes do not match the %d uploaded", downloaded.Len(), len(data)))
+	}
+	report.OK = true
+	return report
+}
+
+func gridFSProbeSnapshot() *gridFSProbeReport {
+	gridFSMu.Lock()
+	defer gridFSMu.Unlock()
+	return lastGridFSProbe
+}
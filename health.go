@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// Health states reported per check. A cluster that answers but whose ping
+// takes longer than DEGRADED_LATENCY_MS is degraded rather than healthy;
+// through PrivateLink that usually means a detour or a struggling endpoint
+// long before anything times out. So is a replica set with members that
+// cannot be reached directly (TOPOLOGY_CHANGE_CHECK).
+const (
+	healthHealthy  = "healthy"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+var (
+	degradedLatency         time.Duration
+	failuresBeforeAlert     int
+	successesBeforeRecovery int
+)
+
+// loadHealthConfig reads DEGRADED_LATENCY_MS (default 0, no degraded
+// state), and CONSECUTIVE_FAILURES_BEFORE_ALERT and
+// CONSECUTIVE_SUCCESSES_BEFORE_RECOVERY (both default 1), the number of
+// checks in a row it takes to call a cluster down or up again.
+func loadHealthConfig() {
+	degradedLatency = time.Duration(getEnvInt("DEGRADED_LATENCY_MS", 0)) * time.Millisecond
+	failuresBeforeAlert = getEnvInt("CONSECUTIVE_FAILURES_BEFORE_ALERT", 1)
+	successesBeforeRecovery = getEnvInt("CONSECUTIVE_SUCCESSES_BEFORE_RECOVERY", 1)
+	if failuresBeforeAlert < 1 || successesBeforeRecovery < 1 {
+		log.Fatal("CONSECUTIVE_FAILURES_BEFORE_ALERT and CONSECUTIVE_SUCCESSES_BEFORE_RECOVERY must be at least 1")
+	}
+}
+
+// countStreak updates the cluster's run of consecutive failures or
+// successes, remembering when the current run of failures started.
+func (c *cluster) countStreak(err error, start time.Time) {
+	if err != nil {
+		if c.failures == 0 {
+			c.failingSince = start
+		}
+		c.failures++
+		c.successes = 0
+		return
+	}
+	c.successes++
+	c.failures = 0
+}
+
+// health is the cluster's current state as the monitor decided it.
+func (c *cluster) health() string {
+	switch {
+	case !c.up:
+		return healthDown
+	case c.degraded:
+		return healthDegraded
+	}
+	return healthHealthy
+}
+
+func healthOf(err error, ping time.Duration) string {
+	switch {
+	case err != nil:
+		return healthDown
+	case degradedLatency > 0 && ping > degradedLatency:
+		return healthDegraded
+	}
+	return healthHealthy
+}
+
+// evaluateDegraded alerts when a cluster that is up starts or stops
+// answering slowly or with members unreachable. Going down ends the degraded state without an alert of
+// its own; the failure alert covers it.
+func (c *cluster) evaluateDegraded(result checkResult) {
+	if !c.up {
+		c.degraded = false
+		return
+	}
+	degraded := result.Health == healthDegraded
+	if degraded == c.degraded {
+		return
+	}
+	c.degraded = degraded
+	slow := degradedLatency > 0 && result.PingMS > float64(degradedLatency.Microseconds())/1000
+	if degraded && !slow {
+		c.degradedMembers = true
+		log.Printf("%s is degraded: %d member(s) unreachable\n", c.name, len(result.Unreachable))
+		sendTargetAlert(c.name, "MongoDB Connection Degraded",
+			tr("degraded.members", "The connection to {target} works, but {count} replica set member(s) cannot be reached directly:\n{members}\n\nThe set is running with less redundancy than it should.\n{dns}",
+				"target", c.name, "count", len(result.Unreachable), "members", strings.Join(result.Unreachable, "\n"), "dns", describeDNSLookups(result.DNS)))
+	} else if degraded {
+		c.degradedMembers = false
+		log.Printf("%s is degraded: ping took %.1fms\n", c.name, result.PingMS)
+		sendTargetAlert(c.name, "MongoDB Connection Degraded",
+			tr("degraded.slow", "The connection to {target} works but is slow: ping took {ping:%.1f}ms, above the {threshold} threshold (check took {latency:%.1f}ms).\n\n{dns}",
+				"target", c.name, "ping", result.PingMS, "threshold", degradedLatency, "latency", result.LatencyMS, "dns", describeDNSLookups(result.DNS)))
+	} else if c.degradedMembers {
+		sendTargetRecovery(c.name, "MongoDB Connection No Longer Degraded",
+			tr("degraded.members_restored", "Every replica set member of {target} can be reached again.", "target", c.name))
+	} else {
+		sendTargetRecovery(c.name, "MongoDB Connection No Longer Degraded",
+			tr("degraded.slow_restored", "Ping to {target} is back below {threshold} ({ping:%.1f}ms).", "target", c.name, "threshold", degradedLatency, "ping", result.PingMS))
+	}
+}
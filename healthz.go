@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// recentLatencyChecks is how many of the latest results the cluster
+// summary reports latencies for.
+const recentLatencyChecks = 10
+
+var livenessCycles int
+
+// clusterSummary is one cluster's entry in /status/clusters.
+type clusterSummary struct {
+	Target          string    `json:"target"`
+	Namespace       string    `json:"namespace,omitempty"`
+	Healthy         bool      `json:"healthy"`
+	Health          string    `json:"health"`
+	LastCheck       time.Time `json:"last_check"`
+	LastError       string    `json:"last_error,omitempty"`
+	ErrorClass      string    `json:"error_class,omitempty"`
+	Incident        string    `json:"incident,omitempty"`
+	LatencyMS       float64   `json:"latency_ms"`
+	RecentLatencyMS []float64 `json:"recent_latency_ms"`
+}
+
+// loadLivenessConfig serves /healthz for liveness probes and
+// /status/clusters. LIVENESS_STALE_CYCLES (default 3) is how many check
+// intervals, on top of the watchdog's hard cap, a cluster may go without
+// completing a cycle before /healthz reports the monitor as stalled.
+func loadLivenessConfig() {
+	livenessCycles = getEnvInt("LIVENESS_STALE_CYCLES", 3)
+	httpMux.HandleFunc("/healthz", handleHealthz)
+	httpMux.HandleFunc("/status/clusters", handleClusterSummaries)
+}
+
+// handleHealthz answers whether the monitor itself is working, not whether
+// MongoDB is reachable: it fails only when a check loop has stopped
+// completing cycles, so an orchestrator restarts a stuck process without
+// restarting a healthy one during a PrivateLink outage. It needs no token.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	var stalled []string
+	statusMu.Lock()
+	for _, c := range clusters {
+		last := processStart
+		if s := statuses[c.name]; s != nil {
+			last = s.UpdatedAt
+		}
+		if now.Sub(last) > time.Duration(livenessCycles)*c.interval+c.hardCap() {
+			stalled = append(stalled, c.name)
+		}
+	}
+	statusMu.Unlock()
+
+	body := map[string]interface{}{
+		"status":         "ok",
+		"version":        buildVersion,
+		"uptime_seconds": int(now.Sub(processStart).Seconds()),
+	}
+	if len(stalled) > 0 {
+		body["status"] = "stalled"
+		body["stalled"] = stalled
+		writeJSON(w, http.StatusServiceUnavailable, body)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// handleClusterSummaries serves /status/clusters, the state of every
+// cluster the token may see in one response, for dashboards and scripts.
+func handleClusterSummaries(w http.ResponseWriter, r *http.Request) {
+	t, ok := authorize(w, r, roleReadOnly)
+	if !ok {
+		return
+	}
+	summaries := []clusterSummary{}
+	for _, c := range clusters {
+		if !t.owns(c.name) {
+			continue
+		}
+		statusMu.Lock()
+		snapshot := statuses[c.name]
+		statusMu.Unlock()
+		if snapshot == nil {
+			summaries = append(summaries, clusterSummary{Target: c.name, Namespace: namespaceName(c.name), Health: "unknown", RecentLatencyMS: []float64{}})
+			continue
+		}
+		summary := clusterSummary{
+			Target:          c.name,
+			Namespace:       snapshot.Namespace,
+			Healthy:         snapshot.Healthy,
+			Health:          snapshot.Health,
+			LastCheck:       snapshot.LastResult.Time,
+			LastError:       snapshot.LastResult.Error,
+			ErrorClass:      snapshot.LastResult.ErrorClass,
+			LatencyMS:       snapshot.LastResult.LatencyMS,
+			RecentLatencyMS: []float64{},
+		}
+		if snapshot.Incident != nil {
+			summary.Incident = snapshot.Incident.ID
+		}
+		for _, result := range recentResults(c.name, recentLatencyChecks) {
+			summary.RecentLatencyMS = append(summary.RecentLatencyMS, result.LatencyMS)
+		}
+		summaries = append(summaries, summary)
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// resultRing holds the most recent results of one target, oldest first
+// once read back.
+type resultRing struct {
+	results []checkResult
+	next    int
+	full    bool
+}
+
+var (
+	historySize int
+
+	historyMu sync.Mutex
+	history   = map[string]*resultRing{}
+)
+
+func loadHistoryConfig() {
+	historySize = getEnvInt("HISTORY_SIZE", 1000)
+	httpMux.HandleFunc("/status/history", handleHistory)
+}
+
+func recordHistory(result checkResult) {
+	storeResult(result)
+	if historySize <= 0 {
+		return
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	ring, ok := history[result.Target]
+	if !ok {
+		ring = &resultRing{results: make([]checkResult, historySize)}
+		history[result.Target] = ring
+	}
+	ring.results[ring.next] = result
+	ring.next = (ring.next + 1) % historySize
+	if ring.next == 0 {
+		ring.full = true
+	}
+}
+
+// recentResults returns up to limit of the latest results, oldest first.
+func recentResults(target string, limit int) []checkResult {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	ring, ok := history[target]
+	if !ok {
+		return []checkResult{}
+	}
+	var ordered []checkResult
+	if ring.full {
+		ordered = append(ordered, ring.results[ring.next:]...)
+	}
+	ordered = append(ordered, ring.results[:ring.next]...)
+	if limit > 0 && len(ordered) > limit {
+		ordered = ordered[len(ordered)-limit:]
+	}
+	return ordered
+}
+
+// handleHistory serves /status/history?target=<name>&limit=<n> from memory,
+// for quick triage without a history backend, or with since=<RFC 3339>
+// (and until=) from HISTORY_DB.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	t, ok := authorize(w, r, roleReadOnly)
+	if !ok {
+		return
+	}
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		target = targetName()
+	}
+	if !t.owns(target) {
+		writeError(w, http.StatusForbidden, "target belongs to another tenant")
+		return
+	}
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	if r.URL.Query().Has("since") {
+		handleStoredHistory(w, r, target, limit)
+		return
+	}
+	writeJSON(w, http.StatusOK, recentResults(target, limit))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	historyDBPath      string
+	historyDBRetention time.Duration
+
+	historyDB       *sql.DB
+	historyDBMu     sync.Mutex
+	historyDBPruned time.Time
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS checks (
+	time         INTEGER NOT NULL,
+	target       TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	health       TEXT NOT NULL,
+	latency_ms   REAL NOT NULL,
+	ping_ms      REAL,
+	error_class  TEXT,
+	error        TEXT,
+	error_host   TEXT,
+	trace_id     TEXT,
+	clock_gap_ms REAL
+);
+CREATE INDEX IF NOT EXISTS checks_target_time ON checks (target, time);
+`
+
+// loadHistoryDBConfig reads HISTORY_DB, the path of a SQLite database that
+// keeps every check result, and HISTORY_DB_RETENTION_DAYS (default 30).
+// Unlike the in-memory history it survives restarts and covers whole
+// outages, so they can be analyzed after the fact with /status/history
+// ?since= or any SQLite client. The sqlite3 driver needs a cgo build.
+func loadHistoryDBConfig() {
+	historyDBPath = os.Getenv("HISTORY_DB")
+	historyDBRetention = time.Duration(getEnvInt("HISTORY_DB_RETENTION_DAYS", 30)) * 24 * time.Hour
+	if historyDBPath == "" {
+		return
+	}
+	db, err := sql.Open("sqlite3", historyDBPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err == nil {
+		_, err = db.Exec(historySchema)
+	}
+	if err == nil {
+		// Databases created before clock gaps were recorded lack the column
+		_, err = db.Exec(`ALTER TABLE checks ADD COLUMN clock_gap_ms REAL`)
+		if err != nil && strings.Contains(err.Error(), "duplicate column") {
+			err = nil
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to open HISTORY_DB %s: %v", historyDBPath, err)
+	}
+	// One writer at a time is all SQLite allows anyway
+	db.SetMaxOpenConns(1)
+	historyDB = db
+}
+
+// storeResult appends a check result to the history database and, at most
+// hourly, deletes results past the retention period.
+func storeResult(result checkResult) {
+	if historyDB == nil {
+		return
+	}
+	_, err := historyDB.Exec(`INSERT INTO checks (time, target, status, health, latency_ms, ping_ms, error_class, error, error_host, trace_id, clock_gap_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		result.Time.UnixMilli(), result.Target, result.Status, result.Health, result.LatencyMS, result.PingMS,
+		result.ErrorClass, result.Error, result.ErrorHost, result.TraceID, result.ClockGapMS)
+	if err != nil {
+		logThrottled("Failed to store check result in HISTORY_DB", err)
+		return
+	}
+
+	historyDBMu.Lock()
+	due := historyDBRetention > 0 && time.Since(historyDBPruned) >= time.Hour
+	if due {
+		historyDBPruned = time.Now()
+	}
+	historyDBMu.Unlock()
+	if due {
+		cutoff := time.Now().Add(-historyDBRetention).UnixMilli()
+		if res, err := historyDB.Exec(`DELETE FROM checks WHERE time < ?`, cutoff); err != nil {
+			logThrottled("Failed to prune HISTORY_DB", err)
+		} else if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("Pruned %d check result(s) older than %v from %s\n", n, historyDBRetention, historyDBPath)
+		}
+	}
+}
+
+// storedResults reads a target's results in [since, until) from the
+// history database, oldest first, at most limit of them when limit > 0.
+func storedResults(target string, since, until time.Time, limit int) ([]checkResult, error) {
+	query := `SELECT time, status, health, latency_ms, ping_ms, error_class, error, error_host, trace_id, clock_gap_ms
+		FROM checks WHERE target = ? AND time >= ? AND time < ? ORDER BY time`
+	args := []interface{}{target, since.UnixMilli(), until.UnixMilli()}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := historyDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []checkResult{}
+	for rows.Next() {
+		var millis int64
+		var ping, gap sql.NullFloat64
+		var class, msg, host, trace sql.NullString
+		result := checkResult{Target: target}
+		if err := rows.Scan(&millis, &result.Status, &result.Health, &result.LatencyMS, &ping, &class, &msg, &host, &trace, &gap); err != nil {
+			return nil, err
+		}
+		result.Time = time.UnixMilli(millis)
+		result.PingMS, result.ErrorClass, result.Error, result.ErrorHost, result.TraceID = ping.Float64, class.String, msg.String, host.String, trace.String
+		result.ClockGapMS = gap.Float64
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// handleStoredHistory serves /status/history requests with since (and
+// optionally until) from the history database.
+func handleStoredHistory(w http.ResponseWriter, r *http.Request, target string, limit int) {
+	if historyDB == nil {
+		writeError(w, http.StatusNotFound, "since/until need HISTORY_DB")
+		return
+	}
+	since, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid since, expected RFC 3339")
+		return
+	}
+	until := time.Now()
+	if value := r.URL.Query().Get("until"); value != "" {
+		if until, err = time.Parse(time.RFC3339, value); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid until, expected RFC 3339")
+			return
+		}
+	}
+	results, err := storedResults(target, since, until, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
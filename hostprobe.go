@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// hostProbe is the outcome of dialing one member directly, below the
+// driver, after a failed check. Layer is the first layer that failed, or
+// "ok".
+type hostProbe struct {
+	Host  string  `json:"host"`
+	Layer string  `json:"layer"`
+	Error string  `json:"error,omitempty"`
+	TCPMS float64 `json:"tcp_ms,omitempty"`
+	TLSMS float64 `json:"tls_ms,omitempty"`
+}
+
+var hostProbeTimeout time.Duration
+
+// loadHostProbeConfig reads HOST_PROBE_TIMEOUT_SECONDS, the limit for
+// each of the TCP dial and the TLS handshake (default 5).
+func loadHostProbeConfig() {
+	hostProbeTimeout = time.Duration(getEnvInt("HOST_PROBE_TIMEOUT_SECONDS", 5)) * time.Second
+}
+
+// probeHosts dials every replica set member in parallel and, when the
+// connection string uses TLS, attempts a handshake, so a failed check can
+// say which layer broke on which host instead of repeating the driver's
+// error. The members are those the last hello reply named, which may
+// differ from the seed list; without one (mongos, or no check has
+// succeeded yet) the seed list is dialed, resolving the SRV records for
+// mongodb+srv.
+func probeHosts(uri string, members []string) []hostProbe {
+	srvHost, hosts, err := parseSeedList(uri)
+	if err != nil {
+		return nil
+	}
+	if len(members) > 0 {
+		hosts = members
+	} else if srvHost != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), hostProbeTimeout)
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "mongodb", "tcp", srvHost)
+		cancel()
+		if err != nil {
+			return []hostProbe{{Host: srvHost, Layer: "dns", Error: err.Error()}}
+		}
+		for _, record := range records {
+			hosts = append(hosts, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), fmt.Sprint(record.Port)))
+		}
+	}
+
+	tlsConfig := probeTLSConfig(uri)
+	probes := make([]hostProbe, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			probes[i] = probeHost(host, tlsConfig)
+		}(i, host)
+	}
+	wg.Wait()
+	return probes
+}
+
+// probeTLSConfig is the TLS configuration the driver uses for the
+// connection string, so the handshake trusts its tlsCAFile, presents its
+// client certificate and honours tlsInsecure, or nil without TLS.
+func probeTLSConfig(uri string) *tls.Config {
+	if opts := options.Client().ApplyURI(uri); opts.TLSConfig != nil {
+		return fipsTLS(opts.TLSConfig.Clone())
+	}
+	// The URI's TLS options did not parse (e.g. an unreadable tlsCAFile);
+	// the driver fails on that too, so the system roots will do
+	if srvHost, _, _ := parseSeedList(uri); srvHost != "" || uriUsesTLS(uri) {
+		return fipsTLS(&tls.Config{})
+	}
+	return nil
+}
+
+func probeHost(hostPort string, tlsConfig *tls.Config) hostProbe {
+	return probeHostAt(hostPort, hostPort, tlsConfig)
+}
+
+// probeHostAt dials addr, one of the addresses behind hostPort, and
+// handshakes with hostPort's name when tlsConfig is not nil.
+func probeHostAt(hostPort, addr string, tlsConfig *tls.Config) hostProbe {
+	probe := hostProbe{Host: hostPort}
+	start := time.Now()
+	conn, err := probeDialer(hostProbeTimeout).Dial("tcp", addr)
+	probe.TCPMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		probe.Layer = "tcp"
+		probe.Error = describeDialError(err)
+		return probe
+	}
+	defer conn.Close()
+	if tlsConfig == nil {
+		probe.Layer = "ok"
+		return probe
+	}
+
+	config := tlsConfig.Clone()
+	config.ServerName, _, _ = net.SplitHostPort(hostPort)
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		recordPeerCertificates(state)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hostProbeTimeout)
+	defer cancel()
+	start = time.Now()
+	err = tls.Client(conn, config).HandshakeContext(ctx)
+	probe.TLSMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		probe.Layer = "tls"
+		if errors.Is(err, context.DeadlineExceeded) {
+			probe.Error = "handshake timeout"
+		} else {
+			probe.Error = "handshake failed: " + err.Error()
+		}
+		return probe
+	}
+	probe.Layer = "ok"
+	return probe
+}
+
+func describeDialError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return "DNS lookup failed: " + dnsErr.Error()
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "host unreachable"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "connect timeout"
+	}
+	return err.Error()
+}
+
+func uriUsesTLS(uri string) bool {
+	_, query, _ := strings.Cut(uri, "?")
+	for _, param := range strings.Split(strings.ToLower(query), "&") {
+		if param == "tls=true" || param == "ssl=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// describeHostProbes is the per-host section of failure alerts.
+func describeHostProbes(probes []hostProbe) string {
+	if len(probes) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(tr("hosts.probes", "Direct probes of each host:\n"))
+	for _, p := range probes {
+		switch p.Layer {
+		case "ok":
+			b.WriteString(tr("hosts.reachable", "  {host}: reachable (TCP {tcp:%.1f}ms, TLS {tls:%.1f}ms), the failure is above the transport\n",
+				"host", p.Host, "tcp", p.TCPMS, "tls", p.TLSMS))
+		case "tcp":
+			b.WriteString(tr("hosts.tcp_failed", "  {host}: TCP {error} after {tcp:%.1f}ms\n", "host", p.Host, "error", p.Error, "tcp", p.TCPMS))
+		case "tls":
+			b.WriteString(tr("hosts.tls_failed", "  {host}: TCP fine ({tcp:%.1f}ms), TLS {error} after {tls:%.1f}ms\n",
+				"host", p.Host, "tcp", p.TCPMS, "error", p.Error, "tls", p.TLSMS))
+		default:
+			b.WriteString(tr("hosts.failed", "  {host}: {layer} {error}\n", "host", p.Host, "layer", strings.ToUpper(p.Layer), "error", p.Error))
+		}
+	}
+	return b.String()
+}
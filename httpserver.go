@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	httpListenAddr string
+	httpMux        = http.NewServeMux()
+)
+
+func loadHTTPConfig() {
+	httpListenAddr = os.Getenv("HTTP_LISTEN_ADDR")
+	loadHTTPTLSConfig()
+}
+
+// startHTTPServer serves the monitor's API in the background when
+// HTTP_LISTEN_ADDR is set, over TLS when a certificate is configured.
+func startHTTPServer() {
+	if httpListenAddr == "" {
+		return
+	}
+	server := &http.Server{Addr: httpListenAddr, Handler: httpMux}
+	if httpTLSEnabled() {
+		tlsConfig, err := httpTLSConfig()
+		if err != nil {
+			log.Fatalf("Failed to set up TLS for the HTTP API: %v", err)
+		}
+		server.TLSConfig = tlsConfig
+	}
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			log.Printf("Starting HTTPS API on %s\n", httpListenAddr)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Starting HTTP API on %s\n", httpListenAddr)
+			err = server.ListenAndServe()
+		}
+		log.Printf("HTTP API stopped: %v\n", err)
+	}()
+}
+
+// apiBaseURL is the address command-line helpers use to reach a running
+// monitor on the same host.
+func apiBaseURL() string {
+	if url := os.Getenv("MONITOR_API_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	addr := httpListenAddr
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	if httpTLSEnabled() {
+		return "https://" + addr
+	}
+	return "http://" + addr
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write HTTP response: %v\n", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	httpTLSCertFile   string
+	httpTLSKeyFile    string
+	httpTLSCACertFile string
+	httpTLSCAKeyFile  string
+	httpTLSHostnames  []string
+
+	issuedMu   sync.Mutex
+	issuedCert *tls.Certificate
+
+	fixedMu       sync.Mutex
+	fixedCert     *tls.Certificate
+	fixedModified time.Time
+)
+
+// loadHTTPTLSConfig reads HTTP_TLS_CERT_FILE/HTTP_TLS_KEY_FILE for a fixed
+// certificate, or HTTP_TLS_CA_CERT_FILE/HTTP_TLS_CA_KEY_FILE to have the
+// monitor issue its own short-lived certificate from an internal CA for
+// HTTP_TLS_HOSTNAMES (default: this host's name and localhost). Command-line
+// helpers may set HTTP_TLS_CA_CERT_FILE alone, to trust the monitor's CA;
+// with HTTP_LISTEN_ADDR set that would serve plain HTTP, so it is refused.
+func loadHTTPTLSConfig() {
+	httpTLSCertFile = os.Getenv("HTTP_TLS_CERT_FILE")
+	httpTLSKeyFile = os.Getenv("HTTP_TLS_KEY_FILE")
+	httpTLSCACertFile = os.Getenv("HTTP_TLS_CA_CERT_FILE")
+	httpTLSCAKeyFile = os.Getenv("HTTP_TLS_CA_KEY_FILE")
+
+	if (httpTLSCertFile == "") != (httpTLSKeyFile == "") {
+		log.Fatal("HTTP_TLS_CERT_FILE and HTTP_TLS_KEY_FILE must be set together")
+	}
+	if httpTLSCAKeyFile != "" && httpTLSCACertFile == "" {
+		log.Fatal("HTTP_TLS_CA_KEY_FILE requires HTTP_TLS_CA_CERT_FILE")
+	}
+	if httpListenAddr != "" && httpTLSCertFile == "" && httpTLSCACertFile != "" && httpTLSCAKeyFile == "" {
+		log.Fatal("HTTP_TLS_CA_CERT_FILE requires HTTP_TLS_CA_KEY_FILE to serve HTTPS on HTTP_LISTEN_ADDR")
+	}
+
+	httpTLSHostnames = splitList(os.Getenv("HTTP_TLS_HOSTNAMES"))
+	if len(httpTLSHostnames) == 0 {
+		if hostname, err := os.Hostname(); err == nil {
+			httpTLSHostnames = append(httpTLSHostnames, hostname)
+		}
+		httpTLSHostnames = append(httpTLSHostnames, "localhost")
+	}
+}
+
+func httpTLSEnabled() bool {
+	return httpTLSCertFile != "" || httpTLSCAKeyFile != ""
+}
+
+// httpTLSConfig returns the server TLS configuration. Fixed certificates
+// are re-read when either file changes, so a rotated file is picked up
+// without a restart; CA-issued certificates are renewed a week before they
+// expire.
+func httpTLSConfig() (*tls.Config, error) {
+	if httpTLSCertFile != "" {
+		if _, err := currentFixedCert(); err != nil {
+			return nil, err
+		}
+		return fipsTLS(&tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return currentFixedCert()
+			},
+		}), nil
+	}
+
+	if _, err := currentIssuedCert(); err != nil {
+		return nil, err
+	}
+	return fipsTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return currentIssuedCert()
+		},
+	}), nil
+}
+
+// currentFixedCert returns the key pair from HTTP_TLS_CERT_FILE and
+// HTTP_TLS_KEY_FILE, loading it again only when either file's modification
+// time changed. While a rotation has replaced one file but not yet the
+// other, the pair does not match and the previous one is kept.
+func currentFixedCert() (*tls.Certificate, error) {
+	var modified time.Time
+	for _, path := range []string{httpTLSCertFile, httpTLSKeyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			modified = time.Time{}
+			break
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+
+	fixedMu.Lock()
+	defer fixedMu.Unlock()
+	if fixedCert != nil && !modified.IsZero() && modified.Equal(fixedModified) {
+		return fixedCert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(httpTLSCertFile, httpTLSKeyFile)
+	if err != nil {
+		if fixedCert != nil {
+			logThrottled("Failed to reload the HTTP certificate, keeping the current one", err)
+			return fixedCert, nil
+		}
+		return nil, err
+	}
+	if fixedCert != nil {
+		log.Println("Reloaded the HTTP certificate")
+	}
+	fixedCert, fixedModified = &cert, modified
+	return fixedCert, nil
+}
+
+func currentIssuedCert() (*tls.Certificate, error) {
+	issuedMu.Lock()
+	defer issuedMu.Unlock()
+
+	if issuedCert != nil && time.Until(issuedCert.Leaf.NotAfter) > 7*24*time.Hour {
+		return issuedCert, nil
+	}
+	cert, err := issueCertificate()
+	if err != nil {
+		if issuedCert != nil {
+			log.Printf("Failed to renew HTTP certificate, keeping the current one: %v\n", err)
+			return issuedCert, nil
+		}
+		return nil, err
+	}
+	log.Printf("Issued HTTP certificate for %v, valid until %s\n", httpTLSHostnames, cert.Leaf.NotAfter.Format("2006-01-02"))
+	issuedCert = cert
+	return cert, nil
+}
+
+// issueCertificate signs a 30-day server certificate with the internal CA.
+func issueCertificate() (*tls.Certificate, error) {
+	ca, err := tls.LoadX509KeyPair(httpTLSCACertFile, httpTLSCAKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load internal CA: %w", err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse internal CA: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: httpTLSHostnames[0]},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(30 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, name := range httpTLSHostnames {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("sign certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der, ca.Certificate[0]}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// apiClient is the HTTP client command-line helpers use to reach the
+// monitor, trusting the internal CA when one is configured.
+func apiClient() *http.Client {
+	if httpTLSCACertFile == "" {
+		return http.DefaultClient
+	}
+	pem, err := os.ReadFile(httpTLSCACertFile)
+	if err != nil {
+		log.Printf("Failed to read HTTP_TLS_CA_CERT_FILE: %v\n", err)
+		return http.DefaultClient
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	pool.AppendCertsFromPEM(pem)
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: fipsTLS(&tls.Config{RootCAs: pool})}}
+}
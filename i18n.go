@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Alert and report text is written in English in the code and translated
+// through a message catalog: ALERT_LOCALE (e.g. "de") selects
+// <ALERT_CATALOG_DIR>/<locale>.json (default directory "locales"), a JSON
+// object mapping message IDs to their translation. IDs such as
+// "incident.reminder" stay the same when the English wording changes, and
+// values are referred to by name, as in "{target}" or "{latency:%.1f}", so a
+// translation can put them in any order. Subjects double as identifiers in
+// ALERT_ROUTES and inhibit rules and are never reworded, so their
+// translations are keyed "subject." plus the English subject. Messages
+// missing from the catalog stay in English, so a catalog can be filled in
+// gradually.
+
+var messageCatalog map[string]string
+
+// placeholderPattern matches {name} and {name:verb} in message text.
+var placeholderPattern = regexp.MustCompile(`\{[A-Za-z][A-Za-z0-9_]*(:%[^{}]*)?\}`)
+
+func loadMessageCatalog() {
+	locale := os.Getenv("ALERT_LOCALE")
+	if locale == "" || locale == "en" {
+		return
+	}
+	path := filepath.Join(orString(os.Getenv("ALERT_CATALOG_DIR"), "locales"), locale+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read message catalog for ALERT_LOCALE=%s: %v", locale, err)
+	}
+	if err := json.Unmarshal(data, &messageCatalog); err != nil {
+		log.Fatalf("Invalid message catalog %s: %v", path, err)
+	}
+	log.Printf("Alerts in %s, %d message(s) from %s\n", locale, len(messageCatalog), path)
+}
+
+// tr returns message id in the configured locale, or english, with each
+// placeholder filled in from fields, which alternate between a name and its
+// value. A placeholder without a matching field is left as it is.
+func tr(id, english string, fields ...interface{}) string {
+	text := english
+	if translated, ok := messageCatalog[id]; ok {
+		text = translated
+	}
+	if len(fields) == 0 {
+		return text
+	}
+	values := make(map[string]interface{}, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		values[fmt.Sprint(fields[i])] = fields[i+1]
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name, verb := placeholder[1:len(placeholder)-1], "%v"
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name, verb = name[:i], name[i+1:]
+		}
+		value, ok := values[name]
+		if !ok {
+			return placeholder
+		}
+		return fmt.Sprintf(verb, value)
+	})
+}
+
+// trSubject returns the translation of an alert subject.
+func trSubject(subject string) string {
+	return tr("subject."+subject, subject)
+}
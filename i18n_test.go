@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTr(t *testing.T) {
+	defer func(saved map[string]string) { messageCatalog = saved }(messageCatalog)
+	messageCatalog = map[string]string{"greeting": "Hallo {name}, {count} Prüfung(en)"}
+
+	tests := []struct {
+		name    string
+		id      string
+		english string
+		fields  []interface{}
+		want    string
+	}{
+		{"translated", "greeting", "{count} check(s) for {name}", []interface{}{"name", "db", "count", 3}, "Hallo db, 3 Prüfung(en)"},
+		{"missing from catalog", "farewell", "Bye {name}", []interface{}{"name", "db"}, "Bye db"},
+		{"verb", "latency", "took {ms:%.1f}ms", []interface{}{"ms", 12.345}, "took 12.3ms"},
+		{"padding", "entry", "[{class:%-6s}]", []interface{}{"class", "dns"}, "[dns   ]"},
+		{"duration", "downtime", "down {for}", []interface{}{"for", 90 * time.Second}, "down 1m30s"},
+		{"unknown field left as is", "partial", "{a} and {b}", []interface{}{"a", 1}, "1 and {b}"},
+		{"no fields", "plain", "100% {literal}", nil, "100% {literal}"},
+		{"percent in text", "uptime", "{uptime:%.2f}% uptime", []interface{}{"uptime", 99.5}, "99.50% uptime"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tr(tt.id, tt.english, tt.fields...); got != tt.want {
+				t.Errorf("tr(%q) = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+
+	messageCatalog = map[string]string{"subject.MongoDB Connection Failed": "MongoDB-Verbindung fehlgeschlagen"}
+	if got := trSubject("MongoDB Connection Failed"); got != "MongoDB-Verbindung fehlgeschlagen" {
+		t.Errorf("trSubject = %q", got)
+	}
+	if got := trSubject("MongoDB Primary Changed"); got != "MongoDB Primary Changed" {
+		t.Errorf("trSubject without a translation = %q", got)
+	}
+}
+
+// TestCatalogKeysUsed checks every catalog in locales against the tr calls
+// of the package: each message ID must be used, with the fields its
+// translation refers to, and each subject must be sent somewhere. trSubject
+// in i18n.go is the one caller passing a computed ID.
+func TestCatalogKeysUsed(t *testing.T) {
+	messages := map[string]string{}
+	literals := map[string]bool{}
+	fset := token.NewFileSet()
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if s, err := strconv.Unquote(lit.Value); err == nil {
+					literals[s] = true
+				}
+			}
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) < 2 {
+				return true
+			}
+			if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "tr" || path == "i18n.go" {
+				return true
+			}
+			id, ok := stringConstant(call.Args[0])
+			english, ok2 := stringConstant(call.Args[1])
+			if !ok || !ok2 {
+				t.Errorf("%s: tr needs a constant ID and English text", fset.Position(call.Pos()))
+				return true
+			}
+			if previous, seen := messages[id]; seen && previous != english {
+				t.Errorf("%s: message %s is used with different English text:\n%q\n%q", fset.Position(call.Pos()), id, previous, english)
+			}
+			messages[id] = english
+			return true
+		})
+	}
+
+	catalogs, err := filepath.Glob(filepath.Join("locales", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalogs) == 0 {
+		t.Fatal("no catalogs in locales")
+	}
+	for _, path := range catalogs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		for id, translated := range catalog {
+			if subject, ok := strings.CutPrefix(id, "subject."); ok {
+				if !literals[subject] {
+					t.Errorf("%s: %s is not a subject any alert is sent with", path, id)
+				}
+				continue
+			}
+			english, ok := messages[id]
+			if !ok {
+				t.Errorf("%s: message %s is not used", path, id)
+				continue
+			}
+			known := map[string]bool{}
+			for _, placeholder := range placeholderPattern.FindAllString(english, -1) {
+				known[placeholderName(placeholder)] = true
+			}
+			for _, placeholder := range placeholderPattern.FindAllString(translated, -1) {
+				if !known[placeholderName(placeholder)] {
+					t.Errorf("%s: message %s refers to %s, which its English text does not have", path, id, placeholder)
+				}
+			}
+		}
+	}
+}
+
+// stringConstant returns the value of a string literal or a concatenation
+// of them.
+func stringConstant(expr ast.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, err == nil
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := stringConstant(e.X)
+		y, ok2 := stringConstant(e.Y)
+		return x + y, ok && ok2
+	case *ast.ParenExpr:
+		return stringConstant(e.X)
+	}
+	return "", false
+}
+
+func placeholderName(placeholder string) string {
+	name, _, _ := strings.Cut(placeholder[1:len(placeholder)-1], ":")
+	return name
+}
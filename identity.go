@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// clusterIdentity is what the monitor pins on the first successful check to
+// recognise the cluster later.
+type clusterIdentity struct {
+	SetName      string    `json:"set_name,omitempty"`
+	ReplicaSetID string    `json:"replica_set_id,omitempty"`
+	HostsHash    string    `json:"hosts_hash,omitempty"`
+	KeyID        int64     `json:"cluster_time_key_id,omitempty"`
+	PinnedAt     time.Time `json:"pinned_at"`
+}
+
+var (
+	errWrongCluster = errors.New("connected to a different cluster than the pinned one")
+
+	identityFile   string
+	pinnedIdentity *clusterIdentity
+)
+
+// loadClusterIdentity reads the pinned identity from IDENTITY_FILE
+// (default cluster_identity.json). Only the monitor (run) pins; deleting
+// the file re-pins on its next successful check, e.g. after an intentional
+// migration.
+func loadClusterIdentity() {
+	identityFile = os.Getenv("IDENTITY_FILE")
+	if identityFile == "" {
+		identityFile = "cluster_identity.json"
+	}
+	data, err := os.ReadFile(identityFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read identity file: %v\n", err)
+		return
+	}
+	var id clusterIdentity
+	if err := json.Unmarshal(data, &id); err != nil {
+		log.Printf("Failed to parse identity file: %v\n", err)
+		return
+	}
+	pinnedIdentity = &id
+}
+
+// compareIdentity compares the cluster behind a connection with the pinned
+// one. The replica set name and replicaSetId are definitive; the member
+// list and the cluster time signing key both change legitimately (scaling,
+// key rotation), so only both changing at once counts.
+func compareIdentity(pinned *clusterIdentity, current clusterIdentity) error {
+	if pinned == nil {
+		return nil
+	}
+	var differences []string
+	if pinned.SetName != current.SetName {
+		differences = append(differences, fmt.Sprintf("replica set %q, pinned %q", current.SetName, pinned.SetName))
+	}
+	if pinned.ReplicaSetID != "" && current.ReplicaSetID != "" && pinned.ReplicaSetID != current.ReplicaSetID {
+		differences = append(differences, fmt.Sprintf("replicaSetId %s, pinned %s", current.ReplicaSetID, pinned.ReplicaSetID))
+	}
+	if pinned.HostsHash != current.HostsHash && pinned.KeyID != 0 && pinned.KeyID != current.KeyID {
+		differences = append(differences, fmt.Sprintf("member list and cluster time signing key both changed (keyId %d, pinned %d)", current.KeyID, pinned.KeyID))
+	}
+	if len(differences) > 0 {
+		return fmt.Errorf("%w (pinned %s): %s", errWrongCluster, pinned.PinnedAt.Format("2006-01-02 15:04"), strings.Join(differences, "; "))
+	}
+	return nil
+}
+
+// pinClusterIdentity pins the identity a check observed when none is
+// pinned yet. Only the monitor pins: pinning from whatever a single ad-hoc
+// check reached would make that the reference for the monitor.
+func pinClusterIdentity(current clusterIdentity) {
+	if pinnedIdentity != nil || !monitoring {
+		return
+	}
+	current.PinnedAt = time.Now()
+	pinnedIdentity = &current
+	log.Printf("Pinned cluster identity: set=%s replicaSetId=%s hosts=%s keyId=%d\n", current.SetName, current.ReplicaSetID, current.HostsHash, current.KeyID)
+	data, _ := json.MarshalIndent(current, "", "  ")
+	if err := writeFileAtomic(identityFile, data); err != nil {
+		log.Printf("Failed to write identity file: %v\n", err)
+	}
+}
+
+func observeIdentity(ctx context.Context, client *mongo.Client, topology, serverStatus bson.M) clusterIdentity {
+	var id clusterIdentity
+	id.SetName, _ = topology["setName"].(string)
+	if id.SetName == "" {
+		// mongos: identify the cluster by its config server replica set
+		if sharding, ok := serverStatus["sharding"].(bson.M); ok {
+			cs, _ := sharding["configsvrConnectionString"].(string)
+			id.SetName, _, _ = strings.Cut(cs, "/")
+		}
+	}
+
+	var hosts []string
+	if list, ok := topology["hosts"].(primitive.A); ok {
+		for _, host := range list {
+			hosts = append(hosts, fmt.Sprint(host))
+		}
+	}
+	sort.Strings(hosts)
+	if len(hosts) > 0 {
+		sum := sha1.Sum([]byte(strings.Join(hosts, ",")))
+		id.HostsHash = hex.EncodeToString(sum[:])[:10]
+	}
+
+	if clusterTime, ok := topology["$clusterTime"].(bson.M); ok {
+		if signature, ok := clusterTime["signature"].(bson.M); ok {
+			id.KeyID, _ = toInt64(signature["keyId"])
+		}
+	}
+
+	// Needs clusterMonitor, so it is only used when available
+	var config struct {
+		Config struct {
+			Settings struct {
+				ReplicaSetID primitive.ObjectID `bson:"replicaSetId"`
+			} `bson:"settings"`
+		} `bson:"config"`
+	}
+	if id.SetName != "" && topology["msg"] != "isdbgrid" {
+		if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetConfig", Value: 1}}).Decode(&config); err == nil {
+			if !config.Config.Settings.ReplicaSetID.IsZero() {
+				id.ReplicaSetID = config.Config.Settings.ReplicaSetID.Hex()
+			}
+		}
+	}
+	return id
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// incident is one continuous outage of a target, from the failure alert to
+// the recovery alert.
+type incident struct {
+	ID         string           `json:"id"`
+	Target     string           `json:"target"`
+	Start      time.Time        `json:"start"`
+	AckedBy    string           `json:"acked_by,omitempty"`
+	AckedAt    time.Time        `json:"acked_at,omitempty"`
+	Deliveries []delivery       `json:"deliveries,omitempty"`
+	Timeline   []timelineEntry  `json:"timeline"`
+	AWSEvents  []awsHealthEvent `json:"aws_events,omitempty"`
+	Commands   []commandEvent   `json:"commands,omitempty"`
+	Rotations  []uriRotation    `json:"uri_rotations,omitempty"`
+	lastAlert  time.Time
+}
+
+// timelineEntry groups consecutive failures with the same error fingerprint.
+type timelineEntry struct {
+	Fingerprint string    `json:"fingerprint"`
+	Class       string    `json:"class"`
+	Host        string    `json:"host,omitempty"`
+	Error       string    `json:"error"`
+	First       time.Time `json:"first"`
+	Last        time.Time `json:"last"`
+	Count       int       `json:"count"`
+}
+
+var (
+	ackSecret        string
+	ackBaseURL       string
+	reminderInterval time.Duration
+
+	incidentMu sync.Mutex
+	incidents  = map[string]*incident{}
+)
+
+func loadIncidentConfig() {
+	ackSecret = os.Getenv("ACK_SECRET")
+	ackBaseURL = strings.TrimSuffix(os.Getenv("ACK_BASE_URL"), "/")
+	if ackBaseURL == "" && httpListenAddr != "" {
+		ackBaseURL = apiBaseURL()
+	}
+	reminderInterval = time.Duration(getEnvInt("ALERT_REMINDER_MINUTES", 0)) * time.Minute
+
+	httpMux.HandleFunc("/ack", handleAck)
+}
+
+func openIncident(target string, start time.Time) *incident {
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+
+	inc := &incident{
+		ID:        fmt.Sprintf("%s-%d", target, start.Unix()),
+		Target:    target,
+		Start:     start,
+		lastAlert: start,
+	}
+	incidents[target] = inc
+	log.Printf("Incident %s opened\n", inc.ID)
+	startDebugCapture(target)
+	return inc
+}
+
+// recordIncidentRotation notes a connection string rotation on the
+// target's open incident, since a rotation mid-outage is often its cause or
+// its fix.
+func recordIncidentRotation(rotation uriRotation) {
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+	if inc := incidents[rotation.Target]; inc != nil {
+		inc.Rotations = append(inc.Rotations, rotation)
+	}
+}
+
+// openIncidentID is the ID of the target's open incident, or "".
+func openIncidentID(target string) string {
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+
+	if inc := incidents[target]; inc != nil {
+		return inc.ID
+	}
+	return ""
+}
+
+// incidentSnapshot returns a copy of the target's open incident, or nil.
+func incidentSnapshot(target string) *incident {
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+
+	if inc := incidents[target]; inc != nil {
+		snapshot := *inc
+		return &snapshot
+	}
+	return nil
+}
+
+// recordIncidentFailure adds a failed check to the open incident's timeline.
+// It reports whether the error fingerprint changed, along with the entry for
+// the previous error.
+func recordIncidentFailure(result checkResult) (changed bool, previous timelineEntry) {
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+
+	inc := incidents[result.Target]
+	if inc == nil {
+		return false, timelineEntry{}
+	}
+	timeline := inc.Timeline
+	if n := len(timeline); n > 0 && timeline[n-1].Fingerprint == result.Fingerprint {
+		timeline[n-1].Last = result.Time
+		timeline[n-1].Count++
+		return false, timelineEntry{}
+	}
+
+	inc.Timeline = append(timeline, timelineEntry{
+		Fingerprint: result.Fingerprint,
+		Class:       result.ErrorClass,
+		Host:        result.ErrorHost,
+		Error:       result.Error,
+		First:       result.Time,
+		Last:        result.Time,
+		Count:       1,
+	})
+	if len(timeline) == 0 {
+		return false, timelineEntry{}
+	}
+	return true, timeline[len(timeline)-1]
+}
+
+// errorUnchangedSince is the start of the current run of identical errors.
+// The caller holds incidentMu.
+func errorUnchangedSince(inc *incident) string {
+	if n := len(inc.Timeline); n > 0 {
+		return inc.Timeline[n-1].First.Format("15:04")
+	}
+	return inc.Start.Format("15:04")
+}
+
+// recoverySummary is the compact postmortem timeline included in the
+// recovery alert. Clock gaps (host sleep, VM pauses) are not counted as
+// downtime.
+func recoverySummary(target string, recovered time.Time) string {
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+
+	inc := incidents[target]
+	if inc == nil {
+		return ""
+	}
+
+	gapTime := clockGapTime(inc.Start, recovered)
+	downtime := recovered.Sub(inc.Start) - gapTime
+
+	failed := 0
+	for _, entry := range inc.Timeline {
+		failed += entry.Count
+	}
+
+	var b strings.Builder
+	b.WriteString(tr("incident.summary.id", "Incident {id}\n", "id", inc.ID))
+	b.WriteString(tr("incident.summary.start", "First failure:  {start}\n", "start", inc.Start.Format("2006-01-02 15:04:05")))
+	b.WriteString(tr("incident.summary.recovered", "Recovered:      {recovered}\n", "recovered", recovered.Format("2006-01-02 15:04:05")))
+	b.WriteString(tr("incident.summary.downtime", "Total downtime: {downtime}", "downtime", downtime.Round(time.Second)))
+	if gapTime > 0 {
+		b.WriteString(tr("incident.summary.clock_gaps", " (excluding {gaps} of clock gaps)", "gaps", gapTime.Round(time.Second)))
+	}
+	b.WriteString(tr("incident.summary.failed", "\nChecks failed:  {failed}\n", "failed", failed))
+	if inc.AckedBy != "" {
+		b.WriteString(tr("incident.summary.acked", "Acknowledged:   {by} at {at}\n", "by", inc.AckedBy, "at", inc.AckedAt.Format("15:04:05")))
+	}
+	b.WriteString(tr("incident.summary.timeline", "Timeline:\n"))
+	for _, entry := range inc.Timeline {
+		message := entry.Error
+		if len(message) > 120 {
+			message = message[:117] + "..."
+		}
+		b.WriteString(tr("incident.summary.entry", "  {first}-{last}  {class:%-24s} x{count:%-4d} {error}\n",
+			"first", entry.First.Format("15:04"), "last", entry.Last.Format("15:04"), "class", entry.Class, "count", entry.Count, "error", message))
+	}
+	if awsHealthEnabled {
+		b.WriteString(describeAWSEvents(inc.AWSEvents))
+	}
+	return b.String()
+}
+
+func closeIncident(target string) {
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+
+	if inc := incidents[target]; inc != nil {
+		log.Printf("Incident %s closed after %v\n", inc.ID, time.Since(inc.Start).Round(time.Second))
+	}
+	delete(incidents, target)
+	stopDebugCapture(target)
+}
+
+// sendReminder repeats the failure alert for an open, unacknowledged
+// incident every ALERT_REMINDER_MINUTES.
+func sendReminder(target string, err error) {
+	incidentMu.Lock()
+	inc := incidents[target]
+	due := inc != nil && inc.AckedBy == "" && reminderInterval > 0 && time.Since(inc.lastAlert) >= reminderInterval
+	var start time.Time
+	var since, ack string
+	if due {
+		inc.lastAlert = time.Now()
+		start, since, ack = inc.Start, errorUnchangedSince(inc), ackLinkText(inc)
+	}
+	incidentMu.Unlock()
+	if !due {
+		return
+	}
+
+	dispatchAlert(Alert{Subject: "MongoDB Connection Still Failing", Target: target, Severity: severityCritical, Class: classifyError(err),
+		Body: tr("incident.reminder", "MongoDB has been unreachable for {duration}.\nMongoDB Connectivity Error (unchanged since {since}): {error}{ack}",
+			"duration", time.Since(start).Round(time.Second), "since", since, "error", err, "ack", ack)})
+}
+
+// ackLinkText is appended to alert bodies so the recipient can acknowledge
+// the incident from the alert. Links are only offered when ACK_SECRET is
+// set and the HTTP API is reachable. The link is signed for the incident
+// only: alerts are forwarded and shared, so whoever acknowledges says who
+// they are on the confirmation page.
+func ackLinkText(inc *incident) string {
+	if ackSecret == "" || ackBaseURL == "" || inc == nil {
+		return ""
+	}
+	query := url.Values{
+		"incident": {inc.ID},
+		"sig":      {ackSignature(inc.ID)},
+	}
+	return tr("incident.ack_link", "\n\nAcknowledge this incident and stop reminders:\n{link}", "link", ackBaseURL+"/ack?"+query.Encode())
+}
+
+func ackSignature(incidentID string) string {
+	mac := hmac.New(sha256.New, []byte(ackSecret))
+	mac.Write([]byte(incidentID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ackPage is what the link opens. Mail scanners and link previews follow
+// links on their own, so the GET only asks; the form's POST acknowledges.
+var ackPage = template.Must(template.New("ack").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Acknowledge incident {{.ID}}</title></head>
+<body>
+<h1>Acknowledge incident {{.ID}}</h1>
+<p>{{.Target}} has been failing since {{.Start.Format "2006-01-02 15:04:05 MST"}}.{{if .AckedBy}} Already acknowledged by {{.AckedBy}} at {{.AckedAt.Format "15:04:05"}}.{{end}}</p>
+<form method="post" action="ack">
+<input type="hidden" name="incident" value="{{.ID}}">
+<input type="hidden" name="sig" value="{{.Sig}}">
+<label>Your name or email <input name="by" required maxlength="200"></label>
+<button type="submit">Acknowledge and stop reminders</button>
+</form>
+</body></html>
+`))
+
+func handleAck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	incidentID := r.FormValue("incident")
+	sig := r.FormValue("sig")
+	if ackSecret == "" || !hmac.Equal([]byte(sig), []byte(ackSignature(incidentID))) {
+		http.Error(w, "invalid acknowledgment link", http.StatusForbidden)
+		return
+	}
+
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+
+	var inc *incident
+	for _, open := range incidents {
+		if open.ID == incidentID {
+			inc = open
+		}
+	}
+	if inc == nil {
+		http.Error(w, "incident is no longer open", http.StatusGone)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		ackPage.Execute(w, struct {
+			*incident
+			Sig string
+		}{inc, sig})
+		return
+	}
+	by := strings.TrimSpace(r.PostFormValue("by"))
+	if by == "" || len(by) > 200 {
+		http.Error(w, "say who is acknowledging", http.StatusBadRequest)
+		return
+	}
+	if inc.AckedBy == "" {
+		inc.AckedBy = by
+		inc.AckedAt = time.Now()
+		log.Printf("Incident %s acknowledged by %s\n", incidentID, by)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Incident %s acknowledged by %s at %s\n", incidentID, inc.AckedBy, inc.AckedAt.Format("2006-01-02 15:04:05"))
+}
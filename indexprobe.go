@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexProbeReport is the outcome of the last index probe.
+type indexProbeReport struct {
+	Namespace string   `json:"namespace"`
+	Index     string   `json:"index"`
+	Exists    bool     `json:"exists"`
+	Stages    []string `json:"stages,omitempty"`
+	UsesIndex bool     `json:"uses_index"`
+	Problem   string   `json:"problem,omitempty"`
+}
+
+var (
+	indexProbeDB         string
+	indexProbeCollection string
+	indexProbeIndex      string
+	indexProbeFilter     bson.D
+
+	indexProbeMu   sync.Mutex
+	lastIndexProbe *indexProbeReport
+)
+
+// loadIndexProbeConfig reads INDEX_PROBE_NAMESPACE (db.collection),
+// INDEX_PROBE_INDEX (index name) and INDEX_PROBE_FILTER (extended JSON).
+func loadIndexProbeConfig() {
+	ns := os.Getenv("INDEX_PROBE_NAMESPACE")
+	if ns == "" {
+		return
+	}
+	db, coll, ok := strings.Cut(ns, ".")
+	if !ok || db == "" || coll == "" {
+		log.Fatalf("Invalid INDEX_PROBE_NAMESPACE %q, expected db.collection", ns)
+	}
+	indexProbeDB, indexProbeCollection = db, coll
+
+	indexProbeIndex = os.Getenv("INDEX_PROBE_INDEX")
+	if indexProbeIndex == "" {
+		log.Fatal("INDEX_PROBE_INDEX is required with INDEX_PROBE_NAMESPACE")
+	}
+
+	indexProbeFilter = bson.D{}
+	if filter := os.Getenv("INDEX_PROBE_FILTER"); filter != "" {
+		if err := bson.UnmarshalExtJSON([]byte(filter), false, &indexProbeFilter); err != nil {
+			log.Fatalf("Invalid INDEX_PROBE_FILTER: %v", err)
+		}
+	}
+}
+
+// checkIndexProbe verifies the critical index still exists, that the
+// planner picks it for the probe query, and that the query runs with it
+// hinted. A plan change to COLLSCAN usually shows up as timeouts long
+// before anyone looks at the indexes.
+func checkIndexProbe(uri string) {
+	if indexProbeDB == "" || !probeAllowed("index_probe") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "index"))
+	if err != nil {
+		logThrottled("Failed to connect for index probe", err)
+		return
+	}
+	defer closeClient(client, "index")
+
+	report, err := runIndexProbe(ctx, client.Database(indexProbeDB))
+	if err != nil {
+		logThrottled("Index probe failed", err)
+		return
+	}
+	log.Printf("Index probe %s on %s: exists=%v stages=%s\n", report.Index, report.Namespace, report.Exists, strings.Join(report.Stages, ","))
+
+	indexProbeMu.Lock()
+	previous := lastIndexProbe
+	lastIndexProbe = report
+	indexProbeMu.Unlock()
+
+	wasProblem := previous != nil && previous.Problem != ""
+	if report.Problem != "" && (previous == nil || previous.Problem != report.Problem) {
+		sendAlert("MongoDB Index Probe Failing",
+			tr("index.failing", "Index {index} on {namespace}: {problem}\nWinning plan stages: {stages}",
+				"index", report.Index, "namespace", report.Namespace, "problem", report.Problem, "stages", strings.Join(report.Stages, " -> ")))
+	} else if report.Problem == "" && wasProblem {
+		sendRecovery("MongoDB Index Probe Restored", tr("index.restored", "Index {index} on {namespace} exists and is used by the probe query again.", "index", report.Index, "namespace", report.Namespace))
+	}
+}
+
+func runIndexProbe(ctx context.Context, db *mongo.Database) (*indexProbeReport, error) {
+	report := &indexProbeReport{
+		Namespace: indexProbeDB + "." + indexProbeCollection,
+		Index:     indexProbeIndex,
+	}
+	coll := db.Collection(indexProbeCollection)
+
+	specs, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listIndexes: %w", err)
+	}
+	for _, spec := range specs {
+		if spec.Name == indexProbeIndex {
+			report.Exists = true
+		}
+	}
+	if !report.Exists {
+		report.Problem = "index is missing"
+		return report, nil
+	}
+
+	var explain bson.M
+	err = db.RunCommand(ctx, bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "find", Value: indexProbeCollection},
+			{Key: "filter", Value: indexProbeFilter},
+		}},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Decode(&explain)
+	if err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+	planner, _ := explain["queryPlanner"].(bson.M)
+	collectPlanStages(planner["winningPlan"], report)
+	switch {
+	case slices.Contains(report.Stages, "COLLSCAN"):
+		report.Problem = "query planner falls back to COLLSCAN"
+	case !report.UsesIndex:
+		report.Problem = "query planner does not use the index"
+	}
+
+	// The hinted query must still run even when the planner prefers
+	// another index; it fails outright if the index cannot serve it.
+	cursor, err := coll.Find(ctx, indexProbeFilter, options.Find().SetHint(indexProbeIndex).SetLimit(1))
+	if err != nil {
+		if report.Problem == "" {
+			report.Problem = fmt.Sprintf("hinted query failed: %v", err)
+		}
+		return report, nil
+	}
+	cursor.Close(ctx)
+	return report, nil
+}
+
+// collectPlanStages walks an explain plan, including per-shard plans and
+// the SBE queryPlan wrapper, recording stage names and index use.
+func collectPlanStages(node interface{}, report *indexProbeReport) {
+	switch n := node.(type) {
+	case bson.M:
+		if stage, ok := n["stage"].(string); ok {
+			report.Stages = append(report.Stages, stage)
+		}
+		if name, ok := n["indexName"].(string); ok && name == indexProbeIndex {
+			report.UsesIndex = true
+		}
+		for _, key := range []string{"queryPlan", "shards", "winningPlan", "inputStage", "inputStages"} {
+			collectPlanStages(n[key], report)
+		}
+	case bson.A:
+		for _, child := range n {
+			collectPlanStages(child, report)
+		}
+	}
+}
+
+func indexProbeSnapshot() *indexProbeReport {
+	indexProbeMu.Lock()
+	defer indexProbeMu.Unlock()
+	return lastIndexProbe
+}
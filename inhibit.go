@@ -0,0 +1,164 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const inhibitEnvPrefix = "INHIBIT_"
+
+// inhibitCondition is a root cause that makes the alerts it explains
+// redundant while it holds. holds is asked about the alert's target;
+// conditions of the PrivateLink endpoints hold for every target.
+type inhibitCondition struct {
+	name  string
+	holds func(alert Alert) bool
+	// Subject patterns of the alerts it inhibits, e.g. "MongoDB Shard *"
+	subjects []string
+}
+
+// dependentProbes are the alerts of probes that cannot succeed while the
+// connection itself fails.
+var dependentProbes = []string{
+	"MongoDB Shard *", "MongoDB Config Server *", "MongoDB Analytics Nodes *",
+	"MongoDB Index Probe *", "MongoDB GridFS Probe *", "MongoDB Causal Consistency *", "MongoDB Scripted Probe *",
+	"MongoDB Balancer *", "MongoDB Replication Lag *", "MongoDB Open Cursors *", "MongoDB Connection String Variants *",
+	"MongoDB Connection Degraded", "MongoDB Connection No Longer Degraded",
+}
+
+var inhibitConditions = []*inhibitCondition{
+	{
+		name: "connection_down",
+		// The connection's own transition alerts are never inhibited by it
+		holds:    func(alert Alert) bool { return alert.Result == nil && openIncidentID(alert.Target) != "" },
+		subjects: dependentProbes,
+	},
+	{
+		name: "endpoint_down",
+		holds: func(Alert) bool {
+			return anyVPCEndpoint(func(s *vpcEndpointStatus) bool { return s.State != "available" })
+		},
+		subjects: append([]string{
+			"MongoDB Connection Still Failing", "MongoDB Connection Failure Changed",
+			"PrivateLink Endpoint Zones *", "PrivateLink Endpoint Security Groups *",
+		}, dependentProbes...),
+	},
+	{
+		name: "endpoint_zones_degraded",
+		holds: func(Alert) bool {
+			return anyVPCEndpoint(func(s *vpcEndpointStatus) bool { return len(s.Problems) > 0 })
+		},
+		subjects: []string{"MongoDB Connection Degraded", "MongoDB Connection No Longer Degraded"},
+	},
+	{
+		name: "security_groups_blocking",
+		holds: func(Alert) bool {
+			return anyVPCEndpoint(func(s *vpcEndpointStatus) bool { return len(s.RuleProblems) > 0 })
+		},
+		subjects: append([]string{"MongoDB Connection Still Failing", "MongoDB Connection Failure Changed"}, dependentProbes...),
+	},
+}
+
+var (
+	inhibitMu sync.Mutex
+	// Incidents whose opening alert was inhibited, so that the alert
+	// closing them is too
+	inhibitedIncidents = map[string]bool{}
+	alertsInhibited    = map[string]int{}
+)
+
+// loadInhibitRules lets INHIBIT_<CONDITION> replace the subject patterns a
+// condition inhibits, as a comma-separated list of globs, or "none" to turn
+// it off; e.g. INHIBIT_ENDPOINT_DOWN="MongoDB Connection *,MongoDB Shard *"
+// also holds back the connection alerts of every cluster behind an endpoint
+// that AWS reports as down. The conditions are connection_down,
+// endpoint_down, endpoint_zones_degraded and security_groups_blocking.
+func loadInhibitRules() {
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		name, ok := strings.CutPrefix(key, inhibitEnvPrefix)
+		if !ok {
+			continue
+		}
+		condition := findInhibitCondition(strings.ToLower(name))
+		if condition == nil {
+			log.Fatalf("Invalid %s: unknown condition %q", key, strings.ToLower(name))
+		}
+		condition.subjects = nil
+		if strings.EqualFold(strings.TrimSpace(value), "none") {
+			log.Printf("Inhibition by %s disabled\n", condition.name)
+			continue
+		}
+		for _, pattern := range splitList(value) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				log.Fatalf("Invalid %s: pattern %q: %v", key, pattern, err)
+			}
+			condition.subjects = append(condition.subjects, pattern)
+		}
+		log.Printf("While %s, inhibiting: %s\n", condition.name, strings.Join(condition.subjects, ", "))
+	}
+}
+
+func findInhibitCondition(name string) *inhibitCondition {
+	for _, c := range inhibitConditions {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func anyVPCEndpoint(match func(*vpcEndpointStatus) bool) bool {
+	vpcEndpointMu.Lock()
+	defer vpcEndpointMu.Unlock()
+	for _, status := range vpcEndpointStates {
+		if match(status) {
+			return true
+		}
+	}
+	return false
+}
+
+// inhibitedBy returns the condition explaining the alert, if one holds.
+// An alert that resolves an incident follows the alert that opened it.
+func inhibitedBy(alert Alert) (string, bool) {
+	inhibitMu.Lock()
+	defer inhibitMu.Unlock()
+
+	if alert.Incident != "" && inhibitedIncidents[alert.Incident] {
+		if alert.Resolved && alert.Result != nil {
+			delete(inhibitedIncidents, alert.Incident)
+		}
+		alertsInhibited["incident"]++
+		return "incident", true
+	}
+	for _, c := range inhibitConditions {
+		if !matchesAny(alert.Subject, c.subjects) || !c.holds(alert) {
+			continue
+		}
+		if alert.Incident != "" && alert.Result != nil && !alert.Resolved {
+			inhibitedIncidents[alert.Incident] = true
+		}
+		alertsInhibited[c.name]++
+		return c.name, true
+	}
+	return "", false
+}
+
+func logInhibited(alert Alert, condition string) {
+	slog.Info("alert inhibited", "condition", condition, "target", alert.Target, "subject", alert.Subject, "incident", alert.Incident)
+}
+
+func inhibitSnapshot() map[string]int {
+	inhibitMu.Lock()
+	defer inhibitMu.Unlock()
+	counts := make(map[string]int, len(alertsInhibited))
+	for condition, n := range alertsInhibited {
+		counts[condition] = n
+	}
+	return counts
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	initialStatePolicy string
+	startupGrace       time.Duration
+)
+
+func loadInitialStateConfig() {
+	initialStatePolicy = os.Getenv("INITIAL_STATE_POLICY")
+	switch initialStatePolicy {
+	case "":
+		initialStatePolicy = "assume-down"
+	case "assume-down", "alert", "grace":
+	default:
+		log.Fatalf("Invalid INITIAL_STATE_POLICY %q: expected assume-down, alert or grace", initialStatePolicy)
+	}
+	startupGrace = time.Duration(getEnvInt("STARTUP_GRACE_SECONDS", 120)) * time.Second
+}
+
+// applyInitialState settles the connection state after startup. It returns
+// true when it consumed the check result and the caller should not run the
+// normal transition logic for it.
+//
+//   - assume-down: start as down, so the first success sends a "restored"
+//     alert and a monitor started during an outage stays silent.
+//   - alert: the first result sets the state; an initial failure alerts.
+//   - grace: failures are ignored for STARTUP_GRACE_SECONDS after startup,
+//     then alert as usual.
+func (c *cluster) applyInitialState(err error) bool {
+	if c.initialStateKnown {
+		return false
+	}
+
+	switch initialStatePolicy {
+	case "alert":
+		c.initialStateKnown = true
+		c.up = true
+		if err == nil {
+			log.Println("Initial check succeeded")
+			return true
+		}
+		return false
+
+	case "grace":
+		if err == nil {
+			c.initialStateKnown = true
+			c.up = true
+			log.Println("Initial check succeeded")
+			return true
+		}
+		if time.Since(processStart) < startupGrace {
+			log.Printf("Initial check failed within the %v startup grace period, not alerting yet: %v\n", startupGrace, err)
+			return true
+		}
+		c.initialStateKnown = true
+		c.up = true
+		return false
+
+	default:
+		c.initialStateKnown = true
+		return false
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// raceAttempt is one address of a host, dialed on its own.
+type raceAttempt struct {
+	IP    string  `json:"ip"`
+	Zone  string  `json:"zone,omitempty"`
+	Layer string  `json:"layer"`
+	Error string  `json:"error,omitempty"`
+	TCPMS float64 `json:"tcp_ms,omitempty"`
+	TLSMS float64 `json:"tls_ms,omitempty"`
+}
+
+// ipRace is every address of a host that resolves to more than one, dialed
+// side by side the way happy eyeballs would, with the fastest that worked.
+type ipRace struct {
+	Host     string        `json:"host"`
+	Attempts []raceAttempt `json:"attempts"`
+	Fastest  string        `json:"fastest,omitempty"`
+}
+
+var ipRaceCheck bool
+
+// loadIPRaceConfig reads IP_RACE_CHECK=true.
+func loadIPRaceConfig() {
+	ipRaceCheck = os.Getenv("IP_RACE_CHECK") == "true"
+}
+
+// raceAddresses dials each address of every multi-address host from the
+// check's A lookups in parallel. A multi-AZ endpoint name returns one
+// address per zone, and the driver quietly moves on when one of them does
+// not answer, so a broken zone only shows up here.
+func raceAddresses(uri string, lookups []dnsLookup) []ipRace {
+	if !ipRaceCheck {
+		return nil
+	}
+	ports := map[string]string{}
+	_, hosts, _ := parseSeedList(uri)
+	for _, lookup := range lookups {
+		for _, answer := range lookup.Answers {
+			if value, ok := strings.CutPrefix(answer, "SRV "); ok {
+				hosts = append(hosts, value)
+			}
+		}
+	}
+	for _, hostPort := range hosts {
+		if host, port, err := net.SplitHostPort(hostPort); err == nil {
+			ports[host] = port
+		}
+	}
+	tlsConfig := probeTLSConfig(uri)
+	zones := endpointZoneIPs()
+
+	var races []ipRace
+	for _, lookup := range lookups {
+		var ips []string
+		for _, answer := range lookup.Answers {
+			if value, ok := strings.CutPrefix(answer, "A "); ok {
+				ips = append(ips, value)
+			}
+		}
+		port, ok := ports[lookup.Name]
+		if lookup.Type != "A" || len(ips) < 2 || !ok {
+			continue
+		}
+
+		race := ipRace{Host: net.JoinHostPort(lookup.Name, port), Attempts: make([]raceAttempt, len(ips))}
+		var wg sync.WaitGroup
+		for i, ip := range ips {
+			wg.Add(1)
+			go func(i int, ip string) {
+				defer wg.Done()
+				probe := probeHostAt(race.Host, net.JoinHostPort(ip, port), tlsConfig)
+				race.Attempts[i] = raceAttempt{IP: ip, Zone: zones[ip], Layer: probe.Layer, Error: probe.Error, TCPMS: probe.TCPMS, TLSMS: probe.TLSMS}
+			}(i, ip)
+		}
+		wg.Wait()
+
+		best := -1.0
+		for _, attempt := range race.Attempts {
+			if total := attempt.TCPMS + attempt.TLSMS; attempt.Layer == "ok" && (best < 0 || total < best) {
+				best, race.Fastest = total, attempt.IP
+			}
+		}
+		races = append(races, race)
+	}
+	return races
+}
+
+// endpointZoneIPs maps VPC endpoint interface addresses to their zone, as
+// last described.
+func endpointZoneIPs() map[string]string {
+	zones := map[string]string{}
+	for _, e := range vpcEndpointSnapshot() {
+		for _, zone := range e.Zones {
+			if zone.IP != "" {
+				zones[zone.IP] = zone.Zone
+			}
+		}
+	}
+	return zones
+}
+
+// evaluateIPRaces alerts when some addresses of a host stop answering
+// while others still do, and again when all of them answer. Hosts with no
+// working address are left to the failure alert.
+func (c *cluster) evaluateIPRaces(result checkResult) {
+	var failing []string
+	for _, race := range result.IPRaces {
+		if race.Fastest == "" {
+			continue
+		}
+		for _, attempt := range race.Attempts {
+			if attempt.Layer != "ok" {
+				failing = append(failing, race.Host+" via "+attempt.where()+": "+attempt.Layer+" "+attempt.Error)
+			}
+		}
+	}
+	sort.Strings(failing)
+	current := strings.Join(failing, "\n")
+	if current == c.raceFailures {
+		return
+	}
+	previous := c.raceFailures
+	c.raceFailures = current
+	if current != "" {
+		log.Printf("%s has addresses that do not answer:\n%s\n", c.name, current)
+		sendTargetAlert(c.name, "MongoDB Endpoint Addresses Failing",
+			tr("ipracing.failing", "Some addresses behind {target} do not answer while others do, so the driver is failing over silently:\n{failing}\n\n{races}",
+				"target", c.name, "failing", current, "races", describeIPRaces(result.IPRaces)))
+	} else if previous != "" {
+		sendTargetRecovery(c.name, "MongoDB Endpoint Addresses Answering Again",
+			tr("ipracing.answering", "Every address behind {target} answers again.", "target", c.name))
+	}
+}
+
+// describeIPRaces lists each address of each raced host with its timing.
+func describeIPRaces(races []ipRace) string {
+	var b strings.Builder
+	for _, race := range races {
+		b.WriteString(tr("ipracing.host", "{host} (fastest {fastest}):\n", "host", race.Host, "fastest", orString(race.Fastest, tr("ipracing.no_fastest", "none"))))
+		for _, attempt := range race.Attempts {
+			switch {
+			case attempt.Layer != "ok":
+				b.WriteString(tr("ipracing.attempt_failed", "  {address}: {layer} {error}\n", "address", attempt.where(), "layer", attempt.Layer, "error", attempt.Error))
+			case attempt.TLSMS > 0:
+				b.WriteString(tr("ipracing.attempt_tls", "  {address}: TCP {tcp:%.1f}ms, TLS {tls:%.1f}ms\n", "address", attempt.where(), "tcp", attempt.TCPMS, "tls", attempt.TLSMS))
+			default:
+				b.WriteString(tr("ipracing.attempt_tcp", "  {address}: TCP {tcp:%.1f}ms\n", "address", attempt.where(), "tcp", attempt.TCPMS))
+			}
+		}
+	}
+	return b.String()
+}
+
+// where is the address with its zone when known.
+func (a raceAttempt) where() string {
+	if a.Zone == "" {
+		return a.IP
+	}
+	return a.IP + " (" + a.Zone + ")"
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+var (
+	tcpKeepAlive      time.Duration
+	idleProbeLadder   []time.Duration
+	idleProbeInterval time.Duration
+)
+
+// loadKeepaliveConfig reads TCP_KEEPALIVE_SECONDS and the idle probe ladder,
+// IDLE_PROBE_MINUTES="1,5,10,30,60", which is re-run every
+// IDLE_PROBE_REPEAT_HOURS.
+func loadKeepaliveConfig() {
+	tcpKeepAlive = time.Duration(getEnvInt("TCP_KEEPALIVE_SECONDS", 0)) * time.Second
+	idleProbeInterval = time.Duration(getEnvInt("IDLE_PROBE_REPEAT_HOURS", 24)) * time.Hour
+
+	spec := os.Getenv("IDLE_PROBE_MINUTES")
+	if spec == "" {
+		return
+	}
+	for _, part := range strings.Split(spec, ",") {
+		minutes, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || minutes <= 0 {
+			log.Fatalf("Invalid IDLE_PROBE_MINUTES entry %q", part)
+		}
+		idleProbeLadder = append(idleProbeLadder, time.Duration(minutes*float64(time.Minute)))
+	}
+	sort.Slice(idleProbeLadder, func(i, j int) bool { return idleProbeLadder[i] < idleProbeLadder[j] })
+}
+
+// applyDialer sets the TCP keepalive period and source binding on
+// connections the driver opens.
+func applyDialer(opts *options.ClientOptions) {
+	if tcpKeepAlive > 0 || sourceIP != nil {
+		dialer := probeDialer(30 * time.Second)
+		dialer.KeepAlive = tcpKeepAlive
+		opts.SetDialer(dialer)
+	}
+}
+
+// startIdleProbe runs the idle ladder in the background: hold one pooled
+// connection idle for each duration in turn and check it still works. The
+// longest idle period that survives is the maximum safe idle time through
+// the endpoint with the configured keepalive.
+func startIdleProbe(uri string) {
+	if len(idleProbeLadder) == 0 {
+		return
+	}
+	go func() {
+		for {
+			safe, dropped := runIdleLadder(uri)
+			recordMaxSafeIdle(safe)
+			if dropped > 0 {
+				log.Printf("Idle probe: connection dropped after %v idle, maximum safe idle time %v (keepalive %s)\n", dropped, safe, describeKeepAlive())
+			} else {
+				log.Printf("Idle probe: connection survived every idle period, maximum safe idle time at least %v (keepalive %s)\n", safe, describeKeepAlive())
+			}
+			time.Sleep(idleProbeInterval)
+		}
+	}()
+}
+
+func runIdleLadder(uri string) (safe, dropped time.Duration) {
+	for _, idle := range idleProbeLadder {
+		err := probeIdle(uri, idle)
+		if err == nil {
+			log.Printf("Idle probe: connection survived %v idle\n", idle)
+			safe = idle
+			continue
+		}
+		if !mongo.IsNetworkError(err) && !mongo.IsTimeout(err) {
+			// Not an idle drop; the cluster is probably down, try again later
+			log.Printf("Idle probe at %v inconclusive: %v\n", idle, err)
+			return safe, 0
+		}
+		return safe, idle
+	}
+	return safe, 0
+}
+
+func probeIdle(uri string, idle time.Duration) error {
+	clientOpts := newClientOptions(uri, "idle").SetMaxPoolSize(1).SetMaxConnIdleTime(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	client, err := mongo.Connect(ctx, clientOpts)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer closeClient(client, "idle")
+
+	ping := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+		defer cancel()
+		return client.Ping(ctx, readpref.Primary())
+	}
+	if err := ping(); err != nil {
+		return fmt.Errorf("first ping: %w", err)
+	}
+	time.Sleep(idle)
+	return ping()
+}
+
+func describeKeepAlive() string {
+	if tcpKeepAlive == 0 {
+		return "driver default"
+	}
+	return tcpKeepAlive.String()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// leakReport is what /status shows about cursors and sessions left behind
+// by probes, and the server-wide open cursor count.
+type leakReport struct {
+	LeakedCursors     map[string]int `json:"leaked_cursors,omitempty"`
+	LeakedSessions    map[string]int `json:"leaked_sessions,omitempty"`
+	ServerOpenCursors int64          `json:"server_open_cursors"`
+	ServerTimedOut    int64          `json:"server_timed_out_cursors"`
+}
+
+var (
+	openCursorThreshold int64
+
+	leakMu          sync.Mutex
+	openCursors     = map[int64]string{}
+	pendingGetMores = map[int64]int64{}
+	leakedCursors   = map[string]int{}
+	leakedSessions  = map[string]int{}
+
+	serverOpenCursors int64
+	serverTimedOut    int64
+	cursorsHigh       bool
+)
+
+func loadLeakConfig() {
+	openCursorThreshold = int64(getEnvInt("OPEN_CURSORS_THRESHOLD", 0))
+}
+
+// cursorMonitor follows the cursors a probe client opens and closes, so a
+// probe that forgets to close one is caught at the end of the cycle.
+func cursorMonitor(probe string) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			leakMu.Lock()
+			defer leakMu.Unlock()
+			switch evt.CommandName {
+			case "getMore":
+				if id, ok := evt.Command.Lookup("getMore").Int64OK(); ok {
+					pendingGetMores[evt.RequestID] = id
+				}
+			case "killCursors":
+				if cursors, ok := evt.Command.Lookup("cursors").ArrayOK(); ok {
+					ids, _ := cursors.Values()
+					for _, id := range ids {
+						delete(openCursors, id.AsInt64())
+					}
+				}
+			}
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			leakMu.Lock()
+			defer leakMu.Unlock()
+			id, _ := evt.Reply.Lookup("cursor", "id").Int64OK()
+			switch evt.CommandName {
+			case "find", "aggregate", "listIndexes", "listCollections":
+				if id != 0 {
+					openCursors[id] = probe
+				}
+			case "getMore":
+				if id == 0 {
+					delete(openCursors, pendingGetMores[evt.RequestID])
+				}
+				delete(pendingGetMores, evt.RequestID)
+			}
+		},
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			// A failed getMore may leave the cursor open on the server, so
+			// it stays tracked
+			leakMu.Lock()
+			delete(pendingGetMores, evt.RequestID)
+			leakMu.Unlock()
+		},
+	}
+}
+
+// closeClient disconnects a probe client, counting any explicit sessions
+// the probe started and never ended. Disconnect gets its own deadline
+// rather than what is left of the probe's, which is often nothing after a
+// failure, and a dead connection cannot hold it up for longer than
+// MONGODB_DISCONNECT_TIMEOUT_MS.
+func closeClient(client *mongo.Client, probe string) {
+	if n := client.NumberSessionsInProgress(); n > 0 {
+		log.Printf("Probe %s leaked %d session(s)\n", probe, n)
+		leakMu.Lock()
+		leakedSessions[probe] += n
+		leakMu.Unlock()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := client.Disconnect(ctx); err != nil {
+		log.Printf("Disconnect of %s client gave up after %v: %v\n", probe, time.Since(start).Round(time.Millisecond), err)
+	}
+}
+
+// endLeakCycle runs after every probe of the cycle has finished; cursors
+// still open at that point belong to clients that are already gone and
+// will only be reaped by the server's idle cursor timeout.
+func endLeakCycle() {
+	leakMu.Lock()
+	defer leakMu.Unlock()
+	for id, probe := range openCursors {
+		log.Printf("Probe %s leaked cursor %d\n", probe, id)
+		leakedCursors[probe]++
+	}
+	clear(openCursors)
+	clear(pendingGetMores)
+}
+
+// recordServerCursors takes the open cursor counts from serverStatus and
+// alerts when they cross OPEN_CURSORS_THRESHOLD.
+func recordServerCursors(serverStatus bson.M) {
+	metrics, _ := serverStatus["metrics"].(bson.M)
+	cursor, _ := metrics["cursor"].(bson.M)
+	open, _ := cursor["open"].(bson.M)
+	total, ok := toInt64(open["total"])
+	if !ok {
+		return
+	}
+	timedOut, _ := toInt64(cursor["timedOut"])
+	log.Printf("Open cursors: %d (timed out since startup: %d)\n", total, timedOut)
+
+	leakMu.Lock()
+	serverOpenCursors = total
+	serverTimedOut = timedOut
+	wasHigh := cursorsHigh
+	cursorsHigh = openCursorThreshold > 0 && total >= openCursorThreshold
+	high := cursorsHigh
+	leakMu.Unlock()
+
+	if high && !wasHigh {
+		sendAlert("MongoDB Open Cursors High",
+			tr("cursors.high", "The server has {open} open cursors (threshold {threshold}, {timed_out} timed out since startup).\n"+
+				"Cursors abandoned by clients during flaky connectivity hold memory and locks until they time out.",
+				"open", total, "threshold", openCursorThreshold, "timed_out", timedOut))
+	} else if !high && wasHigh {
+		sendRecovery("MongoDB Open Cursors Back To Normal", tr("cursors.normal", "The server has {open} open cursors (threshold {threshold}).", "open", total, "threshold", openCursorThreshold))
+	}
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+func leakSnapshot() leakReport {
+	leakMu.Lock()
+	defer leakMu.Unlock()
+	return leakReport{
+		LeakedCursors:     maps.Clone(leakedCursors),
+		LeakedSessions:    maps.Clone(leakedSessions),
+		ServerOpenCursors: serverOpenCursors,
+		ServerTimedOut:    serverTimedOut,
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var logLevel slog.LevelVar
+
+// setupLogging switches the log file to leveled, structured records:
+// LOG_FORMAT is text (key=value, the default) or json, one object per line
+// for log shippers, and LOG_LEVEL is debug, info (the default), warn or
+// error. Plain log.Printf lines go through the same handler at info level.
+func setupLogging() {
+	configureLogRotation()
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		logLevel.Set(slog.LevelDebug)
+	case "", "info":
+		logLevel.Set(slog.LevelInfo)
+	case "warn", "warning":
+		logLevel.Set(slog.LevelWarn)
+	case "error":
+		logLevel.Set(slog.LevelError)
+	default:
+		log.Fatalf("Invalid LOG_LEVEL %q: expected debug, info, warn or error", os.Getenv("LOG_LEVEL"))
+	}
+
+	opts := &slog.HandlerOptions{Level: &logLevel, AddSource: true}
+	var handler slog.Handler
+	switch strings.ToLower(os.Getenv("LOG_FORMAT")) {
+	case "", "text":
+		handler = slog.NewTextHandler(logOutput(), opts)
+	case "json":
+		handler = slog.NewJSONHandler(logOutput(), opts)
+	default:
+		log.Fatalf("Invalid LOG_FORMAT %q: expected text or json", os.Getenv("LOG_FORMAT"))
+	}
+	slog.SetDefault(slog.New(handler))
+}
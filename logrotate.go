@@ -0,0 +1,160 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatingLog is the log file. It is rotated when it would grow past
+// LOG_MAX_SIZE_MB (default 100) or has been written to for LOG_MAX_AGE_HOURS
+// (default 0, no age limit): the file is renamed with a timestamp suffix,
+// gzipped when LOG_COMPRESS=true, and only the newest LOG_MAX_BACKUPS
+// (default 5) rotated files are kept.
+type rotatingLog struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	compress   bool
+}
+
+// openRotatingLog opens path for appending. Rotation stays off until
+// configureLogRotation has read the settings.
+func openRotatingLog(path string) (*rotatingLog, error) {
+	l := &rotatingLog{path: path}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func configureLogRotation() {
+	logFile.mu.Lock()
+	defer logFile.mu.Unlock()
+	logFile.maxSize = int64(getEnvInt("LOG_MAX_SIZE_MB", 100)) << 20
+	logFile.maxAge = time.Duration(getEnvInt("LOG_MAX_AGE_HOURS", 0)) * time.Hour
+	logFile.maxBackups = getEnvInt("LOG_MAX_BACKUPS", 5)
+	logFile.compress = os.Getenv("LOG_COMPRESS") == "true"
+}
+
+func (l *rotatingLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size, l.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tooBig := l.maxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.maxSize
+	tooOld := l.maxAge > 0 && time.Since(l.opened) >= l.maxAge
+	if tooBig || tooOld {
+		if err := l.rotate(); err != nil {
+			// Keep logging to whatever file is open rather than losing lines
+			os.Stderr.WriteString("log rotation failed: " + err.Error() + "\n")
+		}
+	}
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file and starts a new one. The caller holds
+// l.mu.
+func (l *rotatingLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	backup := l.path + "." + time.Now().Format("2006-01-02T15-04-05.000")
+	renameErr := os.Rename(l.path, backup)
+	if err := l.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	go l.cleanup(backup)
+	return nil
+}
+
+// cleanup compresses the file just rotated out and removes the oldest
+// backups beyond the limit.
+func (l *rotatingLog) cleanup(backup string) {
+	if l.compress {
+		if err := gzipFile(backup); err != nil {
+			log.Printf("Failed to compress rotated log %s: %v\n", backup, err)
+		}
+	}
+	if l.maxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(l.path + ".*")
+	if err != nil {
+		return
+	}
+	// The timestamp suffix sorts chronologically
+	sort.Strings(backups)
+	for len(backups) > l.maxBackups {
+		if !strings.HasSuffix(backups[0], ".tmp") {
+			os.Remove(backups[0])
+		}
+		backups = backups[1:]
+	}
+}
+
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz.tmp")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".gz.tmp", path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (l *rotatingLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// repeatedError tracks an error that keeps recurring at the same log site so
+// that long outages produce periodic summaries instead of one line per cycle.
+type repeatedError struct {
+	scope       string
+	message     string
+	count       int
+	windowStart time.Time
+	seen        bool
+}
+
+var (
+	errorSummaryInterval time.Duration
+
+	throttleMu     sync.Mutex
+	repeatedErrors = map[string]*repeatedError{}
+)
+
+// logThrottled logs "<prefix>: <err>" the first time an error is seen for
+// prefix and then only a summary every errorSummaryInterval while it repeats.
+func logThrottled(prefix string, err error) {
+	logThrottledScoped("", prefix, err)
+}
+
+// logThrottledScoped is logThrottled for errors of a check loop other than
+// the primary one; scope names the loop whose cycles clear them.
+func logThrottledScoped(scope, prefix string, err error) {
+	message := err.Error()
+	now := time.Now()
+
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+
+	r, ok := repeatedErrors[prefix]
+	if !ok || r.message != message {
+		if ok && r.count > 0 {
+			slog.Warn(prefix+": previous error repeated", "count", r.count, "error", r.message)
+		}
+		repeatedErrors[prefix] = &repeatedError{scope: scope, message: message, windowStart: now, seen: true}
+		slog.Error(prefix, "error", err)
+		return
+	}
+
+	r.seen = true
+	r.count++
+	if elapsed := now.Sub(r.windowStart); elapsed >= errorSummaryInterval {
+		slog.Error(prefix+": same error", "count", r.count, "window", elapsed.Round(time.Second).String(), "error", r.message)
+		r.count = 0
+		r.windowStart = now
+	}
+}
+
+// endThrottleCycle is called once per check cycle of the loop named by
+// scope. Errors that were not reported again during the cycle have cleared;
+// their pending count is logged and they are forgotten so a recurrence is
+// logged in full.
+func endThrottleCycle(scope string) {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+
+	for prefix, r := range repeatedErrors {
+		if r.scope != scope {
+			continue
+		}
+		if r.seen {
+			r.seen = false
+			continue
+		}
+		if r.count > 0 {
+			slog.Info(prefix+": error cleared", "repeated", r.count, "error", r.message)
+		}
+		delete(repeatedErrors, prefix)
+	}
+}
@@ -2,48 +2,87 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"net/smtp"
+	"log/slog"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var (
-	lastConnectionStatus bool
-	smtpHost             string
-	smtpPort             string
-	fromEmail            string
-	toEmail              string
-	password             string
-	index                string
-	checkInterval        time.Duration
-	logFile              *os.File
+	smtpHost      string
+	smtpPort      string
+	fromEmail     string
+	toEmail       string
+	password      string
+	index         string
+	checkInterval time.Duration
+	logFile       *rotatingLog
 )
 
-func init() {
+// checkResult is the outcome of one check cycle as published to status feeds.
+type checkResult struct {
+	Time        time.Time   `json:"time"`
+	Target      string      `json:"target"`
+	Status      string      `json:"status"`
+	Health      string      `json:"health"`
+	PingMS      float64     `json:"ping_ms,omitempty"`
+	WriteMS     float64     `json:"canary_write_ms,omitempty"`
+	ReadMS      float64     `json:"canary_read_ms,omitempty"`
+	LatencyMS   float64     `json:"latency_ms"`
+	Error       string      `json:"error,omitempty"`
+	ErrorClass  string      `json:"error_class,omitempty"`
+	ErrorHost   string      `json:"error_host,omitempty"`
+	Fingerprint string      `json:"fingerprint,omitempty"`
+	TraceID     string      `json:"trace_id"`
+	ColdConnect bool        `json:"cold_connect"`
+	DNS         []dnsLookup `json:"dns,omitempty"`
+	Hosts       []hostProbe `json:"hosts,omitempty"`
+	PublicIPs   []string    `json:"public_ips,omitempty"`
+	IPRaces     []ipRace    `json:"ip_races,omitempty"`
+	Unreachable []string    `json:"unreachable_members,omitempty"`
+	Annotation  string      `json:"annotation,omitempty"`
+	// ClockGapMS is how much of the time since the previous check fell
+	// into a clock gap (host sleep, VM pause, NTP step): not downtime
+	ClockGapMS float64 `json:"clock_gap_ms,omitempty"`
+}
+
+// initialize opens the log and loads the configuration; it runs once the
+// command line is parsed, since flags choose the files involved.
+func initialize() {
 	var err error
-	logFile, err = os.OpenFile("mongodb_connection_monitor.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	logFile, err = openRotatingLog("mongodb_connection_monitor.log")
 	if err != nil {
 		log.Fatal("Failed to open log file:", err)
 	}
-	log.SetOutput(logFile)
+	log.SetOutput(logOutput())
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
 	log.Println("Starting application initialization")
 
-	err = godotenv.Load()
-	if err != nil {
+	// Environment variables win over .env, which wins over the config file
+	configFile := configFilePath()
+	err = godotenv.Load(envFile)
+	if err != nil && !(os.IsNotExist(err) && (configFile != "" || envFile != ".env")) {
 		log.Fatal("Error loading .env file:", err)
 	}
+	if configFile != "" {
+		set, err := loadConfigFile(configFile)
+		if err != nil {
+			log.Fatal("Error loading config file: ", err)
+		}
+		log.Printf("Loaded %d setting(s) from %s\n", set, configFile)
+	}
+	setupLogging()
 
 	smtpHost = os.Getenv("SMTP_HOST")
 	smtpPort = os.Getenv("SMTP_PORT")
@@ -51,10 +90,76 @@ func init() {
 	toEmail = os.Getenv("TO_EMAIL")
 	password = os.Getenv("EMAIL_PASSWORD")
 	index = os.Getenv("INDEX")
-
-	if smtpHost == "" || smtpPort == "" || fromEmail == "" || toEmail == "" || password == "" {
-		log.Fatal("Email configuration is incomplete in .env file")
-	}
+	loadFIPSConfig()
+	loadTracingConfig()
+	loadTenants()
+	loadAPITokens()
+	loadCredentialSets()
+	loadMQTTConfig()
+	startMQTTPublisher()
+	loadHTTPConfig()
+	loadSilences()
+	loadIncidentConfig()
+	loadSchedules()
+	loadTelemetry()
+	loadCycleConfig()
+	loadStatusConfig()
+	loadLivenessConfig()
+	loadTextfileConfig()
+	loadMessageCatalog()
+	loadFallbackChain()
+	loadAlertRoutes()
+	loadInhibitRules()
+	loadBodyLimits()
+	loadRateLimitConfig()
+	startNotificationWorker()
+	loadInitialStateConfig()
+	loadConcerns()
+	loadTimeouts()
+	loadKeepaliveConfig()
+	loadSourceBinding()
+	loadTriggerConfig()
+	loadAtlasConfig()
+	loadShardConfig()
+	loadBalancerConfig()
+	loadReplicationConfig()
+	loadCapabilityConfig()
+	loadIndexProbeConfig()
+	loadGridFSProbeConfig()
+	loadLeakConfig()
+	loadDebugCaptureConfig()
+	loadCommandLogConfig()
+	loadVersionState()
+	loadDriftConfig()
+	loadConsulConfig()
+	loadExpectedTopology()
+	loadTopologyChangeConfig()
+	loadClusterIdentity()
+	loadReadAfterWriteConfig()
+	loadProbeScripts()
+	loadAnalyticsConfig()
+	loadHostProbeConfig()
+	loadIPRaceConfig()
+	loadAZRedundancyConfig()
+	loadResultStreamConfig()
+	loadCertConfig()
+	loadHealthConfig()
+	loadCleanupConfig()
+	loadCanaryConfig()
+	loadDumpConfig()
+	loadHistoryConfig()
+	loadHistoryDBConfig()
+	loadDigestConfig()
+	loadSLOConfig()
+	loadSLOExportConfig()
+	loadAWSConfig()
+	loadAWSHealthConfig()
+	loadAWSAccounts()
+	loadVPCEndpointConfig()
+	loadPrivatePathConfig()
+	loadAtlasEndpointConfig()
+	loadUsageConfig()
+	loadAtlasStatusConfig()
 
 	intervalStr := os.Getenv("CHECK_INTERVAL_SECONDS")
 	if intervalStr == "" {
@@ -65,119 +170,474 @@ func init() {
 		log.Fatalf("Invalid CHECK_INTERVAL_SECONDS: %v", err)
 	}
 	checkInterval = time.Duration(interval) * time.Second
+	clockJumpThreshold = time.Duration(getEnvInt("CLOCK_JUMP_THRESHOLD_SECONDS", 60)) * time.Second
+	errorSummaryInterval = time.Duration(getEnvInt("ERROR_SUMMARY_INTERVAL_MINUTES", 60)) * time.Minute
+	loadClusters()
+	loadURISources()
+	loadConnectionMode()
 
 	log.Println("Application initialization complete")
 }
 
 func main() {
+	command, args := parseCommandLine()
+	if command == "version" {
+		printVersion()
+		return
+	}
+	initialize()
 	defer logFile.Close()
 
+	var err error
+	switch command {
+	case "run":
+		err = runMonitor(args)
+	case "check":
+		err = runCheckCommand(args)
+	case "validate-config":
+		err = runValidateConfigCommand(args)
+	case "report":
+		err = runReportCommand(args)
+	case "diagnose":
+		err = runDiagnoseCommand(args)
+	case "silence", "unsilence":
+		err = runSilenceCommand(command, args)
+	case "drill":
+		err = runDrillCommand(args)
+	case "provision":
+		err = runProvisionCommand(args)
+	case "cleanup":
+		err = runCleanupCommand(args)
+	}
+	shutdownTracing()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", command, err)
+		logFile.Close()
+		os.Exit(1)
+	}
+}
+
+// runMonitor implements `run`, the default command: check every cluster
+// forever, or once with -once.
+func runMonitor(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.BoolVar(&runOnce, "once", runOnce, "run a single check cycle of every cluster, deliver its alerts, and exit")
+	fs.Parse(args)
+	monitoring = true
+
 	mongoURI := os.Getenv("MONGODB_URI")
 	if mongoURI == "" {
 		log.Fatal("MONGODB_URI not set in .env file")
 	}
+	if len(allNotifiers()) == 0 {
+		return errors.New("no notification channel is configured: set up email (SMTP_*), SLACK_WEBHOOK_URL, PAGERDUTY_ROUTING_KEY or WEBHOOK_URLS")
+	}
 
 	log.Printf("Starting MongoDB connection monitor. Check interval: %v\n", checkInterval)
 	log.Printf("MongoDB URI: %s\n", mongoURI)
+	if sourceIP != nil {
+		log.Printf("Probe connections leave from %s\n", describeSourceBinding())
+	}
+	reportConcerns(mongoURI)
+	reportTimeouts(mongoURI)
+
+	if report := runSelfTest(mongoURI); !report.OK && selfTestStrict() {
+		log.Fatal("Startup self-test failed a critical step, refusing to start (SELFTEST_STRICT=true)")
+	}
+
+	if runOnce {
+		return runSingleCycle()
+	}
+
+	startHTTPServer()
+	startServiceRegistration()
+	startResultStream()
+	startIdleProbe(mongoURI)
+	startDriftCheck()
+	startAWSHealthPoller()
+	startVPCEndpointCheck()
+	startUsagePoller()
+	startAtlasStatusPoller()
+	startURISourceWatcher()
+	startDigest()
+
+	for _, c := range clusters[1:] {
+		log.Printf("Also monitoring cluster %s every %v\n", c.name, c.interval)
+		go c.run()
+	}
+	clusters[0].run()
+	return nil
+}
 
+// run is the cluster's check loop. Only the primary cluster's loop watches
+// for clock jumps.
+func (c *cluster) run() {
+	var pending []checkRequest
 	for {
-		err := checkConnection(mongoURI)
-
-		if err == nil && !lastConnectionStatus {
-			sendAlert("MongoDB Connection Restored", "The connection to MongoDB has been restored.")
-			lastConnectionStatus = true
-		} else if err != nil && lastConnectionStatus {
-			sendAlert("MongoDB Connection Failed", fmt.Sprintf("MongoDB Connectivity Error: %v", err))
-			lastConnectionStatus = false
+		cycleStart := time.Now()
+		clockJumped := c.primary && detectClockJump(cycleStart)
+		rotated := c.applyURIRotation()
+		result, err := c.check()
+		c.lastErr = err
+		result.Annotation = rotated
+		if !c.lastCycle.IsZero() {
+			result.ClockGapMS = float64(clockGapTime(c.lastCycle, cycleStart.Round(0)).Milliseconds())
+		}
+		c.lastCycle = cycleStart.Round(0)
+		start := result.Time
+		if err == nil && c.primary {
+			checkCredentials(c.uri)
+			checkShards(c.uri)
+			checkBalancer(c.uri)
+			checkReplicationLag(c.uri)
+			checkIndexProbe(c.uri)
+			checkGridFSProbe(c.uri)
+			checkReadAfterWrite(c.uri)
+			checkAnalyticsNodes(c.uri)
+			checkProbeScripts(c.uri)
+			checkCertExpiry()
+		}
+		c.checkVariants()
+		publishMQTT(result)
+		streamResult(result)
+		c.endThrottleCycle()
+		if c.primary {
+			endLeakCycle()
+		}
+
+		c.countStreak(err, start)
+		if c.applyInitialState(err) {
+			// Startup policy decided what this result means
+		} else if err != nil && clockJumped && c.up {
+			// The network is often still coming back right after a wake-up;
+			// give it one more cycle before calling it an outage
+			log.Printf("Ignoring failure right after clock jump, will re-check: %v\n", err)
+		} else if err == nil && !c.up && c.successes < successesBeforeRecovery {
+			slog.Info("check succeeded, not calling it restored yet", "target", c.name, "successes", c.successes, "required", successesBeforeRecovery)
+		} else if err == nil && !c.up {
+			dump := c.captureStateDump("recovery", result)
+			sendTransition("MongoDB Connection Restored", tr("connection.restored", "The connection to MongoDB has been restored.\n\n")+recoverySummary(c.name, start)+dump, result)
+			closeIncident(c.name)
+			c.up = true
+		} else if err != nil && c.up && c.failures < failuresBeforeAlert {
+			slog.Warn("check failed, not alerting yet", "target", c.name, "failures", c.failures, "required", failuresBeforeAlert, "error", err)
+		} else if err != nil && c.up {
+			inc := openIncident(c.name, c.failingSince)
+			recordIncidentFailure(result)
+			recordIncidentCommands(c.name, c.uri)
+			dump := c.captureStateDump("failure", result)
+			annotateIncidentsWithAWS()
+			sendTransition("MongoDB Connection Failed", tr("connection.failed", "MongoDB Connectivity Error: {error}\n{class}\n\n{hosts}{dns}{dns_change}\n{aws}{atlas_status}{endpoints}{atlas_endpoints}{dump}{ack}",
+				"error", err, "class", c.describeFailureClass(result.ErrorClass), "hosts", describeHostProbes(result.Hosts), "dns", describeDNSLookups(result.DNS),
+				"dns_change", lastDNSChangeSummary(), "aws", awsHealthSummary(start), "atlas_status", atlasStatusSummary(), "endpoints", vpcEndpointFailureSummary(),
+				"atlas_endpoints", atlasEndpointSummary(), "dump", dump, "ack", ackLinkText(inc)), result)
+			c.up = false
+		} else if err != nil {
+			if changed, previous := recordIncidentFailure(result); changed {
+				dispatchAlert(Alert{Subject: "MongoDB Connection Failure Changed", Target: c.name, Severity: severityCritical, Class: result.ErrorClass,
+					Body: tr("connection.error_changed", "The underlying error changed.\nPrevious ({class}, {count} check(s) since {since}): {previous}\nNow: {error}\n{failure_class}",
+						"class", previous.Class, "count", previous.Count, "since", previous.First.Format("15:04"), "previous", previous.Error,
+						"error", err, "failure_class", c.describeFailureClass(result.ErrorClass))})
+			}
+			sendReminder(c.name, err)
+		}
+		c.evaluateDegraded(result)
+		c.evaluatePrivatePath(result)
+		c.evaluateIPRaces(result)
+
+		cycleDuration := time.Since(cycleStart)
+		recordCycle(cycleDuration, c.interval)
+		recordResult(result)
+		recordHistory(result)
+		if c.primary {
+			evaluateSLO(result)
+		}
+		c.updateStatus(result, cycleDuration)
+		writeTextfile()
+		if c.primary {
+			updateConsulTarget(c.uri, result, c.up)
+		}
+
+		for _, req := range pending {
+			req.reply <- result
+		}
+		if runOnce {
+			return
 		}
 
-		time.Sleep(checkInterval)
+		delay := nextCycleDelay(cycleDuration, c.interval)
+		if c.primary {
+			expectWakeAfter(delay)
+		}
+		pending = c.waitForNextCycle(delay)
 	}
 }
 
-func checkConnection(uri string) error {
-	log.Println("Starting connection check")
+// check runs one connection check and builds its result, with the DNS
+// lookups made for it and, when it failed, the per-host probes.
+func (c *cluster) check() (checkResult, error) {
+	lookups := trackDNS(c.uri)
+	if c.primary {
+		endpointLookups := trackEndpointDNS()
+		evaluateAZRedundancy(endpointLookups)
+		lookups = append(lookups, endpointLookups...)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
-	defer cancel()
+	start := time.Now()
+	span := startCheckSpan(c.name)
+	traceID := spanTraceID(span)
+	slog.Debug("check started", "target", c.name, "trace_id", traceID)
+	cold, err := c.checkWithWatchdog()
+	result := newCheckResult(c.name, start, err)
+	result.TraceID = traceID
+	result.ColdConnect = cold
+	var ping time.Duration
+	if err == nil {
+		ping = c.pingLatency
+		result.PingMS = float64(ping.Microseconds()) / 1000
+		result.WriteMS = float64(c.canaryWrite.Microseconds()) / 1000
+		result.ReadMS = float64(c.canaryRead.Microseconds()) / 1000
+	}
+	result.Health = healthOf(err, ping)
+	if err == nil {
+		result.Unreachable = c.trackMembers()
+		if result.Health == healthHealthy && len(result.Unreachable) > 0 {
+			result.Health = healthDegraded
+		}
+	}
+	slog.Info("check completed", "target", c.name, "status", result.Status, "health", result.Health,
+		"latency_ms", result.LatencyMS, "ping_ms", result.PingMS, "error_class", result.ErrorClass, "trace_id", traceID)
+	result.DNS = lookups
+	result.PublicIPs = publicAddresses(c.uri, lookups)
+	result.IPRaces = raceAddresses(c.uri, lookups)
+	if err != nil || debugCaptureActive() {
+		result.Hosts = probeHosts(c.uri, replyHosts(c.topology, "hosts", "passives", "arbiters"))
+	}
+	endCheckSpan(span, result, err)
+	return result, err
+}
 
-	clientOpts := options.Client().ApplyURI(uri)
+func targetName() string {
+	if index != "" {
+		return index
+	}
+	return "default"
+}
 
-	client, err := mongo.Connect(ctx, clientOpts)
+func newCheckResult(target string, start time.Time, err error) checkResult {
+	result := checkResult{
+		Time:      start,
+		Target:    target,
+		Status:    "up",
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = "down"
+		result.Error = err.Error()
+		result.ErrorClass = classifyError(err)
+		result.Fingerprint, result.ErrorHost = fingerprintError(err, result.ErrorClass)
+	}
+	return result
+}
+
+func getEnvInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
 	if err != nil {
-		log.Printf("Failed to connect to MongoDB: %v\n", err)
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return n
+}
+
+// newClientOptions builds driver options from the URI plus the configured
+// concern, timeout, and dialer overrides, with cursor tracking for the probe.
+func newClientOptions(uri, probe string) *options.ClientOptions {
+	clientOpts := options.Client().ApplyURI(uri)
+	applyConcerns(clientOpts, probe)
+	applyTimeouts(clientOpts)
+	applyDialer(clientOpts)
+	applyCertCapture(clientOpts)
+	applyDebugCapture(clientOpts)
+	clientOpts.SetMonitor(commandMonitor(uri, probe))
+	return clientOpts
+}
+
+// checkConnection connects, pings, and reads the server status and
+// topology. It only records what it reads in check, for adopt to apply if
+// the check returns in time; it changes no state of its own. The reads
+// that keep state about the deployment only run for the primary cluster.
+func (c *cluster) checkConnection(check *connectionCheck) (cold bool, err error) {
+	slog.Debug("starting connection check", "target", c.name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+	defer cancel()
+
+	var client *mongo.Client
+	var clientOpts *options.ClientOptions
+	err = withOperation(ctx, func(ctx context.Context) error {
+		var err error
+		client, clientOpts, cold, err = check.acquireClient(ctx, check.uri)
 		return err
+	})
+	if err != nil {
+		c.logThrottled("Failed to connect to MongoDB", err)
+		return cold, err
+	}
+	defer func() { check.releaseClient(err != nil) }()
+	if cold {
+		slog.Debug("checking with a newly connected client", "target", c.name)
 	}
-	defer client.Disconnect(ctx)
 
 	// Test connection
-	err = client.Ping(ctx, readpref.Primary())
+	pingStart := time.Now()
+	err = withOperation(ctx, func(ctx context.Context) error { return client.Ping(ctx, readpref.Primary()) })
+	check.pingLatency = time.Since(pingStart)
 	if err != nil {
-		log.Printf("Failed to ping MongoDB: %v\n", err)
-		return err
+		c.logThrottled("Failed to ping MongoDB", err)
+		return cold, err
+	}
+	if cold {
+		// The first ping of a new client includes connection setup; time
+		// a second one for the degraded threshold
+		pingStart = time.Now()
+		if err = withOperation(ctx, func(ctx context.Context) error { return client.Ping(ctx, readpref.Primary()) }); err != nil {
+			c.logThrottled("Failed to ping MongoDB", err)
+			return cold, err
+		}
+		check.pingLatency = time.Since(pingStart)
 	}
 
-	log.Println("Successfully connected to MongoDB")
+	slog.Debug("connected to MongoDB", "target", c.name)
+	if cold && c.primary {
+		withOperation(ctx, func(ctx context.Context) error {
+			check.capabilities = discoverCapabilities(ctx, client)
+			return nil
+		})
+	}
 
-	// Print connection information
-	log.Println("Connection Information:")
 	var serverStatus bson.M
-	err = client.Database("admin").RunCommand(ctx, bson.D{{"serverStatus", 1}}).Decode(&serverStatus)
+	err = withOperation(ctx, func(ctx context.Context) error {
+		return client.Database("admin").RunCommand(ctx, bson.D{{Key: "serverStatus", Value: 1}}).Decode(&serverStatus)
+	})
 	if err != nil {
-		log.Printf("Failed to get server status: %v\n", err)
-		return err
+		c.logThrottled("Failed to get server status", err)
+		return cold, err
 	}
-	log.Printf("Server version: %v\n", serverStatus["version"])
+	slog.Debug("server version", "target", c.name, "version", serverStatus["version"])
+	check.serverStatus = serverStatus
 	if transportSecurity, ok := serverStatus["transportSecurity"].(bson.M); ok {
-		log.Printf("Connection type: %v\n", transportSecurity["type"])
+		slog.Debug("connection type", "target", c.name, "type", transportSecurity["type"])
 	}
 
-	// Print cluster topology
-	log.Println("Cluster Topology:")
+	// Read cluster topology
 	var topology bson.M
-	err = client.Database("admin").RunCommand(ctx, bson.D{{"isMaster", 1}}).Decode(&topology)
+	err = withOperation(ctx, func(ctx context.Context) error {
+		return client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&topology)
+	})
 	if err != nil {
-		log.Printf("Failed to get cluster topology: %v\n", err)
-		return err
+		c.logThrottled("Failed to get cluster topology", err)
+		return cold, err
 	}
-	log.Printf("Is master: %v\n", topology["ismaster"])
-	if hosts, ok := topology["hosts"].(primitive.A); ok {
-		log.Println("Hosts:")
-		for _, host := range hosts {
-			log.Printf("  - %v\n", host)
+	slog.Debug("cluster topology", "target", c.name, "ismaster", topology["ismaster"], "hosts", topology["hosts"], "secondaries", topology["secondaries"])
+	check.topology = topology
+	withOperation(ctx, func(ctx context.Context) error {
+		check.primaryHost, check.electedAt, check.term = c.observePrimary(ctx, client, topology)
+		return nil
+	})
+
+	if c.primary && (check.pinned != nil || monitoring) {
+		withOperation(ctx, func(ctx context.Context) error {
+			identity := observeIdentity(ctx, client, topology, serverStatus)
+			check.identity = &identity
+			return nil
+		})
+		if err = compareIdentity(check.pinned, *check.identity); err != nil {
+			slog.Error("cluster identity check failed", "target", c.name, "error", err)
+			return cold, err
 		}
 	}
-	if secondaries, ok := topology["secondaries"].(primitive.A); ok {
-		log.Println("Secondaries:")
-		for _, secondary := range secondaries {
-			log.Printf("  - %v\n", secondary)
-		}
+	if c.primary {
+		withOperation(ctx, func(ctx context.Context) error {
+			check.features = readServerFeatures(ctx, client, clientOpts)
+			return nil
+		})
 	}
 
-	// Print read preference
-	log.Printf("Read Preference: %v\n", clientOpts.ReadPreference)
-
-	// Print write concern
-	log.Printf("Write Concern: %+v\n", clientOpts.WriteConcern)
+	if check.capabilities != nil && !check.capabilities.allows("canary") {
+		slog.Debug("skipping canary, the monitor user lacks its privileges", "target", c.name)
+	} else if check.canaryWrite, check.canaryRead, err = c.runCanary(ctx, client); err != nil {
+		c.logThrottled("Canary write/read failed", err)
+		return cold, err
+	}
 
-	log.Println("Connection check complete")
-	return nil
+	readPreference := "primary (driver default)"
+	if clientOpts.ReadPreference != nil {
+		readPreference = clientOpts.ReadPreference.Mode().String()
+	}
+	slog.Debug("connection check complete", "target", c.name, "read_preference", readPreference,
+		"write_concern", describeWriteConcern(clientOpts.WriteConcern), "read_concern", describeReadConcern(clientOpts.ReadConcern))
+	return cold, nil
 }
 
+// sendAlert sends an alert about the primary cluster.
 func sendAlert(subject, body string) {
-	log.Printf("Sending alert: %s\n", subject)
-	auth := smtp.PlainAuth("", fromEmail, password, smtpHost)
-	to := []string{toEmail}
+	sendTargetAlert(targetName(), subject, body)
+}
 
-	currentTime := time.Now().Format("2006-01-02 15:04:05")
+func sendTargetAlert(target, subject, body string) {
+	dispatchAlert(Alert{Subject: subject, Body: body, Target: target})
+}
 
-	msg := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\nDate: %s\r\nIndex: %s\r\n%s", toEmail, subject, currentTime, index, body))
+// sendRecovery sends the alert saying a problem of the primary cluster is
+// over.
+func sendRecovery(subject, body string) {
+	sendTargetRecovery(targetName(), subject, body)
+}
 
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, fromEmail, to, msg)
-	if err != nil {
-		log.Printf("Failed to send alert email: %v\n", err)
+func sendTargetRecovery(target, subject, body string) {
+	dispatchAlert(Alert{Subject: subject, Body: body, Target: target, Resolved: true})
+}
+
+// sendTransition sends the alert for a connection state change. The check
+// result goes along for notifiers that report it, and a successful result
+// marks the alert that closes the open incident, which notifiers with
+// incident state of their own (PagerDuty) use to resolve it.
+func sendTransition(subject, body string, result checkResult) {
+	dispatchAlert(Alert{Subject: subject, Body: body, Target: result.Target, Severity: severityCritical, Class: result.ErrorClass,
+		Result: &result, Resolved: result.Error == ""})
+}
+
+func dispatchAlert(alert Alert) {
+	subject := alert.Subject
+	if s, ok := activeSilence(alert.Target); ok {
+		slog.Info("alert suppressed by silence", "target", s.Target, "until", s.Until, "by", s.By, "reason", s.Reason, "subject", subject)
+		return
+	}
+
+	if atlasStatusSuppress && !alert.Resolved {
+		if upstream, ok := confirmedAtlasIncident(); ok {
+			slog.Info("alert suppressed during MongoDB status page incident", "incident", upstream.Name, "link", upstream.Link, "subject", subject)
+			return
+		}
+	}
+
+	alert.Time = time.Now()
+	alert.Incident = openIncidentID(alert.Target)
+	if alert.Severity == "" {
+		alert.Severity = alertSeverity(subject)
+	}
+	if condition, ok := inhibitedBy(alert); ok {
+		logInhibited(alert, condition)
+		return
+	}
+	if deduplicate(&alert) {
+		logDeduplicated(alert)
 		return
 	}
 
-	log.Printf("Alert email sent: %s\n", subject)
+	slog.Info("sending alert", "target", alert.Target, "subject", subject, "severity", alert.Severity, "incident", alert.Incident)
+	queueAlert(alert)
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memberSet is the replica set membership a check saw.
+type memberSet struct {
+	CheckedAt   time.Time `json:"checked_at"`
+	SetName     string    `json:"set_name"`
+	Hosts       []string  `json:"hosts"`
+	Arbiters    []string  `json:"arbiters,omitempty"`
+	Unreachable []string  `json:"unreachable,omitempty"`
+}
+
+var topologyChangeCheck bool
+
+// loadTopologyChangeConfig reads TOPOLOGY_CHANGE_CHECK=true.
+func loadTopologyChangeConfig() {
+	topologyChangeCheck = os.Getenv("TOPOLOGY_CHANGE_CHECK") == "true"
+}
+
+// trackMembers compares the membership in the last isMaster reply with the
+// previous check's, alerting when members were added or removed or the set
+// name changed, and dials every member directly. Ping only needs one
+// member, so a set that lost members behind the endpoint still answers it;
+// the unreachable members it returns turn the check's health degraded.
+// mongos and standalone replies, which name no set, are skipped.
+func (c *cluster) trackMembers() []string {
+	if !topologyChangeCheck || c.topology == nil {
+		return nil
+	}
+	current := memberSet{CheckedAt: time.Now()}
+	current.SetName, _ = c.topology["setName"].(string)
+	if current.SetName == "" {
+		return nil
+	}
+	current.Hosts = replyHosts(c.topology, "hosts", "passives")
+	current.Arbiters = replyHosts(c.topology, "arbiters")
+	current.Unreachable = unreachableMembers(c.uri, append(slices.Clone(current.Hosts), current.Arbiters...))
+
+	previous := c.members
+	c.members = &current
+	if previous == nil {
+		return current.Unreachable
+	}
+
+	var changes []string
+	if previous.SetName != current.SetName {
+		changes = append(changes, tr("membership.set_name", "replica set name changed from {previous:%q} to {current:%q}", "previous", previous.SetName, "current", current.SetName))
+	}
+	changes = append(changes, describeMemberDiff(tr("membership.member", "member"), previous.Hosts, current.Hosts)...)
+	changes = append(changes, describeMemberDiff(tr("membership.arbiter", "arbiter"), previous.Arbiters, current.Arbiters)...)
+	if len(changes) > 0 {
+		log.Printf("Replica set membership of %s changed:\n%s\n", c.name, strings.Join(changes, "\n"))
+		sendTargetAlert(c.name, "MongoDB Replica Set Membership Changed",
+			tr("membership.changed", "The members of {set} changed since the previous check:\n{changes}\n\nMembers now: {members}\n{dns_change}",
+				"set", current.SetName, "changes", strings.Join(changes, "\n"), "members", strings.Join(current.Hosts, ", "), "dns_change", lastDNSChangeSummary()))
+	}
+	return current.Unreachable
+}
+
+// replyHosts collects the host lists under keys of an isMaster reply.
+func replyHosts(reply bson.M, keys ...string) []string {
+	var hosts []string
+	for _, key := range keys {
+		if list, ok := reply[key].(primitive.A); ok {
+			for _, host := range list {
+				hosts = append(hosts, fmt.Sprint(host))
+			}
+		}
+	}
+	slices.Sort(hosts)
+	return hosts
+}
+
+// describeMemberDiff lists the hosts added to and removed from a sorted
+// host list.
+func describeMemberDiff(kind string, before, after []string) []string {
+	var changes []string
+	for _, host := range after {
+		if !slices.Contains(before, host) {
+			changes = append(changes, tr("membership.added", "{kind} added: {host}", "kind", kind, "host", host))
+		}
+	}
+	for _, host := range before {
+		if !slices.Contains(after, host) {
+			changes = append(changes, tr("membership.removed", "{kind} removed: {host}", "kind", kind, "host", host))
+		}
+	}
+	return changes
+}
+
+// unreachableMembers dials every member in parallel the way host probes
+// do and returns "host: error" for the ones that fail.
+func unreachableMembers(uri string, hosts []string) []string {
+	tlsConfig := probeTLSConfig(uri)
+	probes := make([]hostProbe, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			probes[i] = probeHost(host, tlsConfig)
+		}(i, host)
+	}
+	wg.Wait()
+
+	var unreachable []string
+	for _, probe := range probes {
+		if probe.Layer != "ok" {
+			unreachable = append(unreachable, probe.Host+": "+probe.Layer+" "+probe.Error)
+		}
+	}
+	return unreachable
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Minimal MQTT 3.1.1 publisher: connect, publish QoS 0 messages, disconnect.
+// That is all the status feed needs, so no client library is pulled in.
+
+const mqttTimeout = 10 * time.Second
+
+var (
+	mqttBroker      string
+	mqttTopicPrefix string
+	mqttUsername    string
+	mqttPassword    string
+	mqttClientID    string
+
+	mqttQueue chan []mqttMessage
+	mqttDone  = make(chan struct{})
+)
+
+func loadMQTTConfig() {
+	mqttBroker = os.Getenv("MQTT_BROKER")
+	mqttTopicPrefix = os.Getenv("MQTT_TOPIC_PREFIX")
+	if mqttTopicPrefix == "" {
+		mqttTopicPrefix = "mongodb-monitor"
+	}
+	mqttUsername = os.Getenv("MQTT_USERNAME")
+	mqttPassword = os.Getenv("MQTT_PASSWORD")
+	if mqttPassword != "" && mqttUsername == "" {
+		// MQTT 3.1.1 only allows a password along with a user name
+		log.Fatal("MQTT_PASSWORD is set without MQTT_USERNAME")
+	}
+	mqttClientID = os.Getenv("MQTT_CLIENT_ID")
+	if mqttClientID == "" {
+		hostname, _ := os.Hostname()
+		mqttClientID = "mongodb-monitor-" + hostname
+	}
+}
+
+// startMQTTPublisher runs the goroutine that sends queued results to the
+// broker, so that a slow or unreachable broker never holds back a check.
+// MQTT_QUEUE_SIZE (default 100) results wait at most; beyond that the
+// oldest are dropped, as the retained status must end up at the latest.
+func startMQTTPublisher() {
+	if mqttBroker == "" {
+		close(mqttDone)
+		return
+	}
+	mqttQueue = make(chan []mqttMessage, getEnvInt("MQTT_QUEUE_SIZE", 100))
+	go func() {
+		defer close(mqttDone)
+		for messages := range mqttQueue {
+			err := mqttPublish(messages)
+			recordNotification("mqtt", err)
+			if err != nil {
+				logThrottled("Failed to publish to MQTT broker", err)
+			}
+		}
+	}()
+}
+
+// drainMQTT stops taking results and waits until the queued ones are
+// published, for commands that exit after one cycle.
+func drainMQTT() {
+	if mqttQueue != nil {
+		close(mqttQueue)
+	}
+	<-mqttDone
+}
+
+// publishMQTT queues the retained up/down status and the full check result
+// for <prefix>/<target>/status and <prefix>/<target>/result.
+func publishMQTT(result checkResult) {
+	if mqttBroker == "" {
+		return
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Failed to encode MQTT check result: %v\n", err)
+		return
+	}
+	topic := mqttTopicPrefix + "/" + result.Target
+
+	messages := []mqttMessage{
+		{topic: topic + "/status", payload: []byte(result.Status), retain: true},
+		{topic: topic + "/result", payload: payload},
+	}
+	for {
+		select {
+		case mqttQueue <- messages:
+			return
+		default:
+		}
+		select {
+		case <-mqttQueue:
+			slog.Warn("MQTT queue full, dropped the oldest result", "waiting", cap(mqttQueue))
+		default:
+		}
+	}
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+func mqttPublish(messages []mqttMessage) error {
+	conn, err := mqttDial(mqttBroker)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+
+	var connect []byte
+	connect = appendMQTTString(connect, "MQTT")
+	flags := byte(0x02) // clean session
+	if mqttUsername != "" {
+		flags |= 0x80
+		if mqttPassword != "" {
+			flags |= 0x40
+		}
+	}
+	connect = append(connect, 4, flags)                  // protocol level 3.1.1
+	connect = binary.BigEndian.AppendUint16(connect, 60) // keepalive seconds
+	connect = appendMQTTString(connect, mqttClientID)
+	if mqttUsername != "" {
+		connect = appendMQTTString(connect, mqttUsername)
+		if mqttPassword != "" {
+			connect = appendMQTTString(connect, mqttPassword)
+		}
+	}
+	if err := writeMQTTPacket(conn, 0x10, connect); err != nil {
+		return err
+	}
+
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil {
+		return fmt.Errorf("reading CONNACK: %w", err)
+	}
+	if connack[0] != 0x20 {
+		return fmt.Errorf("unexpected MQTT packet type 0x%02x instead of CONNACK", connack[0])
+	}
+	if connack[3] != 0 {
+		return fmt.Errorf("MQTT broker refused connection (return code %d)", connack[3])
+	}
+
+	for _, msg := range messages {
+		header := byte(0x30)
+		if msg.retain {
+			header |= 0x01
+		}
+		if err := writeMQTTPacket(conn, header, append(appendMQTTString(nil, msg.topic), msg.payload...)); err != nil {
+			return err
+		}
+	}
+	return writeMQTTPacket(conn, 0xe0, nil)
+}
+
+func mqttDial(broker string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	switch {
+	case strings.HasPrefix(broker, "ssl://"), strings.HasPrefix(broker, "tls://"), strings.HasPrefix(broker, "mqtts://"):
+		addr := broker[strings.Index(broker, "://")+3:]
+		host, _, _ := net.SplitHostPort(addr)
+		return tls.DialWithDialer(dialer, "tcp", addr, fipsTLS(&tls.Config{ServerName: host}))
+	default:
+		return dialer.Dial("tcp", strings.TrimPrefix(strings.TrimPrefix(broker, "tcp://"), "mqtt://"))
+	}
+}
+
+func writeMQTTPacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	// Remaining length is a base-128 varint
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Alert is one notification, as handed to every notifier. Incident is the
+// ID of the open connection incident, if any. Resolved marks an alert
+// saying a problem is over; with Result, which is set only on connection
+// state transitions, it is the alert that closes the incident.
+// Severity and Class (the error class of connection alerts) select the
+// route in the routing matrix.
+type Alert struct {
+	Subject  string
+	Body     string
+	Target   string
+	Severity string
+	Class    string
+	Time     time.Time
+	Incident string
+	Resolved bool
+	Result   *checkResult
+}
+
+// Notifier delivers alerts over one channel.
+type Notifier interface {
+	Name() string
+	Send(ctx context.Context, alert Alert) error
+}
+
+// notifierTester is implemented by notifiers that can check their
+// configuration without sending anything, for the startup self-test.
+type notifierTester interface {
+	Test(ctx context.Context) error
+}
+
+// notifierFilter is implemented by notifiers that only handle some alerts,
+// so that the others are skipped before they count against the channel's
+// hourly limit.
+type notifierFilter interface {
+	Applies(alert Alert) bool
+}
+
+// errNotApplicable is returned by notifiers for alerts they do not handle;
+// it is not counted as a delivery.
+var errNotApplicable = errors.New("alert not applicable to this notifier")
+
+// delivery records the outcome of one delivery attempt for an incident.
+type delivery struct {
+	Time    time.Time `json:"time"`
+	Subject string    `json:"subject"`
+	Channel string    `json:"channel"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// notifierFactories is the registry of notifier types. A factory returns
+// nil when its channel is not configured, so each channel is enabled just
+// by setting its own variables.
+var notifierFactories = map[string]func() Notifier{}
+
+func registerNotifier(name string, factory func() Notifier) {
+	notifierFactories[name] = factory
+}
+
+const notifyTimeout = 30 * time.Second
+
+var (
+	availableNotifiers = map[string]Notifier{}
+	fallbackChain      []Notifier
+	fanoutNotifiers    []Notifier
+
+	alertQueue    chan Alert
+	alertsDropped int
+	alertsDone    = make(chan struct{})
+	alertsMuted   bool
+)
+
+// loadFallbackChain builds every configured notifier and the ordered list
+// from NOTIFY_FALLBACK_CHAIN, e.g. "email,email-backup". An alert goes to
+// the first notifier in the chain that accepts it; later ones are only
+// tried on failure. Configured notifiers not in the chain, such as Slack,
+// get every alert in addition.
+func loadFallbackChain() {
+	for name, factory := range notifierFactories {
+		if n := factory(); n != nil {
+			availableNotifiers[name] = n
+		}
+	}
+
+	chain := os.Getenv("NOTIFY_FALLBACK_CHAIN")
+	if chain == "" {
+		chain = "email,email-backup"
+	}
+	inChain := map[string]bool{}
+	for _, name := range strings.Split(chain, ",") {
+		name = strings.TrimSpace(name)
+		n, ok := availableNotifiers[name]
+		if !ok {
+			if os.Getenv("NOTIFY_FALLBACK_CHAIN") != "" {
+				log.Fatalf("NOTIFY_FALLBACK_CHAIN names unknown or unconfigured channel %q", name)
+			}
+			continue
+		}
+		fallbackChain = append(fallbackChain, n)
+		inChain[name] = true
+	}
+	names := make([]string, 0, len(availableNotifiers))
+	for name := range availableNotifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !inChain[name] {
+			fanoutNotifiers = append(fanoutNotifiers, availableNotifiers[name])
+		}
+	}
+}
+
+// allNotifiers lists the chain followed by the fan-out notifiers.
+func allNotifiers() []Notifier {
+	return append(fallbackChain[:len(fallbackChain):len(fallbackChain)], fanoutNotifiers...)
+}
+
+// startNotificationWorker delivers queued alerts one at a time, in the
+// order they were raised, so a hanging mail server or webhook delays only
+// other alerts and never the checks. ALERT_QUEUE_SIZE (default 100) bounds
+// the queue; alerts raised while it is full are dropped and counted. Once a
+// minute it also releases the alerts held back by deduplication and rate
+// limits (see releaseHeldAlerts).
+func startNotificationWorker() {
+	alertQueue = make(chan Alert, getEnvInt("ALERT_QUEUE_SIZE", 100))
+	go func() {
+		defer close(alertsDone)
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case alert, ok := <-alertQueue:
+				if !ok {
+					return
+				}
+				deliverAlert(alert)
+			case now := <-ticker.C:
+				releaseHeldAlerts(now)
+			}
+		}
+	}()
+}
+
+// drainAlerts stops taking alerts and waits until the queued ones are
+// delivered, for commands that exit after one cycle.
+func drainAlerts() {
+	close(alertQueue)
+	<-alertsDone
+}
+
+func queueAlert(alert Alert) {
+	if alertsMuted {
+		log.Printf("Not sending alert from a one-off check: %s\n", alert.Subject)
+		return
+	}
+	select {
+	case alertQueue <- alert:
+	default:
+		telemetryMu.Lock()
+		alertsDropped++
+		telemetryMu.Unlock()
+		slog.Error("alert queue full, dropping alert", "waiting", cap(alertQueue), "subject", alert.Subject)
+	}
+}
+
+// deliverAlert sends the alert to the channels of its route or, without
+// one, walks the fallback chain until one notifier delivers the alert and
+// sends it to every fan-out notifier as well. Notifiers outside their
+// notification schedule are passed over.
+func deliverAlert(alert Alert) {
+	if route, ok := routeFor(alert); ok {
+		if len(route.channels) == 0 {
+			slog.Info("alert dropped by route", "route", route.name, "subject", alert.Subject)
+		}
+		for _, n := range route.channels {
+			if attempted, err := deliverVia(n, alert); attempted && err != nil {
+				slog.Error("failed to deliver alert", "channel", n.Name(), "route", route.name, "subject", alert.Subject, "error", err)
+			}
+		}
+		return
+	}
+
+	delivered := false
+	for _, n := range fallbackChain {
+		attempted, err := deliverVia(n, alert)
+		if !attempted {
+			continue
+		}
+		if err == nil {
+			delivered = true
+			break
+		}
+		slog.Warn("failed to deliver alert, trying next channel", "channel", n.Name(), "subject", alert.Subject, "error", err)
+	}
+	if len(fallbackChain) > 0 && !delivered {
+		slog.Error("alert could not be delivered on any channel of the fallback chain", "subject", alert.Subject)
+	}
+
+	for _, n := range fanoutNotifiers {
+		if attempted, err := deliverVia(n, alert); attempted && err != nil {
+			slog.Error("failed to deliver alert", "channel", n.Name(), "subject", alert.Subject, "error", err)
+		}
+	}
+}
+
+func deliverVia(n Notifier, alert Alert) (attempted bool, err error) {
+	if !channelActive(n.Name(), time.Now()) {
+		slog.Info("skipping channel outside its notification schedule", "channel", n.Name(), "subject", alert.Subject)
+		return false, nil
+	}
+	if filter, ok := n.(notifierFilter); ok && !filter.Applies(alert) {
+		return false, nil
+	}
+	note, limited := rateLimited(n.Name(), alert)
+	if limited {
+		// Not attempted, so that the fallback chain moves on to the next
+		// channel
+		slog.Warn("alert suppressed by the channel's hourly limit", "channel", n.Name(), "subject", alert.Subject)
+		return false, nil
+	}
+	alert.Body = note + alert.Body
+	alert.Subject = trSubject(alert.Subject)
+	alert.Body = limitBody(alert.Body, bodyLimits[n.Name()])
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	err = n.Send(ctx, alert)
+	if errors.Is(err, errNotApplicable) {
+		return false, nil
+	}
+	recordNotification(n.Name(), err)
+	recordDelivery(alert, n.Name(), err)
+	if err == nil {
+		recordChannelSend(n.Name(), alert.Target)
+		slog.Info("alert delivered", "channel", n.Name(), "subject", alert.Subject)
+	}
+	return true, err
+}
+
+// recordDelivery adds the delivery to the incident the alert was sent for.
+// Alerts are delivered after a delay, by which time the target's incident
+// may have closed and another opened, so the incident is found by the ID
+// the alert carries rather than by target.
+func recordDelivery(alert Alert, channel string, err error) {
+	if alert.Incident == "" {
+		return
+	}
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+
+	for _, inc := range incidents {
+		if inc.ID != alert.Incident {
+			continue
+		}
+		d := delivery{Time: time.Now(), Subject: alert.Subject, Channel: channel}
+		if err != nil {
+			d.Error = err.Error()
+		}
+		inc.Deliveries = append(inc.Deliveries, d)
+		return
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// pagerDutyNotifier sends connection incidents to PagerDuty Events API v2:
+// the failure alert triggers a PagerDuty incident keyed by our incident
+// ID, later alerts of the same incident are deduplicated into it, and the
+// recovery alert resolves it. Alerts outside a connection incident are left
+// to the other notifiers.
+type pagerDutyNotifier struct {
+	routingKey string
+	eventsURL  string
+}
+
+var pagerDutyHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+func init() {
+	registerNotifier("pagerduty", func() Notifier {
+		key := os.Getenv("PAGERDUTY_ROUTING_KEY")
+		if key == "" {
+			return nil
+		}
+		return &pagerDutyNotifier{
+			routingKey: key,
+			eventsURL:  orString(os.Getenv("PAGERDUTY_EVENTS_URL"), "https://events.pagerduty.com/v2/enqueue"),
+		}
+	})
+}
+
+func (p *pagerDutyNotifier) Name() string { return "pagerduty" }
+
+func (p *pagerDutyNotifier) Applies(alert Alert) bool { return alert.Incident != "" }
+
+func (p *pagerDutyNotifier) Send(ctx context.Context, alert Alert) error {
+	if !p.Applies(alert) {
+		return errNotApplicable
+	}
+
+	event := map[string]interface{}{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    alert.Incident,
+	}
+	if alert.Resolved && alert.Result != nil {
+		event["event_action"] = "resolve"
+	} else {
+		event["payload"] = map[string]interface{}{
+			"summary":   alert.Subject + " (" + alert.Target + ")",
+			"source":    alert.Target,
+			"severity":  "critical",
+			"timestamp": alert.Time.Format(time.RFC3339),
+			"component": "privatelink",
+			"custom_details": map[string]string{
+				"details": alert.Body,
+			},
+		}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.eventsURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := pagerDutyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pagerduty returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// defaultPrivateCIDRs are the ranges a PrivateLink endpoint's interfaces
+// can have: RFC 1918, carrier-grade NAT, and IPv6 unique local addresses.
+var defaultPrivateCIDRs = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"}
+
+var (
+	privatePathCheck   bool
+	privatePathENIOnly bool
+	privateCIDRs       []netip.Prefix
+)
+
+// loadPrivatePathConfig reads PRIVATE_PATH_CHECK=true, which checks every
+// check that each cluster host resolves into PRIVATE_CIDRS (default the
+// private ranges) or to a VPC endpoint interface, and
+// PRIVATE_PATH_ENI_ONLY=true, which accepts only the interface addresses
+// once the VPC endpoint check has seen them.
+func loadPrivatePathConfig() {
+	privatePathCheck = os.Getenv("PRIVATE_PATH_CHECK") == "true"
+	if !privatePathCheck {
+		return
+	}
+	privatePathENIOnly = os.Getenv("PRIVATE_PATH_ENI_ONLY") == "true"
+	cidrs := splitList(os.Getenv("PRIVATE_CIDRS"))
+	if len(cidrs) == 0 {
+		cidrs = defaultPrivateCIDRs
+	}
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			log.Fatalf("Invalid PRIVATE_CIDRS entry %q: %v", cidr, err)
+		}
+		privateCIDRs = append(privateCIDRs, prefix)
+	}
+	log.Printf("Checking that cluster hosts resolve into %s\n", strings.Join(cidrs, ", "))
+}
+
+// endpointInterfaceIPs are the addresses of the VPC endpoints' network
+// interfaces, as last described.
+func endpointInterfaceIPs() map[netip.Addr]bool {
+	ips := map[netip.Addr]bool{}
+	for _, e := range vpcEndpointSnapshot() {
+		for _, zone := range e.Zones {
+			if addr, err := netip.ParseAddr(zone.IP); err == nil {
+				ips[addr] = true
+			}
+		}
+	}
+	return ips
+}
+
+// publicAddresses returns "host -> address" for every address behind the
+// connection string outside the private path, from the check's A lookups
+// and any IP literals in the seed list.
+func publicAddresses(uri string, lookups []dnsLookup) []string {
+	if !privatePathCheck {
+		return nil
+	}
+	enis := endpointInterfaceIPs()
+	private := func(addr netip.Addr) bool {
+		if enis[addr] {
+			return true
+		}
+		if privatePathENIOnly && len(enis) > 0 {
+			return false
+		}
+		for _, prefix := range privateCIDRs {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var public []string
+	for _, lookup := range lookups {
+		if lookup.Type != "A" {
+			continue
+		}
+		for _, answer := range lookup.Answers {
+			value, ok := strings.CutPrefix(answer, "A ")
+			if !ok {
+				continue
+			}
+			if addr, err := netip.ParseAddr(value); err == nil && !private(addr.Unmap()) {
+				public = append(public, lookup.Name+" -> "+value)
+			}
+		}
+	}
+	if _, hosts, err := parseSeedList(uri); err == nil {
+		for _, hostPort := range hosts {
+			host, _, err := net.SplitHostPort(hostPort)
+			if err != nil {
+				continue
+			}
+			if addr, err := netip.ParseAddr(host); err == nil && !private(addr.Unmap()) {
+				public = append(public, host)
+			}
+		}
+	}
+	return public
+}
+
+// evaluatePrivatePath alerts when a cluster host starts or stops resolving
+// outside the private path. A DNS fallback to the public endpoint keeps the
+// connection working, so nothing else would notice.
+func (c *cluster) evaluatePrivatePath(result checkResult) {
+	current := strings.Join(result.PublicIPs, "\n")
+	if current == c.publicPath {
+		return
+	}
+	previous := c.publicPath
+	c.publicPath = current
+	if current != "" {
+		log.Printf("%s resolves outside the private path: %s\n", c.name, strings.Join(result.PublicIPs, ", "))
+		sendTargetAlert(c.name, "MongoDB Hosts Resolve To Public Addresses",
+			tr("privatepath.public", "Traffic to {target} is not staying on the PrivateLink path; these hosts resolve outside the private ranges:\n{hosts}\n\n{dns}",
+				"target", c.name, "hosts", current, "dns", describeDNSLookups(result.DNS)))
+	} else if previous != "" {
+		sendTargetRecovery(c.name, "MongoDB Hosts Resolve To Private Addresses Again",
+			tr("privatepath.private", "Every host of {target} resolves onto the private path again.", "target", c.name))
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// runProvisionCommand implements `provision`: create the canary database
+// with its collections and TTL indexes, and a monitoring user that can run
+// every probe but nothing more (clusterMonitor plus readWrite on the canary
+// database). The user is created through an admin connection string, or
+// through the Atlas API, where createUser is not allowed. An existing user
+// gets its roles brought in line but keeps its password unless -rotate is
+// given, so re-running provision does not lock the running monitor out.
+func runProvisionCommand(args []string) error {
+	fs := flag.NewFlagSet("provision", flag.ExitOnError)
+	adminURI := fs.String("admin-uri", os.Getenv("MONGODB_ADMIN_URI"), "connection string with userAdmin rights, instead of the Atlas API")
+	canaryDB := fs.String("db", orString(rawProbeDB, "monitor_canary"), "canary database for the write probes")
+	username := fs.String("user", "privatelink-monitor", "monitoring user to create")
+	userPassword := fs.String("password", "", "password for a new user, or with -rotate an existing one (generated if empty)")
+	rotate := fs.Bool("rotate", false, "set a new password if the user already exists")
+	secretFile := fs.String("secret-file", "", "write a new password to this file (mode 0600) instead of printing it")
+	fs.Parse(args)
+
+	if *adminURI == "" && !atlasConfigured() {
+		return errors.New("either -admin-uri (or MONGODB_ADMIN_URI) or the Atlas API settings are required")
+	}
+	if *userPassword == "" {
+		buf := make([]byte, 18)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		*userPassword = hex.EncodeToString(buf)
+	}
+
+	roles := []bson.D{
+		{{Key: "role", Value: "clusterMonitor"}, {Key: "db", Value: "admin"}},
+		{{Key: "role", Value: "readWrite"}, {Key: "db", Value: *canaryDB}},
+	}
+	var created bool
+	var err error
+	if *adminURI != "" {
+		created, err = provisionUserWithMongo(*adminURI, *username, *userPassword, roles, *rotate)
+	} else {
+		created, err = provisionUserWithAtlas(*username, *userPassword, *canaryDB, *rotate)
+	}
+	if err != nil {
+		return err
+	}
+	passwordSet := created || *rotate
+	switch {
+	case created:
+		fmt.Printf("monitoring user %s created\n", *username)
+	case *rotate:
+		fmt.Printf("monitoring user %s updated, password rotated\n", *username)
+	default:
+		fmt.Printf("monitoring user %s updated, password unchanged (pass -rotate to set a new one)\n", *username)
+	}
+	if passwordSet && *secretFile != "" {
+		if err := os.WriteFile(*secretFile, []byte(*userPassword+"\n"), 0o600); err != nil {
+			return fmt.Errorf("write the password to %s: %w", *secretFile, err)
+		}
+		fmt.Printf("password written to %s\n", *secretFile)
+	}
+
+	// Create the canary collections as the user, which also proves its
+	// roles are enough for the write probes. With the password unchanged,
+	// and so unknown here, the monitor's own connection string is used.
+	uri := *adminURI
+	if uri == "" || !passwordSet {
+		uri = os.Getenv("MONGODB_URI")
+	}
+	if uri == "" {
+		return errors.New("MONGODB_URI not set in .env file")
+	}
+	clientOpts := newClientOptions(uri, "provision")
+	if passwordSet {
+		auth := options.Credential{}
+		if clientOpts.Auth != nil {
+			auth = *clientOpts.Auth
+		}
+		auth.Username, auth.Password, auth.PasswordSet, auth.AuthSource = *username, *userPassword, true, "admin"
+		clientOpts.SetAuth(auth)
+	}
+
+	// Atlas takes a moment to roll a new user out to every node
+	for attempt := 0; attempt < 10; attempt++ {
+		if err = provisionCanary(clientOpts, *canaryDB); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Second)
+	}
+	if err != nil {
+		return fmt.Errorf("create canary collections as %s: %w", *username, err)
+	}
+
+	fmt.Printf("\nAdd to .env:\nCANARY_DB=%s\nRAW_PROBE_DB=%s\nGRIDFS_PROBE_DB=%s\n", *canaryDB, *canaryDB, *canaryDB)
+	if !passwordSet {
+		return nil
+	}
+	password := *userPassword
+	if *secretFile != "" {
+		password = "<password from " + *secretFile + ">"
+	}
+	if u, err := url.Parse(os.Getenv("MONGODB_URI")); err == nil && u.Host != "" {
+		u.User = url.UserPassword(*username, password)
+		fmt.Printf("MONGODB_URI=%s\n", u.String())
+	} else {
+		fmt.Printf("# connect as %s with password %s\n", *username, password)
+	}
+	return nil
+}
+
+// provisionUserWithMongo creates the user, or brings an existing one's
+// roles in line, setting its password only when rotate is true. It reports
+// whether the user was created.
+func provisionUserWithMongo(adminURI, username, userPassword string, roles []bson.D, rotate bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	client, err := mongo.Connect(ctx, newClientOptions(adminURI, "provision"))
+	if err != nil {
+		return false, fmt.Errorf("connect with admin credentials: %w", err)
+	}
+	defer closeClient(client, "provision")
+
+	admin := client.Database("admin")
+	err = admin.RunCommand(ctx, bson.D{{Key: "createUser", Value: username}, {Key: "pwd", Value: userPassword}, {Key: "roles", Value: roles}}).Err()
+	if err == nil {
+		return true, nil
+	}
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Code != 51003 {
+		return false, fmt.Errorf("create user %s: %w", username, err)
+	}
+	// DuplicateKey: the user exists, bring it in line instead
+	update := bson.D{{Key: "updateUser", Value: username}, {Key: "roles", Value: roles}}
+	if rotate {
+		update = append(update, bson.E{Key: "pwd", Value: userPassword})
+	}
+	if err := admin.RunCommand(ctx, update).Err(); err != nil {
+		return false, fmt.Errorf("update user %s: %w", username, err)
+	}
+	return false, nil
+}
+
+// provisionUserWithAtlas is provisionUserWithMongo through the Atlas API.
+func provisionUserWithAtlas(username, userPassword, canaryDB string, rotate bool) (bool, error) {
+	user := map[string]interface{}{
+		"databaseName": "admin",
+		"username":     username,
+		"password":     userPassword,
+		"roles": []map[string]string{
+			{"roleName": "clusterMonitor", "databaseName": "admin"},
+			{"roleName": "readWrite", "databaseName": canaryDB},
+		},
+	}
+	if atlasClusterName != "" {
+		user["scopes"] = []map[string]string{{"name": atlasClusterName, "type": "CLUSTER"}}
+	}
+
+	path := "/groups/" + atlasProjectID + "/databaseUsers"
+	err := atlasRequest(http.MethodPost, path, user, nil)
+	if err == nil {
+		return true, nil
+	}
+	var apiErr *atlasError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		return false, fmt.Errorf("create Atlas database user %s: %w", username, err)
+	}
+	if !rotate {
+		delete(user, "password")
+	}
+	if err := atlasRequest(http.MethodPatch, path+"/admin/"+url.PathEscape(username), user, nil); err != nil {
+		return false, fmt.Errorf("update Atlas database user %s: %w", username, err)
+	}
+	return false, nil
+}
+
+func provisionCanary(clientOpts *options.ClientOptions, canaryDB string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return err
+	}
+	defer closeClient(client, "provision")
+
+	db := client.Database(canaryDB)
+	collections := map[string]string{
+		orString(rawProbeCollection, "monitor_read_after_write"): "written_at",
+		orString(canaryCollection, "monitor_canary"):             "written_at",
+		gridFSProbeBucket + ".files":                             "uploadDate",
+	}
+	for name, field := range collections {
+		err := db.CreateCollection(ctx, name)
+		var cmdErr mongo.CommandError
+		if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == 48) {
+			// 48 is NamespaceExists
+			return fmt.Errorf("create %s: %w", name, err)
+		}
+		if err := ensureProbeTTL(ctx, db.Collection(name), field); err != nil {
+			return err
+		}
+		fmt.Printf("collection %s.%s ready with a %v TTL on %s\n", canaryDB, name, probeDataTTL, field)
+	}
+	return nil
+}
+
+func orString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// alertDedupInterval is the minimum time between two identical alerts;
+	// 0 turns deduplication off
+	alertDedupInterval time.Duration
+	// channelRateLimits caps the alerts each channel delivers in any hour
+	channelRateLimits = map[string]int{}
+
+	rateLimitMu sync.Mutex
+	// lastAlerts holds, per target, subject and body, when the alert was
+	// last sent and what was suppressed since
+	lastAlerts = map[string]*dedupState{}
+	// lastSentKeys holds, per target, the lastAlerts key of the alert
+	// deduplication last let through
+	lastSentKeys = map[string]string{}
+	// heldAlerts holds, per target, the latest repeat deduplication
+	// suppressed while another alert was the last word on the target
+	heldAlerts   = map[string]heldAlert{}
+	channelSends = map[string][]time.Time{}
+	// channelSuppressed holds, per channel, the alerts held back by its
+	// cap since its last delivery
+	channelSuppressed = map[string]*suppressedAlerts{}
+	// channelHeld holds, per channel and target, the latest alert the
+	// channel's cap held back
+	channelHeld        = map[string]map[string]Alert{}
+	alertsDeduplicated int
+	alertsRateLimited  = map[string]int{}
+)
+
+// heldAlert is an alert held back until its deduplication interval ends,
+// so that the last state of a flapping target still goes out.
+type heldAlert struct {
+	alert Alert
+	key   string
+	due   time.Time
+}
+
+type dedupState struct {
+	sent       time.Time
+	suppressed suppressedAlerts
+}
+
+type suppressedAlerts struct {
+	count int
+	since time.Time
+}
+
+func (s *suppressedAlerts) add(t time.Time) {
+	if s.count == 0 {
+		s.since = t
+	}
+	s.count++
+}
+
+// note is what to tell about the suppressed alerts, if any.
+func (s *suppressedAlerts) note(what string) string {
+	if s.count == 0 {
+		return ""
+	}
+	return tr("ratelimit.suppressed", "[{count} {what} suppressed since {since}]\n\n", "count", s.count, "what", what, "since", s.since.Format("2006-01-02 15:04 MST"))
+}
+
+// take returns the note and resets the count.
+func (s *suppressedAlerts) take(what string) string {
+	note := s.note(what)
+	*s = suppressedAlerts{}
+	return note
+}
+
+// loadRateLimitConfig reads ALERT_DEDUP_MINUTES, the minimum interval
+// between identical alerts, and ALERT_RATE_LIMIT_PER_HOUR_<CHANNEL>, then
+// ALERT_RATE_LIMIT_PER_HOUR, the most alerts a channel delivers in any
+// hour. Both default to 0, which turns them off. Both apply to every alert,
+// the connection's own transitions included, since a flapping endpoint
+// sends nothing else; the last alert held back about a target still goes
+// out once the interval ends or the channel is under its cap again.
+func loadRateLimitConfig() {
+	alertDedupInterval = time.Duration(getEnvInt("ALERT_DEDUP_MINUTES", 0)) * time.Minute
+	if alertDedupInterval < 0 {
+		log.Fatal("Invalid ALERT_DEDUP_MINUTES: must not be negative")
+	}
+	if alertDedupInterval > 0 {
+		log.Printf("Identical alerts are sent at most once every %v\n", alertDedupInterval)
+	}
+	def := getEnvInt("ALERT_RATE_LIMIT_PER_HOUR", 0)
+	for name := range availableNotifiers {
+		limit := getEnvInt("ALERT_RATE_LIMIT_PER_HOUR_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_")), def)
+		if limit < 0 {
+			log.Fatalf("Invalid alert rate limit for channel %s: must not be negative", name)
+		}
+		if limit > 0 {
+			channelRateLimits[name] = limit
+			log.Printf("Channel %s delivers at most %d alert(s) per hour\n", name, limit)
+		}
+	}
+}
+
+// deduplicate reports whether the alert repeats, word for word, one sent
+// for the same target less than ALERT_DEDUP_MINUTES ago, counting it if
+// so. A repeat suppressed while another alert was the last word on the
+// target, such as a failure after its recovery, is held for
+// releaseHeldAlerts. Otherwise it notes the sending and prefixes the body
+// with how many repeats were suppressed.
+func deduplicate(alert *Alert) bool {
+	if alertDedupInterval <= 0 {
+		return false
+	}
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	sum := sha256.Sum256([]byte(alert.Body))
+	key := alert.Target + "\x00" + alert.Subject + "\x00" + hex.EncodeToString(sum[:])
+	state := lastAlerts[key]
+	if state == nil {
+		state = &dedupState{}
+		lastAlerts[key] = state
+	}
+	if !state.sent.IsZero() && alert.Time.Sub(state.sent) < alertDedupInterval {
+		state.suppressed.add(alert.Time)
+		alertsDeduplicated++
+		if lastSentKeys[alert.Target] == key {
+			delete(heldAlerts, alert.Target)
+		} else {
+			heldAlerts[alert.Target] = heldAlert{alert: *alert, key: key, due: state.sent.Add(alertDedupInterval)}
+		}
+		return true
+	}
+	markSentLocked(alert, key, state)
+	for k, st := range lastAlerts {
+		if alert.Time.Sub(st.sent) >= alertDedupInterval && st.suppressed.count == 0 {
+			delete(lastAlerts, k)
+		}
+	}
+	return false
+}
+
+// markSentLocked notes that the alert goes out and prefixes its body with
+// how many repeats were suppressed. rateLimitMu must be held.
+func markSentLocked(alert *Alert, key string, state *dedupState) {
+	state.sent = alert.Time
+	alert.Body = state.suppressed.take(tr("ratelimit.identical", "identical alert(s)")) + alert.Body
+	lastSentKeys[alert.Target] = key
+	delete(heldAlerts, alert.Target)
+}
+
+// dueHeldAlerts takes the alerts deduplication held whose interval has
+// ended, ready to send.
+func dueHeldAlerts(now time.Time) []Alert {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	var due []Alert
+	for target, held := range heldAlerts {
+		if now.Before(held.due) {
+			continue
+		}
+		delete(heldAlerts, target)
+		alert := held.alert
+		state := lastAlerts[held.key]
+		if state == nil {
+			state = &dedupState{}
+			lastAlerts[held.key] = state
+		}
+		alert.Time = now
+		markSentLocked(&alert, held.key, state)
+		due = append(due, alert)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Target < due[j].Target })
+	return due
+}
+
+// rateLimited reports whether the channel has delivered its hourly cap of
+// alerts, counting the alert if so and holding it as the latest about its
+// target. Otherwise it returns the note about the alerts the channel held
+// back, for the body.
+func rateLimited(channel string, alert Alert) (note string, limited bool) {
+	limit := channelRateLimits[channel]
+	if limit <= 0 {
+		return "", false
+	}
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	now := time.Now()
+	sends := channelSends[channel]
+	for len(sends) > 0 && now.Sub(sends[0]) >= time.Hour {
+		sends = sends[1:]
+	}
+	channelSends[channel] = sends
+	suppressed := channelSuppressed[channel]
+	if suppressed == nil {
+		suppressed = &suppressedAlerts{}
+		channelSuppressed[channel] = suppressed
+	}
+	if len(sends) >= limit {
+		suppressed.add(now)
+		alertsRateLimited[channel]++
+		if channelHeld[channel] == nil {
+			channelHeld[channel] = map[string]Alert{}
+		}
+		channelHeld[channel][alert.Target] = alert
+		return "", true
+	}
+	return suppressed.note(tr("ratelimit.over_limit", "alert(s) over this channel's limit of {limit} per hour", "limit", limit)), false
+}
+
+// recordChannelSend counts a delivery towards the channel's cap. Only
+// deliveries count, and the one that carried the note of the suppressed
+// alerts resets it. An alert held back about the same target is older
+// than the one delivered, so it is dropped.
+func recordChannelSend(channel, target string) {
+	if channelRateLimits[channel] <= 0 {
+		return
+	}
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	channelSends[channel] = append(channelSends[channel], time.Now())
+	if suppressed := channelSuppressed[channel]; suppressed != nil {
+		*suppressed = suppressedAlerts{}
+	}
+	delete(channelHeld[channel], target)
+}
+
+// dueChannelAlerts takes, per channel under its cap again, as many of the
+// alerts it held back as it has room for, oldest first.
+func dueChannelAlerts(now time.Time) map[string][]Alert {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	due := map[string][]Alert{}
+	for channel, held := range channelHeld {
+		room := channelRateLimits[channel]
+		for _, sent := range channelSends[channel] {
+			if now.Sub(sent) < time.Hour {
+				room--
+			}
+		}
+		if room <= 0 || len(held) == 0 {
+			continue
+		}
+		alerts := make([]Alert, 0, len(held))
+		for _, alert := range held {
+			alerts = append(alerts, alert)
+		}
+		sort.Slice(alerts, func(i, j int) bool { return alerts[i].Time.Before(alerts[j].Time) })
+		if len(alerts) > room {
+			alerts = alerts[:room]
+		}
+		for _, alert := range alerts {
+			delete(held, alert.Target)
+		}
+		due[channel] = alerts
+	}
+	return due
+}
+
+// releaseHeldAlerts sends the alerts held back as the last word about
+// their target, once their deduplication interval has ended or their
+// channel is under its cap again, so a flapping target's final state is
+// never lost. It runs on the notification worker.
+func releaseHeldAlerts(now time.Time) {
+	for _, alert := range dueHeldAlerts(now) {
+		if _, silenced := activeSilence(alert.Target); silenced {
+			continue
+		}
+		slog.Info("sending alert held back as a duplicate", "target", alert.Target, "subject", alert.Subject)
+		deliverAlert(alert)
+	}
+	for channel, alerts := range dueChannelAlerts(now) {
+		n := availableNotifiers[channel]
+		if n == nil {
+			continue
+		}
+		for _, alert := range alerts {
+			if _, silenced := activeSilence(alert.Target); silenced {
+				continue
+			}
+			if attempted, err := deliverVia(n, alert); attempted && err != nil {
+				slog.Error("failed to deliver held alert", "channel", channel, "subject", alert.Subject, "error", err)
+			}
+		}
+	}
+}
+
+func logDeduplicated(alert Alert) {
+	slog.Info("alert suppressed as a duplicate", "target", alert.Target, "subject", alert.Subject, "incident", alert.Incident, "interval", alertDedupInterval)
+}
+
+func rateLimitSnapshot() (deduplicated int, rateLimited map[string]int) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	rateLimited = make(map[string]int, len(alertsRateLimited))
+	for channel, n := range alertsRateLimited {
+		rateLimited[channel] = n
+	}
+	return alertsDeduplicated, rateLimited
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// resetRateLimits clears the deduplication and rate limit state, and
+// restores the settings when the test ends.
+func resetRateLimits(t *testing.T) {
+	interval, limits := alertDedupInterval, channelRateLimits
+	reset := func() {
+		lastAlerts = map[string]*dedupState{}
+		lastSentKeys = map[string]string{}
+		heldAlerts = map[string]heldAlert{}
+		channelHeld = map[string]map[string]Alert{}
+		channelSends = map[string][]time.Time{}
+		channelSuppressed = map[string]*suppressedAlerts{}
+		alertsDeduplicated = 0
+		alertsRateLimited = map[string]int{}
+	}
+	reset()
+	t.Cleanup(func() {
+		alertDedupInterval, channelRateLimits = interval, limits
+		reset()
+	})
+}
+
+func TestDeduplicate(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	alert := func(minute int, subject, body string) Alert {
+		return Alert{Target: "cluster0", Subject: subject, Body: body, Severity: severityWarning, Time: base.Add(time.Duration(minute) * time.Minute)}
+	}
+	transition := func(minute int, restored bool) Alert {
+		if restored {
+			return Alert{Target: "cluster0", Subject: "MongoDB Connection Restored", Body: "up", Severity: severityCritical, Resolved: true, Time: base.Add(time.Duration(minute) * time.Minute)}
+		}
+		return Alert{Target: "cluster0", Subject: "MongoDB Connection Failed", Body: "down", Severity: severityCritical, Time: base.Add(time.Duration(minute) * time.Minute)}
+	}
+	type step struct {
+		alert      Alert
+		suppressed bool
+		// Prefix the body must start with when the alert is sent
+		note string
+	}
+	tests := []struct {
+		name     string
+		interval time.Duration
+		steps    []step
+	}{
+		{
+			name:     "off",
+			interval: 0,
+			steps: []step{
+				{alert: alert(0, "Slow", "p95 400ms")},
+				{alert: alert(1, "Slow", "p95 400ms")},
+			},
+		},
+		{
+			name:     "repeats within the interval",
+			interval: 10 * time.Minute,
+			steps: []step{
+				{alert: alert(0, "Slow", "p95 400ms")},
+				{alert: alert(1, "Slow", "p95 400ms"), suppressed: true},
+				{alert: alert(5, "Slow", "p95 400ms"), suppressed: true},
+				{alert: alert(10, "Slow", "p95 400ms"), note: "[2 identical alert(s) suppressed since 2024-05-01 12:01 UTC]\n\n"},
+				{alert: alert(11, "Slow", "p95 400ms"), suppressed: true},
+			},
+		},
+		{
+			name:     "different body or subject",
+			interval: 10 * time.Minute,
+			steps: []step{
+				{alert: alert(0, "Slow", "p95 400ms")},
+				{alert: alert(1, "Slow", "p95 500ms")},
+				{alert: alert(2, "Slower", "p95 400ms")},
+			},
+		},
+		{
+			name:     "flapping connection",
+			interval: 10 * time.Minute,
+			steps: []step{
+				{alert: transition(0, false)},
+				{alert: transition(1, true)},
+				{alert: transition(2, false), suppressed: true},
+				{alert: transition(3, true), suppressed: true},
+				{alert: transition(11, true), note: "[1 identical alert(s) suppressed since 2024-05-01 12:03 UTC]\n\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRateLimits(t)
+			alertDedupInterval = tt.interval
+			for i, s := range tt.steps {
+				a := s.alert
+				if got := deduplicate(&a); got != s.suppressed {
+					t.Fatalf("step %d: deduplicate() = %v, want %v", i, got, s.suppressed)
+				}
+				if !s.suppressed && a.Body != s.note+s.alert.Body {
+					t.Errorf("step %d: body = %q, want %q", i, a.Body, s.note+s.alert.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	warning := Alert{Subject: "Slow", Severity: severityWarning}
+	tests := []struct {
+		name  string
+		limit int
+		// Deliveries this long ago, already counted
+		sent       []time.Duration
+		alert      Alert
+		want       bool
+		suppressed int
+	}{
+		{name: "no limit", limit: 0, sent: []time.Duration{time.Minute, time.Minute}, alert: warning},
+		{name: "under the cap", limit: 3, sent: []time.Duration{time.Minute, 2 * time.Minute}, alert: warning},
+		{name: "at the cap", limit: 2, sent: []time.Duration{time.Minute, 2 * time.Minute}, alert: warning, want: true, suppressed: 1},
+		{name: "older deliveries expire", limit: 2, sent: []time.Duration{61 * time.Minute, 2 * time.Minute}, alert: warning},
+		{name: "critical at the cap", limit: 1, sent: []time.Duration{time.Minute}, alert: Alert{Subject: "MongoDB Connection Failed", Severity: severityCritical}, want: true, suppressed: 1},
+		{name: "recovery at the cap", limit: 1, sent: []time.Duration{time.Minute}, alert: Alert{Subject: "MongoDB Connection Restored", Severity: severityCritical, Resolved: true}, want: true, suppressed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRateLimits(t)
+			channelRateLimits = map[string]int{"slack": tt.limit}
+			for _, ago := range tt.sent {
+				channelSends["slack"] = append(channelSends["slack"], time.Now().Add(-ago))
+			}
+			note, limited := rateLimited("slack", tt.alert)
+			if limited != tt.want {
+				t.Errorf("rateLimited() = %v, want %v", limited, tt.want)
+			}
+			if note != "" {
+				t.Errorf("note = %q, want none", note)
+			}
+			if alertsRateLimited["slack"] != tt.suppressed {
+				t.Errorf("%d alert(s) counted as limited, want %d", alertsRateLimited["slack"], tt.suppressed)
+			}
+		})
+	}
+}
+
+// The first delivery after the cap carries the note of what was held
+// back, and delivering it resets the count.
+func TestRateLimitedNote(t *testing.T) {
+	resetRateLimits(t)
+	channelRateLimits = map[string]int{"slack": 1}
+	alert := Alert{Subject: "Slow", Severity: severityWarning}
+
+	recordChannelSend("slack", "")
+	for i := 0; i < 2; i++ {
+		if _, limited := rateLimited("slack", alert); !limited {
+			t.Fatalf("alert %d over the cap was not limited", i+1)
+		}
+	}
+	channelSends["slack"] = nil
+	note, limited := rateLimited("slack", alert)
+	if limited || !strings.HasPrefix(note, "[2 alert(s) over this channel's limit of 1 per hour suppressed since ") {
+		t.Fatalf("rateLimited() = %q, %v, want the note of 2 suppressed alerts", note, limited)
+	}
+	recordChannelSend("slack", "")
+	channelSends["slack"] = nil
+	if note, _ := rateLimited("slack", alert); note != "" {
+		t.Errorf("note after its delivery = %q, want none", note)
+	}
+}
+
+// Of the transitions a flapping endpoint sends, the last one held back by
+// deduplication goes out when the interval ends, unless a later alert
+// about the target went out first.
+func TestDueHeldAlerts(t *testing.T) {
+	resetRateLimits(t)
+	alertDedupInterval = 10 * time.Minute
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	failed := func(minute int) *Alert {
+		return &Alert{Target: "cluster0", Subject: "MongoDB Connection Failed", Body: "down", Time: base.Add(time.Duration(minute) * time.Minute)}
+	}
+	restored := &Alert{Target: "cluster0", Subject: "MongoDB Connection Restored", Body: "up", Resolved: true, Time: base.Add(time.Minute)}
+
+	deduplicate(failed(0))
+	deduplicate(restored)
+	if !deduplicate(failed(2)) || !deduplicate(failed(4)) {
+		t.Fatal("repeated failures were not deduplicated")
+	}
+	if due := dueHeldAlerts(base.Add(9 * time.Minute)); len(due) != 0 {
+		t.Fatalf("dueHeldAlerts() before the interval ended = %+v, want none", due)
+	}
+	due := dueHeldAlerts(base.Add(10 * time.Minute))
+	if len(due) != 1 || due[0].Subject != "MongoDB Connection Failed" {
+		t.Fatalf("dueHeldAlerts() = %+v, want the last failure", due)
+	}
+	if want := "[2 identical alert(s) suppressed since 2024-05-01 12:02 UTC]\n\ndown"; due[0].Body != want {
+		t.Errorf("body = %q, want %q", due[0].Body, want)
+	}
+	if due := dueHeldAlerts(base.Add(time.Hour)); len(due) != 0 {
+		t.Errorf("dueHeldAlerts() after the release = %+v, want none", due)
+	}
+
+	// A repeat of the alert that was the last word is not held
+	if !deduplicate(failed(11)) {
+		t.Fatal("repeat of the released failure was not deduplicated")
+	}
+	if due := dueHeldAlerts(base.Add(time.Hour)); len(due) != 0 {
+		t.Errorf("dueHeldAlerts() for a repeat of the last word = %+v, want none", due)
+	}
+}
+
+// A channel at its cap holds the latest alert per target and releases it
+// once it has room again.
+func TestDueChannelAlerts(t *testing.T) {
+	resetRateLimits(t)
+	channelRateLimits = map[string]int{"slack": 1}
+	now := time.Now()
+	channelSends["slack"] = []time.Time{now.Add(-59 * time.Minute)}
+
+	for _, alert := range []Alert{
+		{Target: "cluster0", Subject: "MongoDB Connection Failed", Time: now.Add(-2 * time.Minute)},
+		{Target: "cluster0", Subject: "MongoDB Connection Restored", Resolved: true, Time: now.Add(-time.Minute)},
+	} {
+		if _, limited := rateLimited("slack", alert); !limited {
+			t.Fatalf("%s was not limited", alert.Subject)
+		}
+	}
+	if due := dueChannelAlerts(now); len(due["slack"]) != 0 {
+		t.Fatalf("dueChannelAlerts() at the cap = %+v, want none", due)
+	}
+	due := dueChannelAlerts(now.Add(2 * time.Minute))
+	if len(due["slack"]) != 1 || due["slack"][0].Subject != "MongoDB Connection Restored" {
+		t.Fatalf("dueChannelAlerts() = %+v, want the restoration", due)
+	}
+	if due := dueChannelAlerts(now.Add(2 * time.Minute)); len(due["slack"]) != 0 {
+		t.Errorf("dueChannelAlerts() after the release = %+v, want none", due)
+	}
+
+	// A delivery about the target drops what was held about it
+	rateLimited("slack", Alert{Target: "cluster0", Subject: "MongoDB Connection Failed", Time: now})
+	recordChannelSend("slack", "cluster0")
+	if due := dueChannelAlerts(now.Add(2 * time.Hour)); len(due["slack"]) != 0 {
+		t.Errorf("dueChannelAlerts() after a later delivery = %+v, want none", due)
+	}
+}
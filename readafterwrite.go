@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// rawRead is one way of reading back the probe write.
+type rawRead struct {
+	ReadPreference string  `json:"read_preference"`
+	ReadConcern    string  `json:"read_concern"`
+	Causal         bool    `json:"causal"`
+	SawWrite       bool    `json:"saw_write"`
+	StalenessMS    float64 `json:"staleness_ms"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// rawReport is the outcome of the last read-after-write probe.
+type rawReport struct {
+	Time    time.Time `json:"time"`
+	Seq     int64     `json:"seq"`
+	WriteMS float64   `json:"write_ms"`
+	Reads   []rawRead `json:"reads,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type rawReadSpec struct {
+	mode    readpref.Mode
+	concern string
+}
+
+var (
+	rawProbeDB         string
+	rawProbeCollection string
+	rawProbeReads      []rawReadSpec
+	rawProbeMaxWait    time.Duration
+
+	rawMu         sync.Mutex
+	lastRAWReport *rawReport
+	causalBroken  bool
+)
+
+// loadReadAfterWriteConfig reads RAW_PROBE_DB (enables the probe),
+// RAW_PROBE_COLLECTION, RAW_PROBE_MAX_WAIT_MS, and RAW_PROBE_READS, a list
+// of readPreference/readConcern pairs such as
+// "primary/majority,secondary/local,nearest/majority".
+func loadReadAfterWriteConfig() {
+	rawProbeDB = os.Getenv("RAW_PROBE_DB")
+	rawProbeCollection = os.Getenv("RAW_PROBE_COLLECTION")
+	if rawProbeCollection == "" {
+		rawProbeCollection = "monitor_read_after_write"
+	}
+	rawProbeMaxWait = time.Duration(getEnvInt("RAW_PROBE_MAX_WAIT_MS", 2000)) * time.Millisecond
+
+	spec := os.Getenv("RAW_PROBE_READS")
+	if spec == "" {
+		spec = "primary/majority,secondaryPreferred/local,secondaryPreferred/majority,nearest/majority"
+	}
+	for _, item := range splitList(spec) {
+		modeName, concern, _ := strings.Cut(item, "/")
+		mode, err := readpref.ModeFromString(modeName)
+		if err != nil {
+			log.Fatalf("Invalid RAW_PROBE_READS entry %q: %v", item, err)
+		}
+		if concern == "" {
+			concern = "local"
+		}
+		if _, err := parseReadConcern(concern); err != nil {
+			log.Fatalf("Invalid RAW_PROBE_READS entry %q: %v", item, err)
+		}
+		rawProbeReads = append(rawProbeReads, rawReadSpec{mode: mode, concern: concern})
+	}
+}
+
+// checkReadAfterWrite writes a sequence number with w:majority and reads it
+// back with each configured read preference and concern, both plainly and
+// in a causally consistent session, recording how long each took to see
+// the write. A causal majority read that misses the write breaks the
+// guarantee applications rely on and is alerted on.
+func checkReadAfterWrite(uri string) {
+	if rawProbeDB == "" || !probeAllowed("read_after_write") {
+		return
+	}
+
+	report := runReadAfterWrite(uri)
+	if report.Error != "" {
+		logThrottled("Read-after-write probe failed", errors.New(report.Error))
+	}
+
+	var violations []string
+	for _, read := range report.Reads {
+		log.Printf("Read-after-write %s/%s causal=%v: saw write=%v after %.1fms\n", read.ReadPreference, read.ReadConcern, read.Causal, read.SawWrite, read.StalenessMS)
+		if read.Causal && read.ReadConcern == "majority" && read.Error == "" && !read.SawWrite {
+			violations = append(violations, tr("causal.not_seen", "{read_preference}/{read_concern} did not see the write within {wait}",
+				"read_preference", read.ReadPreference, "read_concern", read.ReadConcern, "wait", rawProbeMaxWait))
+		}
+	}
+
+	rawMu.Lock()
+	lastRAWReport = report
+	wasBroken := causalBroken
+	causalBroken = len(violations) > 0
+	rawMu.Unlock()
+
+	if causalBroken && !wasBroken {
+		sendAlert("MongoDB Causal Consistency Violation",
+			tr("causal.violation", "A majority write was not visible to causally consistent majority reads:\n")+strings.Join(violations, "\n"))
+	} else if !causalBroken && wasBroken {
+		sendRecovery("MongoDB Causal Consistency Restored", tr("causal.restored", "Causally consistent reads see majority writes again."))
+	}
+}
+
+func runReadAfterWrite(uri string) *rawReport {
+	report := &rawReport{Time: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "read-after-write"))
+	if err != nil {
+		report.Error = "connect: " + err.Error()
+		return report
+	}
+	defer closeClient(client, "read-after-write")
+
+	session, err := client.StartSession(options.Session().SetCausalConsistency(true))
+	if err != nil {
+		report.Error = "start session: " + err.Error()
+		return report
+	}
+	defer session.EndSession(ctx)
+	sctx := mongo.NewSessionContext(ctx, session)
+
+	// Wall-clock nanoseconds keep increasing across restarts, unlike a counter
+	report.Seq = time.Now().UnixNano()
+	majority := options.Collection().SetWriteConcern(writeconcern.Majority())
+	coll := client.Database(rawProbeDB).Collection(rawProbeCollection, majority)
+	if err := ensureProbeTTL(ctx, coll, "written_at"); err != nil {
+		logThrottled("Read-after-write probe TTL index", err)
+	}
+	start := time.Now()
+	_, err = coll.UpdateByID(sctx, targetName(),
+		bson.D{{Key: "$set", Value: bson.D{{Key: "seq", Value: report.Seq}, {Key: "written_at", Value: start}}}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		report.Error = "write: " + err.Error()
+		return report
+	}
+	report.WriteMS = float64(time.Since(start).Microseconds()) / 1000
+
+	for _, spec := range rawProbeReads {
+		for _, causal := range []bool{false, true} {
+			readCtx := ctx
+			if causal {
+				readCtx = sctx
+			}
+			report.Reads = append(report.Reads, readBack(readCtx, client, spec, causal, report.Seq, start))
+		}
+	}
+	return report
+}
+
+// readBack polls until the read sees seq or RAW_PROBE_MAX_WAIT_MS passes.
+func readBack(ctx context.Context, client *mongo.Client, spec rawReadSpec, causal bool, seq int64, written time.Time) rawRead {
+	read := rawRead{ReadPreference: spec.mode.String(), ReadConcern: spec.concern, Causal: causal}
+	rp, _ := readpref.New(spec.mode)
+	opts := options.Collection().SetReadPreference(rp).SetReadConcern(readconcern.New(readconcern.Level(spec.concern)))
+	coll := client.Database(rawProbeDB).Collection(rawProbeCollection, opts)
+
+	deadline := time.Now().Add(rawProbeMaxWait)
+	for {
+		var doc struct {
+			Seq int64 `bson:"seq"`
+		}
+		err := coll.FindOne(ctx, bson.D{{Key: "_id", Value: targetName()}}).Decode(&doc)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			read.Error = err.Error()
+			return read
+		}
+		read.StalenessMS = float64(time.Since(written).Microseconds()) / 1000
+		if doc.Seq >= seq {
+			read.SawWrite = true
+			return read
+		}
+		if time.Now().After(deadline) {
+			return read
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func readAfterWriteSnapshot() *rawReport {
+	rawMu.Lock()
+	defer rawMu.Unlock()
+	return lastRAWReport
+}
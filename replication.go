@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memberLag is one replica set member as replSetGetStatus sees it.
+type memberLag struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"`
+	Healthy    bool      `json:"healthy"`
+	OptimeDate time.Time `json:"optime_date"`
+	LagSeconds float64   `json:"lag_seconds"`
+}
+
+// replicationReport is the outcome of the last replication lag check.
+type replicationReport struct {
+	CheckedAt     time.Time   `json:"checked_at"`
+	Set           string      `json:"set,omitempty"`
+	Permitted     bool        `json:"permitted"`
+	Members       []memberLag `json:"members,omitempty"`
+	MaxLagSeconds float64     `json:"max_lag_seconds"`
+	Lagging       []string    `json:"lagging,omitempty"`
+}
+
+var (
+	replicationLagCheck bool
+	replicationLagMax   time.Duration
+
+	replicationMu     sync.Mutex
+	lastReplication   *replicationReport
+	replicationLagged string
+)
+
+// loadReplicationConfig reads REPLICATION_LAG_CHECK=true and
+// REPLICATION_LAG_MAX_SECONDS (default 60).
+func loadReplicationConfig() {
+	replicationLagCheck = os.Getenv("REPLICATION_LAG_CHECK") == "true"
+	replicationLagMax = time.Duration(getEnvInt("REPLICATION_LAG_MAX_SECONDS", 60)) * time.Second
+}
+
+// checkReplicationLag runs replSetGetStatus and alerts when a secondary's
+// last applied operation is more than REPLICATION_LAG_MAX_SECONDS behind
+// the primary's. Readers pinned to lagging members (analytics nodes in
+// particular) keep answering, just with old data, so nothing else notices.
+// Without the clusterMonitor role the check reports itself as not
+// permitted and stays quiet.
+func checkReplicationLag(uri string) {
+	if !replicationLagCheck || !probeAllowed("replication") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	defer cancel()
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "replication"))
+	if err != nil {
+		logThrottled("Failed to connect for replication lag check", err)
+		return
+	}
+	defer closeClient(client, "replication")
+
+	report := &replicationReport{CheckedAt: time.Now(), Permitted: true}
+	var status struct {
+		Set     string `bson:"set"`
+		Members []struct {
+			Name       string    `bson:"name"`
+			Health     float64   `bson:"health"`
+			StateStr   string    `bson:"stateStr"`
+			OptimeDate time.Time `bson:"optimeDate"`
+		} `bson:"members"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&status); err != nil {
+		if cmdErr, ok := err.(mongo.CommandError); ok {
+			switch cmdErr.Code {
+			case 13: // Unauthorized
+				report.Permitted = false
+				replicationMu.Lock()
+				lastReplication = report
+				replicationMu.Unlock()
+				logThrottled("Replication lag check not permitted", err)
+				return
+			case 59, 76: // CommandNotFound (mongos), NoReplicationEnabled
+				return
+			}
+		}
+		logThrottled("Failed to get replica set status", err)
+		return
+	}
+	report.Set = status.Set
+
+	// Lag is measured against the primary, or the most recent member while
+	// there is none
+	var newest time.Time
+	for _, member := range status.Members {
+		if member.StateStr == "PRIMARY" {
+			newest = member.OptimeDate
+			break
+		}
+		if member.OptimeDate.After(newest) {
+			newest = member.OptimeDate
+		}
+	}
+	var laggingNames []string
+	for _, member := range status.Members {
+		lag := memberLag{Name: member.Name, State: member.StateStr, Healthy: member.Health == 1, OptimeDate: member.OptimeDate}
+		if member.StateStr == "SECONDARY" && !member.OptimeDate.IsZero() {
+			lag.LagSeconds = newest.Sub(member.OptimeDate).Seconds()
+			if lag.LagSeconds > report.MaxLagSeconds {
+				report.MaxLagSeconds = lag.LagSeconds
+			}
+			if newest.Sub(member.OptimeDate) > replicationLagMax {
+				report.Lagging = append(report.Lagging, tr("replication.behind", "{member} is {lag} behind", "member", member.Name, "lag", newest.Sub(member.OptimeDate).Round(time.Second)))
+				laggingNames = append(laggingNames, member.Name)
+			}
+		}
+		report.Members = append(report.Members, lag)
+	}
+	sort.Strings(report.Lagging)
+	sort.Strings(laggingNames)
+	log.Printf("Replication: set=%s members=%d maxLag=%.1fs\n", report.Set, len(report.Members), report.MaxLagSeconds)
+
+	// Only a change in which members lag is news, not every second they
+	// fall further behind
+	lagging := strings.Join(laggingNames, ",")
+	replicationMu.Lock()
+	lastReplication = report
+	previous := replicationLagged
+	replicationLagged = lagging
+	replicationMu.Unlock()
+
+	switch {
+	case lagging != "" && lagging != previous:
+		sendAlert("MongoDB Replication Lag High",
+			tr("replication.lag_high", "Secondaries of {set} are more than {max} behind the primary:\n{lagging}\n\nReads sent to these members (analytics nodes, readPreference=secondary) return stale data.",
+				"set", report.Set, "max", replicationLagMax, "lagging", strings.Join(report.Lagging, "\n")))
+	case lagging == "" && previous != "":
+		sendRecovery("MongoDB Replication Lag Recovered", tr("replication.lag_recovered", "All secondaries of {set} are within {max} of the primary again.", "set", report.Set, "max", replicationLagMax))
+	}
+}
+
+func replicationSnapshot() *replicationReport {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+	return lastReplication
+}
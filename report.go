@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outageSpan is a run of failed checks, from the first failure to the next
+// success (or the end of the window).
+type outageSpan struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Seconds  float64   `json:"seconds"`
+	Checks   int       `json:"checks"`
+	Class    string    `json:"error_class,omitempty"`
+	Ongoing  bool      `json:"ongoing,omitempty"`
+	duration time.Duration
+	// Clock gaps inside the span, which are not downtime
+	gaps time.Duration
+}
+
+// uptimeReport summarizes one target's stored history over a window.
+type uptimeReport struct {
+	Target          string       `json:"target"`
+	Since           time.Time    `json:"since"`
+	Until           time.Time    `json:"until"`
+	Checks          int          `json:"checks"`
+	FailedChecks    int          `json:"failed_checks"`
+	UptimePercent   float64      `json:"uptime_percent"`
+	Outages         int          `json:"outages"`
+	DowntimeSeconds float64      `json:"downtime_seconds"`
+	P50MS           float64      `json:"p50_ms"`
+	P95MS           float64      `json:"p95_ms"`
+	P99MS           float64      `json:"p99_ms"`
+	OutageList      []outageSpan `json:"outage_list,omitempty"`
+	ClockGapSeconds float64      `json:"clock_gap_seconds,omitempty"`
+	firstCheck      time.Time
+}
+
+// runReportCommand implements `report`: uptime, outages, downtime, and
+// latency percentiles per cluster from HISTORY_DB.
+func runReportCommand(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	sinceFlag := fs.String("since", "7d", "start of the window, RFC 3339 or a duration back from -until such as 24h or 30d")
+	untilFlag := fs.String("until", "", "end of the window, RFC 3339 (default now)")
+	target := fs.String("target", "", "report only this cluster")
+	format := fs.String("format", "text", "text, json, csv, or html")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	fs.Parse(args)
+
+	if historyDB == nil {
+		return errors.New("report reads HISTORY_DB, which is not set")
+	}
+	until := time.Now()
+	if *untilFlag != "" {
+		t, err := time.Parse(time.RFC3339, *untilFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -until: %w", err)
+		}
+		until = t
+	}
+	since, err := parseReportStart(*sinceFlag, until)
+	if err != nil {
+		return err
+	}
+
+	selected := clusters
+	if *target != "" {
+		c := findCluster(*target)
+		if c == nil {
+			return fmt.Errorf("unknown cluster %q", *target)
+		}
+		selected = []*cluster{c}
+	}
+	var reports []uptimeReport
+	for _, c := range selected {
+		results, err := storedResults(c.name, since, until, 0)
+		if err != nil {
+			return fmt.Errorf("read history of %s: %w", c.name, err)
+		}
+		reports = append(reports, summarizeUptime(c.name, since, until, results))
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	switch *format {
+	case "text":
+		return writeReportText(out, reports)
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	case "csv":
+		return writeReportCSV(out, reports)
+	case "html":
+		return reportHTML.Execute(out, reports)
+	}
+	return fmt.Errorf("unknown -format %q", *format)
+}
+
+// parseReportStart accepts a timestamp or a duration before until, with
+// "d" for days as well as what time.ParseDuration takes.
+func parseReportStart(value string, until time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n > 0 {
+			return until.AddDate(0, 0, -n), nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid -since %q, expected RFC 3339 or a duration such as 24h or 30d", value)
+	}
+	return until.Add(-d), nil
+}
+
+// summarizeUptime computes the report from results ordered oldest first.
+// Uptime is by time, not by check count: the share of the window from the
+// first result on that was not inside an outage. Clock gaps (host sleep, VM
+// pauses) count as neither, and like the check loop, a failure right after
+// one does not start an outage, nor does its latency count.
+func summarizeUptime(target string, since, until time.Time, results []checkResult) uptimeReport {
+	report := uptimeReport{Target: target, Since: since, Until: until, Checks: len(results)}
+	var latencies []float64
+	var current *outageSpan
+	var downtime, gaps time.Duration
+	for i, result := range results {
+		gap := time.Duration(result.ClockGapMS * float64(time.Millisecond))
+		if i > 0 {
+			gaps += gap
+		}
+		if current != nil {
+			current.gaps += gap
+		}
+		if result.Status == "down" {
+			report.FailedChecks++
+			if current == nil && gap == 0 {
+				current = &outageSpan{Start: result.Time, Class: result.ErrorClass}
+			}
+			if current != nil {
+				current.Checks++
+			}
+			continue
+		}
+		if gap == 0 {
+			latencies = append(latencies, result.LatencyMS)
+		}
+		if current != nil {
+			current.End = result.Time
+			report.OutageList = append(report.OutageList, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		current.End, current.Ongoing = until, true
+		report.OutageList = append(report.OutageList, *current)
+	}
+	for i := range report.OutageList {
+		span := &report.OutageList[i]
+		span.duration = max(0, span.End.Sub(span.Start)-span.gaps)
+		span.Seconds = span.duration.Seconds()
+		downtime += span.duration
+	}
+	report.Outages = len(report.OutageList)
+	report.DowntimeSeconds = downtime.Seconds()
+	report.ClockGapSeconds = gaps.Seconds()
+
+	if len(results) > 0 {
+		report.firstCheck = results[0].Time
+		covered := until.Sub(results[0].Time) - gaps
+		if covered > 0 {
+			report.UptimePercent = math.Max(0, 100*(1-downtime.Seconds()/covered.Seconds()))
+		} else if report.FailedChecks == 0 {
+			report.UptimePercent = 100
+		}
+	}
+	sort.Float64s(latencies)
+	report.P50MS = percentile(latencies, 50)
+	report.P95MS = percentile(latencies, 95)
+	report.P99MS = percentile(latencies, 99)
+	return report
+}
+
+// percentile is the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func writeReportText(w io.Writer, reports []uptimeReport) error {
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s, %s to %s\n", r.Target, r.Since.Format(time.RFC3339), r.Until.Format(time.RFC3339))
+		if r.Checks == 0 {
+			fmt.Fprintf(w, "  no checks recorded\n\n")
+			continue
+		}
+		fmt.Fprintf(w, "  uptime    %.3f%% (%d of %d checks failed)\n", r.UptimePercent, r.FailedChecks, r.Checks)
+		fmt.Fprintf(w, "  outages   %d, %v down in total\n", r.Outages, time.Duration(r.DowntimeSeconds*float64(time.Second)).Round(time.Second))
+		fmt.Fprintf(w, "  latency   p50 %.1fms, p95 %.1fms, p99 %.1fms\n", r.P50MS, r.P95MS, r.P99MS)
+		if r.ClockGapSeconds > 0 {
+			fmt.Fprintf(w, "  excluded  %v of clock gaps\n", time.Duration(r.ClockGapSeconds*float64(time.Second)).Round(time.Second))
+		}
+		for _, o := range r.OutageList {
+			end := o.End.Format(time.RFC3339)
+			if o.Ongoing {
+				end = "ongoing"
+			}
+			fmt.Fprintf(w, "    %s to %s  %v  %d check(s)  %s\n", o.Start.Format(time.RFC3339), end, o.duration.Round(time.Second), o.Checks, o.Class)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func writeReportCSV(w io.Writer, reports []uptimeReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"target", "since", "until", "checks", "failed_checks", "uptime_percent", "outages", "downtime_seconds", "p50_ms", "p95_ms", "p99_ms"})
+	for _, r := range reports {
+		cw.Write([]string{r.Target, r.Since.Format(time.RFC3339), r.Until.Format(time.RFC3339),
+			strconv.Itoa(r.Checks), strconv.Itoa(r.FailedChecks), strconv.FormatFloat(r.UptimePercent, 'f', 4, 64),
+			strconv.Itoa(r.Outages), strconv.FormatFloat(r.DowntimeSeconds, 'f', 0, 64),
+			strconv.FormatFloat(r.P50MS, 'f', 1, 64), strconv.FormatFloat(r.P95MS, 'f', 1, 64), strconv.FormatFloat(r.P99MS, 'f', 1, 64)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ts": func(t time.Time) string { return t.Format("2006-01-02 15:04:05 MST") },
+	"dur": func(seconds float64) string {
+		return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>MongoDB uptime report</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse;margin-bottom:1em}td,th{border:1px solid #ccc;padding:4px 8px;text-align:left}</style>
+</head><body>
+<h1>MongoDB uptime report</h1>
+<table>
+<tr><th>Target</th><th>Window</th><th>Uptime</th><th>Checks (failed)</th><th>Outages</th><th>Downtime</th><th>p50</th><th>p95</th><th>p99</th></tr>
+{{range .}}<tr><td>{{.Target}}</td><td>{{ts .Since}} to {{ts .Until}}</td><td>{{printf "%.3f" .UptimePercent}}%</td><td>{{.Checks}} ({{.FailedChecks}})</td><td>{{.Outages}}</td><td>{{dur .DowntimeSeconds}}</td><td>{{printf "%.1f" .P50MS}}ms</td><td>{{printf "%.1f" .P95MS}}ms</td><td>{{printf "%.1f" .P99MS}}ms</td></tr>
+{{end}}</table>
+{{range .}}{{if .OutageList}}<h2>Outages of {{.Target}}</h2>
+<table>
+<tr><th>Start</th><th>End</th><th>Duration</th><th>Failed checks</th><th>Error class</th></tr>
+{{range .OutageList}}<tr><td>{{ts .Start}}</td><td>{{if .Ongoing}}ongoing{{else}}{{ts .End}}{{end}}</td><td>{{dur .Seconds}}</td><td>{{.Checks}}</td><td>{{.Class}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}</body></html>
+`))
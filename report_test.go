@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSummarizeUptime(t *testing.T) {
+	since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	until := since.Add(10 * time.Minute)
+	type check struct {
+		minute  int
+		down    bool
+		latency float64
+		gapMS   float64
+	}
+	tests := []struct {
+		name          string
+		checks        []check
+		uptime        float64
+		outages       int
+		downtime      float64
+		ongoing       bool
+		gapSeconds    float64
+		p50, p99      float64
+		failedChecks  int
+		outageChecks  []int
+		outageSeconds []float64
+	}{
+		{
+			name:   "no checks",
+			uptime: 0,
+		},
+		{
+			name:   "all up",
+			checks: []check{{0, false, 10, 0}, {5, false, 20, 0}, {9, false, 30, 0}},
+			uptime: 100, p50: 20, p99: 30,
+		},
+		{
+			name:          "one outage",
+			checks:        []check{{0, false, 10, 0}, {2, true, 0, 0}, {3, true, 0, 0}, {4, false, 10, 0}},
+			uptime:        80,
+			outages:       1,
+			downtime:      120,
+			failedChecks:  2,
+			p50:           10,
+			p99:           10,
+			outageChecks:  []int{2},
+			outageSeconds: []float64{120},
+		},
+		{
+			name:          "ongoing outage",
+			checks:        []check{{0, false, 10, 0}, {5, true, 0, 0}},
+			uptime:        50,
+			outages:       1,
+			downtime:      300,
+			ongoing:       true,
+			failedChecks:  1,
+			p50:           10,
+			p99:           10,
+			outageChecks:  []int{1},
+			outageSeconds: []float64{300},
+		},
+		{
+			// The host slept for two minutes inside the outage
+			name:          "clock gap inside an outage",
+			checks:        []check{{0, false, 10, 0}, {2, true, 0, 0}, {5, true, 0, 120000}, {6, false, 10, 0}},
+			uptime:        75,
+			outages:       1,
+			downtime:      120,
+			gapSeconds:    120,
+			failedChecks:  2,
+			p50:           10,
+			p99:           10,
+			outageChecks:  []int{2},
+			outageSeconds: []float64{120},
+		},
+		{
+			// A failure right after a gap does not open an outage, and a
+			// success right after one has no latency worth counting
+			name:         "failure right after a clock gap",
+			checks:       []check{{0, false, 10, 0}, {5, true, 0, 240000}, {6, false, 900, 60000}, {7, false, 20, 0}},
+			uptime:       100,
+			gapSeconds:   300,
+			failedChecks: 1,
+			p50:          10,
+			p99:          20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []checkResult
+			for _, c := range tt.checks {
+				result := checkResult{Time: since.Add(time.Duration(c.minute) * time.Minute), Status: "up", LatencyMS: c.latency, ClockGapMS: c.gapMS}
+				if c.down {
+					result.Status, result.ErrorClass = "down", classNetwork
+				}
+				results = append(results, result)
+			}
+			r := summarizeUptime("cluster0", since, until, results)
+			if math.Abs(r.UptimePercent-tt.uptime) > 1e-9 {
+				t.Errorf("uptime = %v%%, want %v%%", r.UptimePercent, tt.uptime)
+			}
+			if r.Checks != len(tt.checks) || r.FailedChecks != tt.failedChecks {
+				t.Errorf("checks = %d (%d failed), want %d (%d failed)", r.Checks, r.FailedChecks, len(tt.checks), tt.failedChecks)
+			}
+			if r.Outages != tt.outages || r.DowntimeSeconds != tt.downtime {
+				t.Errorf("outages = %d, %vs down, want %d, %vs", r.Outages, r.DowntimeSeconds, tt.outages, tt.downtime)
+			}
+			if r.ClockGapSeconds != tt.gapSeconds {
+				t.Errorf("clock gaps = %vs, want %vs", r.ClockGapSeconds, tt.gapSeconds)
+			}
+			if r.P50MS != tt.p50 || r.P99MS != tt.p99 {
+				t.Errorf("p50, p99 = %v, %v, want %v, %v", r.P50MS, r.P99MS, tt.p50, tt.p99)
+			}
+			for i, span := range r.OutageList {
+				if span.Checks != tt.outageChecks[i] || span.Seconds != tt.outageSeconds[i] || span.Ongoing != tt.ongoing {
+					t.Errorf("outage %d = %d check(s), %vs, ongoing %v, want %d, %vs, %v",
+						i, span.Checks, span.Seconds, span.Ongoing, tt.outageChecks[i], tt.outageSeconds[i], tt.ongoing)
+				}
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 50, 0},
+		{[]float64{7}, 99, 7},
+		{sorted, 0, 1},
+		{sorted, 50, 5},
+		{sorted, 95, 10},
+		{sorted, 100, 10},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.values, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.values, tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// The result stream posts every check result, not only transitions, to
+// RESULT_WEBHOOK_URL in batches of JSON:
+// {"results":[...],"dropped":0}
+// Results queue in memory while the receiver is slow or down; once
+// RESULT_WEBHOOK_QUEUE results are waiting the oldest are dropped and the
+// count is reported with the next batch, so checks never wait for it.
+
+type resultBatch struct {
+	Results []checkResult `json:"results"`
+	Dropped int           `json:"dropped"`
+}
+
+var (
+	resultStream      *webhookNotifier
+	resultBatchSize   int
+	resultQueueSize   int
+	resultFlushPeriod time.Duration
+
+	resultMu           sync.Mutex
+	resultQueue        []checkResult
+	resultDropped      int
+	resultDroppedTotal int
+	resultWake         = make(chan struct{}, 1)
+)
+
+// loadResultStreamConfig reads RESULT_WEBHOOK_URL (enables the stream),
+// RESULT_WEBHOOK_BATCH_SIZE (default 50), RESULT_WEBHOOK_FLUSH_SECONDS
+// (default 10) and RESULT_WEBHOOK_QUEUE (default 1000). Headers and
+// retries are shared with the transition webhook.
+func loadResultStreamConfig() {
+	url := os.Getenv("RESULT_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+	resultStream = &webhookNotifier{
+		urls:    []string{url},
+		headers: webhookHeaders(),
+		retries: getEnvInt("WEBHOOK_RETRIES", 3),
+		backoff: time.Duration(getEnvInt("WEBHOOK_RETRY_BACKOFF_MS", 1000)) * time.Millisecond,
+	}
+	resultBatchSize = getEnvInt("RESULT_WEBHOOK_BATCH_SIZE", 50)
+	resultQueueSize = getEnvInt("RESULT_WEBHOOK_QUEUE", 1000)
+	resultFlushPeriod = time.Duration(getEnvInt("RESULT_WEBHOOK_FLUSH_SECONDS", 10)) * time.Second
+	if resultBatchSize < 1 || resultQueueSize < resultBatchSize {
+		log.Fatal("RESULT_WEBHOOK_QUEUE must be at least RESULT_WEBHOOK_BATCH_SIZE, which must be positive")
+	}
+}
+
+// startResultStream runs the goroutine that sends queued results whenever
+// a batch is full or the flush period passes.
+func startResultStream() {
+	if resultStream == nil {
+		return
+	}
+	log.Printf("Streaming check results to %s in batches of %d\n", resultStream.urls[0], resultBatchSize)
+	go func() {
+		ticker := time.NewTicker(resultFlushPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-resultWake:
+			}
+			for flushResults() {
+			}
+		}
+	}()
+}
+
+// streamResult queues a result without blocking the check loop.
+func streamResult(result checkResult) {
+	if resultStream == nil {
+		return
+	}
+	resultMu.Lock()
+	defer resultMu.Unlock()
+	resultQueue = append(resultQueue, result)
+	trimResultQueue()
+	if len(resultQueue) >= resultBatchSize {
+		select {
+		case resultWake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// trimResultQueue drops the oldest results beyond the queue limit. The
+// caller holds resultMu.
+func trimResultQueue() {
+	if excess := len(resultQueue) - resultQueueSize; excess > 0 {
+		resultQueue = append([]checkResult(nil), resultQueue[excess:]...)
+		resultDropped += excess
+		resultDroppedTotal += excess
+	}
+}
+
+// flushResults sends one batch and reports whether a full batch is still
+// waiting. A batch that could not be delivered goes back to the front of
+// the queue.
+func flushResults() bool {
+	resultMu.Lock()
+	if len(resultQueue) == 0 {
+		resultMu.Unlock()
+		return false
+	}
+	n := min(len(resultQueue), resultBatchSize)
+	batch := resultBatch{Results: append([]checkResult(nil), resultQueue[:n]...), Dropped: resultDropped}
+	resultQueue = resultQueue[n:]
+	resultDropped = 0
+	resultMu.Unlock()
+
+	data, err := json.Marshal(batch)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), resultFlushPeriod)
+		err = resultStream.post(ctx, resultStream.urls[0], data)
+		cancel()
+	}
+	recordNotification("result-webhook", err)
+
+	resultMu.Lock()
+	defer resultMu.Unlock()
+	if err != nil {
+		logThrottled("Failed to post check results", err)
+		resultQueue = append(batch.Results, resultQueue...)
+		resultDropped += batch.Dropped
+		trimResultQueue()
+		return false
+	}
+	return len(resultQueue) >= resultBatchSize
+}
+
+func resultStreamSnapshot() (queued, dropped int) {
+	resultMu.Lock()
+	defer resultMu.Unlock()
+	return len(resultQueue), resultDroppedTotal
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const routeEnvPrefix = "ALERT_ROUTE_"
+
+// Alert severities, used by the routing matrix.
+const (
+	severityCritical = "critical"
+	severityWarning  = "warning"
+	severityInfo     = "info"
+)
+
+// severityTags maps the bracketed subject prefixes some alerts carry, such
+// as "[page] MongoDB SLO fast burn", to a severity.
+var severityTags = map[string]string{
+	"page":   severityCritical,
+	"ticket": severityWarning,
+	"info":   severityInfo,
+}
+
+// alertRoute is one row of the routing matrix: alerts whose target,
+// severity and error class match the patterns go to the channels. An empty
+// pattern list matches anything.
+type alertRoute struct {
+	name     string
+	spec     string
+	target   []string
+	severity []string
+	class    []string
+	channels []Notifier
+}
+
+var alertRoutes []alertRoute
+
+// loadAlertRoutes reads the routing matrix from ALERT_ROUTE_<N> variables,
+// tried in numeric order, e.g.
+//
+//	ALERT_ROUTE_1="target=prod-* severity=critical -> pagerduty,email"
+//	ALERT_ROUTE_2="class=dns,tls -> slack"
+//	ALERT_ROUTE_3="severity=info -> none"
+//
+// The first matching route decides which channels get an alert; "none"
+// drops it. Patterns are globs and a comma separates alternatives. Alerts
+// matching no route go to the fallback chain and fan-out channels as
+// before, so without routes every channel gets every alert.
+func loadAlertRoutes() {
+	type numbered struct {
+		n     int
+		route alertRoute
+	}
+	var routes []numbered
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		suffix, ok := strings.CutPrefix(key, routeEnvPrefix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(suffix)
+		if err != nil {
+			log.Fatalf("Invalid %s: routes are numbered, e.g. %s1", key, routeEnvPrefix)
+		}
+		route, err := parseAlertRoute(value)
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", key, err)
+		}
+		route.name = key
+		routes = append(routes, numbered{n, route})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].n < routes[j].n })
+	for _, r := range routes {
+		alertRoutes = append(alertRoutes, r.route)
+		log.Printf("Alert route %s: %s\n", r.route.name, r.route.spec)
+	}
+}
+
+// parseAlertRoute parses "target=prod-* severity=critical,warning -> email,slack".
+func parseAlertRoute(spec string) (alertRoute, error) {
+	route := alertRoute{spec: strings.TrimSpace(spec)}
+	match, channels, ok := strings.Cut(spec, "->")
+	if !ok {
+		return route, fmt.Errorf("missing \"-> channels\" in %q", route.spec)
+	}
+	for _, field := range strings.Fields(match) {
+		key, value, ok := strings.Cut(field, "=")
+		patterns := splitList(value)
+		if !ok || len(patterns) == 0 {
+			return route, fmt.Errorf("invalid condition %q, want key=pattern", field)
+		}
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return route, fmt.Errorf("invalid pattern %q: %v", p, err)
+			}
+		}
+		switch strings.ToLower(key) {
+		case "target":
+			route.target = patterns
+		case "severity":
+			route.severity = patterns
+		case "class":
+			route.class = patterns
+		default:
+			return route, fmt.Errorf("unknown condition %q, want target, severity or class", key)
+		}
+	}
+
+	names := splitList(channels)
+	if len(names) == 0 {
+		return route, fmt.Errorf("no channels in %q", route.spec)
+	}
+	if len(names) == 1 && strings.EqualFold(names[0], "none") {
+		return route, nil
+	}
+	for _, name := range names {
+		n, ok := availableNotifiers[name]
+		if !ok {
+			return route, fmt.Errorf("unknown or unconfigured channel %q", name)
+		}
+		route.channels = append(route.channels, n)
+	}
+	return route, nil
+}
+
+// matchesCondition reports whether value matches one of the patterns of a
+// route condition; a route without the condition matches any value.
+func matchesCondition(value string, patterns []string) bool {
+	return len(patterns) == 0 || matchesAny(value, patterns)
+}
+
+func (r alertRoute) matches(alert Alert) bool {
+	return matchesCondition(alert.Target, r.target) && matchesCondition(alert.Severity, r.severity) && matchesCondition(alert.Class, r.class)
+}
+
+// routeFor returns the first route matching the alert.
+func routeFor(alert Alert) (alertRoute, bool) {
+	for _, r := range alertRoutes {
+		if r.matches(alert) {
+			return r, true
+		}
+	}
+	return alertRoute{}, false
+}
+
+// alertSeverity is the severity of alerts raised without one: that of a
+// bracketed subject prefix, or warning.
+func alertSeverity(subject string) string {
+	if rest, ok := strings.CutPrefix(subject, "["); ok {
+		if tag, _, ok := strings.Cut(rest, "]"); ok {
+			if severity, ok := severityTags[strings.ToLower(tag)]; ok {
+				return severity
+			}
+		}
+	}
+	return severityWarning
+}
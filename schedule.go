@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const scheduleEnvPrefix = "NOTIFY_SCHEDULE_"
+
+// scheduleWindow is a time-of-day range on a set of weekdays. A window whose
+// end is not after its start runs past midnight into the following day.
+type scheduleWindow struct {
+	days  [7]bool
+	start int // minutes since midnight
+	end   int
+}
+
+// channelSchedule lists the windows in which a notification channel may be
+// used. An empty schedule means always.
+type channelSchedule []scheduleWindow
+
+var (
+	scheduleLocation *time.Location
+	channelSchedules = map[string]channelSchedule{}
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// loadSchedules reads NOTIFY_SCHEDULE_<CHANNEL> variables, e.g.
+// NOTIFY_SCHEDULE_EMAIL="Mon-Fri 09:00-17:00", interpreted in NOTIFY_TIMEZONE.
+func loadSchedules() {
+	scheduleLocation = time.Local
+	if tz := os.Getenv("NOTIFY_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			log.Fatalf("Invalid NOTIFY_TIMEZONE: %v", err)
+		}
+		scheduleLocation = loc
+	}
+
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, scheduleEnvPrefix) {
+			continue
+		}
+		schedule, err := parseSchedule(value)
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", key, err)
+		}
+		channel := strings.ToLower(strings.TrimPrefix(key, scheduleEnvPrefix))
+		channelSchedules[channel] = schedule
+		log.Printf("Notification schedule for %s: %s (%s)\n", channel, value, scheduleLocation)
+	}
+}
+
+// parseSchedule parses "Mon-Fri 09:00-17:00; Sat 10:00-14:00". A window
+// without a time range covers the whole day; "24/7" or "always" is no limit.
+func parseSchedule(spec string) (channelSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "always") || spec == "24/7" {
+		return nil, nil
+	}
+
+	var schedule channelSchedule
+	for _, part := range strings.Split(spec, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid window %q", strings.TrimSpace(part))
+		}
+		var w scheduleWindow
+		if err := parseDays(fields[0], &w.days); err != nil {
+			return nil, err
+		}
+		w.end = 24 * 60
+		if len(fields) == 2 {
+			startStr, endStr, ok := strings.Cut(fields[1], "-")
+			if !ok {
+				return nil, fmt.Errorf("invalid time range %q", fields[1])
+			}
+			var err error
+			if w.start, err = parseClock(startStr); err != nil {
+				return nil, err
+			}
+			if w.end, err = parseClock(endStr); err != nil {
+				return nil, err
+			}
+		}
+		schedule = append(schedule, w)
+	}
+	return schedule, nil
+}
+
+func parseDays(spec string, days *[7]bool) error {
+	if spec == "*" || strings.EqualFold(spec, "daily") {
+		for i := range days {
+			days[i] = true
+		}
+		return nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(item), "-")
+		first, ok := weekdayNames[from]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdayNames[to]; !ok {
+				return fmt.Errorf("unknown weekday %q", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (s channelSchedule) allows(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	t = t.In(scheduleLocation)
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	for _, w := range s {
+		if w.end > w.start {
+			if w.days[today] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// Overnight window, e.g. 22:00-06:00
+		if (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// channelActive reports whether channel may be notified at t.
+func channelActive(channel string, t time.Time) bool {
+	return channelSchedules[channel].allows(t)
+}
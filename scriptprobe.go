@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A probe script is a short synthetic transaction, run as one probe
+// against the primary cluster every cycle:
+//
+//	name: checkout
+//	database: monitor
+//	collection: synthetic_orders
+//	timeout_ms: 5000
+//	steps:
+//	  - op: insert
+//	    document: '{"order": "{{run}}", "qty": 1}'
+//	  - op: update
+//	    filter: '{"order": "{{run}}"}'
+//	    update: '{"$inc": {"qty": 1}}'
+//	    expect_modified: 1
+//	  - op: aggregate
+//	    pipeline: '[{"$match": {"order": "{{run}}"}}]'
+//	    expect: '{"qty": 2}'
+//	    max_ms: 200
+//	  - op: delete
+//	    filter: '{"order": "{{run}}"}'
+//	    expect_deleted: 1
+//
+// Documents, filters, updates and pipelines are extended JSON, in which
+// {{run}} stands for an ID unique to the run. The steps are insert, find,
+// update, aggregate and delete, optionally on their own collection, and
+// may assert expect_count (documents found), expect_matched,
+// expect_modified, expect_deleted, expect (fields the first document found
+// must have) and max_ms. The script stops at the first failing step.
+
+const scriptRunPlaceholder = "{{run}}"
+
+type scriptStep struct {
+	op         string
+	collection string
+	document   string
+	filter     string
+	update     string
+	pipeline   string
+	expect     string
+	counts     map[string]int64
+	max        time.Duration
+}
+
+type probeScript struct {
+	name       string
+	database   string
+	collection string
+	timeout    time.Duration
+	steps      []scriptStep
+}
+
+// scriptStepResult is the outcome of one step of a script run.
+type scriptStepResult struct {
+	Step      int     `json:"step"`
+	Op        string  `json:"op"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// scriptReport is the outcome of the last run of one script.
+type scriptReport struct {
+	Script  string             `json:"script"`
+	Time    time.Time          `json:"time"`
+	TotalMS float64            `json:"total_ms"`
+	OK      bool               `json:"ok"`
+	Steps   []scriptStepResult `json:"steps"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// scriptStepOps are the supported operations with the fields they need.
+var scriptStepOps = map[string][]string{
+	"insert":    {"document"},
+	"find":      {"filter"},
+	"update":    {"filter", "update"},
+	"aggregate": {"pipeline"},
+	"delete":    {"filter"},
+}
+
+var scriptCounts = []string{"expect_count", "expect_matched", "expect_modified", "expect_deleted"}
+
+var (
+	probeScripts []*probeScript
+
+	scriptMu      sync.Mutex
+	scriptReports = map[string]*scriptReport{}
+	scriptFailing = map[string]bool{}
+)
+
+// loadProbeScripts reads the scripts listed in PROBE_SCRIPTS, YAML or, for
+// .json files, JSON.
+func loadProbeScripts() {
+	for _, path := range splitList(os.Getenv("PROBE_SCRIPTS")) {
+		script, err := loadProbeScript(path)
+		if err != nil {
+			log.Fatalf("Invalid probe script %s: %v", path, err)
+		}
+		for _, other := range probeScripts {
+			if other.name == script.name {
+				log.Fatalf("Probe script name %s is used twice", script.name)
+			}
+		}
+		probeScripts = append(probeScripts, script)
+		log.Printf("Probe script %s: %d step(s) on %s.%s\n", script.name, len(script.steps), script.database, script.collection)
+	}
+}
+
+func loadProbeScript(path string) (*probeScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		doc, err = parseYAML(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	script := &probeScript{
+		name:       scriptField(doc, "name"),
+		database:   scriptField(doc, "database"),
+		collection: orString(scriptField(doc, "collection"), "monitor_synthetic"),
+		timeout:    checkInterval,
+	}
+	if script.name == "" {
+		script.name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if script.database == "" {
+		return nil, fmt.Errorf("database is required")
+	}
+	if ms := scriptField(doc, "timeout_ms"); ms != "" {
+		n, err := strconv.Atoi(ms)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("timeout_ms must be a positive number of milliseconds")
+		}
+		script.timeout = time.Duration(n) * time.Millisecond
+	}
+
+	steps, _ := doc["steps"].([]interface{})
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("the script has no steps")
+	}
+	for i, raw := range steps {
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("step %d: expected op and its fields", i+1)
+		}
+		step, err := parseScriptStep(m)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		script.steps = append(script.steps, step)
+	}
+	return script, nil
+}
+
+func parseScriptStep(m map[string]interface{}) (scriptStep, error) {
+	step := scriptStep{
+		op:         scriptField(m, "op"),
+		collection: scriptField(m, "collection"),
+		document:   scriptField(m, "document"),
+		filter:     scriptField(m, "filter"),
+		update:     scriptField(m, "update"),
+		pipeline:   scriptField(m, "pipeline"),
+		expect:     scriptField(m, "expect"),
+		counts:     map[string]int64{},
+	}
+	required, ok := scriptStepOps[step.op]
+	if !ok {
+		return step, fmt.Errorf("unknown op %q, want insert, find, update, aggregate or delete", step.op)
+	}
+	for _, field := range required {
+		if scriptField(m, field) == "" {
+			return step, fmt.Errorf("%s needs %s", step.op, field)
+		}
+	}
+	for _, key := range scriptCounts {
+		if value := scriptField(m, key); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return step, fmt.Errorf("%s must be a number", key)
+			}
+			step.counts[key] = n
+		}
+	}
+	if value := scriptField(m, "max_ms"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return step, fmt.Errorf("max_ms must be a number")
+		}
+		step.max = time.Duration(n) * time.Millisecond
+	}
+
+	// Catch malformed JSON now rather than on every run
+	for _, text := range []string{step.document, step.filter, step.update, step.expect} {
+		if _, err := scriptDocument(text, "check"); text != "" && err != nil {
+			return step, err
+		}
+	}
+	if step.pipeline != "" {
+		if _, err := scriptPipeline(step.pipeline, "check"); err != nil {
+			return step, err
+		}
+	}
+	return step, nil
+}
+
+// scriptField returns a field as text; JSON scripts may give documents as
+// objects rather than strings.
+func scriptField(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return strings.TrimSpace(configScalar(v))
+	}
+}
+
+func scriptDocument(text, run string) (bson.D, error) {
+	doc := bson.D{}
+	if text == "" {
+		return doc, nil
+	}
+	if err := bson.UnmarshalExtJSON([]byte(strings.ReplaceAll(text, scriptRunPlaceholder, run)), false, &doc); err != nil {
+		return nil, fmt.Errorf("invalid extended JSON %s: %v", text, err)
+	}
+	return doc, nil
+}
+
+func scriptPipeline(text, run string) (bson.A, error) {
+	doc, err := scriptDocument(`{"pipeline": `+text+`}`, run)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline %s: %v", text, err)
+	}
+	pipeline, ok := doc[0].Value.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("the pipeline must be a list of stages")
+	}
+	return pipeline, nil
+}
+
+// checkProbeScripts runs every script and alerts when one starts or stops
+// failing.
+func checkProbeScripts(uri string) {
+	for _, script := range probeScripts {
+		report := script.run(uri)
+		log.Printf("Probe script %s: ok=%v in %.1fms\n", script.name, report.OK, report.TotalMS)
+
+		scriptMu.Lock()
+		scriptReports[script.name] = report
+		wasFailing := scriptFailing[script.name]
+		scriptFailing[script.name] = !report.OK
+		scriptMu.Unlock()
+
+		if !report.OK && !wasFailing {
+			sendAlert("MongoDB Scripted Probe Failing",
+				tr("script.failing", "Probe script {script} failed: {error}\n\n{steps}", "script", script.name, "error", report.Error, "steps", describeScriptSteps(report)))
+		} else if report.OK && wasFailing {
+			sendRecovery("MongoDB Scripted Probe Restored",
+				tr("script.restored", "Probe script {script} succeeds again.\n\n{steps}", "script", script.name, "steps", describeScriptSteps(report)))
+		}
+	}
+}
+
+// stepCollection is the collection a step works on: its own, or the
+// script's.
+func (s *probeScript) stepCollection(step scriptStep) string {
+	return orString(step.collection, s.collection)
+}
+
+// namespaces lists the collections the script's steps work on.
+func (s *probeScript) namespaces() []string {
+	namespaces := make([]string, 0, len(s.steps))
+	for _, step := range s.steps {
+		namespaces = append(namespaces, s.database+"."+s.stepCollection(step))
+	}
+	return namespaces
+}
+
+func (s *probeScript) run(uri string) *scriptReport {
+	report := &scriptReport{Script: s.name, Time: time.Now(), Steps: []scriptStepResult{}}
+	defer func() {
+		report.TotalMS = float64(time.Since(report.Time).Microseconds()) / 1000
+		report.OK = report.Error == ""
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "script-"+s.name))
+	if err != nil {
+		report.Error = "connect: " + err.Error()
+		return report
+	}
+	defer closeClient(client, "script-"+s.name)
+
+	run := strconv.FormatInt(report.Time.UnixNano(), 36)
+	db := client.Database(s.database)
+	for i, step := range s.steps {
+		coll := db.Collection(s.stepCollection(step))
+		start := time.Now()
+		err := step.run(ctx, coll, run)
+		elapsed := time.Since(start)
+		if err == nil && step.max > 0 && elapsed > step.max {
+			err = fmt.Errorf("took %v, more than max_ms %v", elapsed.Round(time.Millisecond), step.max)
+		}
+		result := scriptStepResult{Step: i + 1, Op: step.op, LatencyMS: float64(elapsed.Microseconds()) / 1000}
+		if err != nil {
+			result.Error = err.Error()
+			report.Error = fmt.Sprintf("step %d (%s): %v", i+1, step.op, err)
+		}
+		report.Steps = append(report.Steps, result)
+		if err != nil {
+			break
+		}
+	}
+	return report
+}
+
+func (step scriptStep) run(ctx context.Context, coll *mongo.Collection, run string) error {
+	filter, err := scriptDocument(step.filter, run)
+	if err != nil {
+		return err
+	}
+	got := map[string]int64{}
+	var docs []bson.M
+	switch step.op {
+	case "insert":
+		doc, err := scriptDocument(step.document, run)
+		if err != nil {
+			return err
+		}
+		if _, err := coll.InsertOne(ctx, doc); err != nil {
+			return err
+		}
+	case "find":
+		cursor, err := coll.Find(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if err := cursor.All(ctx, &docs); err != nil {
+			return err
+		}
+	case "update":
+		update, err := scriptDocument(step.update, run)
+		if err != nil {
+			return err
+		}
+		res, err := coll.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		got["expect_matched"], got["expect_modified"] = res.MatchedCount, res.ModifiedCount
+	case "aggregate":
+		pipeline, err := scriptPipeline(step.pipeline, run)
+		if err != nil {
+			return err
+		}
+		cursor, err := coll.Aggregate(ctx, pipeline, options.Aggregate())
+		if err != nil {
+			return err
+		}
+		if err := cursor.All(ctx, &docs); err != nil {
+			return err
+		}
+	case "delete":
+		res, err := coll.DeleteMany(ctx, filter)
+		if err != nil {
+			return err
+		}
+		got["expect_deleted"] = res.DeletedCount
+	}
+	got["expect_count"] = int64(len(docs))
+
+	for _, key := range scriptCounts {
+		if want, ok := step.counts[key]; ok && got[key] != want {
+			return fmt.Errorf("%s %d, got %d", key, want, got[key])
+		}
+	}
+	if step.expect != "" {
+		expect, err := scriptDocument(step.expect, run)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return fmt.Errorf("expected %s, found no document", step.expect)
+		}
+		for _, field := range expect {
+			if fmt.Sprint(docs[0][field.Key]) != fmt.Sprint(field.Value) {
+				return fmt.Errorf("expected %s: %v, got %v", field.Key, field.Value, docs[0][field.Key])
+			}
+		}
+	}
+	return nil
+}
+
+func describeScriptSteps(report *scriptReport) string {
+	var b strings.Builder
+	for _, step := range report.Steps {
+		fmt.Fprintf(&b, "  %d. %-9s %7.1fms", step.Step, step.Op, step.LatencyMS)
+		if step.Error != "" {
+			b.WriteString("  " + step.Error)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(tr("script.total", "Total: {latency:%.1f}ms\n", "latency", report.TotalMS))
+	return b.String()
+}
+
+// scriptSnapshot returns the last report of each script, in the order
+// configured.
+func scriptSnapshot() []scriptReport {
+	scriptMu.Lock()
+	defer scriptMu.Unlock()
+
+	var reports []scriptReport
+	for _, script := range probeScripts {
+		if report := scriptReports[script.name]; report != nil {
+			reports = append(reports, *report)
+		}
+	}
+	return reports
+}
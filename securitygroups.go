@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// portRange is an inclusive TCP port range.
+type portRange struct {
+	from, to int
+}
+
+func (p portRange) String() string {
+	if p.from == p.to {
+		return strconv.Itoa(p.from)
+	}
+	return fmt.Sprintf("%d-%d", p.from, p.to)
+}
+
+// securityGroupRule is one ingress permission of a security group.
+type securityGroupRule struct {
+	group    string
+	protocol string
+	ports    portRange
+	cidrs    []string
+	groups   []string
+}
+
+var (
+	monitorSources []string
+	endpointPorts  []portRange
+)
+
+// loadSecurityGroupConfig reads AWS_MONITOR_SOURCES, the CIDRs and security
+// group IDs the monitor connects from (e.g. "10.20.0.0/24,sg-0123"), and
+// AWS_ENDPOINT_PORTS, the ports and ranges it must reach (default 27017;
+// Atlas PrivateLink endpoints use one port per node, e.g. "1024-65535").
+// Without sources the security group check is skipped.
+func loadSecurityGroupConfig() {
+	for _, source := range splitList(os.Getenv("AWS_MONITOR_SOURCES")) {
+		if !strings.HasPrefix(source, "sg-") {
+			if !strings.Contains(source, "/") {
+				source += "/32"
+			}
+			if _, _, err := net.ParseCIDR(source); err != nil {
+				log.Fatalf("Invalid AWS_MONITOR_SOURCES entry %q: %v", source, err)
+			}
+		}
+		monitorSources = append(monitorSources, source)
+	}
+	for _, value := range splitList(orString(os.Getenv("AWS_ENDPOINT_PORTS"), "27017")) {
+		p, err := parsePortRange(value)
+		if err != nil {
+			log.Fatalf("Invalid AWS_ENDPOINT_PORTS entry %q: %v", value, err)
+		}
+		endpointPorts = append(endpointPorts, p)
+	}
+}
+
+func parsePortRange(value string) (portRange, error) {
+	from, to, isRange := strings.Cut(value, "-")
+	var p portRange
+	var err error
+	if p.from, err = strconv.Atoi(from); err != nil {
+		return p, err
+	}
+	p.to = p.from
+	if isRange {
+		if p.to, err = strconv.Atoi(to); err != nil {
+			return p, err
+		}
+	}
+	if p.from < 1 || p.to > 65535 || p.from > p.to {
+		return p, fmt.Errorf("port range out of bounds")
+	}
+	return p, nil
+}
+
+// checkSecurityGroups verifies that the endpoint's security groups let
+// every monitor source reach every endpoint port, recording each missing
+// permission in status.RuleProblems.
+func checkSecurityGroups(account *awsAccount, status *vpcEndpointStatus) error {
+	if len(monitorSources) == 0 || len(status.SecurityGroups) == 0 {
+		return nil
+	}
+	rules, err := describeSecurityGroupRules(account, status.SecurityGroups)
+	if err != nil {
+		return err
+	}
+	groups := strings.Join(status.SecurityGroups, ", ")
+	for _, source := range monitorSources {
+		for _, ports := range endpointPorts {
+			if !slices.ContainsFunc(rules, func(r securityGroupRule) bool { return r.allows(source, ports) }) {
+				status.RuleProblems = append(status.RuleProblems,
+					tr("securitygroups.not_allowed", "TCP {ports} from {source} is not allowed by {groups}", "ports", ports, "source", source, "groups", groups))
+			}
+		}
+	}
+	return nil
+}
+
+// allows reports whether the rule admits TCP traffic on all of ports from
+// source, a CIDR or a security group ID.
+func (r securityGroupRule) allows(source string, ports portRange) bool {
+	if r.protocol != "-1" && r.protocol != "tcp" && r.protocol != "6" {
+		return false
+	}
+	if r.protocol != "-1" && (ports.from < r.ports.from || ports.to > r.ports.to) {
+		return false
+	}
+	if strings.HasPrefix(source, "sg-") {
+		return slices.Contains(r.groups, source)
+	}
+	ip, sourceNet, _ := net.ParseCIDR(source)
+	sourceBits, _ := sourceNet.Mask.Size()
+	for _, cidr := range r.cidrs {
+		_, ruleNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		ruleBits, _ := ruleNet.Mask.Size()
+		if ruleNet.Contains(ip) && ruleBits <= sourceBits {
+			return true
+		}
+	}
+	return false
+}
+
+// alertSecurityGroups alerts when the missing rules of an available
+// endpoint change.
+func alertSecurityGroups(status, previous *vpcEndpointStatus) {
+	if status.State != "available" || status.Error != "" {
+		return
+	}
+	before := ""
+	if previous != nil {
+		before = strings.Join(previous.RuleProblems, "\n")
+	}
+	after := strings.Join(status.RuleProblems, "\n")
+	if after == before {
+		return
+	}
+	if after != "" {
+		log.Printf("VPC endpoint %s security groups block the monitor:\n%s\n", status.ID, after)
+		sendAlert("PrivateLink Endpoint Security Groups Block The Monitor",
+			tr("securitygroups.blocked", "VPC endpoint {id} in AWS account {account}:\n{problems}", "id", status.ID, "account", status.Account, "problems", after))
+	} else if previous != nil && previous.State == "available" {
+		sendRecovery("PrivateLink Endpoint Security Groups Allow The Monitor Again",
+			tr("securitygroups.allowed", "The security groups of VPC endpoint {id} in AWS account {account} allow every monitor source again.", "id", status.ID, "account", status.Account))
+	}
+}
+
+// describeSecurityGroupRules returns the ingress rules of the groups.
+func describeSecurityGroupRules(account *awsAccount, ids []string) ([]securityGroupRule, error) {
+	creds, err := account.credentials()
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{
+		"Action":        {"DescribeSecurityGroups"},
+		"Version":       {"2016-11-15"},
+		"Filter.1.Name": {"group-id"},
+	}
+	for i, id := range ids {
+		params.Set("Filter.1.Value."+strconv.Itoa(i+1), id)
+	}
+	var out struct {
+		Groups []struct {
+			ID          string `xml:"groupId"`
+			Permissions []struct {
+				Protocol string   `xml:"ipProtocol"`
+				FromPort int      `xml:"fromPort"`
+				ToPort   int      `xml:"toPort"`
+				Groups   []string `xml:"groups>item>groupId"`
+				CIDRs    []string `xml:"ipRanges>item>cidrIp"`
+			} `xml:"ipPermissions>item"`
+		} `xml:"securityGroupInfo>item"`
+	}
+	host := "ec2." + account.region + ".amazonaws.com"
+	if err := awsQueryRequest(creds, account.region, "ec2", host, params, &out); err != nil {
+		return nil, err
+	}
+	var rules []securityGroupRule
+	for _, g := range out.Groups {
+		for _, p := range g.Permissions {
+			rules = append(rules, securityGroupRule{
+				group:    g.ID,
+				protocol: p.Protocol,
+				ports:    portRange{p.FromPort, p.ToPort},
+				cidrs:    p.CIDRs,
+				groups:   p.Groups,
+			})
+		}
+	}
+	return rules, nil
+}
+
+// vpcEndpointProblemSummary lists what the AWS checks found wrong with the
+// endpoints, for failure alerts, so a blocked port or a missing zone shows
+// up instead of just a timeout.
+func vpcEndpointProblemSummary() string {
+	var b strings.Builder
+	for _, e := range vpcEndpointSnapshot() {
+		var problems []string
+		if e.State != "available" {
+			problems = append(problems, tr("vpcendpoint.problem.state", "endpoint is {state}", "state", e.State))
+		}
+		problems = append(problems, e.Problems...)
+		problems = append(problems, e.RuleProblems...)
+		for _, problem := range problems {
+			fmt.Fprintf(&b, "  %s (%s): %s\n", e.ID, e.Account, problem)
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return tr("vpcendpoint.problems", "VPC endpoint problems:\n") + b.String()
+}
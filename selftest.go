@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const selfTestTimeout = 15 * time.Second
+
+// selfTestStep is one line of the startup report.
+type selfTestStep struct {
+	Name       string  `json:"name"`
+	Critical   bool    `json:"critical"`
+	OK         bool    `json:"ok"`
+	Detail     string  `json:"detail,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+type selfTestReport struct {
+	Time  time.Time      `json:"time"`
+	OK    bool           `json:"ok"`
+	Steps []selfTestStep `json:"steps"`
+}
+
+// runSelfTest exercises every component the monitor depends on once and logs
+// a single JSON report. With SELFTEST_STRICT=true a failed critical step stops
+// the monitor before it enters the check loop. MongoDB itself is never
+// critical: starting during an outage is a legitimate thing to do.
+func runSelfTest(uri string) selfTestReport {
+	report := selfTestReport{Time: time.Now(), OK: true}
+	run := func(name string, critical bool, fn func() (string, error)) bool {
+		start := time.Now()
+		detail, err := fn()
+		step := selfTestStep{Name: name, Critical: critical, OK: err == nil, Detail: detail}
+		if err != nil {
+			step.Detail = err.Error()
+			if critical {
+				report.OK = false
+			}
+		}
+		step.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+		report.Steps = append(report.Steps, step)
+		return err == nil
+	}
+
+	run("config", true, func() (string, error) {
+		srvHost, hosts, err := parseSeedList(uri)
+		if err != nil {
+			return "", err
+		}
+		if srvHost != "" {
+			return "SRV " + srvHost, nil
+		}
+		return fmt.Sprintf("%d seed host(s)", len(hosts)), nil
+	})
+
+	run("dns", false, func() (string, error) {
+		return selfTestDNS(uri)
+	})
+
+	anyChannel := false
+	for _, n := range allNotifiers() {
+		tester, ok := n.(notifierTester)
+		if !ok {
+			continue
+		}
+		if run("notifier:"+n.Name(), false, func() (string, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+			defer cancel()
+			return "", tester.Test(ctx)
+		}) {
+			anyChannel = true
+		}
+	}
+	run("notifiers", true, func() (string, error) {
+		if !anyChannel {
+			return "", errors.New("no notification channel passed its self-test")
+		}
+		return "", nil
+	})
+
+	if mqttBroker != "" {
+		run("mqtt", false, func() (string, error) { return mqttBroker, mqttPublish(nil) })
+	}
+
+	run("mongodb", false, func() (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+		defer cancel()
+		client, err := mongo.Connect(ctx, newClientOptions(uri, probeConnection))
+		if err != nil {
+			return "", err
+		}
+		defer closeClient(client, probeConnection)
+		return "", client.Ping(ctx, readpref.Primary())
+	})
+
+	data, _ := json.Marshal(report)
+	log.Printf("Startup self-test report: %s\n", data)
+	return report
+}
+
+func selfTestDNS(uri string) (string, error) {
+	srvHost, hosts, err := parseSeedList(uri)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+
+	if srvHost != "" {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "mongodb", "tcp", srvHost)
+		if err != nil {
+			return "", err
+		}
+		for _, record := range records {
+			hosts = append(hosts, net.JoinHostPort(record.Target, fmt.Sprint(record.Port)))
+		}
+	}
+	resolved := 0
+	for _, hostPort := range hosts {
+		host, _, _ := net.SplitHostPort(hostPort)
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return "", err
+		}
+		resolved++
+	}
+	return fmt.Sprintf("%d host(s) resolved", resolved), nil
+}
+
+// testSMTP connects, negotiates TLS when offered, and authenticates without
+// sending anything.
+func testSMTP(host, port, password string) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), selfTestTimeout)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(selfTestTimeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("greeting: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(fipsTLS(&tls.Config{ServerName: host})); err != nil {
+			return fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+	if ok, _ := c.Extension("AUTH"); ok {
+		if err := c.Auth(smtp.PlainAuth("", fromEmail, password, host)); err != nil {
+			return fmt.Errorf("AUTH: %w", err)
+		}
+	}
+	return c.Quit()
+}
+
+func selfTestStrict() bool {
+	return os.Getenv("SELFTEST_STRICT") == "true"
+}
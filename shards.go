@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// shardStatus is the reachability of one shard replica set through the
+// endpoint, as of the last cycle.
+type shardStatus struct {
+	Shard      string   `json:"shard"`
+	ReplicaSet string   `json:"replica_set"`
+	Hosts      []string `json:"hosts"`
+	Reachable  bool     `json:"reachable"`
+	LatencyMS  float64  `json:"latency_ms"`
+	Error      string   `json:"error,omitempty"`
+}
+
+var (
+	shardChecksEnabled bool
+	shardReachable     = map[string]bool{}
+
+	configServerSeen      bool
+	configServerReachable bool
+
+	shardMu          sync.Mutex
+	lastShardReport  []shardStatus
+	lastConfigServer *shardStatus
+)
+
+func loadShardConfig() {
+	shardChecksEnabled = os.Getenv("SHARD_CHECKS") == "true"
+}
+
+// checkShards enumerates shards with listShards when the target is a mongos
+// and reports how the routers see each shard replica set, since one
+// shard's members can become unreachable while the router and other
+// shards look fine. Atlas only exposes the routers through the endpoint,
+// so the shard members cannot be dialed from here; the router's replica
+// set monitor (connPoolStats) is the view every query is routed by.
+func checkShards(uri string) {
+	if !shardChecksEnabled || !probeAllowed("shards") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	defer cancel()
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "shards"))
+	if err != nil {
+		logThrottled("Failed to connect for the shard checks", err)
+		return
+	}
+	defer closeClient(client, "shards")
+
+	shards, configServer, err := listShards(ctx, client)
+	if err != nil {
+		logThrottled("Failed to list shards", err)
+		return
+	}
+	if shards == nil {
+		return
+	}
+	view, err := routerReplicaSets(ctx, client)
+	if configServer != nil {
+		checkConfigServer(ctx, client, configServer, view)
+	}
+	if err != nil {
+		logThrottled("Failed to read the router's view of the shards", err)
+		return
+	}
+
+	var report []shardStatus
+	for _, shard := range shards {
+		shard.observe(view)
+		if !shard.Reachable {
+			logThrottled(fmt.Sprintf("Shard %s unreachable", shard.Shard), errors.New(shard.Error))
+		} else {
+			log.Printf("Shard %s reachable from the router in %.1fms\n", shard.Shard, shard.LatencyMS)
+		}
+		report = append(report, shard)
+
+		wasReachable, seen := shardReachable[shard.Shard]
+		shardReachable[shard.Shard] = shard.Reachable
+		if !shard.Reachable && (!seen || wasReachable) {
+			sendAlert("MongoDB Shard Unreachable",
+				tr("shards.unreachable", "Shard {shard} ({set}) is unreachable from the router while the cluster is up.\nHosts: {hosts}\nError: {error}",
+					"shard", shard.Shard, "set", shard.ReplicaSet, "hosts", strings.Join(shard.Hosts, ", "), "error", shard.Error))
+		} else if shard.Reachable && seen && !wasReachable {
+			sendRecovery("MongoDB Shard Reachable Again",
+				tr("shards.reachable", "Shard {shard} ({set}) is reachable again ({latency:%.1f}ms).", "shard", shard.Shard, "set", shard.ReplicaSet, "latency", shard.LatencyMS))
+		}
+	}
+
+	shardMu.Lock()
+	lastShardReport = report
+	lastConfigServer = configServer
+	shardMu.Unlock()
+}
+
+// routerMember is one replica set member as the router's replica set
+// monitor last saw it.
+type routerMember struct {
+	Addr     string `bson:"addr"`
+	OK       bool   `bson:"ok"`
+	IsMaster bool   `bson:"ismaster"`
+	PingMS   int64  `bson:"pingTimeMillis"`
+}
+
+// routerReplicaSets returns, by replica set name, the members the router
+// monitors and whether it can reach them.
+func routerReplicaSets(ctx context.Context, client *mongo.Client) (map[string][]routerMember, error) {
+	var stats struct {
+		ReplicaSets map[string]struct {
+			Hosts []routerMember `bson:"hosts"`
+		} `bson:"replicaSets"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "connPoolStats", Value: 1}}).Decode(&stats); err != nil {
+		return nil, err
+	}
+	view := make(map[string][]routerMember, len(stats.ReplicaSets))
+	for name, rs := range stats.ReplicaSets {
+		view[name] = rs.Hosts
+	}
+	return view, nil
+}
+
+// observe fills in the shard's members and reachability from the router's
+// view: a shard answers queries while the router reaches any of its
+// members, and its latency is the router's ping to the nearest one.
+func (s *shardStatus) observe(view map[string][]routerMember) {
+	members, ok := view[s.ReplicaSet]
+	if !ok {
+		s.Error = "the router does not monitor this replica set"
+		return
+	}
+	s.Hosts = nil
+	var down []string
+	for _, m := range members {
+		s.Hosts = append(s.Hosts, m.Addr)
+		if !m.OK {
+			down = append(down, m.Addr)
+			continue
+		}
+		if ms := float64(m.PingMS); !s.Reachable || ms < s.LatencyMS {
+			s.LatencyMS = ms
+		}
+		s.Reachable = true
+	}
+	if !s.Reachable {
+		s.Error = "the router reaches none of its members: " + strings.Join(down, ", ")
+	}
+}
+
+// checkConfigServer reads the shard registry from the config server
+// replica set primary through the router. Losing it breaks metadata
+// operations (chunk migrations, sharded DDL, and routers refreshing their
+// routing tables) even while every data shard is healthy, so it gets its
+// own alert. Like the shards, its members are not reachable through the
+// endpoint; the router's view of them, when it has one, names the members.
+func checkConfigServer(ctx context.Context, client *mongo.Client, cs *shardStatus, view map[string][]routerMember) {
+	if members, ok := view[cs.ReplicaSet]; ok {
+		cs.Hosts = nil
+		for _, m := range members {
+			cs.Hosts = append(cs.Hosts, m.Addr)
+		}
+	}
+
+	start := time.Now()
+	shards := client.Database("config").Collection("shards",
+		options.Collection().SetReadPreference(readpref.Primary()).SetReadConcern(readconcern.Majority()))
+	_, err := shards.CountDocuments(ctx, bson.D{})
+	cs.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	cs.Reachable = err == nil
+	if err != nil {
+		cs.Error = err.Error()
+		logThrottled("Config server replica set unreachable", err)
+	} else {
+		log.Printf("Config server replica set %s primary answered through the router in %.1fms\n", cs.ReplicaSet, cs.LatencyMS)
+	}
+
+	seen, wasReachable := configServerSeen, configServerReachable
+	configServerSeen, configServerReachable = true, cs.Reachable
+	if !cs.Reachable && (!seen || wasReachable) {
+		sendAlert("MongoDB Config Server Unreachable",
+			tr("shards.config_unreachable", "The config server replica set {set} has no primary the router can read from.\n"+
+				"Metadata operations (chunk migrations, sharded DDL, routing table refreshes) will fail even though data shards may be healthy.\n"+
+				"Hosts: {hosts}\nError: {error}", "set", cs.ReplicaSet, "hosts", strings.Join(cs.Hosts, ", "), "error", err))
+	} else if cs.Reachable && seen && !wasReachable {
+		sendRecovery("MongoDB Config Server Reachable Again",
+			tr("shards.config_reachable", "The config server replica set {set} primary is reachable again ({latency:%.1f}ms).", "set", cs.ReplicaSet, "latency", cs.LatencyMS))
+	}
+}
+
+// listShards returns the data shards and the config server replica set, or
+// nil without error when the target is not sharded.
+func listShards(ctx context.Context, client *mongo.Client) ([]shardStatus, *shardStatus, error) {
+	admin := client.Database("admin")
+	var hello bson.M
+	if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return nil, nil, err
+	}
+	if hello["msg"] != "isdbgrid" {
+		return nil, nil, nil
+	}
+
+	var result struct {
+		Shards []struct {
+			ID   string `bson:"_id"`
+			Host string `bson:"host"`
+		} `bson:"shards"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "listShards", Value: 1}}).Decode(&result); err != nil {
+		return nil, nil, err
+	}
+
+	var shards []shardStatus
+	for _, s := range result.Shards {
+		shards = append(shards, parseShardHost(s.ID, s.Host))
+	}
+
+	var status struct {
+		Sharding struct {
+			ConfigsvrConnectionString string `bson:"configsvrConnectionString"`
+		} `bson:"sharding"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "serverStatus", Value: 1}}).Decode(&status); err != nil {
+		logThrottled("Failed to read config server connection string", err)
+		return shards, nil, nil
+	}
+	if cs := status.Sharding.ConfigsvrConnectionString; cs != "" {
+		configServer := parseShardHost("config", cs)
+		return shards, &configServer, nil
+	}
+	return shards, nil, nil
+}
+
+// parseShardHost splits "<replSetName>/<host:port>,<host:port>,...". The
+// hosts are the shard's internal names, for reporting only: they are not
+// reachable through the endpoint.
+func parseShardHost(id, host string) shardStatus {
+	rsName, hosts, ok := strings.Cut(host, "/")
+	if !ok {
+		rsName, hosts = "", host
+	}
+	return shardStatus{Shard: id, ReplicaSet: rsName, Hosts: strings.Split(hosts, ",")}
+}
+
+func shardReportSnapshot() ([]shardStatus, *shardStatus) {
+	shardMu.Lock()
+	defer shardMu.Unlock()
+	return lastShardReport, lastConfigServer
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// silence mutes alerts for a target until it expires. Who set it and why are
+// kept so the next responder knows an incident is already being handled.
+type silence struct {
+	Target    string    `json:"target"`
+	Until     time.Time `json:"until"`
+	By        string    `json:"by"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type silenceRequest struct {
+	Target string  `json:"target"`
+	Hours  float64 `json:"hours"`
+	By     string  `json:"by"`
+	Reason string  `json:"reason"`
+}
+
+var (
+	silenceFile string
+	silencesMu  sync.Mutex
+	silences    = map[string]silence{}
+)
+
+func loadSilences() {
+	httpMux.HandleFunc("/silences", handleSilences)
+
+	silenceFile = os.Getenv("SILENCE_FILE")
+	if silenceFile == "" {
+		silenceFile = "silences.json"
+	}
+
+	data, err := os.ReadFile(silenceFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read silence file: %v\n", err)
+		return
+	}
+	var saved []silence
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("Failed to parse silence file: %v\n", err)
+		return
+	}
+	for _, s := range saved {
+		if time.Now().Before(s.Until) {
+			silences[s.Target] = s
+		}
+	}
+}
+
+// activeSilence returns the unexpired silence for target, if any.
+func activeSilence(target string) (silence, bool) {
+	silencesMu.Lock()
+	defer silencesMu.Unlock()
+
+	s, ok := silences[target]
+	if ok && time.Now().After(s.Until) {
+		log.Printf("Silence for %s set by %s expired\n", target, s.By)
+		delete(silences, target)
+		saveSilencesLocked()
+		return silence{}, false
+	}
+	return s, ok
+}
+
+func addSilence(req silenceRequest) (silence, error) {
+	if req.Target == "" {
+		req.Target = targetName()
+	}
+	if req.Hours <= 0 {
+		return silence{}, errors.New("hours must be positive")
+	}
+	if req.By == "" {
+		return silence{}, errors.New("by is required")
+	}
+
+	now := time.Now()
+	s := silence{
+		Target:    req.Target,
+		Until:     now.Add(time.Duration(req.Hours * float64(time.Hour))),
+		By:        req.By,
+		Reason:    req.Reason,
+		CreatedAt: now,
+	}
+
+	silencesMu.Lock()
+	defer silencesMu.Unlock()
+	silences[s.Target] = s
+	saveSilencesLocked()
+	log.Printf("Alerts for %s silenced until %s by %s: %s\n", s.Target, s.Until.Format("2006-01-02 15:04:05"), s.By, s.Reason)
+	return s, nil
+}
+
+func removeSilence(target, by string) bool {
+	silencesMu.Lock()
+	defer silencesMu.Unlock()
+
+	if _, ok := silences[target]; !ok {
+		return false
+	}
+	delete(silences, target)
+	saveSilencesLocked()
+	log.Printf("Silence for %s removed by %s\n", target, by)
+	return true
+}
+
+func saveSilencesLocked() {
+	saved := make([]silence, 0, len(silences))
+	for _, s := range silences {
+		saved = append(saved, s)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err == nil {
+		err = os.WriteFile(silenceFile, data, 0644)
+	}
+	if err != nil {
+		log.Printf("Failed to save silence file: %v\n", err)
+	}
+}
+
+func handleSilences(w http.ResponseWriter, r *http.Request) {
+	need := roleSilence
+	if r.Method == http.MethodGet {
+		need = roleReadOnly
+	}
+	t, ok := authorize(w, r, need)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		silencesMu.Lock()
+		list := make([]silence, 0, len(silences))
+		for _, s := range silences {
+			if time.Now().Before(s.Until) && t.owns(s.Target) {
+				list = append(list, s)
+			}
+		}
+		silencesMu.Unlock()
+		writeJSON(w, http.StatusOK, list)
+
+	case http.MethodPost:
+		var req silenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+		if req.Target == "" {
+			req.Target = targetName()
+		}
+		if !t.owns(req.Target) {
+			writeError(w, http.StatusForbidden, "target belongs to another tenant")
+			return
+		}
+		s, err := addSilence(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, s)
+
+	case http.MethodDelete:
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			target = targetName()
+		}
+		if !t.owns(target) {
+			writeError(w, http.StatusForbidden, "target belongs to another tenant")
+			return
+		}
+		if !removeSilence(target, r.URL.Query().Get("by")) {
+			writeError(w, http.StatusNotFound, "no active silence for "+target)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// runSilenceCommand implements `silence` and `unsilence` against the API of a
+// running monitor.
+func runSilenceCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	target := fs.String("target", targetName(), "target to silence")
+	hours := fs.Float64("hours", 1, "how long to silence alerts")
+	by := fs.String("by", os.Getenv("USER"), "who is silencing the alerts")
+	reason := fs.String("reason", "", "why the alerts are silenced")
+	fs.Parse(args)
+
+	var req *http.Request
+	var err error
+	if name == "unsilence" {
+		query := url.Values{"target": {*target}, "by": {*by}}
+		req, err = http.NewRequest(http.MethodDelete, apiBaseURL()+"/silences?"+query.Encode(), nil)
+	} else {
+		body, _ := json.Marshal(silenceRequest{Target: *target, Hours: *hours, By: *by, Reason: *reason})
+		req, err = http.NewRequest(http.MethodPost, apiBaseURL()+"/silences", bytes.NewReader(body))
+	}
+	if err != nil {
+		return err
+	}
+	if token := os.Getenv("MONITOR_API_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := apiClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("monitor returned %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	fmt.Printf("%s\n", bytes.TrimSpace(respBody))
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var slackHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// slackNotifier posts alerts to a Slack incoming webhook, configured with
+// SLACK_WEBHOOK_URL.
+type slackNotifier struct {
+	webhookURL string
+}
+
+func init() {
+	registerNotifier("slack", func() Notifier {
+		if url := os.Getenv("SLACK_WEBHOOK_URL"); url != "" {
+			return &slackNotifier{webhookURL: url}
+		}
+		return nil
+	})
+}
+
+func (s *slackNotifier) Name() string { return "slack" }
+
+func (s *slackNotifier) Send(ctx context.Context, alert Alert) error {
+	return postSlack(ctx, s.webhookURL, map[string]string{
+		"text": fmt.Sprintf("*%s* (%s)\n```%s```", alert.Subject, alert.Target, strings.TrimSpace(alert.Body)),
+	})
+}
+
+// Test checks the webhook without posting anything: Slack answers a
+// message without text with "no_text" only when the webhook itself is
+// valid.
+func (s *slackNotifier) Test(ctx context.Context) error {
+	err := postSlack(ctx, s.webhookURL, map[string]string{})
+	if err != nil && strings.Contains(err.Error(), "no_text") {
+		return nil
+	}
+	return err
+}
+
+func postSlack(ctx context.Context, webhookURL string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := slackHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("slack returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// burnRule is one multi-window burn-rate condition: it fires when both the
+// long and the short window burn the error budget faster than the factor.
+// The short window makes the alert stop soon after the problem does.
+type burnRule struct {
+	name     string
+	severity string
+	long     time.Duration
+	short    time.Duration
+	factor   float64
+}
+
+// Thresholds from the Google SRE workbook for a 30-day budget.
+var burnRules = []burnRule{
+	{"fast burn", "page", time.Hour, 5 * time.Minute, 14.4},
+	{"fast burn", "page", 6 * time.Hour, 30 * time.Minute, 6},
+	{"slow burn", "ticket", 24 * time.Hour, 2 * time.Hour, 3},
+}
+
+type sloEvent struct {
+	time time.Time
+	good bool
+}
+
+var (
+	sloTarget           float64
+	sloLatencyThreshold time.Duration
+
+	sloMu     sync.Mutex
+	sloEvents []sloEvent
+	sloFiring = map[string]bool{}
+)
+
+// loadSLOConfig reads SLO_AVAILABILITY_TARGET as a percentage (e.g. 99.9)
+// and SLO_LATENCY_THRESHOLD_MS; a check counts against the budget when it
+// fails or, with a threshold set, takes longer than that.
+func loadSLOConfig() {
+	value := os.Getenv("SLO_AVAILABILITY_TARGET")
+	if value == "" {
+		return
+	}
+	target, err := strconv.ParseFloat(value, 64)
+	if err != nil || target <= 0 || target >= 100 {
+		log.Fatalf("Invalid SLO_AVAILABILITY_TARGET %q, expected a percentage below 100", value)
+	}
+	sloTarget = target / 100
+	sloLatencyThreshold = time.Duration(getEnvInt("SLO_LATENCY_THRESHOLD_MS", 0)) * time.Millisecond
+}
+
+// evaluateSLO records the check against the SLO and alerts when a burn
+// rule starts or stops firing: pages for a fast burn, tickets for a slow
+// one, instead of one alert per bad check. The first check after a clock
+// gap does not count: its failure or cold connect is the host waking up.
+func evaluateSLO(result checkResult) {
+	if sloTarget == 0 || result.ClockGapMS > 0 {
+		return
+	}
+	good := result.Status == "up"
+	if good && sloLatencyThreshold > 0 && result.LatencyMS > float64(sloLatencyThreshold.Milliseconds()) {
+		good = false
+	}
+
+	sloMu.Lock()
+	recordSLOEvent(result.Time, good)
+	sloEvents = append(sloEvents, sloEvent{time: result.Time, good: good})
+	horizon := result.Time.Add(-burnRules[len(burnRules)-1].long)
+	drop := 0
+	for drop < len(sloEvents) && sloEvents[drop].time.Before(horizon) {
+		drop++
+	}
+	sloEvents = sloEvents[drop:]
+	observed := result.Time.Sub(sloEvents[0].time)
+	sloMu.Unlock()
+
+	for _, rule := range burnRules {
+		key := fmt.Sprintf("%s/%v", rule.severity, rule.long)
+		longRate, shortRate := burnRate(rule.long), burnRate(rule.short)
+		// Right after startup a couple of failures would look like a
+		// huge burn rate; wait until the short window has been observed
+		firing := observed >= rule.short && longRate >= rule.factor && shortRate >= rule.factor
+
+		sloMu.Lock()
+		wasFiring := sloFiring[key]
+		sloFiring[key] = firing
+		sloMu.Unlock()
+
+		if firing && !wasFiring {
+			sendAlert(fmt.Sprintf("[%s] MongoDB SLO %s", rule.severity, rule.name),
+				tr("slo.burning", "The {target:%.3g}% SLO error budget is burning {long_rate:%.1f}x too fast over {long} ({short_rate:%.1f}x over {short}), threshold {factor:%.1f}x.\n"+
+					"At this rate a 30-day budget lasts {lifetime}.",
+					"target", sloTarget*100, "long_rate", longRate, "long", rule.long, "short_rate", shortRate, "short", rule.short,
+					"factor", rule.factor, "lifetime", budgetLifetime(longRate)))
+		} else if !firing && wasFiring {
+			sendRecovery(fmt.Sprintf("[%s] MongoDB SLO %s resolved", rule.severity, rule.name),
+				tr("slo.resolved", "The burn rate over {short} is back to {short_rate:%.1f}x (threshold {factor:%.1f}x).",
+					"short", rule.short, "short_rate", shortRate, "factor", rule.factor))
+		}
+	}
+}
+
+// burnRate is the error ratio over the window divided by the error budget.
+func burnRate(window time.Duration) float64 {
+	sloMu.Lock()
+	defer sloMu.Unlock()
+
+	if len(sloEvents) == 0 {
+		return 0
+	}
+	since := sloEvents[len(sloEvents)-1].time.Add(-window)
+	total, bad := 0, 0
+	for i := len(sloEvents) - 1; i >= 0 && !sloEvents[i].time.Before(since); i-- {
+		total++
+		if !sloEvents[i].good {
+			bad++
+		}
+	}
+	return float64(bad) / float64(total) / (1 - sloTarget)
+}
+
+func budgetLifetime(rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(30*24*time.Hour) / rate).Round(time.Minute)
+}
+
+// sloBurnRates is the current burn rate per rule window for /metrics.
+func sloBurnRates() map[string]float64 {
+	if sloTarget == 0 {
+		return nil
+	}
+	rates := map[string]float64{}
+	for _, rule := range burnRules {
+		rates[rule.long.String()] = burnRate(rule.long)
+		rates[rule.short.String()] = burnRate(rule.short)
+	}
+	return rates
+}
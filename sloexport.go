@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeSlice is one fixed interval of the SLO, good when enough of its
+// checks were good.
+type timeSlice struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Good  int       `json:"good_checks"`
+	Total int       `json:"total_checks"`
+	OK    bool      `json:"good"`
+}
+
+var (
+	sliceLength    time.Duration
+	sliceTarget    float64
+	sliceRetention int
+
+	// Guarded by sloMu
+	sloSlices    []timeSlice
+	currentSlice *timeSlice
+	sloGood      int
+	sloTotal     int
+)
+
+// loadSLOExportConfig reads SLO_TIMESLICE_SECONDS (default 60),
+// SLO_TIMESLICE_TARGET, the share of good checks that makes a slice good
+// (default 1, every check), and SLO_TIMESLICE_RETENTION_DAYS (default 30),
+// and serves /slo/timeslices and /slo/spec for SLO tools.
+func loadSLOExportConfig() {
+	if sloTarget == 0 {
+		return
+	}
+	sliceLength = time.Duration(getEnvInt("SLO_TIMESLICE_SECONDS", 60)) * time.Second
+	if sliceLength <= 0 {
+		sliceLength = time.Minute
+	}
+	sliceTarget = 1
+	if value := strings.TrimSpace(os.Getenv("SLO_TIMESLICE_TARGET")); value != "" {
+		target, err := strconv.ParseFloat(value, 64)
+		if err != nil || target <= 0 || target > 1 {
+			log.Fatalf("Invalid SLO_TIMESLICE_TARGET %q, expected a ratio such as 0.95", value)
+		}
+		sliceTarget = target
+	}
+	sliceRetention = int(time.Duration(getEnvInt("SLO_TIMESLICE_RETENTION_DAYS", 30)) * 24 * time.Hour / sliceLength)
+	httpMux.HandleFunc("/slo/timeslices", handleTimeSlices)
+	httpMux.HandleFunc("/slo/spec", handleSLOSpec)
+}
+
+// recordSLOEvent counts a check and adds it to its time slice. sloMu must
+// be held.
+func recordSLOEvent(at time.Time, good bool) {
+	sloTotal++
+	if good {
+		sloGood++
+	}
+	if sliceLength <= 0 {
+		return
+	}
+	start := at.Truncate(sliceLength)
+	if currentSlice != nil && !currentSlice.Start.Equal(start) {
+		closeSlice()
+	}
+	if currentSlice == nil {
+		currentSlice = &timeSlice{Start: start, End: start.Add(sliceLength)}
+	}
+	currentSlice.Total++
+	if good {
+		currentSlice.Good++
+	}
+}
+
+func closeSlice() {
+	s := *currentSlice
+	s.OK = float64(s.Good) >= sliceTarget*float64(s.Total)
+	sloSlices = append(sloSlices, s)
+	if len(sloSlices) > sliceRetention {
+		sloSlices = sloSlices[len(sloSlices)-sliceRetention:]
+	}
+	currentSlice = nil
+}
+
+// completedSlices returns the finished slices overlapping [from, to).
+func completedSlices(from, to time.Time) []timeSlice {
+	sloMu.Lock()
+	defer sloMu.Unlock()
+	if currentSlice != nil && !time.Now().Before(currentSlice.End) {
+		closeSlice()
+	}
+	result := []timeSlice{}
+	for _, s := range sloSlices {
+		if s.End.After(from) && s.Start.Before(to) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func sloCounts() (good, total int) {
+	sloMu.Lock()
+	defer sloMu.Unlock()
+	return sloGood, sloTotal
+}
+
+// handleTimeSlices serves /slo/timeslices?from=<RFC 3339>&to=<RFC 3339>,
+// by default the last day, as JSON or, with format=csv, as
+// "timestamp,good,total" rows that SLO tools such as Nobl9 import as
+// good/total ratio data.
+func handleTimeSlices(w http.ResponseWriter, r *http.Request) {
+	t, ok := authorize(w, r, roleReadOnly)
+	if !ok {
+		return
+	}
+	if !t.owns(targetName()) {
+		writeError(w, http.StatusForbidden, "target belongs to another tenant")
+		return
+	}
+	to, from := time.Now(), time.Now().Add(-24*time.Hour)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := r.URL.Query().Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, name+" must be an RFC 3339 time")
+				return
+			}
+			*dst = t
+		}
+	}
+	result := completedSlices(from, to)
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		fmt.Fprintln(w, "timestamp,good,total")
+		for _, s := range result {
+			fmt.Fprintf(w, "%s,%d,%d\n", s.Start.UTC().Format(time.RFC3339), s.Good, s.Total)
+		}
+		return
+	}
+	good := 0
+	for _, s := range result {
+		if s.OK {
+			good++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"target":        targetName(),
+		"objective":     sloTarget,
+		"slice_seconds": sliceLength.Seconds(),
+		"slice_target":  sliceTarget,
+		"good_slices":   good,
+		"total_slices":  len(result),
+		"slices":        result,
+	})
+}
+
+// handleSLOSpec serves /slo/spec?format=openslo|sloth, an SLO definition
+// over this monitor's Prometheus metrics that the tool can load as is.
+func handleSLOSpec(w http.ResponseWriter, r *http.Request) {
+	t, ok := authorize(w, r, roleReadOnly)
+	if !ok {
+		return
+	}
+	if !t.owns(targetName()) {
+		writeError(w, http.StatusForbidden, "target belongs to another tenant")
+		return
+	}
+	name := "mongodb-privatelink-" + strings.ToLower(strings.ReplaceAll(targetName(), "_", "-"))
+	// Sloth fills in {{.window}} for each of its recording rules
+	good := `sum(rate(mongodb_monitor_slo_good_checks_total[{{.window}}]))`
+	total := `sum(rate(mongodb_monitor_slo_checks_total[{{.window}}]))`
+
+	w.Header().Set("Content-Type", "application/yaml")
+	switch r.URL.Query().Get("format") {
+	case "", "openslo":
+		fmt.Fprintf(w, `apiVersion: openslo/v1
+kind: SLO
+metadata:
+  name: %s
+  displayName: MongoDB PrivateLink availability (%s)
+spec:
+  service: %s
+  indicator:
+    metadata:
+      name: %s-checks
+    spec:
+      ratioMetric:
+        counter: true
+        good:
+          metricSource:
+            type: Prometheus
+            spec:
+              query: sum(mongodb_monitor_slo_good_checks_total)
+        total:
+          metricSource:
+            type: Prometheus
+            spec:
+              query: sum(mongodb_monitor_slo_checks_total)
+  timeWindow:
+    - duration: 30d
+      isRolling: true
+  budgetingMethod: Timeslices
+  objectives:
+    - displayName: availability
+      target: %g
+      timeSliceTarget: %g
+      timeSliceWindow: %s
+`, name, targetName(), name, name, sloTarget, sliceTarget, fmt.Sprintf("%ds", int(sliceLength.Seconds())))
+	case "sloth":
+		fmt.Fprintf(w, `version: prometheus/v1
+service: %s
+labels:
+  target: %q
+slos:
+  - name: availability
+    objective: %g
+    description: Connectivity checks through the PrivateLink endpoint that succeed in time.
+    sli:
+      events:
+        error_query: (%s) - (%s)
+        total_query: %s
+    alerting:
+      name: MongoDBPrivateLinkAvailability
+`, name, targetName(), sloTarget*100, total, good, total)
+	default:
+		writeError(w, http.StatusBadRequest, "format must be openslo or sloth")
+	}
+}
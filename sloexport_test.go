@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeSlices(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	type event struct {
+		second int
+		good   bool
+	}
+	type slice struct {
+		minute      int
+		good, total int
+		ok          bool
+	}
+	tests := []struct {
+		name      string
+		target    float64
+		retention int
+		events    []event
+		want      []slice
+	}{
+		{
+			name:      "every check must be good",
+			target:    1,
+			retention: 10,
+			events:    []event{{0, true}, {30, true}, {60, true}, {90, false}, {150, true}},
+			want:      []slice{{0, 2, 2, true}, {1, 1, 2, false}, {2, 1, 1, true}},
+		},
+		{
+			name:      "ratio target",
+			target:    0.5,
+			retention: 10,
+			events:    []event{{0, true}, {20, false}, {40, false}, {60, true}, {80, false}},
+			want:      []slice{{0, 1, 3, false}, {1, 1, 2, true}},
+		},
+		{
+			name:      "minutes without checks have no slice",
+			target:    1,
+			retention: 10,
+			events:    []event{{10, true}, {250, false}},
+			want:      []slice{{0, 1, 1, true}, {4, 0, 1, false}},
+		},
+		{
+			name:      "retention",
+			target:    1,
+			retention: 2,
+			events:    []event{{0, true}, {60, false}, {120, true}, {180, true}},
+			want:      []slice{{2, 1, 1, true}, {3, 1, 1, true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			length, target, retention := sliceLength, sliceTarget, sliceRetention
+			t.Cleanup(func() {
+				sliceLength, sliceTarget, sliceRetention = length, target, retention
+				sloSlices, currentSlice, sloGood, sloTotal = nil, nil, 0, 0
+			})
+			sliceLength, sliceTarget, sliceRetention = time.Minute, tt.target, tt.retention
+			sloSlices, currentSlice, sloGood, sloTotal = nil, nil, 0, 0
+
+			good := 0
+			sloMu.Lock()
+			for _, e := range tt.events {
+				recordSLOEvent(base.Add(time.Duration(e.second)*time.Second), e.good)
+				if e.good {
+					good++
+				}
+			}
+			sloMu.Unlock()
+			if g, total := sloCounts(); g != good || total != len(tt.events) {
+				t.Errorf("sloCounts() = %d, %d, want %d, %d", g, total, good, len(tt.events))
+			}
+
+			got := completedSlices(base.Add(-time.Hour), base.Add(time.Hour))
+			if len(got) != len(tt.want) {
+				t.Fatalf("completedSlices() returned %d slices, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				start := base.Add(time.Duration(w.minute) * time.Minute)
+				want := timeSlice{Start: start, End: start.Add(time.Minute), Good: w.good, Total: w.total, OK: w.ok}
+				if got[i] != want {
+					t.Errorf("slice %d = %+v, want %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+// completedSlices leaves out the slice still in progress and those
+// outside the window.
+func TestCompletedSlicesWindow(t *testing.T) {
+	length, target, retention := sliceLength, sliceTarget, sliceRetention
+	t.Cleanup(func() {
+		sliceLength, sliceTarget, sliceRetention = length, target, retention
+		sloSlices, currentSlice, sloGood, sloTotal = nil, nil, 0, 0
+	})
+	sliceLength, sliceTarget, sliceRetention = time.Hour, 1, 10
+	sloSlices, currentSlice, sloGood, sloTotal = nil, nil, 0, 0
+
+	now := time.Now()
+	hour := now.Truncate(time.Hour)
+	sloMu.Lock()
+	recordSLOEvent(hour.Add(-3*time.Hour), true)
+	recordSLOEvent(hour.Add(-2*time.Hour), true)
+	recordSLOEvent(now, true)
+	sloMu.Unlock()
+
+	if got := completedSlices(now.Add(-24*time.Hour), now.Add(time.Hour)); len(got) != 2 {
+		t.Errorf("completedSlices() over the day returned %d slices, want the 2 finished ones: %+v", len(got), got)
+	}
+	if got := completedSlices(hour.Add(-2*time.Hour), now.Add(time.Hour)); len(got) != 1 || !got[0].Start.Equal(hour.Add(-2*time.Hour)) {
+		t.Errorf("completedSlices() over the last 2 hours returned %+v, want the slice from %v", got, hour.Add(-2*time.Hour))
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+var (
+	sourceIP        net.IP
+	sourceInterface string
+)
+
+// loadSourceBinding reads PROBE_SOURCE, the local IP address or interface
+// name that connections to MongoDB leave from: the driver's, the host
+// probes', and the member probes'. On multi-homed hosts where only one
+// interface routes to the endpoint subnet, a check that leaves through
+// another tests the wrong path. Alert delivery is not bound.
+func loadSourceBinding() {
+	if source := os.Getenv("PROBE_SOURCE"); source != "" {
+		if err := setSourceBinding(source); err != nil {
+			log.Fatalf("Invalid PROBE_SOURCE: %v", err)
+		}
+	}
+}
+
+// setSourceBinding binds probe connections to an IP address or, given an
+// interface name, to the interface itself where the platform allows it
+// (SO_BINDTODEVICE on Linux, which needs CAP_NET_RAW) and its first
+// address everywhere.
+func setSourceBinding(source string) error {
+	if ip := net.ParseIP(source); ip != nil {
+		sourceIP, sourceInterface = ip, ""
+		return nil
+	}
+	iface, err := net.InterfaceByName(source)
+	if err != nil {
+		return fmt.Errorf("%q is neither an IP address nor an interface: %w", source, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return err
+	}
+	var ip net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && (ip == nil || ip.To4() == nil && ipNet.IP.To4() != nil) {
+			ip = ipNet.IP
+		}
+	}
+	if ip == nil {
+		return fmt.Errorf("interface %s has no address", source)
+	}
+	sourceIP, sourceInterface = ip, iface.Name
+	log.Printf("Binding probe connections to %s (%s)\n", sourceInterface, sourceIP)
+	return nil
+}
+
+// probeDialer returns a TCP dialer bound to PROBE_SOURCE, if any.
+func probeDialer(timeout time.Duration) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if sourceIP != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: sourceIP}
+	}
+	if sourceInterface != "" {
+		dialer.Control = bindToDevice(sourceInterface)
+	}
+	return dialer
+}
+
+// describeSourceBinding is where probe connections leave from, for logs and
+// command output.
+func describeSourceBinding() string {
+	switch {
+	case sourceInterface != "":
+		return fmt.Sprintf("%s (%s)", sourceInterface, sourceIP)
+	case sourceIP != nil:
+		return sourceIP.String()
+	}
+	return "default route"
+}
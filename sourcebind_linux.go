@@ -0,0 +1,18 @@
+package main
+
+import "syscall"
+
+// bindToDevice pins a socket to the interface, so it leaves through it
+// whatever the routing table says.
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var bindErr error
+		err := c.Control(func(fd uintptr) {
+			bindErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		})
+		if err != nil {
+			return err
+		}
+		return bindErr
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+// bindToDevice is not available here; the source address alone decides
+// the interface.
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
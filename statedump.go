@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	dumpDir string
+	// stateDumps tracks the captures still running, for -once to wait on
+	stateDumps sync.WaitGroup
+)
+
+func loadDumpConfig() {
+	dumpDir = os.Getenv("STATE_DUMP_DIR")
+	if dumpDir == "" {
+		dumpDir = "dumps"
+	}
+}
+
+// captureStateDump saves serverStatus, hello, and replSetGetStatus to a
+// timestamped file on a health transition, so the state around an outage
+// can be examined after the fact. Commands that fail, as they will during
+// an outage, are recorded with their error. The capture runs in the
+// background, within the cluster's interval, so that it never holds back
+// the alert; it returns the line naming the file for the alert.
+func (c *cluster) captureStateDump(reason string, result checkResult) string {
+	name := fmt.Sprintf("dump-%s-%s-%s.json", result.Target, time.Now().Format("20060102-150405"), reason)
+	path := filepath.Join(dumpDir, name)
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	stateDumps.Add(1)
+	go func() {
+		defer stateDumps.Done()
+		writeStateDump(c.uri, c.interval, path, reason, result)
+	}()
+	return tr("statedump.path", "State dump: {path}\n", "path", path)
+}
+
+func writeStateDump(uri string, timeout time.Duration, path, reason string, result checkResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dump := bson.D{
+		{Key: "captured_at", Value: time.Now()},
+		{Key: "target", Value: result.Target},
+		{Key: "reason", Value: reason},
+		{Key: "trace_id", Value: result.TraceID},
+		{Key: "error", Value: result.Error},
+	}
+
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "dump"))
+	if err != nil {
+		dump = append(dump, bson.E{Key: "connect_error", Value: err.Error()})
+	} else {
+		defer closeClient(client, "dump")
+		for _, command := range []string{"serverStatus", "hello", "replSetGetStatus"} {
+			var reply bson.M
+			if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: command, Value: 1}}).Decode(&reply); err != nil {
+				dump = append(dump, bson.E{Key: command, Value: bson.D{{Key: "error", Value: err.Error()}}})
+				continue
+			}
+			dump = append(dump, bson.E{Key: command, Value: reply})
+		}
+	}
+
+	data, err := bson.MarshalExtJSONIndent(dump, false, false, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode state dump: %v\n", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("Failed to create state dump directory: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		log.Printf("Failed to write state dump: %v\n", err)
+		return
+	}
+	log.Printf("Wrote state dump %s\n", path)
+}
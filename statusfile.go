@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	statusFile string
+	statusMu   sync.Mutex
+	statuses   = map[string]*statusSnapshot{}
+)
+
+// statusSnapshot is the state of one target after its latest cycle. The
+// primary cluster's is also written to STATUS_FILE; the probe and
+// background check reports only appear in it.
+type statusSnapshot struct {
+	UpdatedAt    time.Time                `json:"updated_at"`
+	Target       string                   `json:"target"`
+	Namespace    string                   `json:"namespace,omitempty"`
+	Healthy      bool                     `json:"healthy"`
+	Health       string                   `json:"health"`
+	LastResult   checkResult              `json:"last_result"`
+	Incident     *incident                `json:"incident"`
+	Concerns     map[string]concernReport `json:"concerns"`
+	Shards       []shardStatus            `json:"shards,omitempty"`
+	ConfigServer *shardStatus             `json:"config_server,omitempty"`
+	Balancer     *balancerReport          `json:"balancer,omitempty"`
+	Replication  *replicationReport       `json:"replication,omitempty"`
+	IndexProbe   *indexProbeReport        `json:"index_probe,omitempty"`
+	GridFSProbe  *gridFSProbeReport       `json:"gridfs_probe,omitempty"`
+	Leaks        leakReport               `json:"leaks"`
+	Features     *serverFeatures          `json:"server_features,omitempty"`
+	Drift        *driftReport             `json:"atlas_drift,omitempty"`
+	ReadAfter    *rawReport               `json:"read_after_write,omitempty"`
+	VPCEndpoints []vpcEndpointStatus      `json:"vpc_endpoints,omitempty"`
+	Usage        []endpointUsage          `json:"privatelink_usage,omitempty"`
+	Variants     []variantResult          `json:"uri_variants,omitempty"`
+	Primary      *primaryState            `json:"replica_set_primary,omitempty"`
+	Rotations    []uriRotation            `json:"uri_rotations,omitempty"`
+	Members      *memberSet               `json:"members,omitempty"`
+	Analytics    *analyticsReport         `json:"analytics_nodes,omitempty"`
+	Certificates []certInfo               `json:"certificates,omitempty"`
+	Scripts      []scriptReport           `json:"probe_scripts,omitempty"`
+	AtlasPL      *atlasEndpointReport     `json:"atlas_private_endpoints,omitempty"`
+	FIPS         *fipsReport              `json:"fips,omitempty"`
+	Capabilities *capabilityReport        `json:"capabilities,omitempty"`
+	Timings      struct {
+		CycleMS         float64 `json:"cycle_ms"`
+		CheckMS         float64 `json:"check_ms"`
+		IntervalSeconds float64 `json:"interval_seconds"`
+	} `json:"timings"`
+}
+
+func loadStatusConfig() {
+	statusFile = os.Getenv("STATUS_FILE")
+	httpMux.HandleFunc("/status", handleStatus)
+}
+
+// updateStatus records the state after a cycle for /status and, when
+// STATUS_FILE is set, writes the primary cluster's to disk.
+func (c *cluster) updateStatus(result checkResult, cycleDuration time.Duration) {
+	snapshot := statusSnapshot{
+		UpdatedAt:  time.Now(),
+		Target:     result.Target,
+		Namespace:  namespaceName(result.Target),
+		Healthy:    c.up,
+		Health:     c.health(),
+		LastResult: result,
+		Incident:   incidentSnapshot(result.Target),
+		Concerns:   effectiveConcerns,
+		Variants:   variantSnapshot(result.Target),
+		Primary:    primarySnapshot(result.Target),
+		Rotations:  rotationSnapshot(result.Target),
+		Members:    c.members,
+	}
+	if c.primary {
+		snapshot.Shards, snapshot.ConfigServer = shardReportSnapshot()
+		snapshot.Balancer = balancerSnapshot()
+		snapshot.Replication = replicationSnapshot()
+		snapshot.IndexProbe = indexProbeSnapshot()
+		snapshot.GridFSProbe = gridFSProbeSnapshot()
+		snapshot.Leaks = leakSnapshot()
+		snapshot.Features = serverFeaturesSnapshot()
+		snapshot.Drift = driftSnapshot()
+		snapshot.ReadAfter = readAfterWriteSnapshot()
+		snapshot.VPCEndpoints = vpcEndpointSnapshot()
+		snapshot.Usage = usageSnapshot()
+		snapshot.Analytics = analyticsSnapshot()
+		snapshot.Certificates = certSnapshot()
+		snapshot.Scripts = scriptSnapshot()
+		snapshot.AtlasPL = atlasEndpointSnapshot()
+		snapshot.FIPS = fipsSnapshot()
+		snapshot.Capabilities = capabilitySnapshot()
+	}
+	snapshot.Timings.CycleMS = float64(cycleDuration.Microseconds()) / 1000
+	snapshot.Timings.CheckMS = result.LatencyMS
+	snapshot.Timings.IntervalSeconds = c.interval.Seconds()
+
+	statusMu.Lock()
+	statuses[c.name] = &snapshot
+	statusMu.Unlock()
+
+	if statusFile == "" || !c.primary {
+		return
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode status file: %v\n", err)
+		return
+	}
+	if err := writeFileAtomic(statusFile, data); err != nil {
+		logThrottled("Failed to write status file", err)
+	}
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	t, ok := authorize(w, r, roleReadOnly)
+	if !ok {
+		return
+	}
+
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		target = targetName()
+	}
+	if !t.owns(target) {
+		writeError(w, http.StatusForbidden, "target belongs to another tenant")
+		return
+	}
+	if findCluster(target) == nil {
+		writeError(w, http.StatusNotFound, "unknown target")
+		return
+	}
+	statusMu.Lock()
+	snapshot := statuses[target]
+	statusMu.Unlock()
+
+	if snapshot == nil {
+		writeError(w, http.StatusServiceUnavailable, "no check has completed yet")
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// writeFileAtomic writes to a temporary file in the same directory and
+// renames it into place, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
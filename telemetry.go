@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Self-telemetry: how healthy is the monitor itself, as opposed to the
+// cluster it watches.
+
+var (
+	telemetryMu        sync.Mutex
+	processStart       = time.Now()
+	configLoadedAt     time.Time
+	checkCycles        int
+	cycleOverruns      int
+	cyclesSkipped      int
+	lastCycleDuration  time.Duration
+	lastResults        = map[string]checkResult{}
+	checkLatencies     = map[string]*latencyHistogram{}
+	maxSafeIdle        time.Duration
+	notificationsSent  = map[string]int{}
+	notificationErrors = map[string]int{}
+	smtpFailures       = map[string]int{}
+)
+
+func loadTelemetry() {
+	configLoadedAt = time.Now()
+	httpMux.HandleFunc("/metrics", handleMetrics)
+}
+
+func recordCycle(d, interval time.Duration) {
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+
+	checkCycles++
+	lastCycleDuration = d
+	if d > interval {
+		cycleOverruns++
+	}
+}
+
+func recordResult(result checkResult) {
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+
+	lastResults[result.Target] = result
+	h, ok := checkLatencies[result.Target]
+	if !ok {
+		h = newLatencyHistogram()
+		checkLatencies[result.Target] = h
+	}
+	// Without tracing the ID leads to no trace, so no exemplar
+	traceID := ""
+	if tracingEnabled {
+		traceID = result.TraceID
+	}
+	h.observe(result.LatencyMS/1000, traceID, result.Time)
+}
+
+func recordMaxSafeIdle(d time.Duration) {
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+
+	maxSafeIdle = d
+}
+
+func recordSkippedCycles(n int) {
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+
+	cyclesSkipped += n
+}
+
+// recordSMTPFailure counts a failed email by channel and dialogue phase.
+func recordSMTPFailure(channel, phase string) {
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+	smtpFailures[channel+"\x00"+phase]++
+}
+
+func recordNotification(channel string, err error) {
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+
+	if err != nil {
+		notificationErrors[channel]++
+	} else {
+		notificationsSent[channel]++
+	}
+}
+
+// handleMetrics serves OpenMetrics, which carries exemplars, to scrapers
+// that ask for it and the classic text format to everyone else. Scrapers
+// authenticate like any other API client; a tenant's token only gets the
+// series of its own targets.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	t, ok := authorize(w, r, roleReadOnly)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		writeMetrics(openMetricsWriter{&buf})
+	} else {
+		writeMetrics(&buf)
+	}
+	data := buf.Bytes()
+	if t != nil {
+		data = tenantMetrics(data, t)
+	}
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		w.Write(data)
+		fmt.Fprint(w, "# EOF\n")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(data)
+}
+
+// tenantMetrics keeps the samples labeled with one of the tenant's targets,
+// and the HELP and TYPE lines of the families that still have samples.
+func tenantMetrics(data []byte, t *tenant) []byte {
+	var out, header bytes.Buffer
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '#' {
+			if bytes.HasPrefix(line, []byte("# HELP ")) {
+				header.Reset()
+			}
+			header.Write(line)
+			continue
+		}
+		owned := false
+		for _, target := range t.targets {
+			if bytes.Contains(line, []byte(fmt.Sprintf("target=%q", target))) {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			continue
+		}
+		out.Write(header.Bytes())
+		header.Reset()
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// writeMetrics renders all metrics in the Prometheus text exposition format.
+func writeMetrics(w io.Writer) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+
+	writeMetric(w, "mongodb_monitor_goroutines", "gauge", "Number of goroutines in the monitor process.", float64(runtime.NumGoroutine()))
+	writeMetric(w, "mongodb_monitor_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.", float64(mem.HeapAlloc))
+	writeMetric(w, "mongodb_monitor_sys_bytes", "gauge", "Bytes of memory obtained from the OS.", float64(mem.Sys))
+	writeMetric(w, "mongodb_monitor_start_time_seconds", "gauge", "Unix time the monitor started.", float64(processStart.Unix()))
+	writeMetric(w, "mongodb_monitor_config_loaded_timestamp_seconds", "gauge", "Unix time of the last successful configuration load.", float64(configLoadedAt.Unix()))
+	writeMetric(w, "mongodb_monitor_check_cycles_total", "counter", "Check cycles completed.", float64(checkCycles))
+	writeMetric(w, "mongodb_monitor_check_cycle_overruns_total", "counter", "Check cycles that took longer than the check interval.", float64(cycleOverruns))
+	writeMetric(w, "mongodb_monitor_check_cycles_skipped_total", "counter", "Check slots skipped because the previous cycle overran.", float64(cyclesSkipped))
+	writeMetric(w, "mongodb_monitor_last_cycle_duration_seconds", "gauge", "Duration of the most recent check cycle.", lastCycleDuration.Seconds())
+	if len(lastResults) > 0 {
+		targets := make([]string, 0, len(lastResults))
+		for target := range lastResults {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+		var up, degraded, public, latency, canary, checked []metricSample
+		var durations []histogramSample
+		for _, target := range targets {
+			result := lastResults[target]
+			labels := fmt.Sprintf("target=%q", target) + namespaceLabel(target)
+			up = append(up, metricSample{labels, boolValue(result.Status == "up")})
+			degraded = append(degraded, metricSample{labels, boolValue(result.Health == healthDegraded)})
+			public = append(public, metricSample{labels, float64(len(result.PublicIPs))})
+			latency = append(latency, metricSample{labels, result.LatencyMS / 1000})
+			if result.WriteMS > 0 {
+				canary = append(canary, metricSample{labels + `,op="write"`, result.WriteMS / 1000}, metricSample{labels + `,op="read"`, result.ReadMS / 1000})
+			}
+			checked = append(checked, metricSample{labels, float64(result.Time.Unix())})
+			durations = append(durations, histogramSample{labels, checkLatencies[target]})
+		}
+		writeFamily(w, "mongodb_monitor_up", "gauge", "Whether the last check of the target succeeded.", up)
+		writeFamily(w, "mongodb_monitor_degraded", "gauge", "Whether the last check of the target answered slower than DEGRADED_LATENCY_MS.", degraded)
+		if privatePathCheck {
+			writeFamily(w, "mongodb_monitor_public_addresses", "gauge", "Addresses behind the target's connection string outside the private path.", public)
+		}
+		writeFamily(w, "mongodb_monitor_check_latency_seconds", "gauge", "Duration of the last check of the target.", latency)
+		if len(canary) > 0 {
+			writeFamily(w, "mongodb_monitor_canary_latency_seconds", "gauge", "Duration of the canary write and its read-back in the last check of the target.", canary)
+		}
+		writeFamily(w, "mongodb_monitor_last_check_timestamp_seconds", "gauge", "Unix time of the last check of the target.", checked)
+		writeHistogram(w, "mongodb_monitor_check_duration_seconds", "Distribution of check durations, with the trace ID of a recent check per bucket.", durations)
+	}
+	shards, configServer := shardReportSnapshot()
+	if configServer != nil {
+		shards = append(shards[:len(shards):len(shards)], *configServer)
+	}
+	if len(shards) > 0 {
+		var up, latency []metricSample
+		for _, shard := range shards {
+			labels := fmt.Sprintf("shard=%q", shard.Shard)
+			up = append(up, metricSample{labels, boolValue(shard.Reachable)})
+			latency = append(latency, metricSample{labels, shard.LatencyMS / 1000})
+		}
+		writeFamily(w, "mongodb_monitor_shard_up", "gauge", "Whether the shard replica set answered a ping in the last cycle.", up)
+		writeFamily(w, "mongodb_monitor_shard_latency_seconds", "gauge", "Time to reach the shard replica set in the last cycle.", latency)
+	}
+	if balancer := balancerSnapshot(); balancer != nil {
+		writeMetric(w, "mongodb_monitor_balancer_enabled", "gauge", "Whether the balancer mode is not off.", boolValue(balancer.Mode != "off"))
+		writeMetric(w, "mongodb_monitor_balancer_in_round", "gauge", "Whether the balancer is inside a balancing round.", boolValue(balancer.InBalancerRound))
+		writeMetric(w, "mongodb_monitor_balancer_active_migrations", "gauge", "Chunk migrations in progress, -1 if unknown.", float64(balancer.ActiveMigrations))
+		writeMetric(w, "mongodb_monitor_balancer_stuck", "gauge", "Whether the balancer round counter has stopped moving.", boolValue(balancer.Stuck))
+	}
+	if replication := replicationSnapshot(); replication != nil && replication.Permitted {
+		var lag []metricSample
+		for _, member := range replication.Members {
+			if member.State == "SECONDARY" {
+				lag = append(lag, metricSample{fmt.Sprintf("member=%q", member.Name), member.LagSeconds})
+			}
+		}
+		if len(lag) > 0 {
+			writeFamily(w, "mongodb_monitor_replication_lag_seconds", "gauge", "How far each secondary's last applied operation is behind the primary's.", lag)
+		}
+	}
+	if capabilities := capabilitySnapshot(); capabilities != nil && len(capabilities.Probes) > 0 {
+		var enabled []metricSample
+		for _, probe := range capabilities.Probes {
+			enabled = append(enabled, metricSample{fmt.Sprintf("probe=%q", probe.Probe), boolValue(probe.Enabled)})
+		}
+		writeFamily(w, "mongodb_monitor_probe_enabled", "gauge", "Whether the monitor user has the privileges a configured probe needs.", enabled)
+	}
+	if probe := indexProbeSnapshot(); probe != nil {
+		writeMetric(w, "mongodb_monitor_index_probe_ok", "gauge", "Whether the critical index exists and is used by the probe query.", boolValue(probe.Problem == ""))
+	}
+	if probe := gridFSProbeSnapshot(); probe != nil {
+		writeMetric(w, "mongodb_monitor_gridfs_probe_ok", "gauge", "Whether the last GridFS round trip succeeded.", boolValue(probe.OK))
+		writeMetric(w, "mongodb_monitor_gridfs_upload_ms", "gauge", "Duration of the last GridFS probe upload.", probe.UploadMS)
+		writeMetric(w, "mongodb_monitor_gridfs_download_ms", "gauge", "Duration of the last GridFS probe download.", probe.DownloadMS)
+	}
+	writeLabeledMetric(w, "mongodb_monitor_failovers_total", "counter", "Changes of primary seen between checks.", "target", failoverCounts())
+	if expectedAZCount > 0 {
+		writeLabeledMetric(w, "mongodb_monitor_endpoint_dns_answers", "gauge", "A records returned for each endpoint DNS name.", "name", endpointAnswerCounts())
+	}
+	leaks := leakSnapshot()
+	writeLabeledMetric(w, "mongodb_monitor_leaked_cursors_total", "counter", "Cursors probes left open when their client disconnected.", "probe", leaks.LeakedCursors)
+	writeLabeledMetric(w, "mongodb_monitor_leaked_sessions_total", "counter", "Sessions probes never ended before disconnecting.", "probe", leaks.LeakedSessions)
+	writeMetric(w, "mongodb_server_open_cursors", "gauge", "Open cursors reported by serverStatus.", float64(leaks.ServerOpenCursors))
+	writeMetric(w, "mongodb_server_timed_out_cursors_total", "counter", "Cursors the server timed out since startup.", float64(leaks.ServerTimedOut))
+	if features := serverFeaturesSnapshot(); features != nil {
+		writeMetric(w, "mongodb_server_max_wire_version", "gauge", "maxWireVersion advertised by the server.", float64(features.MaxWireVersion))
+	}
+	if drift := driftSnapshot(); drift != nil {
+		writeMetric(w, "mongodb_monitor_atlas_config_drift", "gauge", "Number of fields differing from the expected Atlas cluster spec.", float64(len(drift.Differences)))
+	}
+	if raw := readAfterWriteSnapshot(); raw != nil && len(raw.Reads) > 0 {
+		var staleness []metricSample
+		for _, read := range raw.Reads {
+			labels := fmt.Sprintf("read_preference=%q,read_concern=%q,causal=%q", read.ReadPreference, read.ReadConcern, fmt.Sprint(read.Causal))
+			staleness = append(staleness, metricSample{labels, read.StalenessMS / 1000})
+		}
+		writeFamily(w, "mongodb_monitor_read_after_write_staleness_seconds", "gauge", "Time from the majority write until the read saw it.", staleness)
+	}
+	if sloTarget > 0 {
+		good, total := sloCounts()
+		writeMetric(w, "mongodb_monitor_slo_checks_total", "counter", "Checks counted against the SLO.", float64(total))
+		writeMetric(w, "mongodb_monitor_slo_good_checks_total", "counter", "Checks that met the SLO.", float64(good))
+	}
+	if rates := sloBurnRates(); rates != nil {
+		windows := make([]string, 0, len(rates))
+		for window := range rates {
+			windows = append(windows, window)
+		}
+		sort.Strings(windows)
+		samples := make([]metricSample, 0, len(windows))
+		for _, window := range windows {
+			samples = append(samples, metricSample{fmt.Sprintf("window=%q", window), rates[window]})
+		}
+		writeFamily(w, "mongodb_monitor_slo_burn_rate", "gauge", "Error budget burn rate over the window, 1 means exactly on budget.", samples)
+	}
+	if endpoints := vpcEndpointSnapshot(); len(endpoints) > 0 {
+		samples := make([]metricSample, 0, len(endpoints))
+		for _, e := range endpoints {
+			labels := fmt.Sprintf("account=%q,endpoint=%q", e.Account, e.ID)
+			samples = append(samples, metricSample{labels, boolValue(e.State == "available")})
+		}
+		writeFamily(w, "mongodb_monitor_vpc_endpoint_available", "gauge", "Whether EC2 reports the VPC endpoint as available.", samples)
+	}
+	if usage := usageSnapshot(); len(usage) > 0 {
+		samples := make([]metricSample, 0, len(usage))
+		for _, u := range usage {
+			labels := fmt.Sprintf("account=%q,endpoint=%q", u.Account, u.ID)
+			samples = append(samples, metricSample{labels, u.Bytes})
+		}
+		writeFamily(w, "mongodb_monitor_privatelink_processed_bytes_month", "gauge", "Bytes the VPC endpoint processed this month, as billed by AWS.", samples)
+	}
+	if certs := certSnapshot(); len(certs) > 0 {
+		var samples []metricSample
+		for _, c := range certs {
+			samples = append(samples, metricSample{fmt.Sprintf("host=%q,subject=%q", c.Host, c.Subject), time.Until(c.NotAfter).Seconds()})
+		}
+		writeFamily(w, "mongodb_monitor_tls_cert_expiry_seconds", "gauge", "Seconds until a certificate presented by the cluster expires.", samples)
+	}
+	if reports := scriptSnapshot(); len(reports) > 0 {
+		var ok, steps []metricSample
+		for _, report := range reports {
+			ok = append(ok, metricSample{fmt.Sprintf("script=%q", report.Script), boolValue(report.OK)})
+			for _, step := range report.Steps {
+				steps = append(steps, metricSample{fmt.Sprintf("script=%q,step=\"%d\",op=%q", report.Script, step.Step, step.Op), step.LatencyMS / 1000})
+			}
+		}
+		writeFamily(w, "mongodb_monitor_probe_script_ok", "gauge", "Whether the last run of a probe script passed every step.", ok)
+		writeFamily(w, "mongodb_monitor_probe_script_step_seconds", "gauge", "Duration of each step in the last run of a probe script.", steps)
+	}
+	if resultStream != nil {
+		queued, dropped := resultStreamSnapshot()
+		writeMetric(w, "mongodb_monitor_result_stream_queued", "gauge", "Check results waiting to be posted to the result webhook.", float64(queued))
+		writeMetric(w, "mongodb_monitor_result_stream_dropped_total", "counter", "Check results dropped because the result webhook queue was full.", float64(dropped))
+	}
+	if report := analyticsSnapshot(); report != nil && len(report.Nodes) > 0 {
+		var samples []metricSample
+		for _, node := range report.Nodes {
+			samples = append(samples, metricSample{fmt.Sprintf("node_type=%q", node.NodeType), boolValue(node.Reachable)})
+		}
+		writeFamily(w, "mongodb_monitor_tagged_node_reachable", "gauge", "Whether a node with the Atlas nodeType tag could be selected through the endpoint.", samples)
+	}
+	var variantUp []metricSample
+	for _, c := range clusters {
+		for _, v := range variantSnapshot(c.name) {
+			labels := fmt.Sprintf("target=%q,variant=%q", c.name, v.Variant) + namespaceLabel(c.name)
+			variantUp = append(variantUp, metricSample{labels, boolValue(v.Reachable)})
+		}
+	}
+	if len(variantUp) > 0 {
+		writeFamily(w, "mongodb_monitor_uri_variant_up", "gauge", "Whether the connection string variant reached the cluster in the last check.", variantUp)
+	}
+	if len(idleProbeLadder) > 0 {
+		writeMetric(w, "mongodb_monitor_max_safe_idle_seconds", "gauge", "Longest idle period a pooled connection survived in the last idle probe.", maxSafeIdle.Seconds())
+	}
+	writeLabeledMetric(w, "mongodb_monitor_notifications_sent_total", "counter", "Notifications delivered, by channel.", "channel", notificationsSent)
+	writeLabeledMetric(w, "mongodb_monitor_notification_errors_total", "counter", "Notifications that failed to deliver, by channel.", "channel", notificationErrors)
+	if len(smtpFailures) > 0 {
+		keys := make([]string, 0, len(smtpFailures))
+		for key := range smtpFailures {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var samples []metricSample
+		for _, key := range keys {
+			channel, phase, _ := strings.Cut(key, "\x00")
+			samples = append(samples, metricSample{fmt.Sprintf("channel=%q,phase=%q", channel, phase), float64(smtpFailures[key])})
+		}
+		writeFamily(w, "mongodb_monitor_smtp_failures_total", "counter", "Emails that failed to send, by channel and the SMTP dialogue phase that failed.", samples)
+	}
+	writeLabeledMetric(w, "mongodb_monitor_alerts_inhibited_total", "counter", "Alerts held back because a related root cause was already firing, by condition.", "condition", inhibitSnapshot())
+	deduplicated, rateLimited := rateLimitSnapshot()
+	writeMetric(w, "mongodb_monitor_alerts_deduplicated_total", "counter", "Alerts suppressed because an identical alert was sent less than ALERT_DEDUP_MINUTES before.", float64(deduplicated))
+	writeLabeledMetric(w, "mongodb_monitor_alerts_rate_limited_total", "counter", "Alerts a channel did not deliver because it had reached its hourly limit, by channel.", "channel", rateLimited)
+	writeMetric(w, "mongodb_monitor_alert_queue_length", "gauge", "Alerts waiting for the notification worker.", float64(len(alertQueue)))
+	writeMetric(w, "mongodb_monitor_alerts_dropped_total", "counter", "Alerts dropped because the notification queue was full.", float64(alertsDropped))
+}
+
+// metricSample is one value of a metric family; labels is the text between
+// the braces, e.g. `target="prod"`.
+type metricSample struct {
+	labels string
+	value  float64
+}
+
+// writeFamily writes one metric family. All samples of a family must be
+// written together, with a single HELP and TYPE header.
+func writeFamily(w io.Writer, name, kind, help string, samples []metricSample) {
+	family := familyName(w, name, kind)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family, help, family, kind)
+	for _, sample := range samples {
+		if sample.labels == "" {
+			fmt.Fprintf(w, "%s %g\n", name, sample.value)
+		} else {
+			fmt.Fprintf(w, "%s{%s} %g\n", name, sample.labels, sample.value)
+		}
+	}
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value float64) {
+	writeFamily(w, name, kind, help, []metricSample{{"", value}})
+}
+
+func writeLabeledMetric(w io.Writer, name, kind, help, label string, values map[string]int) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	samples := make([]metricSample, 0, len(keys))
+	for _, k := range keys {
+		samples = append(samples, metricSample{fmt.Sprintf("%s=%q", label, k), float64(values[k])})
+	}
+	writeFamily(w, name, kind, help, samples)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
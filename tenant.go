@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// tenant is a team sharing this monitor instance. Its config lives under
+// TENANT_<NAME>_*, and it only sees and receives what concerns its targets.
+// Its API token is registered by loadAPITokens.
+type tenant struct {
+	name       string
+	token      string
+	targets    []string
+	recipients []string
+}
+
+var tenants []*tenant
+
+// loadTenants reads TENANTS="payments,search" and for each namespace
+// TENANT_<NAME>_TARGETS (target names, as set by INDEX), TENANT_<NAME>_TOKEN
+// for the HTTP API, and TENANT_<NAME>_TO_EMAIL for alert routing.
+func loadTenants() {
+	for _, name := range splitList(os.Getenv("TENANTS")) {
+		prefix := "TENANT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		t := &tenant{
+			name:       name,
+			token:      os.Getenv(prefix + "TOKEN"),
+			targets:    splitList(os.Getenv(prefix + "TARGETS")),
+			recipients: splitList(os.Getenv(prefix + "TO_EMAIL")),
+		}
+		if t.token == "" {
+			log.Fatalf("%sTOKEN is required for tenant %s", prefix, name)
+		}
+		if len(t.targets) == 0 {
+			log.Fatalf("%sTARGETS is required for tenant %s", prefix, name)
+		}
+		for _, other := range tenants {
+			for _, target := range t.targets {
+				if slices.Contains(other.targets, target) {
+					log.Fatalf("Target %s belongs to both tenant %s and tenant %s", target, other.name, name)
+				}
+			}
+		}
+		tenants = append(tenants, t)
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// tenantForTarget returns the tenant owning target, or nil.
+func tenantForTarget(target string) *tenant {
+	for _, t := range tenants {
+		if slices.Contains(t.targets, target) {
+			return t
+		}
+	}
+	return nil
+}
+
+// owns reports whether the tenant may see target. A nil tenant stands for
+// a monitor without tenants, which sees everything.
+func (t *tenant) owns(target string) bool {
+	return t == nil || slices.Contains(t.targets, target)
+}
+
+// alertRecipients routes alerts for target to its tenant's recipients,
+// falling back to TO_EMAIL.
+func alertRecipients(target string) []string {
+	if t := tenantForTarget(target); t != nil && len(t.recipients) > 0 {
+		return t.recipients
+	}
+	return splitList(toEmail)
+}
+
+// namespaceLabel is the extra metric label identifying the target's tenant.
+func namespaceLabel(target string) string {
+	if t := tenantForTarget(target); t != nil {
+		return fmt.Sprintf(",namespace=%q", t.name)
+	}
+	return ""
+}
+
+func namespaceName(target string) string {
+	if t := tenantForTarget(target); t != nil {
+		return t.name
+	}
+	return ""
+}
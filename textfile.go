@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+const textfileName = "mongodb_monitor.prom"
+
+var textfileDir string
+
+func loadTextfileConfig() {
+	textfileDir = os.Getenv("TEXTFILE_COLLECTOR_DIR")
+}
+
+// writeTextfile drops the metrics into node_exporter's textfile collector
+// directory. The atomic rename matters here: node_exporter may read the file
+// at any moment.
+func writeTextfile() {
+	if textfileDir == "" {
+		return
+	}
+	var buf bytes.Buffer
+	writeMetrics(&buf)
+	if err := writeFileAtomic(filepath.Join(textfileDir, textfileName), buf.Bytes()); err != nil {
+		logThrottled("Failed to write textfile collector metrics", err)
+	}
+}
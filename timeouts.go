@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Failure classes reported with every failed check.
+const (
+	classDNS                    = "dns"
+	classServerSelectionTimeout = "server_selection_timeout"
+	classConnectTimeout         = "connect_timeout"
+	classSocketTimeout          = "socket_timeout"
+	classCheckDeadline          = "check_deadline"
+	classAuth                   = "auth"
+	classNetwork                = "network"
+	classWrongCluster           = "wrong_cluster"
+	classOther                  = "other"
+)
+
+// Driver timeouts; zero leaves the URI or driver default in place.
+var (
+	serverSelectionTimeout time.Duration
+	connectTimeout         time.Duration
+	socketTimeout          time.Duration
+	heartbeatFrequency     time.Duration
+
+	operationTimeout  time.Duration
+	checkHardCap      time.Duration
+	disconnectTimeout time.Duration
+)
+
+// loadTimeouts reads the driver timeouts, CHECK_OPERATION_TIMEOUT_MS, the
+// deadline of each driver call within a check (default 0, only the check
+// deadline), and CHECK_HARD_CAP_SECONDS, after which the watchdog abandons
+// a check that still has not returned (default twice the interval), and
+// MONGODB_DISCONNECT_TIMEOUT_MS, the deadline for tearing a client down
+// (default 2000).
+func loadTimeouts() {
+	disconnectTimeout = time.Duration(getEnvInt("MONGODB_DISCONNECT_TIMEOUT_MS", 2000)) * time.Millisecond
+	operationTimeout = time.Duration(getEnvInt("CHECK_OPERATION_TIMEOUT_MS", 0)) * time.Millisecond
+	checkHardCap = time.Duration(getEnvInt("CHECK_HARD_CAP_SECONDS", 0)) * time.Second
+	serverSelectionTimeout = time.Duration(getEnvInt("MONGODB_SERVER_SELECTION_TIMEOUT_MS", 0)) * time.Millisecond
+	connectTimeout = time.Duration(getEnvInt("MONGODB_CONNECT_TIMEOUT_MS", 0)) * time.Millisecond
+	socketTimeout = time.Duration(getEnvInt("MONGODB_SOCKET_TIMEOUT_MS", 0)) * time.Millisecond
+	heartbeatFrequency = time.Duration(getEnvInt("MONGODB_HEARTBEAT_FREQUENCY_MS", 0)) * time.Millisecond
+}
+
+func applyTimeouts(opts *options.ClientOptions) {
+	if serverSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(serverSelectionTimeout)
+	}
+	if connectTimeout > 0 {
+		opts.SetConnectTimeout(connectTimeout)
+	}
+	if socketTimeout > 0 {
+		opts.SetSocketTimeout(socketTimeout)
+	}
+	if heartbeatFrequency > 0 {
+		opts.SetHeartbeatInterval(heartbeatFrequency)
+	}
+}
+
+// withOperation runs one driver call under its own deadline within the
+// check's, so a call that hangs cannot use up the time of the ones after it.
+func withOperation(parent context.Context, call func(ctx context.Context) error) error {
+	if operationTimeout <= 0 {
+		return call(parent)
+	}
+	ctx, cancel := context.WithTimeout(parent, operationTimeout)
+	defer cancel()
+	return call(ctx)
+}
+
+// reportTimeouts logs the effective driver timeouts once at startup.
+func reportTimeouts(uri string) {
+	opts := options.Client().ApplyURI(uri)
+	applyTimeouts(opts)
+	log.Printf("Effective timeouts: serverSelectionTimeout=%s connectTimeout=%s socketTimeout=%s heartbeatFrequency=%s check deadline=%v disconnect deadline=%v\n",
+		describeTimeout(opts.ServerSelectionTimeout, "30s"), describeTimeout(opts.ConnectTimeout, "30s"),
+		describeTimeout(opts.SocketTimeout, "none"), describeTimeout(opts.HeartbeatInterval, "10s"), checkInterval, disconnectTimeout)
+}
+
+func describeTimeout(d *time.Duration, driverDefault string) string {
+	if d == nil {
+		return driverDefault + " (driver default)"
+	}
+	return d.String()
+}
+
+// classifyError names the kind of failure, and for timeouts which timeout
+// fired. Server selection errors embed the last error seen for each server,
+// so the most specific cause is checked first.
+func classifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	msg := strings.ToLower(err.Error())
+
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, errWrongCluster):
+		return classWrongCluster
+	case errors.As(err, &dnsErr), strings.Contains(msg, "no such host"), strings.Contains(msg, "error parsing uri") && strings.Contains(msg, "lookup"):
+		return classDNS
+	case strings.Contains(msg, "authentication failed"), strings.Contains(msg, "auth error"):
+		return classAuth
+	case strings.Contains(msg, "handshake") && mongo.IsTimeout(err), strings.Contains(msg, "dial tcp") && strings.Contains(msg, "i/o timeout"):
+		return classConnectTimeout
+	case strings.Contains(msg, "i/o timeout"), strings.Contains(msg, "socket timeout"):
+		return classSocketTimeout
+	case strings.Contains(msg, "server selection timeout"), strings.Contains(msg, "server selection error"):
+		return classServerSelectionTimeout
+	case errors.Is(err, context.DeadlineExceeded), strings.Contains(msg, "context deadline exceeded"):
+		return classCheckDeadline
+	case mongo.IsNetworkError(err), strings.Contains(msg, "connection refused"), strings.Contains(msg, "connection reset"), strings.Contains(msg, "unexpectedly closed"):
+		return classNetwork
+	}
+	return classOther
+}
+
+// describeFailureClass is the line added to failure alerts, with the
+// setting behind a timeout as the cluster's client applies it: from the
+// environment, the connection string, or the driver default.
+func (c *cluster) describeFailureClass(class string) string {
+	opts := options.Client().ApplyURI(c.uri)
+	applyTimeouts(opts)
+	var setting string
+	switch class {
+	case classServerSelectionTimeout:
+		setting = tr("failure_class.server_selection", " (serverSelectionTimeout={timeout})", "timeout", describeTimeout(opts.ServerSelectionTimeout, "30s"))
+	case classConnectTimeout:
+		setting = tr("failure_class.connect", " (connectTimeout={timeout})", "timeout", describeTimeout(opts.ConnectTimeout, "30s"))
+	case classSocketTimeout:
+		setting = tr("failure_class.socket", " (socketTimeout={timeout})", "timeout", describeTimeout(opts.SocketTimeout, "none"))
+	case classCheckDeadline:
+		setting = tr("failure_class.check_deadline", " (check deadline={timeout})", "timeout", c.interval)
+	case classWrongCluster:
+		setting = tr("failure_class.wrong_cluster", " (the endpoint now leads to another cluster; delete {file} to re-pin if this is intended)", "file", identityFile)
+	}
+	return tr("failure_class", "Failure class: {class}{setting}", "class", class, "setting", setting)
+}
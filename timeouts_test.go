@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"no error", nil, ""},
+		{"wrong cluster", fmt.Errorf("identity: %w", errWrongCluster), classWrongCluster},
+		{"dns error", &net.DNSError{Err: "no such host", Name: "cluster0.example.net"}, classDNS},
+		{"srv lookup", errors.New("error parsing uri: lookup _mongodb._tcp.cluster0.example.net on 10.0.0.2:53: server misbehaving"), classDNS},
+		{"auth", errors.New("connection() error occurred during connection handshake: auth error: sasl conversation error: unable to authenticate using mechanism \"SCRAM-SHA-256\": (AuthenticationFailed) Authentication failed."), classAuth},
+		{"dial timeout", errors.New("dial tcp 10.0.1.5:27017: i/o timeout"), classConnectTimeout},
+		{"socket timeout", errors.New("connection(10.0.1.5:27017[-3]) incomplete read of message header: read tcp 10.0.0.4:51234->10.0.1.5:27017: i/o timeout"), classSocketTimeout},
+		{"server selection with its cause", errors.New("server selection error: context deadline exceeded, current topology: { Type: ReplicaSetNoPrimary, Servers: [{ Addr: 10.0.1.5:27017, Type: Unknown, Last error: dial tcp 10.0.1.5:27017: i/o timeout }, ] }"), classConnectTimeout},
+		{"server selection", errors.New("server selection error: server selection timeout, current topology: { Type: ReplicaSetNoPrimary, Servers: [] }"), classServerSelectionTimeout},
+		{"check deadline", fmt.Errorf("ping: %w", context.DeadlineExceeded), classCheckDeadline},
+		{"connection refused", errors.New("dial tcp 10.0.1.5:27017: connect: connection refused"), classNetwork},
+		{"connection closed", errors.New("connection(10.0.1.5:27017[-7]) socket was unexpectedly closed: EOF"), classNetwork},
+		{"other", errors.New("(Unauthorized) not authorized on admin to execute command"), classOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	expectedReplicaSet   string
+	expectedMemberCount  int
+	expectedHostPatterns []string
+
+	topologyMismatch string
+)
+
+// loadExpectedTopology reads EXPECTED_REPLICA_SET, EXPECTED_MEMBER_COUNT,
+// and EXPECTED_HOST_PATTERNS, a comma-separated list of glob patterns such
+// as "*.abc12.mongodb.net:27017" that every member must match.
+func loadExpectedTopology() {
+	expectedReplicaSet = os.Getenv("EXPECTED_REPLICA_SET")
+	expectedMemberCount = getEnvInt("EXPECTED_MEMBER_COUNT", 0)
+	expectedHostPatterns = splitList(os.Getenv("EXPECTED_HOST_PATTERNS"))
+	for _, pattern := range expectedHostPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Fatalf("Invalid EXPECTED_HOST_PATTERNS entry %q: %v", pattern, err)
+		}
+	}
+}
+
+// checkExpectedTopology compares the hello/isMaster reply with the declared
+// topology. Connecting fine to the wrong cluster, because DNS or an endpoint
+// points somewhere unexpected, otherwise looks perfectly healthy.
+func checkExpectedTopology(topology bson.M) {
+	if expectedReplicaSet == "" && expectedMemberCount == 0 && len(expectedHostPatterns) == 0 {
+		return
+	}
+
+	var members []string
+	for _, key := range []string{"hosts", "passives", "arbiters"} {
+		if hosts, ok := topology[key].(primitive.A); ok {
+			for _, host := range hosts {
+				members = append(members, fmt.Sprint(host))
+			}
+		}
+	}
+	setName, _ := topology["setName"].(string)
+
+	var problems []string
+	if expectedReplicaSet != "" && setName != expectedReplicaSet {
+		problems = append(problems, tr("topology.set_name", "replica set name is {name:%q}, expected {expected:%q}", "name", setName, "expected", expectedReplicaSet))
+	}
+	if expectedMemberCount > 0 && len(members) != expectedMemberCount {
+		problems = append(problems, tr("topology.member_count", "{count} members, expected {expected}", "count", len(members), "expected", expectedMemberCount))
+	}
+	if len(expectedHostPatterns) > 0 {
+		for _, member := range members {
+			if !matchesAny(member, expectedHostPatterns) {
+				problems = append(problems, tr("topology.member_pattern", "member {member} matches none of {patterns}", "member", member, "patterns", strings.Join(expectedHostPatterns, ", ")))
+			}
+		}
+	}
+
+	mismatch := strings.Join(problems, "\n")
+	previous := topologyMismatch
+	topologyMismatch = mismatch
+	if mismatch == previous {
+		return
+	}
+	if mismatch != "" {
+		log.Printf("Topology differs from the expected topology:\n%s\n", mismatch)
+		sendAlert("MongoDB Unexpected Topology",
+			tr("topology.unexpected", "The monitor is connected to a deployment that does not look like the expected one:\n{mismatch}\n\nMembers seen: {members}\n{dns_change}",
+				"mismatch", mismatch, "members", strings.Join(members, ", "), "dns_change", lastDNSChangeSummary()))
+	} else {
+		sendRecovery("MongoDB Topology As Expected Again", tr("topology.expected", "The deployment matches the expected topology again."))
+	}
+}
+
+func matchesAny(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// tracingEnabled is whether check spans are exported, and so whether
+	// their trace IDs lead anywhere
+	tracingEnabled bool
+	tracerProvider *sdktrace.TracerProvider
+)
+
+// loadTracingConfig exports a span for every check over OTLP/HTTP when
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set.
+// The exporter and resource read the other standard OTEL_ variables
+// (headers, TLS, OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES), and
+// OTEL_SDK_DISABLED=true turns tracing off.
+func loadTracingConfig() {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return
+	}
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return
+	}
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Fatalf("Failed to set up OTLP trace export: %v", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "mongodb-privatelink-monitor")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK())
+	if err != nil {
+		log.Fatalf("Invalid OpenTelemetry resource: %v", err)
+	}
+	tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tracerProvider)
+	tracingEnabled = true
+	log.Println("Exporting a trace span for every check over OTLP")
+}
+
+// startCheckSpan starts the span of one check of the target. Without
+// tracing it is a no-op span with no trace ID.
+func startCheckSpan(target string) trace.Span {
+	_, span := otel.Tracer("github.com/meticulous-dft/mongodb-privatelink-connectivity-test").Start(context.Background(), "mongodb.check",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mongodb"), attribute.String("monitor.target", target)))
+	return span
+}
+
+// endCheckSpan records the check's outcome on its span and ends it.
+func endCheckSpan(span trace.Span, result checkResult, err error) {
+	span.SetAttributes(
+		attribute.String("monitor.status", result.Status),
+		attribute.String("monitor.health", result.Health),
+		attribute.Float64("monitor.latency_ms", result.LatencyMS),
+		attribute.Bool("monitor.cold_connect", result.ColdConnect))
+	if err != nil {
+		span.SetAttributes(attribute.String("monitor.error_class", result.ErrorClass))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, result.ErrorClass)
+	}
+	span.End()
+}
+
+// spanTraceID is the span's trace ID, or, without tracing, a random ID in
+// the same format that still ties a check's log lines together.
+func spanTraceID(span trace.Span) string {
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return newTraceID()
+}
+
+func newTraceID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// shutdownTracing exports the spans still buffered, for commands that exit.
+func shutdownTracing() {
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		log.Printf("Failed to export the remaining trace spans: %v\n", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// checkRequest asks the check loop to run a cycle now and reply with its
+// result.
+type checkRequest struct {
+	reply chan checkResult
+}
+
+var checkWebhookToken string
+
+func loadTriggerConfig() {
+	checkWebhookToken = os.Getenv("CHECK_WEBHOOK_TOKEN")
+	httpMux.HandleFunc("/check", handleCheckTrigger)
+}
+
+// waitForNextCycle sleeps until the next scheduled cycle or until an
+// on-demand check of the cluster arrives, whichever is first.
+func (c *cluster) waitForNextCycle(delay time.Duration) []checkRequest {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case req := <-c.checkRequests:
+		return []checkRequest{req}
+	}
+}
+
+// handleCheckTrigger runs an immediate check for deployment pipelines and
+// returns its result, of the primary cluster or of ?cluster=<name>. The
+// check goes through the cluster's loop so alerting and state stay
+// consistent with scheduled checks.
+func handleCheckTrigger(w http.ResponseWriter, r *http.Request) {
+	if checkWebhookToken == "" && len(apiTokens) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	name := orString(r.URL.Query().Get("cluster"), targetName())
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if checkWebhookToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(checkWebhookToken)) != 1 {
+		// Not the pipeline webhook token, so it needs an admin API token
+		if len(apiTokens) == 0 {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		t, ok := authorize(w, r, roleAdmin)
+		if !ok {
+			return
+		}
+		if !t.owns(name) {
+			writeError(w, http.StatusForbidden, "target belongs to another tenant")
+			return
+		}
+	}
+
+	c := findCluster(name)
+	if c == nil {
+		writeError(w, http.StatusNotFound, "unknown cluster")
+		return
+	}
+
+	req := checkRequest{reply: make(chan checkResult, 1)}
+	select {
+	case c.checkRequests <- req:
+	case <-r.Context().Done():
+		return
+	}
+	select {
+	case result := <-req.reply:
+		status := http.StatusOK
+		if result.Status != "up" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, result)
+	case <-r.Context().Done():
+	}
+}
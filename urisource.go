@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uriRotation is a change of a cluster's connection string picked up from
+// its URI source while running.
+type uriRotation struct {
+	Time    time.Time `json:"time"`
+	Target  string    `json:"target"`
+	Source  string    `json:"source"`
+	Changed []string  `json:"changed"`
+}
+
+var (
+	uriSourcePoll time.Duration
+
+	uriMu       sync.Mutex
+	pendingURIs = map[string]string{}
+	rotations   = map[string][]uriRotation{}
+)
+
+// loadURISources reads MONGODB_URI_SOURCE and CLUSTER_<NAME>_URI_SOURCE,
+// where a cluster's connection string comes from instead of the
+// environment, and URI_SOURCE_POLL_SECONDS (default 60), how often it is
+// read again. Sources are:
+//
+//	file:/run/secrets/mongodb-uri           a mounted secret or a Vault agent template
+//	aws-secretsmanager:prod/monitor          an AWS Secrets Manager secret string
+//	aws-secretsmanager:prod/monitor#uri      one field of a JSON secret
+//
+// A URI set in the environment as well is used until the source is read.
+func loadURISources() {
+	uriSourcePoll = time.Duration(getEnvInt("URI_SOURCE_POLL_SECONDS", 60)) * time.Second
+	for _, c := range clusters {
+		if c.uriSource == "" {
+			continue
+		}
+		uri, err := readURISource(c.uriSource)
+		if err != nil {
+			if c.uri == "" {
+				log.Fatalf("Failed to read the connection string of cluster %s from %s: %v", c.name, c.uriSource, err)
+			}
+			log.Printf("Failed to read the connection string of cluster %s from %s, using the configured one: %v\n", c.name, c.uriSource, err)
+			continue
+		}
+		c.uri = uri
+		if c.primary {
+			os.Setenv("MONGODB_URI", uri)
+		}
+	}
+}
+
+// readURISource fetches the connection string from source.
+func readURISource(source string) (string, error) {
+	kind, location, _ := strings.Cut(source, ":")
+	var value string
+	switch kind {
+	case "file":
+		data, err := os.ReadFile(location)
+		if err != nil {
+			return "", err
+		}
+		value = string(data)
+	case "aws-secretsmanager":
+		id, field, _ := strings.Cut(location, "#")
+		secret, err := awsSecretString(id)
+		if err != nil {
+			return "", err
+		}
+		value = secret
+		if field != "" {
+			var fields map[string]string
+			if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+				return "", fmt.Errorf("secret %s is not a JSON object: %w", id, err)
+			}
+			value = fields[field]
+		}
+	default:
+		return "", fmt.Errorf("unsupported URI source %q, expected file: or aws-secretsmanager:", source)
+	}
+	value = strings.TrimSpace(value)
+	if _, _, err := parseSeedList(value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// awsSecretString reads a secret's current value with
+// secretsmanager:GetSecretValue in AWS_REGION.
+func awsSecretString(id string) (string, error) {
+	creds, err := awsDefaultCredentials()
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	err = awsJSONRequest(creds, awsRegion, "secretsmanager", "secretsmanager."+awsRegion+".amazonaws.com",
+		"secretsmanager.GetSecretValue", map[string]string{"SecretId": id}, &out)
+	return out.SecretString, err
+}
+
+// startURISourceWatcher polls every cluster's URI source and hands changed
+// connection strings to its check loop, which switches over between checks.
+func startURISourceWatcher() {
+	var watched []*cluster
+	for _, c := range clusters {
+		if c.uriSource != "" {
+			watched = append(watched, c)
+		}
+	}
+	if len(watched) == 0 {
+		return
+	}
+
+	current := map[string]string{}
+	for _, c := range watched {
+		current[c.name] = c.uri
+	}
+	go func() {
+		for {
+			time.Sleep(uriSourcePoll)
+			for _, c := range watched {
+				uri, err := readURISource(c.uriSource)
+				if err != nil {
+					logThrottled("Failed to read connection string source of "+c.name, err)
+					continue
+				}
+				if uri == current[c.name] {
+					continue
+				}
+				current[c.name] = uri
+				uriMu.Lock()
+				pendingURIs[c.name] = uri
+				uriMu.Unlock()
+			}
+		}
+	}()
+}
+
+// applyURIRotation switches the cluster to a connection string the watcher
+// picked up, dropping the client built from the old one. A rotation is
+// planned, so it is recorded as an event (on the next check's result, the
+// open incident, and an informational alert) rather than letting the
+// dropped connections look like an outage. It returns the annotation for
+// the next check's result, or "".
+func (c *cluster) applyURIRotation() string {
+	uriMu.Lock()
+	uri, ok := pendingURIs[c.name]
+	delete(pendingURIs, c.name)
+	uriMu.Unlock()
+	if !ok || uri == c.uri {
+		return ""
+	}
+
+	rotation := uriRotation{Time: time.Now(), Target: c.name, Source: c.uriSource, Changed: uriDifferences(c.uri, uri)}
+	c.uri = uri
+	if c.primary {
+		os.Setenv("MONGODB_URI", uri)
+	}
+	c.dropClient()
+
+	uriMu.Lock()
+	rotations[c.name] = append(rotations[c.name], rotation)
+	if len(rotations[c.name]) > 20 {
+		rotations[c.name] = rotations[c.name][1:]
+	}
+	uriMu.Unlock()
+	recordIncidentRotation(rotation)
+
+	changed := strings.Join(rotation.Changed, ", ")
+	log.Printf("Connection string of %s changed in %s (%s), reconnecting\n", c.name, c.uriSource, changed)
+	dispatchAlert(Alert{Subject: "MongoDB Connection String Rotated", Target: c.name, Severity: severityInfo,
+		Body: tr("uri.rotated", "The connection string in {source} changed ({changed}). The monitor switched to it without restarting; the next check connects with the new settings.",
+			"source", c.uriSource, "changed", changed)})
+	return "connection string rotated: " + changed
+}
+
+// uriDifferences names what differs between two connection strings
+// without revealing either.
+func uriDifferences(old, new string) []string {
+	oldUser, oldPass, oldHosts, oldRest := splitURI(old)
+	newUser, newPass, newHosts, newRest := splitURI(new)
+	var changed []string
+	if oldUser != newUser {
+		changed = append(changed, "username")
+	}
+	if oldPass != newPass {
+		changed = append(changed, "password")
+	}
+	if oldHosts != newHosts {
+		changed = append(changed, "hosts")
+	}
+	if oldRest != newRest {
+		changed = append(changed, "options")
+	}
+	if len(changed) == 0 {
+		changed = append(changed, "scheme")
+	}
+	return changed
+}
+
+// splitURI splits a connection string into user, password, host list, and
+// the database and options after it.
+func splitURI(uri string) (user, password, hosts, rest string) {
+	_, uri, _ = strings.Cut(uri, "://")
+	if i := strings.IndexAny(uri, "/?"); i >= 0 {
+		uri, rest = uri[:i], uri[i:]
+	}
+	if i := strings.LastIndex(uri, "@"); i >= 0 {
+		user, password, _ = strings.Cut(uri[:i], ":")
+		uri = uri[i+1:]
+	}
+	return user, password, uri, rest
+}
+
+func rotationSnapshot(target string) []uriRotation {
+	uriMu.Lock()
+	defer uriMu.Unlock()
+	return append([]uriRotation(nil), rotations[target]...)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// endpointUsage is the data a VPC endpoint processed in the current month,
+// which AWS bills per GB on top of the hourly endpoint charge.
+type endpointUsage struct {
+	Account       string    `json:"account"`
+	ID            string    `json:"id"`
+	Month         string    `json:"month"`
+	Bytes         float64   `json:"bytes"`
+	EstimatedCost float64   `json:"estimated_cost_usd"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+var (
+	usageEnabled    bool
+	usageInterval   time.Duration
+	usagePricePerGB float64
+
+	usageMu    sync.Mutex
+	usageByID  = map[string]*endpointUsage{}
+	usageMonth string
+)
+
+// loadUsageConfig reads PRIVATELINK_USAGE=true, PRIVATELINK_USAGE_POLL_MINUTES,
+// and PRIVATELINK_PRICE_PER_GB (default 0.01, the first-tier rate in most
+// regions). The accounts' roles need cloudwatch:GetMetricStatistics.
+func loadUsageConfig() {
+	usageEnabled = os.Getenv("PRIVATELINK_USAGE") == "true"
+	usageInterval = time.Duration(getEnvInt("PRIVATELINK_USAGE_POLL_MINUTES", 60)) * time.Minute
+	usagePricePerGB = 0.01
+	if value := os.Getenv("PRIVATELINK_PRICE_PER_GB"); value != "" {
+		price, err := strconv.ParseFloat(value, 64)
+		if err != nil || price < 0 {
+			log.Fatalf("Invalid PRIVATELINK_PRICE_PER_GB %q", value)
+		}
+		usagePricePerGB = price
+	}
+	if usageEnabled && len(awsAccounts) == 0 {
+		log.Fatal("PRIVATELINK_USAGE needs the VPC endpoints configured through AWS_ACCOUNTS")
+	}
+}
+
+// startUsagePoller sums each endpoint's BytesProcessed for the month from
+// CloudWatch every PRIVATELINK_USAGE_POLL_MINUTES. When a month ends, the
+// final figures are sent as a report.
+func startUsagePoller() {
+	if !usageEnabled {
+		return
+	}
+	go func() {
+		lastErr := ""
+		for {
+			if err := pollUsage(time.Now().UTC()); err != nil {
+				if err.Error() != lastErr {
+					log.Printf("Failed to fetch PrivateLink usage from CloudWatch: %v\n", err)
+				}
+				lastErr = err.Error()
+			} else {
+				lastErr = ""
+			}
+			time.Sleep(usageInterval)
+		}
+	}()
+}
+
+func pollUsage(now time.Time) error {
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	month := monthStart.Format("2006-01")
+
+	usageMu.Lock()
+	previousMonth := usageMonth
+	usageMu.Unlock()
+	if previousMonth != "" && previousMonth != month {
+		// Settle the month that just ended with its complete figures
+		last := monthStart.AddDate(0, -1, 0)
+		if usage, err := fetchUsage(last, monthStart); err != nil {
+			log.Printf("Failed to fetch PrivateLink usage for %s: %v\n", previousMonth, err)
+		} else {
+			sendAlert("[info] PrivateLink Data Processing Report",
+				tr("usage.report", "PrivateLink data processed in {month}:\n{usage}", "month", previousMonth, "usage", describeUsage(usage)))
+		}
+	}
+
+	usage, err := fetchUsage(monthStart, now)
+	if err != nil {
+		return err
+	}
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	usageMonth = month
+	clear(usageByID)
+	for _, u := range usage {
+		usageByID[u.Account+"/"+u.ID] = u
+	}
+	return nil
+}
+
+// fetchUsage sums the data processed by every known endpoint between start
+// and end. Endpoints not described yet are left out.
+func fetchUsage(start, end time.Time) ([]*endpointUsage, error) {
+	var usage []*endpointUsage
+	for _, e := range vpcEndpointSnapshot() {
+		if e.VPC == "" {
+			continue
+		}
+		account := findAWSAccount(e.Account)
+		if account == nil {
+			continue
+		}
+		bytes, err := endpointBytesProcessed(account, e, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.ID, err)
+		}
+		usage = append(usage, &endpointUsage{
+			Account:       e.Account,
+			ID:            e.ID,
+			Month:         start.Format("2006-01"),
+			Bytes:         bytes,
+			EstimatedCost: bytes / 1e9 * usagePricePerGB,
+			UpdatedAt:     end,
+		})
+	}
+	return usage, nil
+}
+
+// endpointBytesProcessed sums the endpoint's daily BytesProcessed. The
+// metric is only found under its full dimension set.
+func endpointBytesProcessed(account *awsAccount, e vpcEndpointStatus, start, end time.Time) (float64, error) {
+	creds, err := account.credentials()
+	if err != nil {
+		return 0, err
+	}
+	params := url.Values{
+		"Action":                    {"GetMetricStatistics"},
+		"Version":                   {"2010-08-01"},
+		"Namespace":                 {"AWS/PrivateLinkEndpoints"},
+		"MetricName":                {"BytesProcessed"},
+		"StartTime":                 {start.Format(time.RFC3339)},
+		"EndTime":                   {end.Format(time.RFC3339)},
+		"Period":                    {"86400"},
+		"Statistics.member.1":       {"Sum"},
+		"Dimensions.member.1.Name":  {"VPC Id"},
+		"Dimensions.member.1.Value": {e.VPC},
+		"Dimensions.member.2.Name":  {"VPC Endpoint Id"},
+		"Dimensions.member.2.Value": {e.ID},
+		"Dimensions.member.3.Name":  {"Endpoint Type"},
+		"Dimensions.member.3.Value": {"Interface"},
+		"Dimensions.member.4.Name":  {"Service Name"},
+		"Dimensions.member.4.Value": {e.ServiceName},
+	}
+	var out struct {
+		Sums []float64 `xml:"GetMetricStatisticsResult>Datapoints>member>Sum"`
+	}
+	host := "monitoring." + account.region + ".amazonaws.com"
+	if err := awsQueryRequest(creds, account.region, "monitoring", host, params, &out); err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, sum := range out.Sums {
+		total += sum
+	}
+	return total, nil
+}
+
+func describeUsage(usage []*endpointUsage) string {
+	var b strings.Builder
+	var bytes, cost float64
+	for _, u := range usage {
+		b.WriteString(tr("usage.endpoint", "  {id} ({account}): {gb:%.2f} GB, about ${cost:%.2f}\n", "id", u.ID, "account", u.Account, "gb", u.Bytes/1e9, "cost", u.EstimatedCost))
+		bytes += u.Bytes
+		cost += u.EstimatedCost
+	}
+	b.WriteString(tr("usage.total", "  Total: {gb:%.2f} GB, about ${cost:%.2f} at ${price:%g}/GB\n", "gb", bytes/1e9, "cost", cost, "price", usagePricePerGB))
+	return b.String()
+}
+
+// usageSnapshot returns the month-to-date usage ordered as configured.
+func usageSnapshot() []endpointUsage {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	var usage []endpointUsage
+	for _, account := range awsAccounts {
+		for _, id := range account.endpoints {
+			if u := usageByID[account.name+"/"+id]; u != nil {
+				usage = append(usage, *u)
+			}
+		}
+	}
+	return usage
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// variantResult is what one connection string variant of a cluster showed
+// in the last check.
+type variantResult struct {
+	Variant   string   `json:"variant"`
+	Reachable bool     `json:"reachable"`
+	LatencyMS float64  `json:"latency_ms"`
+	Error     string   `json:"error,omitempty"`
+	SetName   string   `json:"set_name,omitempty"`
+	Router    bool     `json:"router,omitempty"`
+	Hosts     []string `json:"hosts,omitempty"`
+	Primary   string   `json:"primary,omitempty"`
+}
+
+var (
+	variantMu      sync.Mutex
+	variantResults = map[string][]variantResult{}
+)
+
+// loadURIVariants reads the other connection strings of a cluster from
+// <prefix>URI_VARIANT_<NAME>, e.g. URI_VARIANT_STANDARD for the non-SRV
+// form or URI_VARIANT_ANALYTICS for the analytics nodes of the primary
+// cluster, and CLUSTER_ORDERS_URI_VARIANT_SHARD0 for another cluster.
+func loadURIVariants(prefix string) map[string]string {
+	variants := map[string]string{}
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		name, ok := strings.CutPrefix(key, prefix+"URI_VARIANT_")
+		if !ok || name == "" || value == "" {
+			continue
+		}
+		variants[strings.ToLower(name)] = value
+	}
+	return variants
+}
+
+// checkVariants connects through the cluster's URI and every variant in
+// parallel and alerts when they disagree about reachability or about the
+// replica set behind them, as happens when an endpoint change was only
+// partly applied.
+func (c *cluster) checkVariants() {
+	if len(c.variants) == 0 {
+		return
+	}
+	names := []string{"default"}
+	for name := range c.variants {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	results := make([]variantResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		uri := c.uri
+		if name != "default" {
+			uri = c.variants[name]
+		}
+		wg.Add(1)
+		go func(i int, name, uri string) {
+			defer wg.Done()
+			results[i] = probeVariant(name, uri, c.interval)
+		}(i, name, uri)
+	}
+	wg.Wait()
+
+	variantMu.Lock()
+	variantResults[c.name] = results
+	variantMu.Unlock()
+
+	problems := strings.Join(compareVariants(results), "\n")
+	if problems == c.variantProblems {
+		return
+	}
+	if problems != "" {
+		log.Printf("Connection string variants of %s disagree:\n%s\n", c.name, problems)
+		sendTargetAlert(c.name, "MongoDB Connection String Variants Disagree",
+			tr("variants.disagree", "The connection strings of {target} do not lead to the same deployment:\n{problems}", "target", c.name, "problems", problems))
+	} else {
+		sendTargetRecovery(c.name, "MongoDB Connection String Variants Agree Again",
+			tr("variants.agree", "Every connection string of {target} reaches the same deployment again.", "target", c.name))
+	}
+	c.variantProblems = problems
+}
+
+func probeVariant(name, uri string, timeout time.Duration) variantResult {
+	result := variantResult{Variant: name}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var hello bson.M
+	client, err := mongo.Connect(ctx, newClientOptions(uri, "variant"))
+	if err == nil {
+		defer closeClient(client, "variant")
+		if err = client.Ping(ctx, readpref.Nearest()); err == nil {
+			err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello)
+		}
+	}
+	result.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Reachable = true
+	result.SetName, _ = hello["setName"].(string)
+	result.Primary, _ = hello["primary"].(string)
+	result.Router = hello["msg"] == "isdbgrid"
+	if hosts, ok := hello["hosts"].(primitive.A); ok {
+		for _, host := range hosts {
+			result.Hosts = append(result.Hosts, fmt.Sprint(host))
+		}
+		sort.Strings(result.Hosts)
+	}
+	return result
+}
+
+// compareVariants lists the disagreements between variants: some reachable
+// while others are not, and variants reaching the same replica set but
+// seeing different members or primaries. Routers and different replica
+// sets (per-shard strings) are only compared for reachability.
+func compareVariants(results []variantResult) []string {
+	var problems, reachable []string
+	for _, r := range results {
+		if r.Reachable {
+			reachable = append(reachable, r.Variant)
+		}
+	}
+	if len(reachable) > 0 && len(reachable) < len(results) {
+		for _, r := range results {
+			if !r.Reachable {
+				problems = append(problems, tr("variants.unreachable", "{variant} is unreachable while {reachable} are reachable: {error}", "variant", r.Variant, "reachable", strings.Join(reachable, ", "), "error", r.Error))
+			}
+		}
+	}
+
+	first := map[string]variantResult{}
+	for _, r := range results {
+		if !r.Reachable || r.Router || r.SetName == "" {
+			continue
+		}
+		ref, seen := first[r.SetName]
+		if !seen {
+			first[r.SetName] = r
+			continue
+		}
+		if !slices.Equal(ref.Hosts, r.Hosts) {
+			problems = append(problems, tr("variants.members", "{first} and {second} see different members of {set}: {first_hosts} vs {second_hosts}",
+				"first", ref.Variant, "second", r.Variant, "set", r.SetName, "first_hosts", ref.Hosts, "second_hosts", r.Hosts))
+		}
+		if ref.Primary != r.Primary {
+			problems = append(problems, tr("variants.primary", "{first} and {second} disagree on the primary of {set}: {first_primary:%q} vs {second_primary:%q}",
+				"first", ref.Variant, "second", r.Variant, "set", r.SetName, "first_primary", ref.Primary, "second_primary", r.Primary))
+		}
+	}
+	return problems
+}
+
+func variantSnapshot(target string) []variantResult {
+	variantMu.Lock()
+	defer variantMu.Unlock()
+	return slices.Clone(variantResults[target])
+}
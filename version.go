@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// observedVersion is the server version last seen for a target.
+type observedVersion struct {
+	Version string    `json:"version"`
+	Since   time.Time `json:"since"`
+}
+
+var (
+	versionFile string
+	versionMu   sync.Mutex
+	versions    = map[string]observedVersion{}
+)
+
+// loadVersionState reads VERSION_STATE_FILE so a version change that
+// happened while the monitor was down is still reported.
+func loadVersionState() {
+	versionFile = os.Getenv("VERSION_STATE_FILE")
+	if versionFile == "" {
+		versionFile = "server_version.json"
+	}
+
+	data, err := os.ReadFile(versionFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read version state file: %v\n", err)
+		return
+	}
+	if err := json.Unmarshal(data, &versions); err != nil {
+		log.Printf("Failed to parse version state file: %v\n", err)
+	}
+}
+
+// trackServerVersion sends an informational notice when the target's
+// version differs from the last one seen. Atlas applies patch upgrades on
+// its own schedule, and a rolling upgrade looks a lot like a series of
+// connectivity blips. Only the monitor (run) records versions, so a
+// one-shot check against another deployment cannot move the baseline.
+func trackServerVersion(version string) {
+	if version == "" || !monitoring {
+		return
+	}
+
+	versionMu.Lock()
+	previous, seen := versions[targetName()]
+	if seen && previous.Version == version {
+		versionMu.Unlock()
+		return
+	}
+	versions[targetName()] = observedVersion{Version: version, Since: time.Now()}
+	saveVersionsLocked()
+	versionMu.Unlock()
+
+	if !seen {
+		log.Printf("Recorded server version %s\n", version)
+		return
+	}
+	log.Printf("Server version changed from %s to %s\n", previous.Version, version)
+	sendAlert("[info] MongoDB Server Version Changed",
+		tr("version.changed", "The server version changed from {previous} (seen since {since}) to {version}.\n"+
+			"This is informational; connectivity blips around this time are likely the rolling upgrade.",
+			"previous", previous.Version, "since", previous.Since.Format("2006-01-02 15:04:05"), "version", version))
+}
+
+func saveVersionsLocked() {
+	data, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode version state: %v\n", err)
+		return
+	}
+	if err := writeFileAtomic(versionFile, data); err != nil {
+		log.Printf("Failed to write version state file: %v\n", err)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vpcEndpointStatus is the last known state of one VPC endpoint, as
+// reported by EC2 in the account owning it.
+type vpcEndpointStatus struct {
+	Account     string    `json:"account"`
+	ID          string    `json:"id"`
+	VPC         string    `json:"vpc,omitempty"`
+	ServiceName string    `json:"service_name,omitempty"`
+	State       string    `json:"state,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+	Error       string    `json:"error,omitempty"`
+
+	// Zone health, checked while the endpoint is available
+	ExpectedZones []string       `json:"expected_zones,omitempty"`
+	Zones         []endpointZone `json:"zones,omitempty"`
+	RegionalDNS   string         `json:"regional_dns,omitempty"`
+	Problems      []string       `json:"problems,omitempty"`
+
+	// Security group rules the monitor's traffic needs but does not get
+	SecurityGroups []string `json:"security_groups,omitempty"`
+	RuleProblems   []string `json:"rule_problems,omitempty"`
+
+	enis     []string
+	dnsNames []string
+}
+
+// vpcEndpointRefreshInterval keeps a burst of failing clusters from
+// describing the endpoints once each.
+const vpcEndpointRefreshInterval = 30 * time.Second
+
+var (
+	vpcEndpointInterval       time.Duration
+	vpcEndpointCheckOnFailure bool
+
+	vpcEndpointMu     sync.Mutex
+	vpcEndpointStates = map[string]*vpcEndpointStatus{}
+
+	vpcEndpointRefreshMu sync.Mutex
+	vpcEndpointRefreshed time.Time
+)
+
+// loadVPCEndpointConfig reads AWS_VPC_ENDPOINT_CHECK_MINUTES and
+// AWS_VPC_ENDPOINT_CHECK_ON_FAILURE, which describes the endpoints again as
+// soon as a connection fails (see vpcEndpointFailureSummary).
+func loadVPCEndpointConfig() {
+	vpcEndpointInterval = time.Duration(getEnvInt("AWS_VPC_ENDPOINT_CHECK_MINUTES", 5)) * time.Minute
+	vpcEndpointCheckOnFailure = os.Getenv("AWS_VPC_ENDPOINT_CHECK_ON_FAILURE") == "true"
+	loadSecurityGroupConfig()
+}
+
+// startVPCEndpointCheck describes the endpoints of every configured AWS
+// account every AWS_VPC_ENDPOINT_CHECK_MINUTES.
+func startVPCEndpointCheck() {
+	if len(awsAccounts) == 0 {
+		return
+	}
+	go func() {
+		lastErr := map[string]string{}
+		for {
+			for _, account := range awsAccounts {
+				err := checkVPCEndpoints(account)
+				msg := ""
+				if err != nil {
+					msg = err.Error()
+				}
+				if msg != "" && msg != lastErr[account.name] {
+					log.Printf("Failed to describe VPC endpoints of AWS account %s: %v\n", account.name, err)
+				}
+				lastErr[account.name] = msg
+			}
+			time.Sleep(vpcEndpointInterval)
+		}
+	}()
+}
+
+func checkVPCEndpoints(account *awsAccount) error {
+	now := time.Now()
+	endpoints, err := describeVPCEndpoints(account, account.endpoints)
+	if err != nil {
+		vpcEndpointMu.Lock()
+		for _, id := range account.endpoints {
+			if status := vpcEndpointStates[account.name+"/"+id]; status != nil {
+				// Keep the last known state when the API is unreachable
+				status.Error = err.Error()
+			}
+		}
+		vpcEndpointMu.Unlock()
+		return err
+	}
+
+	for _, id := range account.endpoints {
+		status := &vpcEndpointStatus{Account: account.name, ID: id, State: "missing"}
+		for _, e := range endpoints {
+			if e.ID == id {
+				*status = e
+			}
+		}
+		status.CheckedAt = now
+
+		key := account.name + "/" + id
+		vpcEndpointMu.Lock()
+		previous := vpcEndpointStates[key]
+		vpcEndpointMu.Unlock()
+		if status.State == "available" {
+			if err := checkEndpointZones(account, status, previous); err != nil {
+				status.Error = err.Error()
+			} else if err := checkSecurityGroups(account, status); err != nil {
+				status.Error = err.Error()
+			}
+		}
+		vpcEndpointMu.Lock()
+		vpcEndpointStates[key] = status
+		vpcEndpointMu.Unlock()
+		alertEndpointZones(status, previous)
+		alertSecurityGroups(status, previous)
+
+		if previous == nil {
+			if status.State != "available" {
+				sendVPCEndpointAlert(status)
+			}
+		} else if previous.State != status.State {
+			if status.State == "available" {
+				sendRecovery("PrivateLink Endpoint Available Again",
+					tr("vpcendpoint.available", "VPC endpoint {id} in AWS account {account} is available again (was {previous}).", "id", id, "account", account.name, "previous", previous.State))
+			} else if previous.State == "available" {
+				sendVPCEndpointAlert(status)
+			}
+		}
+	}
+	return nil
+}
+
+func sendVPCEndpointAlert(status *vpcEndpointStatus) {
+	log.Printf("VPC endpoint %s in AWS account %s is %s\n", status.ID, status.Account, status.State)
+	sendAlert("PrivateLink Endpoint Unavailable",
+		tr("vpcendpoint.unavailable", "VPC endpoint {id} in AWS account {account} is {state}.", "id", status.ID, "account", status.Account, "state", status.State))
+}
+
+// refreshVPCEndpoints describes the endpoints of every account now, unless
+// that was done moments ago.
+func refreshVPCEndpoints() {
+	vpcEndpointRefreshMu.Lock()
+	defer vpcEndpointRefreshMu.Unlock()
+	if time.Since(vpcEndpointRefreshed) < vpcEndpointRefreshInterval {
+		return
+	}
+	for _, account := range awsAccounts {
+		if err := checkVPCEndpoints(account); err != nil {
+			log.Printf("Failed to describe VPC endpoints of AWS account %s after a connection failure: %v\n", account.name, err)
+		}
+	}
+	vpcEndpointRefreshed = time.Now()
+}
+
+// vpcEndpointFailureSummary is the endpoint section of connection failure
+// alerts. With AWS_VPC_ENDPOINT_CHECK_ON_FAILURE=true it describes the
+// endpoints right away and lists the state of each (available,
+// pendingAcceptance, rejected, deleted, ...), so that all of them being
+// available points the search downstream of the endpoint. Otherwise it
+// lists the problems the periodic check last found.
+func vpcEndpointFailureSummary() string {
+	if !vpcEndpointCheckOnFailure || len(awsAccounts) == 0 {
+		return vpcEndpointProblemSummary()
+	}
+	refreshVPCEndpoints()
+
+	var b strings.Builder
+	healthy := true
+	for _, e := range vpcEndpointSnapshot() {
+		if e.Error != "" {
+			b.WriteString(tr("vpcendpoint.describe_failed", "  {id} ({account}): {state} as of {checked}, describing it now failed: {error}\n",
+				"id", e.ID, "account", e.Account, "state", e.State, "checked", e.CheckedAt.Format("15:04:05"), "error", e.Error))
+			healthy = false
+			continue
+		}
+		fmt.Fprintf(&b, "  %s (%s): %s\n", e.ID, e.Account, e.State)
+		if e.State != "available" {
+			healthy = false
+		}
+		for _, problem := range append(append([]string{}, e.Problems...), e.RuleProblems...) {
+			fmt.Fprintf(&b, "    %s\n", problem)
+			healthy = false
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	if healthy {
+		b.WriteString(tr("vpcendpoint.all_available", "All endpoints are available; the failure is downstream of them.\n"))
+	}
+	return tr("vpcendpoint.state", "VPC endpoint state:\n") + b.String()
+}
+
+// describeVPCEndpoints returns the endpoints among ids that still exist in
+// the account. A filter is used instead of VpcEndpointId so that a deleted
+// endpoint is missing from the answer rather than failing the whole call.
+func describeVPCEndpoints(account *awsAccount, ids []string) ([]vpcEndpointStatus, error) {
+	creds, err := account.credentials()
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{
+		"Action":        {"DescribeVpcEndpoints"},
+		"Version":       {"2016-11-15"},
+		"Filter.1.Name": {"vpc-endpoint-id"},
+	}
+	for i, id := range ids {
+		params.Set("Filter.1.Value."+strconv.Itoa(i+1), id)
+	}
+
+	var endpoints []vpcEndpointStatus
+	for {
+		var out struct {
+			Endpoints []struct {
+				ID          string   `xml:"vpcEndpointId"`
+				VPC         string   `xml:"vpcId"`
+				ServiceName string   `xml:"serviceName"`
+				State       string   `xml:"state"`
+				ENIs        []string `xml:"networkInterfaceIdSet>item"`
+				DNSNames    []string `xml:"dnsEntrySet>item>dnsName"`
+				Groups      []string `xml:"groupSet>item>groupId"`
+			} `xml:"vpcEndpointSet>item"`
+			NextToken string `xml:"nextToken"`
+		}
+		host := "ec2." + account.region + ".amazonaws.com"
+		if err := awsQueryRequest(creds, account.region, "ec2", host, params, &out); err != nil {
+			return nil, err
+		}
+		for _, e := range out.Endpoints {
+			endpoints = append(endpoints, vpcEndpointStatus{
+				Account:        account.name,
+				ID:             e.ID,
+				VPC:            e.VPC,
+				ServiceName:    e.ServiceName,
+				State:          e.State,
+				SecurityGroups: e.Groups,
+				enis:           e.ENIs,
+				dnsNames:       e.DNSNames,
+			})
+		}
+		if out.NextToken == "" {
+			return endpoints, nil
+		}
+		params.Set("NextToken", out.NextToken)
+	}
+}
+
+// vpcEndpointSnapshot returns the endpoint states ordered as configured.
+func vpcEndpointSnapshot() []vpcEndpointStatus {
+	vpcEndpointMu.Lock()
+	defer vpcEndpointMu.Unlock()
+
+	var states []vpcEndpointStatus
+	for _, account := range awsAccounts {
+		for _, id := range account.endpoints {
+			if status := vpcEndpointStates[account.name+"/"+id]; status != nil {
+				states = append(states, *status)
+			}
+		}
+	}
+	return states
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// webhookNotifier posts a JSON description of every connection state
+// transition to WEBHOOK_URLS. Extra request headers come from
+// WEBHOOK_HEADER_<NAME>=value, with underscores in the name turned into
+// dashes (WEBHOOK_HEADER_X_API_KEY sets X-Api-Key). Failed posts are
+// retried with exponential backoff while the delivery timeout allows.
+type webhookNotifier struct {
+	urls    []string
+	headers http.Header
+	retries int
+	backoff time.Duration
+}
+
+type webhookPayload struct {
+	Status       string             `json:"status"`
+	Timestamp    time.Time          `json:"timestamp"`
+	ClusterIndex string             `json:"cluster_index"`
+	Incident     string             `json:"incident,omitempty"`
+	Subject      string             `json:"subject"`
+	Error        string             `json:"error,omitempty"`
+	Diagnostics  webhookDiagnostics `json:"diagnostics"`
+}
+
+type webhookDiagnostics struct {
+	Check   checkResult `json:"check"`
+	Details string      `json:"details"`
+}
+
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func init() {
+	registerNotifier("webhook", func() Notifier {
+		urls := splitList(os.Getenv("WEBHOOK_URLS"))
+		if len(urls) == 0 {
+			return nil
+		}
+		w := &webhookNotifier{
+			urls:    urls,
+			headers: webhookHeaders(),
+			retries: getEnvInt("WEBHOOK_RETRIES", 3),
+			backoff: time.Duration(getEnvInt("WEBHOOK_RETRY_BACKOFF_MS", 1000)) * time.Millisecond,
+		}
+		log.Printf("Webhook notifier posting to %d URL(s), %d retries\n", len(urls), w.retries)
+		return w
+	})
+}
+
+func webhookHeaders() http.Header {
+	headers := http.Header{}
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		name, ok := strings.CutPrefix(key, "WEBHOOK_HEADER_")
+		if !ok || name == "" {
+			continue
+		}
+		headers.Set(strings.ReplaceAll(name, "_", "-"), value)
+	}
+	return headers
+}
+
+func (w *webhookNotifier) Name() string { return "webhook" }
+
+func (w *webhookNotifier) Applies(alert Alert) bool { return alert.Result != nil }
+
+func (w *webhookNotifier) Send(ctx context.Context, alert Alert) error {
+	if !w.Applies(alert) {
+		return errNotApplicable
+	}
+
+	payload := webhookPayload{
+		Status:       "down",
+		Timestamp:    alert.Time.UTC(),
+		ClusterIndex: alert.Target,
+		Incident:     alert.Incident,
+		Subject:      alert.Subject,
+		Error:        alert.Result.Error,
+		Diagnostics:  webhookDiagnostics{Check: *alert.Result, Details: alert.Body},
+	}
+	if alert.Resolved {
+		payload.Status = "up"
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, url := range w.urls {
+		if err := w.post(ctx, url, data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// post delivers data to url, retrying network errors, 429 and 5xx replies.
+func (w *webhookNotifier) post(ctx context.Context, url string, data []byte) error {
+	delay := w.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.postOnce(ctx, url, data)
+		if err == nil || !retry || attempt >= w.retries {
+			return err
+		}
+		log.Printf("Webhook post to %s failed, retrying in %s: %v\n", url, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (w *webhookNotifier) postOnce(ctx context.Context, url string, data []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return false, nil
+}